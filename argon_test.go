@@ -0,0 +1,124 @@
+package boulder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const argonDir = "data/argon_coveragetool_av1_base_and_extended_profiles_v2.1"
+
+func skipWithoutArgon(t *testing.T) {
+	t.Helper()
+
+	if _, err := os.Stat(argonDir); err != nil {
+		t.Skipf("%s not available", argonDir)
+	}
+}
+
+// argonStreams returns the streams of every profile directory of the
+// Argon suite, skipping the test when the suite is not available.
+func argonStreams(t *testing.T) []string {
+	t.Helper()
+	skipWithoutArgon(t)
+
+	obuPaths, err := filepath.Glob(filepath.Join(argonDir, "*", "streams", "*.obu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(obuPaths)
+
+	return obuPaths
+}
+
+type argonResult int
+
+const (
+	argonPass argonResult = iota
+	argonFail
+	argonUnsupported
+)
+
+// decodeArgonStream decodes obuPath and checks its output against the
+// shipped MD5s. Streams that need a feature the decoder does not implement
+// yet count as unsupported; any other decoding error is a failure.
+func decodeArgonStream(obuPath string) (result argonResult, detail string) {
+	sink := NewMD5Sink()
+	// The shipped MD5s cover every shown frame, spatial layers included.
+	decoder := NewDecoder(Options{OutputAllLayers: true, OnFrame: sink.WriteFrame})
+	if _, err := decoder.Decode(obuPath); err != nil {
+		if errors.Is(err, ErrNotImplemented) {
+			return argonUnsupported, err.Error()
+		}
+		return argonFail, err.Error()
+	}
+
+	ok, err := md5Matches(obuPath, sink)
+	if err != nil {
+		return argonFail, err.Error()
+	}
+	if !ok {
+		return argonFail, fmt.Sprintf("md5 mismatch over %d frames", len(sink.Frames()))
+	}
+
+	return argonPass, ""
+}
+
+// TestArgon decodes every stream of every profile directory of the Argon
+// suite and reports a pass/fail/unsupported summary per profile. Streams
+// that hit an unimplemented feature are only logged; mismatching output and
+// any other decoding error fail the test.
+func TestArgon(t *testing.T) {
+	skipWithoutArgon(t)
+
+	profiles, err := filepath.Glob(filepath.Join(argonDir, "*", "streams"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(profiles)
+
+	for _, streams := range profiles {
+		profile := filepath.Base(filepath.Dir(streams))
+
+		t.Run(profile, func(t *testing.T) {
+			obuPaths, err := filepath.Glob(filepath.Join(streams, "*.obu"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(obuPaths)
+
+			var counts [3]int
+			for _, obuPath := range obuPaths {
+				name := filepath.Base(obuPath)
+				result, detail := decodeArgonStream(obuPath)
+				counts[result]++
+
+				switch result {
+				case argonFail:
+					t.Errorf("%s: FAIL: %s", name, detail)
+				case argonUnsupported:
+					t.Logf("%s: UNSUPPORTED: %s", name, detail)
+				}
+			}
+
+			t.Logf("%s: %d streams, %d pass, %d fail, %d unsupported",
+				profile, len(obuPaths), counts[argonPass], counts[argonFail], counts[argonUnsupported])
+		})
+	}
+}
+
+func TestDecodeArgonStreamFailsOnErrors(t *testing.T) {
+	// A temporal unit whose size runs past the end of the file.
+	obuPath := filepath.Join(t.TempDir(), "truncated.obu")
+	if err := os.WriteFile(obuPath, []byte{0x10, 0x0f}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, detail := decodeArgonStream(obuPath)
+	assert.Equal(t, argonFail, result, detail)
+}
@@ -0,0 +1,293 @@
+package boulder
+
+var (
+	CdefUvDir = [2][2][8]int{
+		{
+			{0, 1, 2, 3, 4, 5, 6, 7},
+			{1, 2, 2, 2, 3, 4, 6, 0},
+		},
+		{
+			{7, 0, 2, 4, 5, 6, 6, 6},
+			{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+	}
+
+	DivTable = [9]int{0, 840, 420, 280, 210, 168, 140, 120, 105}
+
+	CdefPriTaps = [2][2]int{{4, 2}, {3, 3}}
+	CdefSecTaps = [2][2]int{{2, 1}, {2, 1}}
+
+	CdefDirections = [8][2][2]int{
+		{{-1, 1}, {-2, 2}},
+		{{0, 1}, {-1, 2}},
+		{{0, 1}, {0, 2}},
+		{{0, 1}, {1, 2}},
+		{{1, 1}, {2, 2}},
+		{{1, 0}, {2, 1}},
+		{{1, 0}, {2, 0}},
+		{{1, 0}, {2, -1}},
+	}
+
+	CdefFrame *Frame
+)
+
+// readCdef reads the cdef_idx of the 64x64 block containing the current
+// block the first time a non-skipped block inside it is decoded.
+func readCdef(r *Reader) {
+	if Skip || CodedLossless || !sh.enableCdef || uh.allowIntrabc {
+		return
+	}
+
+	cdefSize4 := Num4x4BlocksWide[BLOCK_64X64]
+	cdefMask4 := ^(cdefSize4 - 1)
+	row := MiRow & cdefMask4
+	col := MiCol & cdefMask4
+
+	if cdefIdx[row][col] == -1 {
+		cdefIdx[row][col] = readLiteral(r, uh.cdefParams.cdefBits)
+
+		w4 := Num4x4BlocksWide[MiSize]
+		h4 := Num4x4BlocksHigh[MiSize]
+		for y := row; y < row+h4; y += cdefSize4 {
+			for x := col; x < col+w4; x += cdefSize4 {
+				cdefIdx[y][x] = cdefIdx[row][col]
+			}
+		}
+	}
+}
+
+// cdefProcess filters the deblocked CurrFrame into CdefFrame one 8x8 block
+// at a time, on up to threads goroutines. When CDEF is off for the frame
+// CdefFrame is CurrFrame itself.
+func cdefProcess(threads int) {
+	if CodedLossless || uh.allowIntrabc || !sh.enableCdef {
+		CdefFrame = CurrFrame
+		return
+	}
+
+	CdefFrame = framePool.Get(FrameWidth, FrameHeight, sh.colorConfig)
+	CdefFrame.CopyFrom(CurrFrame)
+
+	step4 := Num4x4BlocksWide[BLOCK_8X8]
+	cdefSize4 := Num4x4BlocksWide[BLOCK_64X64]
+	cdefMask4 := ^(cdefSize4 - 1)
+
+	// Blocks only write their own samples of CdefFrame, so rows of 64x64
+	// blocks are filtered in parallel.
+	parallelFor(threads, (MiRows+cdefSize4-1)/cdefSize4, func(i int) {
+		baseR := i * cdefSize4
+		for r := baseR; r < min(baseR+cdefSize4, MiRows); r += step4 {
+			for c := 0; c < MiCols; c += step4 {
+				baseC := c & cdefMask4
+				idx := cdefIdx[baseR][baseC]
+				cdefBlock(r, c, idx)
+			}
+		}
+	})
+}
+
+func cdefBlock(r int, c int, idx int) {
+	if idx == -1 {
+		return
+	}
+
+	coeffShift := BitDepth - 8
+	skip := Skips[r][c] && Skips[r+1][c] && Skips[r][c+1] && Skips[r+1][c+1]
+	if skip {
+		return
+	}
+
+	cp := uh.cdefParams
+
+	yDir, variance := cdefDirection(r, c)
+
+	priStr := cp.cdefYPriStrength[idx] << coeffShift
+	secStr := cp.cdefYSecStrength[idx] << coeffShift
+	dir := yDir
+	if priStr == 0 {
+		dir = 0
+	}
+
+	varStr := 0
+	if (variance >> 6) != 0 {
+		varStr = min(floorLog2(variance>>6), 12)
+	}
+	if variance != 0 {
+		priStr = (priStr*(4+varStr) + 8) >> 4
+	} else {
+		priStr = 0
+	}
+
+	damping := CdefDamping + coeffShift
+	cdefFilter(0, r, c, priStr, secStr, damping, dir)
+
+	if NumPlanes == 1 {
+		return
+	}
+
+	priStr = cp.cdefUvPriStrength[idx] << coeffShift
+	secStr = cp.cdefUvSecStrength[idx] << coeffShift
+	dir = CdefUvDir[sh.colorConfig.subsamplingX][sh.colorConfig.subsamplingY][yDir]
+	if priStr == 0 {
+		dir = 0
+	}
+
+	damping = CdefDamping + coeffShift - 1
+	cdefFilter(1, r, c, priStr, secStr, damping, dir)
+	cdefFilter(2, r, c, priStr, secStr, damping, dir)
+}
+
+// cdefDirection finds the dominant edge direction of the 8x8 luma block at
+// (r, c) and how strongly it dominates the orthogonal one.
+func cdefDirection(r int, c int) (yDir int, variance int) {
+	var cost [8]int
+	var partial [8][15]int
+
+	p := &CurrFrame.Planes[0]
+	x0 := c << MI_SIZE_LOG2
+	y0 := r << MI_SIZE_LOG2
+
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			x := (p.At(x0+j, y0+i) >> (BitDepth - 8)) - 128
+			partial[0][i+j] += x
+			partial[1][i+j/2] += x
+			partial[2][i] += x
+			partial[3][3+i-j/2] += x
+			partial[4][7+i-j] += x
+			partial[5][3-i/2+j] += x
+			partial[6][j] += x
+			partial[7][i/2+j] += x
+		}
+	}
+
+	for i := 0; i < 8; i++ {
+		cost[2] += partial[2][i] * partial[2][i]
+		cost[6] += partial[6][i] * partial[6][i]
+	}
+	cost[2] *= DivTable[8]
+	cost[6] *= DivTable[8]
+
+	for i := 0; i < 7; i++ {
+		cost[0] += (partial[0][i]*partial[0][i] + partial[0][14-i]*partial[0][14-i]) * DivTable[i+1]
+		cost[4] += (partial[4][i]*partial[4][i] + partial[4][14-i]*partial[4][14-i]) * DivTable[i+1]
+	}
+	cost[0] += partial[0][7] * partial[0][7] * DivTable[8]
+	cost[4] += partial[4][7] * partial[4][7] * DivTable[8]
+
+	for i := 1; i < 8; i += 2 {
+		for j := 0; j < 4+1; j++ {
+			cost[i] += partial[i][3+j] * partial[i][3+j]
+		}
+		cost[i] *= DivTable[8]
+		for j := 0; j < 4-1; j++ {
+			cost[i] += (partial[i][j]*partial[i][j] + partial[i][10-j]*partial[i][10-j]) * DivTable[2*j+2]
+		}
+	}
+
+	bestCost := 0
+	for i := 0; i < 8; i++ {
+		if cost[i] > bestCost {
+			bestCost = cost[i]
+			yDir = i
+		}
+	}
+
+	variance = (bestCost - cost[(yDir+4)&7]) >> 10
+
+	return yDir, variance
+}
+
+func constrain(diff int, threshold int, damping int) int {
+	if threshold == 0 {
+		return 0
+	}
+
+	dampingAdj := max(0, damping-floorLog2(threshold))
+	val := min(abs(diff), max(0, threshold-(abs(diff)>>dampingAdj)))
+	if diff < 0 {
+		return -val
+	}
+
+	return val
+}
+
+func cdefFilter(plane int, r int, c int, priStr int, secStr int, damping int, dir int) {
+	coeffShift := BitDepth - 8
+
+	subX, subY := 0, 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	x0 := (c * MI_SIZE) >> subX
+	y0 := (r * MI_SIZE) >> subY
+	w := 8 >> subX
+	h := 8 >> subY
+
+	src := &CurrFrame.Planes[plane]
+	dst := &CdefFrame.Planes[plane]
+
+	priTaps := CdefPriTaps[(priStr>>coeffShift)&1]
+	secTaps := CdefSecTaps[(priStr>>coeffShift)&1]
+
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			x := src.At(x0+j, y0+i)
+			sum := 0
+			maxV := x
+			minV := x
+
+			for k := 0; k < 2; k++ {
+				for sign := -1; sign <= 1; sign += 2 {
+					p, ok := cdefGetAt(plane, x0, y0, i+sign*CdefDirections[dir][k][0], j+sign*CdefDirections[dir][k][1], subX, subY)
+					if ok {
+						sum += priTaps[k] * constrain(p-x, priStr, damping)
+						maxV = max(p, maxV)
+						minV = min(p, minV)
+					}
+
+					for dirOff := -2; dirOff <= 2; dirOff += 4 {
+						s0 := (dir + dirOff) & 7
+						s, ok := cdefGetAt(plane, x0, y0, i+sign*CdefDirections[s0][k][0], j+sign*CdefDirections[s0][k][1], subX, subY)
+						if ok {
+							sum += secTaps[k] * constrain(s-x, secStr, damping)
+							maxV = max(s, maxV)
+							minV = min(s, minV)
+						}
+					}
+				}
+			}
+
+			neg := 0
+			if sum < 0 {
+				neg = 1
+			}
+			dst.Set(x0+j, y0+i, clip3(minV, maxV, x+((8+sum-neg)>>4)))
+		}
+	}
+}
+
+// cdefGetAt returns the unfiltered sample at offset (i, j) from (x0, y0)
+// and whether it lies inside the frame.
+func cdefGetAt(plane int, x0 int, y0 int, i int, j int, subX int, subY int) (int, bool) {
+	y := y0 + i
+	x := x0 + j
+
+	candidateR := (y << subY) >> MI_SIZE_LOG2
+	candidateC := (x << subX) >> MI_SIZE_LOG2
+
+	if !isInsideFilterRegion(candidateR, candidateC) {
+		return 0, false
+	}
+
+	return CurrFrame.Planes[plane].At(x, y), true
+}
+
+func isInsideFilterRegion(candidateR int, candidateC int) bool {
+	return candidateC >= 0 &&
+		candidateC < MiCols &&
+		candidateR >= 0 &&
+		candidateR < MiRows
+}
@@ -0,0 +1,93 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCdefTest(t *testing.T) {
+	setupLoopFilterTest(t, 8, 8)
+	saveGlobals(t, &CodedLossless, &CdefDamping, &CdefFrame)
+	sh.enableCdef = true
+	CodedLossless = false
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			CurrFrame.Planes[0].Set(x, y, 100)
+		}
+	}
+	for row := range cdefIdx {
+		for col := range cdefIdx[row] {
+			cdefIdx[row][col] = -1
+		}
+	}
+}
+
+func TestConstrain(t *testing.T) {
+	assert.Equal(t, 0, constrain(5, 0, 3))
+	assert.Equal(t, 3, constrain(3, 4, 3))
+	assert.Equal(t, -3, constrain(-3, 4, 3))
+	assert.Equal(t, 0, constrain(10, 4, 3))
+}
+
+func TestCdefDirectionVertical(t *testing.T) {
+	setupCdefTest(t)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x += 2 {
+			CurrFrame.Planes[0].Set(x, y, 192)
+			CurrFrame.Planes[0].Set(x+1, y, 64)
+		}
+	}
+
+	yDir, variance := cdefDirection(0, 0)
+	assert.Equal(t, 6, yDir)
+	assert.Greater(t, variance, 0)
+}
+
+func TestCdefProcess(t *testing.T) {
+	setupCdefTest(t)
+	CurrFrame.Planes[0].Set(3, 3, 120)
+	CdefDamping = 6
+	uh.cdefParams = CdefParams{
+		cdefYPriStrength: []int{0},
+		cdefYSecStrength: []int{4},
+	}
+
+	cdefProcess(0)
+	assert.Equal(t, 120, CdefFrame.Planes[0].At(3, 3))
+
+	cdefIdx[0][0] = 0
+	cdefProcess(0)
+	assert.Equal(t, 118, CdefFrame.Planes[0].At(3, 3))
+	assert.Equal(t, 100, CdefFrame.Planes[0].At(4, 3))
+	assert.Equal(t, 120, CurrFrame.Planes[0].At(3, 3))
+}
+
+func TestCdefProcessThreads(t *testing.T) {
+	setupLoopFilterTest(t, 64, 256)
+	saveGlobals(t, &CodedLossless, &CdefDamping, &CdefFrame)
+	sh.enableCdef = true
+	CodedLossless = false
+	CdefDamping = 6
+	uh.cdefParams = CdefParams{
+		cdefYPriStrength: []int{8},
+		cdefYSecStrength: []int{2},
+	}
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 64; x++ {
+			CurrFrame.Planes[0].Set(x, y, (x*7+y*13)%64+96)
+		}
+	}
+	for row := range cdefIdx {
+		for col := range cdefIdx[row] {
+			cdefIdx[row][col] = 0
+		}
+	}
+
+	cdefProcess(0)
+	serial := CdefFrame
+
+	cdefProcess(4)
+	assert.NotSame(t, serial, CdefFrame)
+	assert.Equal(t, serial.Planes[0].Pix8, CdefFrame.Planes[0].Pix8)
+}
@@ -0,0 +1,272 @@
+// Command boulder inspects AV1 streams in the Annex B format without
+// decoding them.
+//
+// Usage:
+//
+//	boulder info [--json] [--operating-point n] file.obu
+//	boulder obus [--json] [--operating-point n] file.obu
+//	boulder headers [--json] [--operating-point n] file.obu
+//
+// info summarises the sequence header, obus lists every OBU and headers
+// prints the frame header fields of every frame. OBUs outside of the
+// operating point, 0 by default, are not parsed.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/m4tthewde/boulder"
+)
+
+const usage = `usage: boulder <command> [--json] [--operating-point n] file.obu
+
+commands:
+  info     sequence header, operating points, color config and duration
+  obus     offset, type, size and layer of every OBU
+  headers  frame header fields of every frame
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "boulder: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	var printResult func(w io.Writer, result boulder.ProbeResult, asJSON bool) error
+	switch args[0] {
+	case "info":
+		printResult = printInfo
+	case "obus":
+		printResult = printObus
+	case "headers":
+		printResult = printHeaders
+	default:
+		return errUsage
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	asJSON := flags.Bool("json", false, "write JSON instead of text")
+	operatingPoint := flags.Int("operating-point", 0, "operating point to parse")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	d := boulder.NewDecoder(boulder.Options{OperatingPoint: *operatingPoint})
+	result, probeErr := d.Probe(flags.Arg(0))
+	if probeErr != nil && len(result.OBUs) == 0 {
+		return probeErr
+	}
+
+	// Whatever was parsed before an error is still printed, which is
+	// what is needed to find the broken part of a stream.
+	if err := printResult(stdout, result, *asJSON); err != nil {
+		return err
+	}
+
+	return probeErr
+}
+
+type info struct {
+	boulder.ProbeResult
+	ShownFrames     int      `json:"shown_frames"`
+	DurationSeconds *float64 `json:"duration_seconds,omitempty"`
+}
+
+func printInfo(w io.Writer, result boulder.ProbeResult, asJSON bool) error {
+	out := info{ProbeResult: result}
+	out.Frames = nil
+	out.OBUs = nil
+	for _, f := range result.Frames {
+		if f.ShowFrame {
+			out.ShownFrames++
+		}
+	}
+
+	if result.Timing != nil {
+		if num, den := result.Timing.FrameRate(); num != 0 {
+			duration := float64(out.ShownFrames*den) / float64(num)
+			out.DurationSeconds = &duration
+		}
+	}
+
+	if asJSON {
+		return writeJSON(w, out)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "profile\t%d\n", result.Profile)
+	fmt.Fprintf(tw, "still picture\t%s\n", yesNo(result.StillPicture))
+	fmt.Fprintf(tw, "max frame size\t%dx%d\n", result.MaxFrameWidth, result.MaxFrameHeight)
+	fmt.Fprintf(tw, "bit depth\t%d\n", result.BitDepth)
+	fmt.Fprintf(tw, "chroma\t%s\n", chromaFormat(result))
+	fmt.Fprintf(tw, "color\tprimaries %d, transfer %d, matrix %d, %s range\n",
+		result.ColorPrimaries, result.TransferCharacteristics, result.MatrixCoefficients,
+		map[bool]string{true: "full", false: "limited"}[result.FullRange])
+	fmt.Fprintf(tw, "film grain\t%s\n", yesNo(result.FilmGrainParamsPresent))
+
+	for i, op := range result.OperatingPoints {
+		tier := "main"
+		if op.Tier == 1 {
+			tier = "high"
+		}
+		fmt.Fprintf(tw, "operating point %d\tidc 0x%03x, level %s, %s tier\n", i, op.Idc, op.Level(), tier)
+	}
+
+	frameRate := "-"
+	if result.Timing != nil {
+		if num, den := result.Timing.FrameRate(); num != 0 {
+			frameRate = fmt.Sprintf("%d/%d", num, den)
+		}
+	}
+	fmt.Fprintf(tw, "frame rate\t%s\n", frameRate)
+	fmt.Fprintf(tw, "temporal units\t%d\n", result.TemporalUnits)
+	fmt.Fprintf(tw, "frames\t%d (%d shown)\n", len(result.Frames), out.ShownFrames)
+
+	duration := "-"
+	if out.DurationSeconds != nil {
+		duration = fmt.Sprintf("%.3fs", *out.DurationSeconds)
+	}
+	fmt.Fprintf(tw, "duration\t%s\n", duration)
+
+	return tw.Flush()
+}
+
+func printObus(w io.Writer, result boulder.ProbeResult, asJSON bool) error {
+	if asJSON {
+		return writeJSON(w, result.OBUs)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "tu\toffset\ttype\tsize\ttid\tsid\t")
+	for _, obu := range result.OBUs {
+		tid, sid := "-", "-"
+		if obu.HasExtension {
+			tid, sid = fmt.Sprint(obu.TemporalId), fmt.Sprint(obu.SpatialId)
+		}
+
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%s\t%s\t\n",
+			obu.TemporalUnit, obu.Offset, obuTypeName(obu.Type), obu.Size, tid, sid)
+	}
+
+	return tw.Flush()
+}
+
+func printHeaders(w io.Writer, result boulder.ProbeResult, asJSON bool) error {
+	if asJSON {
+		return writeJSON(w, result.Frames)
+	}
+
+	for i, f := range result.Frames {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "frame %d (%s)\n", i, frameTypeName(f.FrameType))
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		writeFields(tw, reflect.ValueOf(f))
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFields writes every field of the struct v as a line with its JSON
+// name, which is the syntax element name, and value. Nested structs are
+// flattened.
+func writeFields(w io.Writer, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name, opts, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+
+		if field.Kind() == reflect.Pointer {
+			if !field.IsNil() {
+				writeFields(w, field.Elem())
+			}
+			continue
+		}
+
+		if opts == "omitempty" && field.IsZero() {
+			continue
+		}
+
+		value := field.Interface()
+		if b, ok := value.(bool); ok {
+			// Flags are printed the way the spec writes them.
+			value = map[bool]int{true: 1, false: 0}[b]
+		}
+		fmt.Fprintf(w, "  %s\t%v\n", name, value)
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func chromaFormat(result boulder.ProbeResult) string {
+	switch {
+	case result.MonoChrome:
+		return "4:0:0"
+	case result.SubsamplingX == 1 && result.SubsamplingY == 1:
+		return "4:2:0"
+	case result.SubsamplingX == 1:
+		return "4:2:2"
+	default:
+		return "4:4:4"
+	}
+}
+
+func obuTypeName(typ int) string {
+	names := map[int]string{
+		1:  "OBU_SEQUENCE_HEADER",
+		2:  "OBU_TEMPORAL_DELIMITER",
+		3:  "OBU_FRAME_HEADER",
+		4:  "OBU_TILE_GROUP",
+		5:  "OBU_METADATA",
+		6:  "OBU_FRAME",
+		7:  "OBU_REDUNDANT_FRAME_HEADER",
+		8:  "OBU_TILE_LIST",
+		15: "OBU_PADDING",
+	}
+
+	if name, ok := names[typ]; ok {
+		return name
+	}
+	return fmt.Sprintf("reserved (%d)", typ)
+}
+
+func frameTypeName(typ int) string {
+	return [...]string{"KEY_FRAME", "INTER_FRAME", "INTRA_ONLY_FRAME", "SWITCH_FRAME"}[typ]
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"testing"
+
+	"github.com/m4tthewde/boulder"
+	"github.com/stretchr/testify/assert"
+)
+
+// testdata/probe.obu holds a shown key frame, a hidden inter frame whose
+// header is repeated, an OBU of a dropped temporal layer and a
+// show_existing_frame header showing the inter frame.
+const stream = "testdata/probe.obu"
+
+func TestInfo(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"info", stream}, &out))
+
+	assert.Contains(t, out.String(), "max frame size     64x64\n")
+	assert.Contains(t, out.String(), "operating point 0  idc 0x103, level 4.0, high tier\n")
+	assert.Contains(t, out.String(), "frames             3 (2 shown)\n")
+	assert.Contains(t, out.String(), "duration           0.067s\n")
+
+	out.Reset()
+	assert.NoError(t, run([]string{"info", "--operating-point", "1", stream}, &out))
+	assert.Contains(t, out.String(), "frames             3 (2 shown)\n")
+}
+
+func TestInfoJSON(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"info", "--json", stream}, &out))
+
+	var got map[string]any
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, 2.0, got["shown_frames"])
+	assert.InDelta(t, 2.0/30, got["duration_seconds"], 1e-9)
+	assert.Equal(t, 9.0, got["color_primaries"])
+	assert.NotContains(t, got, "frames")
+	assert.NotContains(t, got, "obus")
+}
+
+func TestObus(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"obus", stream}, &out))
+	assert.Contains(t, out.String(), "   0      31               OBU_FRAME    10    -    -\n")
+	assert.Contains(t, out.String(), "   2      84        OBU_FRAME_HEADER     3    2    0\n")
+
+	out.Reset()
+	assert.NoError(t, run([]string{"obus", "--json", stream}, &out))
+
+	var obus []boulder.ProbeObu
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &obus))
+	assert.Len(t, obus, 10)
+	assert.Equal(t, boulder.ProbeObu{TemporalUnit: 1, Offset: 74, Type: 4, Size: 5}, obus[6])
+}
+
+func TestHeaders(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, run([]string{"headers", stream}, &out))
+	assert.Contains(t, out.String(), "frame 1 (INTER_FRAME)\n")
+	assert.Contains(t, out.String(), "  refresh_frame_flags           64\n")
+	assert.Contains(t, out.String(), "  ref_frame_idx                 [0 0 0 0 0 0 0]\n")
+
+	out.Reset()
+	assert.NoError(t, run([]string{"headers", "--json", stream}, &out))
+
+	var frames []boulder.ProbeFrame
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &frames))
+	assert.Len(t, frames, 3)
+	assert.Equal(t, 100, frames[0].Header.BaseQIdx)
+	assert.True(t, frames[2].ShowExistingFrame)
+	assert.Nil(t, frames[2].Header)
+}
+
+func TestUsage(t *testing.T) {
+	var out bytes.Buffer
+	assert.ErrorIs(t, run(nil, &out), errUsage)
+	assert.ErrorIs(t, run([]string{"decode", stream}, &out), errUsage)
+	assert.ErrorIs(t, run([]string{"info"}, &out), errUsage)
+	assert.ErrorIs(t, run([]string{"info", "--yaml", stream}, &out), errUsage)
+	assert.ErrorIs(t, run([]string{"info", "--operating-point", "x", stream}, &out), errUsage)
+}
+
+func TestMissingFile(t *testing.T) {
+	var out bytes.Buffer
+	err := run([]string{"info", "testdata/missing.obu"}, &out)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Empty(t, out.String())
+}
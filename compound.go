@@ -0,0 +1,318 @@
+package boulder
+
+const COMPOUND_WEDGE = 0
+const COMPOUND_DIFFWTD = 1
+const COMPOUND_AVERAGE = 2
+const COMPOUND_INTRA = 3
+const COMPOUND_DISTANCE = 4
+
+const II_DC_PRED = 0
+const II_V_PRED = 1
+const II_H_PRED = 2
+const II_SMOOTH_PRED = 3
+
+const WEDGE_HORIZONTAL = 0
+const WEDGE_VERTICAL = 1
+const WEDGE_OBLIQUE27 = 2
+const WEDGE_OBLIQUE63 = 3
+const WEDGE_OBLIQUE117 = 4
+const WEDGE_OBLIQUE153 = 5
+
+const WEDGE_TYPES = 16
+const MASK_MASTER_SIZE = 64
+const MAX_SB_SIZE = 128
+const MAX_FRAME_DISTANCE = 31
+
+var (
+	CompoundType    = COMPOUND_AVERAGE
+	InterIntraMode  int
+	WedgeInterIntra bool
+	WedgeIndex      int
+	WedgeSign       int
+	MaskType        int
+	Mask            [][]int
+	FwdWeight       int
+	BckWeight       int
+	WedgeBits       = [BLOCK_SIZES]int{
+		0, 0, 0, 4, 4, 4, 4, 4, 4, 4, 0,
+		0, 0, 0, 0, 0, 0, 0, 4, 4, 0, 0,
+	}
+	WedgeCodebook = [3][WEDGE_TYPES][3]int{
+		{
+			{WEDGE_OBLIQUE27, 4, 4}, {WEDGE_OBLIQUE63, 4, 4},
+			{WEDGE_OBLIQUE117, 4, 4}, {WEDGE_OBLIQUE153, 4, 4},
+			{WEDGE_HORIZONTAL, 4, 2}, {WEDGE_HORIZONTAL, 4, 4},
+			{WEDGE_HORIZONTAL, 4, 6}, {WEDGE_VERTICAL, 4, 4},
+			{WEDGE_OBLIQUE27, 4, 2}, {WEDGE_OBLIQUE27, 4, 6},
+			{WEDGE_OBLIQUE153, 4, 2}, {WEDGE_OBLIQUE153, 4, 6},
+			{WEDGE_OBLIQUE63, 2, 4}, {WEDGE_OBLIQUE63, 6, 4},
+			{WEDGE_OBLIQUE117, 2, 4}, {WEDGE_OBLIQUE117, 6, 4},
+		},
+		{
+			{WEDGE_OBLIQUE27, 4, 4}, {WEDGE_OBLIQUE63, 4, 4},
+			{WEDGE_OBLIQUE117, 4, 4}, {WEDGE_OBLIQUE153, 4, 4},
+			{WEDGE_VERTICAL, 2, 4}, {WEDGE_VERTICAL, 4, 4},
+			{WEDGE_VERTICAL, 6, 4}, {WEDGE_HORIZONTAL, 4, 4},
+			{WEDGE_OBLIQUE27, 4, 2}, {WEDGE_OBLIQUE27, 4, 6},
+			{WEDGE_OBLIQUE153, 4, 2}, {WEDGE_OBLIQUE153, 4, 6},
+			{WEDGE_OBLIQUE63, 2, 4}, {WEDGE_OBLIQUE63, 6, 4},
+			{WEDGE_OBLIQUE117, 2, 4}, {WEDGE_OBLIQUE117, 6, 4},
+		},
+		{
+			{WEDGE_OBLIQUE27, 4, 4}, {WEDGE_OBLIQUE63, 4, 4},
+			{WEDGE_OBLIQUE117, 4, 4}, {WEDGE_OBLIQUE153, 4, 4},
+			{WEDGE_HORIZONTAL, 4, 2}, {WEDGE_HORIZONTAL, 4, 6},
+			{WEDGE_VERTICAL, 2, 4}, {WEDGE_VERTICAL, 6, 4},
+			{WEDGE_OBLIQUE27, 4, 2}, {WEDGE_OBLIQUE27, 4, 6},
+			{WEDGE_OBLIQUE153, 4, 2}, {WEDGE_OBLIQUE153, 4, 6},
+			{WEDGE_OBLIQUE63, 2, 4}, {WEDGE_OBLIQUE63, 6, 4},
+			{WEDGE_OBLIQUE117, 2, 4}, {WEDGE_OBLIQUE117, 6, 4},
+		},
+	}
+	WedgeMasterObliqueOdd = [MASK_MASTER_SIZE]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 6, 18, 37, 53, 60,
+		63, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64,
+		64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64,
+	}
+	WedgeMasterObliqueEven = [MASK_MASTER_SIZE]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 1, 4, 11, 27, 46, 58, 62, 63,
+		64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64,
+		64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64,
+	}
+	WedgeMasterVertical = [MASK_MASTER_SIZE]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 7, 21, 43, 57, 62,
+		64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64,
+		64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64,
+	}
+	IiWeights1d = [MAX_SB_SIZE]int{
+		60, 58, 56, 54, 52, 50, 48, 47, 45, 44, 42, 41, 39, 38, 37, 35, 34, 33, 32,
+		31, 30, 29, 28, 27, 26, 25, 24, 23, 22, 22, 21, 20, 19, 19, 18, 18, 17, 16,
+		16, 15, 15, 14, 14, 13, 13, 12, 12, 12, 11, 11, 10, 10, 10, 9, 9, 9, 8,
+		8, 8, 8, 7, 7, 7, 7, 6, 6, 6, 6, 6, 5, 5, 5, 5, 5, 4, 4,
+		4, 4, 4, 4, 4, 4, 3, 3, 3, 3, 3, 3, 3, 3, 3, 2, 2, 2, 2,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	}
+	QuantDistWeight = [4][2]int{{2, 3}, {2, 5}, {2, 7}, {1, MAX_FRAME_DISTANCE}}
+	QuantDistLookup = [4][2]int{{9, 7}, {11, 5}, {12, 4}, {13, 3}}
+	MasterMask      = initialiseMasterMask()
+	WedgeMasks      = initialiseWedgeMasks()
+)
+
+func initialiseMasterMask() [6][MASK_MASTER_SIZE][MASK_MASTER_SIZE]int {
+	var masterMask [6][MASK_MASTER_SIZE][MASK_MASTER_SIZE]int
+
+	w := MASK_MASTER_SIZE
+	h := MASK_MASTER_SIZE
+
+	for j := 0; j < w; j++ {
+		shift := MASK_MASTER_SIZE / 4
+		for i := 0; i < h; i += 2 {
+			masterMask[WEDGE_OBLIQUE63][i][j] = WedgeMasterObliqueEven[clip3(0, MASK_MASTER_SIZE-1, j-shift)]
+			shift--
+			masterMask[WEDGE_OBLIQUE63][i+1][j] = WedgeMasterObliqueOdd[clip3(0, MASK_MASTER_SIZE-1, j-shift)]
+			masterMask[WEDGE_VERTICAL][i][j] = WedgeMasterVertical[j]
+			masterMask[WEDGE_VERTICAL][i+1][j] = WedgeMasterVertical[j]
+		}
+	}
+
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			msk := masterMask[WEDGE_OBLIQUE63][i][j]
+			masterMask[WEDGE_OBLIQUE27][j][i] = msk
+			masterMask[WEDGE_OBLIQUE117][i][w-1-j] = 64 - msk
+			masterMask[WEDGE_OBLIQUE153][w-1-j][i] = 64 - msk
+			masterMask[WEDGE_HORIZONTAL][j][i] = masterMask[WEDGE_VERTICAL][i][j]
+		}
+	}
+
+	return masterMask
+}
+
+// initialiseWedgeMasks builds WedgeMasks[bsize][flipSign][wedge] for every
+// block size that allows wedge prediction.
+func initialiseWedgeMasks() [BLOCK_SIZES][2][WEDGE_TYPES][][]int {
+	var wedgeMasks [BLOCK_SIZES][2][WEDGE_TYPES][][]int
+
+	for bsize := 0; bsize < BLOCK_SIZES; bsize++ {
+		if WedgeBits[bsize] == 0 {
+			continue
+		}
+
+		w := BlockWidth[bsize]
+		h := BlockHeight[bsize]
+
+		for wedge := 0; wedge < WEDGE_TYPES; wedge++ {
+			codebook := WedgeCodebook[wedgeShape(bsize)][wedge]
+			dir := codebook[0]
+			xoff := MASK_MASTER_SIZE/2 - ((codebook[1] * w) >> 3)
+			yoff := MASK_MASTER_SIZE/2 - ((codebook[2] * h) >> 3)
+
+			sum := 0
+			for i := 0; i < w; i++ {
+				sum += MasterMask[dir][yoff][xoff+i]
+			}
+			for i := 1; i < h; i++ {
+				sum += MasterMask[dir][yoff+i][xoff]
+			}
+			avg := (sum + (w+h-1)/2) / (w + h - 1)
+			flipSign := boolToInt(avg < 32)
+
+			wedgeMasks[bsize][flipSign][wedge] = make([][]int, h)
+			wedgeMasks[bsize][1-flipSign][wedge] = make([][]int, h)
+			for i := 0; i < h; i++ {
+				wedgeMasks[bsize][flipSign][wedge][i] = make([]int, w)
+				wedgeMasks[bsize][1-flipSign][wedge][i] = make([]int, w)
+				for j := 0; j < w; j++ {
+					m := MasterMask[dir][yoff+i][xoff+j]
+					wedgeMasks[bsize][flipSign][wedge][i][j] = m
+					wedgeMasks[bsize][1-flipSign][wedge][i][j] = 64 - m
+				}
+			}
+		}
+	}
+
+	return wedgeMasks
+}
+
+func wedgeShape(bsize int) int {
+	w := BlockWidth[bsize]
+	h := BlockHeight[bsize]
+
+	if h > w {
+		return 0
+	} else if h < w {
+		return 1
+	}
+
+	return 2
+}
+
+func allocMask(w int, h int) {
+	Mask = make([][]int, h)
+	for i := range Mask {
+		Mask[i] = make([]int, w)
+	}
+}
+
+func wedgeMask(w int, h int) {
+	allocMask(w, h)
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			Mask[i][j] = WedgeMasks[MiSize][WedgeSign][WedgeIndex][i][j]
+		}
+	}
+}
+
+func intraModeVariantMask(w int, h int) {
+	allocMask(w, h)
+	sizeScale := MAX_SB_SIZE / max(h, w)
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			switch InterIntraMode {
+			case II_V_PRED:
+				Mask[i][j] = IiWeights1d[i*sizeScale]
+			case II_H_PRED:
+				Mask[i][j] = IiWeights1d[j*sizeScale]
+			case II_SMOOTH_PRED:
+				Mask[i][j] = IiWeights1d[min(i, j)*sizeScale]
+			default:
+				Mask[i][j] = 32
+			}
+		}
+	}
+}
+
+func differenceWeightMask(preds [2][][]int, w int, h int) {
+	allocMask(w, h)
+	diffShift := (BitDepth - 8) + InterPostRound
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			diff := abs(preds[0][i][j] - preds[1][i][j])
+			diff = round2(diff, diffShift)
+			m := clip3(0, 64, 38+diff/16)
+			if MaskType != 0 {
+				Mask[i][j] = 64 - m
+			} else {
+				Mask[i][j] = m
+			}
+		}
+	}
+}
+
+// distanceWeights derives FwdWeight and BckWeight from the distances in
+// display order between the current frame and both references.
+func distanceWeights(candRow int, candCol int) {
+	var dist [2]int
+	for refList := 0; refList < 2; refList++ {
+		h := OrderHints[RefFrames[candRow][candCol][refList]]
+		dist[refList] = clip3(0, MAX_FRAME_DISTANCE, abs(getRelativeDist(h, OrderHint)))
+	}
+
+	d0 := dist[1]
+	d1 := dist[0]
+	order := boolToInt(d0 <= d1)
+
+	if d0 == 0 || d1 == 0 {
+		FwdWeight = QuantDistLookup[3][order]
+		BckWeight = QuantDistLookup[3][1-order]
+		return
+	}
+
+	i := 0
+	for ; i < 3; i++ {
+		c0 := QuantDistWeight[i][order]
+		c1 := QuantDistWeight[i][1-order]
+		if order == 1 {
+			if d0*c0 > d1*c1 {
+				break
+			}
+		} else if d0*c0 < d1*c1 {
+			break
+		}
+	}
+
+	FwdWeight = QuantDistLookup[i][order]
+	BckWeight = QuantDistLookup[i][1-order]
+}
+
+// maskBlend combines the predictions using Mask, which is always stored
+// at luma resolution. For inter-intra the second prediction is the intra
+// prediction already written to CurrFrame.
+func maskBlend(preds [2][][]int, plane int, dstX int, dstY int, w int, h int) {
+	subX := 0
+	subY := 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	p := &CurrFrame.Planes[plane]
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var m int
+			if (subX == 0 && subY == 0) || (IsInterIntra && !WedgeInterIntra) {
+				m = Mask[y][x]
+			} else if subX == 1 && subY == 0 {
+				m = round2(Mask[y][2*x]+Mask[y][2*x+1], 1)
+			} else if subX == 0 && subY == 1 {
+				m = round2(Mask[2*y][x]+Mask[2*y+1][x], 1)
+			} else {
+				m = round2(Mask[2*y][2*x]+Mask[2*y][2*x+1]+Mask[2*y+1][2*x]+Mask[2*y+1][2*x+1], 2)
+			}
+
+			if IsInterIntra {
+				pred0 := clip1(round2(preds[0][y][x], InterPostRound))
+				pred1 := p.At(x+dstX, y+dstY)
+				setSample(p, x+dstX, y+dstY, round2(m*pred1+(64-m)*pred0, 6))
+			} else {
+				pred0 := preds[0][y][x]
+				pred1 := preds[1][y][x]
+				setSample(p, x+dstX, y+dstY, clip1(round2(m*pred0+(64-m)*pred1, 6+InterPostRound)))
+			}
+		}
+	}
+}
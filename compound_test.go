@@ -0,0 +1,177 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWedgeMasksAreComplementary(t *testing.T) {
+	for bsize := 0; bsize < BLOCK_SIZES; bsize++ {
+		if WedgeBits[bsize] == 0 {
+			assert.Nil(t, WedgeMasks[bsize][0][0])
+			continue
+		}
+
+		for wedge := 0; wedge < WEDGE_TYPES; wedge++ {
+			m0 := WedgeMasks[bsize][0][wedge]
+			m1 := WedgeMasks[bsize][1][wedge]
+			assert.Len(t, m0, BlockHeight[bsize])
+			assert.Len(t, m0[0], BlockWidth[bsize])
+
+			for i := range m0 {
+				for j := range m0[i] {
+					assert.Equal(t, 64, m0[i][j]+m1[i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestMasterMaskSymmetry(t *testing.T) {
+	for i := 0; i < MASK_MASTER_SIZE; i++ {
+		for j := 0; j < MASK_MASTER_SIZE; j++ {
+			assert.Equal(t, MasterMask[WEDGE_VERTICAL][i][j], MasterMask[WEDGE_HORIZONTAL][j][i])
+			assert.Equal(t, MasterMask[WEDGE_OBLIQUE63][i][j], MasterMask[WEDGE_OBLIQUE27][j][i])
+			assert.Equal(t, 64-MasterMask[WEDGE_OBLIQUE63][i][j], MasterMask[WEDGE_OBLIQUE117][i][MASK_MASTER_SIZE-1-j])
+		}
+	}
+}
+
+func TestDistanceWeights(t *testing.T) {
+	setupInterTest(t)
+	saveGlobals(t, &OrderHintBits, &OrderHint, &OrderHints)
+	sh.enableOrderHint = true
+	OrderHintBits = 7
+	OrderHint = 4
+	OrderHints[LAST_FRAME] = 3
+	OrderHints[ALTREF_FRAME] = 6
+	OrderHints[GOLDEN_FRAME] = 2
+
+	RefFrames[0][0] = [2]int{LAST_FRAME, ALTREF_FRAME}
+	distanceWeights(0, 0)
+	assert.Equal(t, 11, FwdWeight)
+	assert.Equal(t, 5, BckWeight)
+
+	RefFrames[0][0] = [2]int{GOLDEN_FRAME, ALTREF_FRAME}
+	distanceWeights(0, 0)
+	assert.Equal(t, 7, FwdWeight)
+	assert.Equal(t, 9, BckWeight)
+}
+
+func TestDifferenceWeightMask(t *testing.T) {
+	saveGlobals(t, &BitDepth, &InterPostRound, &MaskType, &Mask)
+	BitDepth = 8
+	InterPostRound = 4
+	preds := [2][][]int{
+		{{0, 16 * 160}},
+		{{0, 0}},
+	}
+
+	MaskType = 0
+	differenceWeightMask(preds, 2, 1)
+	assert.Equal(t, []int{38, 48}, Mask[0])
+
+	MaskType = 1
+	differenceWeightMask(preds, 2, 1)
+	assert.Equal(t, []int{26, 16}, Mask[0])
+}
+
+func TestIntraModeVariantMask(t *testing.T) {
+	saveGlobals(t, &InterIntraMode, &Mask)
+	InterIntraMode = II_V_PRED
+	intraModeVariantMask(8, 8)
+	assert.Equal(t, IiWeights1d[0], Mask[0][7])
+	assert.Equal(t, IiWeights1d[7*16], Mask[7][0])
+
+	InterIntraMode = II_DC_PRED
+	intraModeVariantMask(8, 8)
+	assert.Equal(t, 32, Mask[3][5])
+}
+
+func TestPredictInterCompoundDistance(t *testing.T) {
+	setupInterTest(t)
+	saveGlobals(t, &OrderHintBits, &OrderHint, &OrderHints)
+	sh.enableOrderHint = true
+	OrderHintBits = 7
+	OrderHint = 4
+	OrderHints[LAST_FRAME] = 3
+	OrderHints[ALTREF_FRAME] = 6
+	CompoundType = COMPOUND_DISTANCE
+
+	RefFrames[0][0] = [2]int{LAST_FRAME, ALTREF_FRAME}
+	Mvs[0][0][0] = [2]int{0, 0}
+	Mvs[0][0][1] = [2]int{0, 16 * 8}
+
+	predictInter(0, 0, 0, 4, 4, 0, 0)
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			v := x + 2*y
+			assert.Equal(t, (11*v+5*(v+16)+8)>>4, CurrFrame.Planes[0].At(x, y))
+		}
+	}
+}
+
+func TestPredictInterInterIntraBlend(t *testing.T) {
+	setupInterTest(t)
+	saveGlobals(t, &WedgeInterIntra, &InterIntraMode)
+	IsInterIntra = true
+	WedgeInterIntra = false
+	CompoundType = COMPOUND_INTRA
+	InterIntraMode = II_DC_PRED
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			CurrFrame.Planes[0].Set(x, y, 100)
+		}
+	}
+
+	RefFrames[0][0] = [2]int{LAST_FRAME, INTRA_FRAME}
+	Mvs[0][0][0] = [2]int{0, 0}
+
+	predictInter(0, 0, 0, 8, 8, 0, 0)
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			assert.Equal(t, round2(32*100+32*(x+2*y), 6), CurrFrame.Planes[0].At(x, y))
+		}
+	}
+}
+
+func TestComputeInterPredictionInterIntra(t *testing.T) {
+	setupInterTest(t)
+	saveGlobals(t, &NumPlanes, &HasChroma, &MiRowStart, &MiColStart, &MiRowEnd,
+		&MiColEnd, &BlockDecoded, &IsInter, &RefFrame, &WedgeInterIntra, &InterIntraMode)
+	NumPlanes = 3
+	HasChroma = false
+	MiRow, MiCol, MiSize = 2, 2, BLOCK_8X8
+	MiRowStart, MiColStart, MiRowEnd, MiColEnd = 0, 0, MiRows, MiCols
+	clearBlockDecodedFlags(0, 0, 16)
+
+	IsInter = true
+	RefFrame = [2]int{LAST_FRAME, INTRA_FRAME}
+	AvailU, AvailL = true, true
+	CompoundType = COMPOUND_INTRA
+	WedgeInterIntra = false
+	InterIntraMode = II_V_PRED
+	for row := 2; row < 4; row++ {
+		for col := 2; col < 4; col++ {
+			RefFrames[row][col] = [2]int{LAST_FRAME, INTRA_FRAME}
+		}
+	}
+
+	for x := 0; x < 32; x++ {
+		CurrFrame.Planes[0].Set(x, 7, 200)
+	}
+
+	computeInterPrediction()
+
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			m := IiWeights1d[i*16]
+			inter := (8 + j) + 2*(8+i)
+			assert.Equal(t, round2(m*200+(64-m)*inter, 6), CurrFrame.Planes[0].At(8+j, 8+i))
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package boulder
 
 import (
-	"log"
-	"math"
-	"os"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 )
 
 const MAX_SEGMENTS = 8
@@ -38,11 +39,12 @@ var (
 	MiRows               int
 	RenderWidth          int
 	RenderHeight         int
-	FeatureData          [SEG_LVL_MAX][MAX_SEGMENTS]int
-	FeatureEnabled       [SEG_LVL_MAX][MAX_SEGMENTS]bool
+	FeatureData          [MAX_SEGMENTS][SEG_LVL_MAX]int
+	FeatureEnabled       [MAX_SEGMENTS][SEG_LVL_MAX]bool
 	PrevSegmentIds       [][]int
 	GmType               = make([]int, ALTREF_FRAME+1)
 	PrevGmParams         [][]int
+	SavedGmParams        [NUM_REF_FRAMES][][]int
 	TileColsLog2         int
 	TileCols             int
 	TileRowsLog2         int
@@ -76,10 +78,10 @@ var (
 	SymbolMaxBits        int
 	AboveLevelContext    [][]int
 	AboveDcContext       [][]int
-	AboveSegPredContext  [][]int
+	AboveSegPredContext  []int
 	LeftLevelContext     [][]int
 	LeftDcContext        [][]int
-	LeftSegPredContext   [][]int
+	LeftSegPredContext   []int
 	DeltaLF              = make([]int, FRAME_LF_COUNT)
 	SgrprojXqdMid        = [2]int{-32, 31}
 	RefSgrXqd            [][]int
@@ -97,129 +99,143 @@ var (
 	cdefIdx             [][]int
 	BlockDecoded        [][][]int
 	LoopRestorationSize []int
+	RefFrameSignBias    = make([]bool, ALTREF_FRAME+1)
+	RefUpscaledWidth    = make([]int, NUM_REF_FRAMES)
+	RefFrameWidth       = make([]int, NUM_REF_FRAMES)
+	RefFrameHeight      = make([]int, NUM_REF_FRAMES)
+	RefRenderWidth      = make([]int, NUM_REF_FRAMES)
+	RefRenderHeight     = make([]int, NUM_REF_FRAMES)
+	RefMiCols           = make([]int, NUM_REF_FRAMES)
+	RefMiRows           = make([]int, NUM_REF_FRAMES)
+	RefFrameType        = make([]int, NUM_REF_FRAMES)
+	SavedOrderHints     = make([][]int, NUM_REF_FRAMES)
+	CurrFrame           *Frame
+	FrameStore          = make([]*Frame, NUM_REF_FRAMES)
+	RefFilmGrainParams  [NUM_REF_FRAMES]FilmGrainParams
+	framePool           = NewFramePool()
 )
 
-type Reader struct {
-	data     []byte
-	bitIndex int
-}
-
-func NewReader(filePath string) Reader {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		panic(err)
-	}
-
-	return Reader{
-		data:     data,
-		bitIndex: 0,
-	}
-
+type OpenBitstreamUnit struct {
+	header ObuHeader
 }
 
-func (r *Reader) discard(n int) {
-	r.bitIndex = r.bitIndex + n*8
+type FrameUnit struct {
+	obus []OpenBitstreamUnit
 }
 
-func (r *Reader) hasRemainingData() bool {
-	return r.bitIndex < len(r.data)*8
+type TemporalUnit struct {
+	frameUnits []FrameUnit
 }
 
-func (r *Reader) readBit() int {
-	bit := int((r.data[int(math.Floor(float64(r.bitIndex)/8))] >> (8 - r.bitIndex%8 - 1)) & 1)
-	r.bitIndex++
-	return bit
+type DecoderResult struct {
+	temporalUnits []TemporalUnit
 }
 
-func (r *Reader) f(n int) int {
-	x := 0
-	for i := 0; i < n; i++ {
-		x = 2*x + r.readBit()
-	}
+// Decoder decodes Annex B streams with the Options it was created with.
+//
+// The decoding state lives in package variables, so only one stream is
+// parsed at a time: Decode and Probe of all Decoders take turns, and each
+// starts from a fresh state.
+type Decoder struct {
+	options Options
 
-	return x
+	// logger is options.Logger, or a logger that discards everything.
+	logger *slog.Logger
 }
 
-func (r *Reader) leb128() int {
-	value := 0
-	Leb128Bytes = 0
-	for i := 0; i < 8; i++ {
-		lebt128_byte := r.f(8)
+// decoderMu is held by the Decode or Probe that owns the package state. It
+// is shared by all Decoders, so a process decodes one stream at a time.
+var decoderMu sync.Mutex
 
-		value = value | (lebt128_byte&0x7f)<<(i*7)
-		Leb128Bytes += 1
+// resetDecoderState forgets everything the previous stream left behind.
+func resetDecoderState() {
+	sh = SequenceHeader{}
+	uh = UncompressedHeader{}
+	OperatingPointIdc = 0
+	SeenFrameHeader = false
 
-		if (lebt128_byte & 0x80) == 0 {
-			break
-		}
-	}
-
-	if value > (1<<32)-1 {
-		panic("invalid leb128 value")
+	for i := 0; i < NUM_REF_FRAMES; i++ {
+		RefValid[i] = 0
+		FrameStore[i] = nil
 	}
+	CurrFrame = nil
+	heldFrame = nil
+	framePool = NewFramePool()
 
-	return value
+	headersOnly = false
+	frameHeaderSink = nil
+	obuSink = nil
+	frameBytes = 0
 }
 
-func (r *Reader) su(n int) int {
-	value := r.f(n)
-	signMask := 1 << (n - 1)
-	if (value & signMask) != 0 {
-		return value - 2*signMask
+func NewDecoder(opts Options) Decoder {
+	logger := opts.Logger
+	if logger == nil {
+		logger = discardLogger
 	}
 
-	return value
+	return Decoder{options: opts, logger: logger}
 }
 
-type OpenBitstreamUnit struct {
-	header ObuHeader
-}
-
-type FrameUnit struct {
-	obus []OpenBitstreamUnit
-}
+// ErrNotImplemented is wrapped by the errors Decode returns for streams
+// that use a part of the decoding process that is not implemented yet.
+var ErrNotImplemented = errors.New("not implemented")
 
-type TemporalUnit struct {
-	frameUnits []FrameUnit
-}
-
-type DecoderResult struct {
-	temporalUnits []TemporalUnit
+// notImplemented is the value decoding panics with when it reaches the part
+// of the decoding process named by what.
+func notImplemented(what string) error {
+	return fmt.Errorf("%w: %s", ErrNotImplemented, what)
 }
 
-type Decoder struct {
-}
+// Decode decodes the Annex B stream in filePath, handing every shown frame
+// to Options.OnFrame. A malformed stream, one that exceeds the limits of
+// Options or one that needs an unimplemented feature is reported as an
+// error, along with the temporal units decoded up to that point.
+func (d *Decoder) Decode(filePath string) (result DecoderResult, err error) {
+	decoderMu.Lock()
+	defer decoderMu.Unlock()
 
-func NewDecoder() Decoder {
-	return Decoder{}
-}
+	r, err := NewReader(filePath)
+	if err != nil {
+		return result, fmt.Errorf("decode: %w", err)
+	}
+	r.tracer = d.options.Tracer
+	r.options = d.options
 
-func (d *Decoder) Decode(filePath string) DecoderResult {
-	r := NewReader(filePath)
+	resetDecoderState()
 
+	tu := 0
 	temporalUnits := make([]TemporalUnit, 0)
 
-	for {
-		if !r.hasRemainingData() {
-			return DecoderResult{
-				temporalUnits: temporalUnits,
+	defer func() {
+		if v := recover(); v != nil {
+			if e, ok := v.(error); ok && errors.Is(e, ErrNotImplemented) {
+				err = fmt.Errorf("decode: temporal unit %d: %w", tu, e)
+			} else {
+				err = fmt.Errorf("decode: temporal unit %d: %v", tu, v)
 			}
 		}
+		result.temporalUnits = temporalUnits
+	}()
 
-		temporalUnitSize := r.leb128()
-
-		log.Printf("temporalUnitSize: %d", temporalUnitSize)
+	for ; r.hasRemainingData(); tu++ {
+		r.logger = d.logger.With("tu", tu)
+		temporalUnitSize := r.named("temporal_unit_size").leb128()
+		r.logger.Debug("temporal unit", "offset", r.position()/8-Leb128Bytes, "size", temporalUnitSize)
 
 		temporalUnit := temporalUnit(&r, temporalUnitSize)
 		temporalUnits = append(temporalUnits, temporalUnit)
+		flushHeldFrame(&r)
 	}
+
+	return result, nil
 }
 
 func temporalUnit(r *Reader, size int) TemporalUnit {
 	frameUnits := make([]FrameUnit, 0)
 
 	for size > 0 {
-		frameUnitSize := r.leb128()
+		frameUnitSize := r.named("frame_unit_size").leb128()
 
 		size = size - Leb128Bytes
 		frameUnit := frameUnit(r, frameUnitSize)
@@ -235,7 +251,7 @@ func frameUnit(r *Reader, size int) FrameUnit {
 	obus := make([]OpenBitstreamUnit, 0)
 
 	for size > 0 {
-		obuLength := r.leb128()
+		obuLength := r.named("obu_length").leb128()
 
 		size = size - Leb128Bytes
 		obu := openBitstreamUnit(r, obuLength)
@@ -247,32 +263,66 @@ func frameUnit(r *Reader, size int) FrameUnit {
 }
 
 func openBitstreamUnit(r *Reader, size int) OpenBitstreamUnit {
+	obuStart := r.position()
 	header := obuHeader(r)
 
 	var obuSize int
 	if header.hasSizeField {
-		obuSize = r.leb128()
+		obuSize = r.named("obu_size").leb128()
 	} else {
 		obuSize = size - 1 - header.extensionFlag
 	}
 
-	startPosition := r.bitIndex
+	tuLogger := r.logger
+	defer func() { r.logger = tuLogger }()
+	r.logger = r.log().With("obu_offset", obuStart/8)
+	r.logger.Debug("obu", "type", header.typ, "size", obuSize,
+		"temporal_id", header.temporalId, "spatial_id", header.spatialId)
+
+	if obuSink != nil {
+		obuSink(header, obuStart/8, (r.position()-obuStart)/8+obuSize)
+	}
+
+	prevEnd := r.limit(obuSize)
+	defer r.restoreLimit(prevEnd)
+
+	startPosition := r.position()
 
 	if header.typ != OBU_SEQUENCE_HEADER &&
 		header.typ != OBU_TEMPORAL_DELIMITER &&
 		OperatingPointIdc != 0 &&
 		header.extensionFlag == 1 {
-		panic("temporal/spatial layer")
+		inTemporalLayer := ((OperatingPointIdc >> temporalId) & 1) != 0
+		inSpatialLayer := ((OperatingPointIdc >> (spatialId + 8)) & 1) != 0
+		if !inTemporalLayer || !inSpatialLayer {
+			r.logger.Debug("dropping obu outside of the operating point")
+			// drop_obu
+			r.discard(obuSize)
+			return OpenBitstreamUnit{header: header}
+		}
+	}
+
+	if header.typ == OBU_FRAME_HEADER ||
+		header.typ == OBU_TILE_GROUP ||
+		header.typ == OBU_FRAME {
+		frameBytes += (r.position()-obuStart)/8 + obuSize
 	}
 
 	if header.typ == OBU_SEQUENCE_HEADER {
 		sh = sequenceHeader(r)
+		r.logger.Debug("sequence header", "seq_profile", sh.seqProfile, "bit_depth", BitDepth)
 	} else if header.typ == OBU_TEMPORAL_DELIMITER {
 		SeenFrameHeader = false
 		r.discard(obuSize)
 		return OpenBitstreamUnit{header: header}
+	} else if header.typ == OBU_FRAME_HEADER && SeenFrameHeader {
+		// frame_header_copy() repeats the frame header that is in use.
+		r.discard(obuSize)
+		return OpenBitstreamUnit{header: header}
 	} else if header.typ == OBU_FRAME_HEADER {
 		frameHeader(r)
+	} else if header.typ == OBU_FRAME {
+		frame(obuSize, r)
 	} else if header.typ == OBU_TILE_GROUP {
 		tileGroup(obuSize, r)
 	} else {
@@ -280,7 +330,7 @@ func openBitstreamUnit(r *Reader, size int) OpenBitstreamUnit {
 		return OpenBitstreamUnit{header: header}
 	}
 
-	currentPosition := r.bitIndex
+	currentPosition := r.position()
 	payloadBits := currentPosition - startPosition
 	if obuSize > 0 && header.typ != OBU_TILE_GROUP &&
 		header.typ != OBU_TILE_LIST &&
@@ -292,11 +342,11 @@ func openBitstreamUnit(r *Reader, size int) OpenBitstreamUnit {
 }
 
 func trailingBits(r *Reader, nbBits int) {
-	r.f(1)
+	r.named("trailing_one_bit").f(1)
 	nbBits--
 
 	for nbBits > 0 {
-		r.f(1)
+		r.named("trailing_zero_bit").f(1)
 		nbBits--
 	}
 }
@@ -314,30 +364,37 @@ type ObuHeader struct {
 	typ           int
 	hasSizeField  bool
 	extensionFlag int
+	temporalId    int
+	spatialId     int
 }
 
 func obuHeader(r *Reader) ObuHeader {
-	forbidden := r.f(1) != 0
+	forbidden := r.named("obu_forbidden_bit").f(1) != 0
 
 	if forbidden {
-		panic("forbidden bit must be 0")
+		conformanceError("forbidden bit must be 0", r)
 	}
 
-	typ := r.f(4)
-	extensionFlag := r.f(1)
-	hasSizeField := r.f(1) != 0
-
-	log.Printf("obu type: %d", typ)
+	typ := r.named("obu_type").f(4)
+	extensionFlag := r.named("obu_extension_flag").f(1)
+	hasSizeField := r.named("obu_has_size_field").f(1) != 0
 
 	// reserved
-	reserved := r.f(1) != 0
+	reserved := r.named("obu_reserved_1bit").f(1) != 0
 
 	if reserved {
-		panic("reserved bit must be 0")
+		conformanceError("reserved bit must be 0", r)
 	}
 
 	if extensionFlag != 0 {
-		panic("obu extension header")
+		temporalId = r.named("temporal_id").f(3)
+		spatialId = r.named("spatial_id").f(2)
+
+		// extension_header_reserved_3bits
+		r.named("extension_header_reserved_3bits").f(3)
+	} else {
+		temporalId = 0
+		spatialId = 0
 	}
 
 	return ObuHeader{
@@ -345,6 +402,8 @@ func obuHeader(r *Reader) ObuHeader {
 		typ:           typ,
 		hasSizeField:  hasSizeField,
 		extensionFlag: extensionFlag,
+		temporalId:    temporalId,
+		spatialId:     spatialId,
 	}
 }
 
@@ -352,6 +411,10 @@ const SELECT_SCREEN_CONTENT_TOOLS = 2
 const SELECT_INTEGER_MV = 2
 
 type SequenceHeader struct {
+	seqProfile                       int
+	seqLevelIdx                      []int
+	seqTier                          []int
+	timingInfoPresentFlag            bool
 	maxFrameWidthMinusOne            int
 	maxFrameHeightMinusOne           int
 	deltaFrameIdLengthMinusTwo       int
@@ -387,58 +450,64 @@ type SequenceHeader struct {
 }
 
 func sequenceHeader(r *Reader) SequenceHeader {
-	seqProfile := r.f(3)
-	log.Printf("seqProfile: %d", seqProfile)
+	seqProfile := r.named("seq_profile").f(3)
 
 	if seqProfile > 2 {
 		panic("invalid seqProfile")
 	}
 
-	stillPicture := r.f(1) != 0
-	reducedStillPictureHeader := r.f(1) != 0
+	stillPicture := r.named("still_picture").f(1) != 0
+	reducedStillPictureHeader := r.named("reduced_still_picture_header").f(1) != 0
 
 	var operatingPointIdc []int
+	var seqLevelIdx []int
+	var seqTier []int
+	var timingInfoPresentFlag bool
 	var decoderModelInfoPresentFlag bool
 	var timingInf TimingInfo
 	var decoderModelInf DecoderModelInfo
 	var operatingPointsCountMinusOne int
-	decoderModelInfoPresentForThisOp := make([]bool, operatingPointsCountMinusOne+1)
+	var decoderModelInfoPresentForThisOp []bool
 
 	if reducedStillPictureHeader {
-		panic("reducedStillPictureHeader")
+		operatingPointIdc = []int{0}
+		seqLevelIdx = []int{r.named("seq_level_idx").f(5)}
+		seqTier = []int{0}
+		decoderModelInfoPresentForThisOp = []bool{false}
 	} else {
-		timingInfoPresentFlag := r.f(1) != 0
+		timingInfoPresentFlag = r.named("timing_info_present_flag").f(1) != 0
 		if timingInfoPresentFlag {
 			timingInf = timingInfo(r)
-		}
 
-		decoderModelInfoPresentFlag = r.f(1) != 0
-		if decoderModelInfoPresentFlag {
-			decoderModelInf = decoderModelInfo(r)
+			decoderModelInfoPresentFlag = r.named("decoder_model_info_present_flag").f(1) != 0
+			if decoderModelInfoPresentFlag {
+				decoderModelInf = decoderModelInfo(r)
+			}
 		}
 
-		initialDisplayDelayPresentFlag := r.f(1) != 0
-		operatingPointsCountMinusOne = r.f(5)
+		initialDisplayDelayPresentFlag := r.named("initial_display_delay_present_flag").f(1) != 0
+		operatingPointsCountMinusOne = r.named("operating_points_cnt_minus_1").f(5)
 
 		operatingPointIdc = make([]int, operatingPointsCountMinusOne+1)
-		seqLevelIdx := make([]int, operatingPointsCountMinusOne+1)
-		seqTier := make([]int, operatingPointsCountMinusOne+1)
+		seqLevelIdx = make([]int, operatingPointsCountMinusOne+1)
+		seqTier = make([]int, operatingPointsCountMinusOne+1)
+		decoderModelInfoPresentForThisOp = make([]bool, operatingPointsCountMinusOne+1)
 		operatingParamters := make([]OperatingParametersInfo, operatingPointsCountMinusOne+1)
 		initialDisplayDelayPresentForThisOp := make([]bool, operatingPointsCountMinusOne+1)
 		initialDisplayDelayMinusOne := make([]int, operatingPointsCountMinusOne+1)
 
 		for i := 0; i <= operatingPointsCountMinusOne; i++ {
-			operatingPointIdc[i] = r.f(12)
-			seqLevelIdx[i] = r.f(5)
+			operatingPointIdc[i] = r.named("operating_point_idc").f(12)
+			seqLevelIdx[i] = r.named("seq_level_idx").f(5)
 
 			if seqLevelIdx[i] > 7 {
-				seqTier[i] = r.f(1)
+				seqTier[i] = r.named("seq_tier").f(1)
 			} else {
 				seqTier[i] = 0
 			}
 
 			if decoderModelInfoPresentFlag {
-				decoderModelInfoPresentForThisOp[i] = r.f(1) != 0
+				decoderModelInfoPresentForThisOp[i] = r.named("decoder_model_present_for_this_op").f(1) != 0
 				if decoderModelInfoPresentForThisOp[i] {
 					operatingParamters[i] = operatingParametersInfo(r, decoderModelInf.bufferDelayLengthMinusOne+1)
 				}
@@ -447,37 +516,37 @@ func sequenceHeader(r *Reader) SequenceHeader {
 			}
 
 			if initialDisplayDelayPresentFlag {
-				initialDisplayDelayPresentForThisOp[i] = r.f(1) != 0
+				initialDisplayDelayPresentForThisOp[i] = r.named("initial_display_delay_present_for_this_op").f(1) != 0
 				if initialDisplayDelayPresentForThisOp[i] {
-					initialDisplayDelayMinusOne[i] = r.f(4)
+					initialDisplayDelayMinusOne[i] = r.named("initial_display_delay_minus_1").f(4)
 				}
 			}
 		}
 	}
 
-	OperatingPointIdc = operatingPointIdc[chooseOperatingPoint()]
+	OperatingPointIdc = operatingPointIdc[chooseOperatingPoint(len(operatingPointIdc), r)]
 
-	frameWidthBitsMinusOne := r.f(4)
-	frameHeightBitsMinusOne := r.f(4)
+	frameWidthBitsMinusOne := r.named("frame_width_bits_minus_1").f(4)
+	frameHeightBitsMinusOne := r.named("frame_height_bits_minus_1").f(4)
 
-	maxFrameWidthMinusOne := r.f(frameWidthBitsMinusOne + 1)
-	maxFrameHeightMinusOne := r.f(frameHeightBitsMinusOne + 1)
+	maxFrameWidthMinusOne := r.named("max_frame_width_minus_1").f(frameWidthBitsMinusOne + 1)
+	maxFrameHeightMinusOne := r.named("max_frame_height_minus_1").f(frameHeightBitsMinusOne + 1)
 
 	frameIdNumbersPresentFlag := false
 	if !reducedStillPictureHeader {
-		frameIdNumbersPresentFlag = r.f(1) != 0
+		frameIdNumbersPresentFlag = r.named("frame_id_numbers_present_flag").f(1) != 0
 	}
 
 	var deltaFrameIdLengthMinusTwo int
 	var additionalFrameIdLengthMinusOne int
 	if frameIdNumbersPresentFlag {
-		deltaFrameIdLengthMinusTwo = r.f(4)
-		additionalFrameIdLengthMinusOne = r.f(3)
+		deltaFrameIdLengthMinusTwo = r.named("delta_frame_id_length_minus_2").f(4)
+		additionalFrameIdLengthMinusOne = r.named("additional_frame_id_length_minus_1").f(3)
 	}
 
-	use128x128Superblock := r.f(1) != 0
-	enableFilterIntra := r.f(1) != 0
-	enableIntraEdgeFilter := r.f(1) != 0
+	use128x128Superblock := r.named("use_128x128_superblock").f(1) != 0
+	enableFilterIntra := r.named("enable_filter_intra").f(1) != 0
+	enableIntraEdgeFilter := r.named("enable_intra_edge_filter").f(1) != 0
 
 	var enableInterIntraCompound bool
 	var enableMaskedCompound bool
@@ -490,48 +559,54 @@ func sequenceHeader(r *Reader) SequenceHeader {
 	var enableOrderHint bool
 
 	if reducedStillPictureHeader {
-		panic("reduced still picture header")
+		seqForceScreenContentTools = SELECT_SCREEN_CONTENT_TOOLS
+		seqForceIntegerMv = SELECT_INTEGER_MV
+		OrderHintBits = 0
 	} else {
-		enableInterIntraCompound = r.f(1) != 0
-		enableMaskedCompound = r.f(1) != 0
-		enableWarpedMotion = r.f(1) != 0
-		enableDualFilter = r.f(1) != 0
-		enableOrderHint = r.f(1) != 0
+		enableInterIntraCompound = r.named("enable_interintra_compound").f(1) != 0
+		enableMaskedCompound = r.named("enable_masked_compound").f(1) != 0
+		enableWarpedMotion = r.named("enable_warped_motion").f(1) != 0
+		enableDualFilter = r.named("enable_dual_filter").f(1) != 0
+		enableOrderHint = r.named("enable_order_hint").f(1) != 0
 
 		enableJntComp = false
 		enableRefFrameMvs = false
 
 		if enableOrderHint {
-			enableJntComp = r.f(1) != 0
-			enableRefFrameMvs = r.f(1) != 0
+			enableJntComp = r.named("enable_jnt_comp").f(1) != 0
+			enableRefFrameMvs = r.named("enable_ref_frame_mvs").f(1) != 0
 		}
 
 		seqForceScreenContentTools = SELECT_SCREEN_CONTENT_TOOLS
-		if r.f(1) == 0 {
-			seqForceScreenContentTools = r.f(1)
+		if r.named("seq_choose_screen_content_tools").f(1) == 0 {
+			seqForceScreenContentTools = r.named("seq_force_screen_content_tools").f(1)
 		}
 
 		seqForceIntegerMv = SELECT_INTEGER_MV
 		if seqForceScreenContentTools > 0 {
-			if r.f(1) == 0 {
-				seqForceIntegerMv = r.f(1)
+			if r.named("seq_choose_integer_mv").f(1) == 0 {
+				seqForceIntegerMv = r.named("seq_force_integer_mv").f(1)
 			}
 		}
 
 		if enableOrderHint {
-			OrderHintBits = r.f(3) + 1
+			OrderHintBits = r.named("order_hint_bits_minus_1").f(3) + 1
 		} else {
 			OrderHintBits = 0
 		}
 	}
 
-	enableSuperres := r.f(1) != 0
-	enableCdef := r.f(1) != 0
-	enableRestoration := r.f(1) != 0
+	enableSuperres := r.named("enable_superres").f(1) != 0
+	enableCdef := r.named("enable_cdef").f(1) != 0
+	enableRestoration := r.named("enable_restoration").f(1) != 0
 	colorConfig := colorConfig(r, seqProfile)
-	filmGrainParamsPresent := r.f(1) != 0
+	filmGrainParamsPresent := r.named("film_grain_params_present").f(1) != 0
 
 	return SequenceHeader{
+		seqProfile:                       seqProfile,
+		seqLevelIdx:                      seqLevelIdx,
+		seqTier:                          seqTier,
+		timingInfoPresentFlag:            timingInfoPresentFlag,
 		maxFrameWidthMinusOne:            maxFrameWidthMinusOne,
 		maxFrameHeightMinusOne:           maxFrameHeightMinusOne,
 		deltaFrameIdLengthMinusTwo:       deltaFrameIdLengthMinusTwo,
@@ -575,18 +650,19 @@ type TimingInfo struct {
 }
 
 func timingInfo(r *Reader) TimingInfo {
-	numUnitsInDisplayTick := r.f(32)
-	timeScale := r.f(32)
-	equalPictureInterval := r.f(1) != 0
+	numUnitsInDisplayTick := r.named("num_units_in_display_tick").f(32)
+	timeScale := r.named("time_scale").f(32)
+	equalPictureInterval := r.named("equal_picture_interval").f(1) != 0
+	numTicksPerPictureMinusOne := 0
 	if equalPictureInterval {
-		panic("equal picture interval")
+		numTicksPerPictureMinusOne = r.named("num_ticks_per_picture_minus_1").uvlc()
 	}
 
 	return TimingInfo{
 		numUnitsInDisplayTick:      numUnitsInDisplayTick,
 		timeScale:                  timeScale,
 		equalPictureInterval:       equalPictureInterval,
-		numTicksPerPictureMinusOne: 0,
+		numTicksPerPictureMinusOne: numTicksPerPictureMinusOne,
 	}
 }
 
@@ -599,10 +675,10 @@ type DecoderModelInfo struct {
 
 func decoderModelInfo(r *Reader) DecoderModelInfo {
 	return DecoderModelInfo{
-		bufferDelayLengthMinusOne:           r.f(5),
-		numUnitsInDecodingTick:              r.f(32),
-		bufferRemovalTimeLengthMinusOne:     r.f(5),
-		framePresentationTimeLengthMinusOne: r.f(5),
+		bufferDelayLengthMinusOne:           r.named("buffer_delay_length_minus_1").f(5),
+		numUnitsInDecodingTick:              r.named("num_units_in_decoding_tick").f(32),
+		bufferRemovalTimeLengthMinusOne:     r.named("buffer_removal_time_length_minus_1").f(5),
+		framePresentationTimeLengthMinusOne: r.named("frame_presentation_time_length_minus_1").f(5),
 	}
 }
 
@@ -614,27 +690,49 @@ type OperatingParametersInfo struct {
 
 func operatingParametersInfo(r *Reader, bufferDelayLength int) OperatingParametersInfo {
 	return OperatingParametersInfo{
-		decoderBufferDelay: r.f(bufferDelayLength),
-		encoderBufferDelay: r.f(bufferDelayLength),
-		lowDelayModeFlag:   r.f(1) != 0,
+		decoderBufferDelay: r.named("decoder_buffer_delay").f(bufferDelayLength),
+		encoderBufferDelay: r.named("encoder_buffer_delay").f(bufferDelayLength),
+		lowDelayModeFlag:   r.named("low_delay_mode_flag").f(1) != 0,
 	}
 }
 
-func chooseOperatingPoint() int {
-	return 0
+// chooseOperatingPoint returns the OperatingPoint of the Options of r if
+// the sequence header has that many operating points and 0 otherwise.
+func chooseOperatingPoint(count int, r *Reader) int {
+	op := r.options.OperatingPoint
+	if op < 0 || op >= count {
+		r.log().Warn("operating point not in the sequence header, using 0", "operating_point", op, "count", count)
+		return 0
+	}
+
+	return op
 }
 
 const CP_BT_709 = 1
 const CP_UNSPECIFIED = 2
+const CP_BT_2020 = 9
 
 const TC_UNSPECIFIED = 2
 const TC_SRGB = 13
+const TC_SMPTE_2084 = 16
+const TC_HLG = 18
 
 const MC_IDENTITY = 0
+const MC_BT_709 = 1
 const MC_UNSPECIFIED = 2
+const MC_FCC = 4
+const MC_BT_470_B_G = 5
+const MC_BT_601 = 6
+const MC_SMPTE_240 = 7
+const MC_BT_2020_NCL = 9
+
 const CSP_UNKNOWN = 0
+const CSP_VERTICAL = 1
+const CSP_COLOCATED = 2
 
 type ColorConfig struct {
+	bitDepth                int
+	monoChrome              bool
 	colorPrimaries          int
 	transferCharacteristics int
 	matrixCoefficients      int
@@ -646,27 +744,25 @@ type ColorConfig struct {
 }
 
 func colorConfig(r *Reader, seqProfile int) ColorConfig {
-	highBitdepth := r.f(1) != 0
+	highBitdepth := r.named("high_bitdepth").f(1) != 0
 
 	if seqProfile == 2 && highBitdepth {
-		if r.f(1) != 0 {
+		if r.named("twelve_bit").f(1) != 0 {
 			BitDepth = 12
 		} else {
 			BitDepth = 10
 		}
 	} else if seqProfile <= 2 {
-		if r.f(1) != 0 {
+		if highBitdepth {
 			BitDepth = 10
 		} else {
 			BitDepth = 8
 		}
 	}
 
-	log.Printf("BitDepth: %d", BitDepth)
-
 	monoChrome := false
 	if seqProfile != 1 {
-		monoChrome = r.f(1) != 0
+		monoChrome = r.named("mono_chrome").f(1) != 0
 	}
 
 	if monoChrome {
@@ -679,10 +775,11 @@ func colorConfig(r *Reader, seqProfile int) ColorConfig {
 	transferCharacteristics := TC_UNSPECIFIED
 	matrixCoefficients := MC_UNSPECIFIED
 
-	if r.f(1) == 0 {
-		colorPrimaries = r.f(8)
-		transferCharacteristics = r.f(8)
-		matrixCoefficients = r.f(8)
+	colorDescriptionPresentFlag := r.named("color_description_present_flag").f(1) != 0
+	if colorDescriptionPresentFlag {
+		colorPrimaries = r.named("color_primaries").f(8)
+		transferCharacteristics = r.named("transfer_characteristics").f(8)
+		matrixCoefficients = r.named("matrix_coefficients").f(8)
 	}
 
 	var colorRange int
@@ -691,8 +788,10 @@ func colorConfig(r *Reader, seqProfile int) ColorConfig {
 	var chromeSamplePosition int
 
 	if monoChrome {
-		colorRange := r.f(1)
+		colorRange := r.named("color_range").f(1)
 		return ColorConfig{
+			bitDepth:                BitDepth,
+			monoChrome:              true,
 			colorPrimaries:          colorPrimaries,
 			transferCharacteristics: transferCharacteristics,
 			matrixCoefficients:      matrixCoefficients,
@@ -705,11 +804,11 @@ func colorConfig(r *Reader, seqProfile int) ColorConfig {
 	} else if colorPrimaries == CP_BT_709 &&
 		transferCharacteristics == TC_SRGB &&
 		matrixCoefficients == MC_IDENTITY {
-		colorRange = 0
+		colorRange = 1
 		subsamplingX = 0
 		subsamplingY = 0
 	} else {
-		colorRange = r.f(1)
+		colorRange = r.named("color_range").f(1)
 		if seqProfile == 0 {
 			subsamplingX = 1
 			subsamplingY = 1
@@ -718,11 +817,11 @@ func colorConfig(r *Reader, seqProfile int) ColorConfig {
 			subsamplingY = 0
 		} else {
 			if BitDepth == 12 {
-				subsamplingX = r.f(1)
+				subsamplingX = r.named("subsampling_x").f(1)
 				subsamplingY = 0
 
 				if subsamplingX != 0 {
-					subsamplingY = r.f(1)
+					subsamplingY = r.named("subsampling_y").f(1)
 				}
 			} else {
 				subsamplingX = 1
@@ -731,11 +830,12 @@ func colorConfig(r *Reader, seqProfile int) ColorConfig {
 		}
 
 		if subsamplingX != 0 && subsamplingY != 0 {
-			chromeSamplePosition = r.f(2)
+			chromeSamplePosition = r.named("chroma_sample_position").f(2)
 		}
 	}
 
 	return ColorConfig{
+		bitDepth:                BitDepth,
 		colorPrimaries:          colorPrimaries,
 		transferCharacteristics: transferCharacteristics,
 		matrixCoefficients:      matrixCoefficients,
@@ -743,33 +843,160 @@ func colorConfig(r *Reader, seqProfile int) ColorConfig {
 		subsamplingX:            subsamplingX,
 		subsamplingY:            subsamplingY,
 		chromaSamplePosition:    chromeSamplePosition,
-		separateUvDeltaQ:        r.f(1) != 0,
+		separateUvDeltaQ:        r.named("separate_uv_delta_q").f(1) != 0,
 	}
 }
 
 func frameHeader(r *Reader) {
-	if SeenFrameHeader {
-		panic("frame header copy")
+	SeenFrameHeader = true
+	uh = uncompressedHeader(r)
+
+	if uh.showExistingFrame {
+		showExistingFrameWrapup(r)
+		SeenFrameHeader = false
 	} else {
+		TileNum = 0
 		SeenFrameHeader = true
-		uh = uncompressedHeader(r)
+		if !headersOnly {
+			allocCurrFrame()
+			allocModeInfo()
+		}
+	}
+}
 
-		if uh.showExistingFrame {
-			panic("showExistingFrame")
-		} else {
-			TileNum = 0
-			SeenFrameHeader = true
+// frame parses an OBU_FRAME, a frame header directly followed by the first
+// tile group of the frame.
+func frame(sz int, r *Reader) {
+	startBitPos := r.position()
+	frameHeader(r)
+	byteAlignment(r)
+	endBitPos := r.position()
+
+	headerBytes := (endBitPos - startBitPos) / 8
+	tileGroup(sz-headerBytes, r)
+}
+
+// showExistingFrameWrapup is decode_frame_wrapup for a frame header with
+// show_existing_frame set: the frame in slot frame_to_show_map_idx is
+// output again and, if it is a key frame, becomes the current frame and
+// refreshes every reference slot.
+func showExistingFrameWrapup(r *Reader) {
+	idx := uh.frameToShowMapIdx
+
+	prev := CurrFrame
+	CurrFrame = FrameStore[idx]
+	releaseFrame(prev)
+
+	if uh.frameType == KEY_FRAME {
+		loadReferenceFrame(idx)
+		referenceFrameUpdate()
+	} else {
+		UpscaledWidth = RefUpscaledWidth[idx]
+		FrameWidth = RefFrameWidth[idx]
+		FrameHeight = RefFrameHeight[idx]
+		RenderWidth = RefRenderWidth[idx]
+		RenderHeight = RefRenderHeight[idx]
+	}
+
+	if frameHeaderSink != nil {
+		frameHeaderSink()
+	}
+
+	outputProcess(r)
+}
+
+// loadReferenceFrame is the reference frame loading process: it restores
+// the state saved for slot idx by referenceFrameUpdate.
+func loadReferenceFrame(idx int) {
+	currentFrameId = RefFrameId[idx]
+	UpscaledWidth = RefUpscaledWidth[idx]
+	FrameWidth = RefFrameWidth[idx]
+	FrameHeight = RefFrameHeight[idx]
+	RenderWidth = RefRenderWidth[idx]
+	RenderHeight = RefRenderHeight[idx]
+	MiCols = RefMiCols[idx]
+	MiRows = RefMiRows[idx]
+	OrderHint = RefOrderHint[idx]
+	copy(OrderHints, SavedOrderHints[idx])
+
+	MfRefFrames = SavedRefFrames[idx]
+	MfMvs = SavedMvs[idx]
+	uh.loopFilterParams.loopFilterRefDeltas = SavedLoopFilterRefDeltas[idx]
+	uh.loopFilterParams.loopFilterModeDeltas = SavedLoopFilterModeDeltas[idx]
+	FeatureEnabled = SavedFeatureEnabled[idx]
+	FeatureData = SavedFeatureData[idx]
+	SegmentIds = SavedSegmentIds[idx]
+	uh.globalMotionParams.gmParams = SavedGmParams[idx]
+	loadCdfs(idx)
+}
+
+func allocCurrFrame() {
+	prev := CurrFrame
+	CurrFrame = framePool.Get(FrameWidth, FrameHeight, sh.colorConfig)
+	releaseFrame(prev)
+}
+
+// replaceMissingRef stands in a mid grey frame of the maximum frame size for
+// a reference slot whose order hint does not match the one signalled by an
+// error resilient frame, as libaom does for lost references.
+func replaceMissingRef(i int, refOrderHint int) {
+	displaced := FrameStore[i]
+
+	RefValid[i] = 0
+	RefOrderHint[i] = refOrderHint
+	RefFrameWidth[i] = sh.maxFrameWidthMinusOne + 1
+	RefFrameHeight[i] = sh.maxFrameHeightMinusOne + 1
+	RefUpscaledWidth[i] = RefFrameWidth[i]
+	RefRenderWidth[i] = RefFrameWidth[i]
+	RefRenderHeight[i] = RefFrameHeight[i]
+	RefMiCols[i] = 2 * ((RefFrameWidth[i] + 7) >> 3)
+	RefMiRows[i] = 2 * ((RefFrameHeight[i] + 7) >> 3)
+
+	if headersOnly {
+		FrameStore[i] = nil
+		releaseFrame(displaced)
+		return
+	}
+
+	grey := framePool.Get(RefFrameWidth[i], RefFrameHeight[i], sh.colorConfig)
+	for plane := 0; plane < grey.NumPlanes; plane++ {
+		p := &grey.Planes[plane]
+		for y := 0; y < p.Height; y++ {
+			for x := 0; x < p.Width; x++ {
+				p.Set(x, y, 1<<(sh.colorConfig.bitDepth-1))
+			}
+		}
+	}
+	FrameStore[i] = grey
+
+	releaseFrame(displaced)
+}
+
+// releaseFrame hands f back to the frame pool unless it is being decoded or
+// a reference slot still holds on to it.
+func releaseFrame(f *Frame) {
+	if f == nil || f == CurrFrame {
+		return
+	}
+
+	for _, ref := range FrameStore {
+		if ref == f {
+			return
 		}
 	}
+
+	framePool.Put(f)
 }
 
 const NUM_REF_FRAMES = 8
 const KEY_FRAME = 0
+const INTER_FRAME = 1
 const INTRA_ONLY_FRAME = 2
 const SWITCH_FRAME = 3
 
 const REFS_PER_FRAME = 7
 
+const NONE = -1
 const INTRA_FRAME = 0
 const LAST_FRAME = 1
 const LAST2_FRAME = 2
@@ -782,26 +1009,44 @@ const ALTREF_FRAME = 7
 const PRIMARY_REF_NONE = 7
 
 type UncompressedHeader struct {
-	framePresentationTime    int
-	forceIntegerMv           bool
-	disableFrameEndUpdateCdf bool
-	loopFilterDeltaEnabled   bool
-	contextUpdateTileId      int
-	deltaQRes                int
-	deltaLfPresent           bool
-	deltaLfRes               int
-	deltaLfMulti             bool
-	loopFilterParams         LoopFilterParams
-	cdefParams               CdefParams
-	skipmodeParams           SkipModeParams
-	allowWarpedMotion        bool
-	reducedTxSet             bool
-	globalMotionParams       GlobalMotionParams
-	showExistingFrame        bool
-	quantizationParams       QuantizationParams
-	deltaQPresent            bool
-	allowIntrabc             bool
-	useSuperres              bool
+	frameType                  int
+	showFrame                  bool
+	showableFrame              bool
+	errorResilientMode         bool
+	disableCdfUpdate           bool
+	primaryRefFrame            int
+	refreshFrameFlags          int
+	refFrameIdx                []int
+	allowHighPrecisionMv       bool
+	interpolationFilter        int
+	isMotionModeSwitchable     bool
+	useRefFrameMvs             bool
+	framePresentationTime      int
+	forceIntegerMv             bool
+	disableFrameEndUpdateCdf   bool
+	loopFilterDeltaEnabled     bool
+	contextUpdateTileId        int
+	deltaQRes                  int
+	deltaLfPresent             bool
+	deltaLfRes                 int
+	deltaLfMulti               bool
+	loopFilterParams           LoopFilterParams
+	cdefParams                 CdefParams
+	referenceSelect            bool
+	skipmodeParams             SkipModeParams
+	allowWarpedMotion          bool
+	reducedTxSet               bool
+	globalMotionParams         GlobalMotionParams
+	showExistingFrame          bool
+	frameToShowMapIdx          int
+	quantizationParams         QuantizationParams
+	deltaQPresent              bool
+	allowIntrabc               bool
+	useSuperres                bool
+	segmentationEnabled        bool
+	segmentationUpdateMap      bool
+	segmentationTemporalUpdate bool
+	filmGrainParams            FilmGrainParams
 }
 
 func uncompressedHeader(r *Reader) UncompressedHeader {
@@ -823,28 +1068,57 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 	allFrames := (1 << NUM_REF_FRAMES) - 1
 
 	if !sh.reducedStillPictureHeader {
-		showExistingFrame = r.f(1) != 0
+		showExistingFrame = r.named("show_existing_frame").f(1) != 0
 		if showExistingFrame {
-			panic("show existing frame")
+			frameToShowMapIdx := r.named("frame_to_show_map_idx").f(3)
+			if sh.decoderModelInfoPresentFlag && !sh.timingInfo.equalPictureInterval {
+				framePresentationTime = r.named("frame_presentation_time").f(sh.decoderModelInfo.framePresentationTimeLengthMinusOne + 1)
+			}
+
+			if sh.frameIdNumbersPresentFlag {
+				// display_frame_id
+				r.named("display_frame_id").f(idLen)
+			}
+
+			frameType = RefFrameType[frameToShowMapIdx]
+			refreshFrameFlags := 0
+			if frameType == KEY_FRAME {
+				refreshFrameFlags = allFrames
+			}
+
+			var filmGrainParams FilmGrainParams
+			if sh.filmGrainParamsPresent {
+				filmGrainParams = loadGrainParams(frameToShowMapIdx)
+			}
+
+			return UncompressedHeader{
+				frameType:             frameType,
+				showFrame:             true,
+				showExistingFrame:     true,
+				frameToShowMapIdx:     frameToShowMapIdx,
+				refreshFrameFlags:     refreshFrameFlags,
+				framePresentationTime: framePresentationTime,
+				filmGrainParams:       filmGrainParams,
+			}
 		}
 
-		frameType = r.f(2)
+		frameType = r.named("frame_type").f(2)
 		FrameIsIntra = frameType == INTRA_ONLY_FRAME || frameType == KEY_FRAME
-		showFrame = r.f(1) != 0
+		showFrame = r.named("show_frame").f(1) != 0
 		if showFrame && sh.decoderModelInfoPresentFlag && !sh.timingInfo.equalPictureInterval {
-			framePresentationTime = r.f(sh.decoderModelInfo.framePresentationTimeLengthMinusOne + 1)
+			framePresentationTime = r.named("frame_presentation_time").f(sh.decoderModelInfo.framePresentationTimeLengthMinusOne + 1)
 		}
 
 		if showFrame {
 			showableFrame = frameType != KEY_FRAME
 		} else {
-			showableFrame = r.f(1) != 0
+			showableFrame = r.named("showable_frame").f(1) != 0
 		}
 
 		if frameType == SWITCH_FRAME || (frameType == KEY_FRAME && showFrame) {
 			errorResilientMode = true
 		} else {
-			errorResilientMode = r.f(1) != 0
+			errorResilientMode = r.named("error_resilient_mode").f(1) != 0
 		}
 	}
 
@@ -854,15 +1128,15 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 			RefOrderHint[i] = 0
 		}
 		for i := 0; i < REFS_PER_FRAME; i++ {
-			OrderHints[LAST_FRAME+1] = 0
+			OrderHints[LAST_FRAME+i] = 0
 		}
 	}
 
-	disableCdfUpdate := r.f(1) != 0
+	disableCdfUpdate := r.named("disable_cdf_update").f(1) != 0
 
 	var allowScreenContentTools bool
 	if sh.seqForceScreenContentTools == SELECT_SCREEN_CONTENT_TOOLS {
-		allowScreenContentTools = r.f(1) != 0
+		allowScreenContentTools = r.named("allow_screen_content_tools").f(1) != 0
 	} else {
 		allowScreenContentTools = sh.seqForceScreenContentTools != 0
 	}
@@ -870,7 +1144,7 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 	var forceIntegerMv bool
 	if allowScreenContentTools {
 		if sh.seqForceIntegerMv == SELECT_INTEGER_MV {
-			forceIntegerMv = r.f(1) != 0
+			forceIntegerMv = r.named("force_integer_mv").f(1) != 0
 		} else {
 			forceIntegerMv = sh.seqForceIntegerMv != 0
 		}
@@ -884,7 +1158,7 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 
 	if sh.frameIdNumbersPresentFlag {
 		PrevFrameId = currentFrameId
-		currentFrameId = r.f(idLen)
+		currentFrameId = r.named("current_frame_id").f(idLen)
 		markRefRames(idLen)
 	} else {
 		currentFrameId = 0
@@ -896,22 +1170,22 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 	} else if sh.reducedStillPictureHeader {
 		frameSizeOverrideFlag = false
 	} else {
-		frameSizeOverrideFlag = r.f(1) != 0
+		frameSizeOverrideFlag = r.named("frame_size_override_flag").f(1) != 0
 	}
 
-	OrderHint = r.f(OrderHintBits)
+	OrderHint = r.named("order_hint").f(OrderHintBits)
 
 	var primaryRefFrame int
 	if FrameIsIntra || errorResilientMode {
 		primaryRefFrame = PRIMARY_REF_NONE
 	} else {
-		primaryRefFrame = r.f(3)
+		primaryRefFrame = r.named("primary_ref_frame").f(3)
 	}
 
 	bufferRemovalTime := make([]int, sh.operatingPointsCountMinusOne+1)
 
 	if sh.decoderModelInfoPresentFlag {
-		if r.f(1) != 0 {
+		if r.named("buffer_removal_time_present_flag").f(1) != 0 {
 			for opNum := 0; opNum <= sh.operatingPointsCountMinusOne; opNum++ {
 				if sh.decoderModelInfoPresentForThisOp[opNum] {
 					opPtIdc := sh.operatingPointIdc[opNum]
@@ -919,7 +1193,7 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 					inSpatialLayer := ((opPtIdc >> (spatialId + 8)) & 1) != 0
 
 					if opPtIdc == 0 || (inTemporalLayer && inSpatialLayer) {
-						bufferRemovalTime[opNum] = r.f(sh.decoderModelInfo.bufferRemovalTimeLengthMinusOne + 1)
+						bufferRemovalTime[opNum] = r.named("buffer_removal_time").f(sh.decoderModelInfo.bufferRemovalTimeLengthMinusOne + 1)
 					}
 				}
 			}
@@ -931,12 +1205,20 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 	if frameType == SWITCH_FRAME || (frameType == KEY_FRAME && showFrame) {
 		refreshFrameFlags = allFrames
 	} else {
-		refreshFrameFlags = r.f(8)
+		refreshFrameFlags = r.named("refresh_frame_flags").f(8)
+		if frameType == INTRA_ONLY_FRAME && refreshFrameFlags == 0xff {
+			conformanceError("intra only frame must not refresh all reference frames", r)
+		}
 	}
 
 	if !FrameIsIntra || refreshFrameFlags != allFrames {
 		if errorResilientMode && sh.enableOrderHint {
-			panic("todo")
+			for i := 0; i < NUM_REF_FRAMES; i++ {
+				refOrderHint := r.named("ref_order_hint").f(OrderHintBits)
+				if refOrderHint != RefOrderHint[i] {
+					replaceMissingRef(i, refOrderHint)
+				}
+			}
 		}
 	}
 
@@ -944,30 +1226,87 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 	var frameRefsShortSignaling bool
 	var useSuperres bool
 
+	refFrameIdx := make([]int, REFS_PER_FRAME)
+	var allowHighPrecisionMv bool
+	var interpolationFilter int
+	var isMotionModeSwitchable bool
+
 	if FrameIsIntra {
 		useSuperres = frameSize(r, frameSizeOverrideFlag)
 		renderSize(r)
 		if allowScreenContentTools && UpscaledWidth == FrameWidth {
-			allowIntrabc = r.f(1) != 0
+			allowIntrabc = r.named("allow_intrabc").f(1) != 0
 		}
 	} else {
 		if !sh.enableOrderHint {
 			frameRefsShortSignaling = false
 		} else {
-			frameRefsShortSignaling = r.f(1) != 0
+			frameRefsShortSignaling = r.named("frame_refs_short_signaling").f(1) != 0
+			if frameRefsShortSignaling {
+				lastFrameIdx := r.named("last_frame_idx").f(3)
+				goldFrameIdx := r.named("gold_frame_idx").f(3)
+				refFrameIdx = setFrameRefs(lastFrameIdx, goldFrameIdx, r)
+			}
+		}
+
+		for i := 0; i < REFS_PER_FRAME; i++ {
 			if !frameRefsShortSignaling {
-				panic("todo")
+				refFrameIdx[i] = r.named("ref_frame_idx").f(3)
+			}
+
+			if sh.frameIdNumbersPresentFlag {
+				deltaFrameIdMinusOne := r.named("delta_frame_id_minus_1").f(sh.deltaFrameIdLengthMinusTwo + 2)
+				deltaFrameId := deltaFrameIdMinusOne + 1
+				expectedFrameId := (currentFrameId + (1 << idLen) - deltaFrameId) % (1 << idLen)
+				if RefFrameId[refFrameIdx[i]] != expectedFrameId {
+					conformanceError("invalid delta_frame_id_minus_1", r)
+				}
 			}
 		}
 
-		panic("todo")
+		if frameSizeOverrideFlag && !errorResilientMode {
+			useSuperres = frameSizeWithRefs(r, frameSizeOverrideFlag, refFrameIdx)
+		} else {
+			useSuperres = frameSize(r, frameSizeOverrideFlag)
+			renderSize(r)
+		}
+
+		for i := 0; i < REFS_PER_FRAME; i++ {
+			checkRefFrameScale(refFrameIdx[i], r)
+		}
+
+		if forceIntegerMv {
+			allowHighPrecisionMv = false
+		} else {
+			allowHighPrecisionMv = r.named("allow_high_precision_mv").f(1) != 0
+		}
+
+		interpolationFilter = readInterpolationFilter(r)
+		isMotionModeSwitchable = r.named("is_motion_mode_switchable").f(1) != 0
+
+		if errorResilientMode || !sh.enableRefFrameMvs {
+			useRefFrameMvs = false
+		} else {
+			useRefFrameMvs = r.named("use_ref_frame_mvs").f(1) != 0
+		}
+
+		for i := 0; i < REFS_PER_FRAME; i++ {
+			refFrame := LAST_FRAME + i
+			hint := RefOrderHint[refFrameIdx[i]]
+			OrderHints[refFrame] = hint
+			if !sh.enableOrderHint {
+				RefFrameSignBias[refFrame] = false
+			} else {
+				RefFrameSignBias[refFrame] = getRelativeDist(hint, OrderHint) > 0
+			}
+		}
 	}
 
 	var disableFrameEndUpdateCdf bool
 	if sh.reducedStillPictureHeader || disableCdfUpdate {
 		disableFrameEndUpdateCdf = true
 	} else {
-		disableFrameEndUpdateCdf = r.f(1) != 0
+		disableFrameEndUpdateCdf = r.named("disable_frame_end_update_cdf").f(1) != 0
 	}
 
 	var loopFilterDeltaEnabled bool
@@ -975,7 +1314,7 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 	var loopFilterModeDeltas []int
 
 	if primaryRefFrame == PRIMARY_REF_NONE {
-		log.Println("todo: init_non_coeff_cdfs()")
+		initNonCoeffCdfs()
 		setupPastIndependence()
 		loopFilterDeltaEnabled = true
 
@@ -993,22 +1332,23 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 		loopFilterModeDeltas[0] = 0
 		loopFilterModeDeltas[1] = 0
 	} else {
-		panic("todo")
+		loadCdfs(refFrameIdx[primaryRefFrame])
+		loopFilterRefDeltas, loopFilterModeDeltas = loadPrevious(refFrameIdx[primaryRefFrame])
 	}
 
-	if useRefFrameMvs {
-		panic("todo")
+	if useRefFrameMvs && !headersOnly {
+		motionFieldEstimation(refFrameIdx)
 	}
 	contextUpdateTileId := tileInfo(r)
 	quantizationParams := quantizationParams(r)
-	segmentationEnabled := segmentationParams(r)
+	segmentationEnabled, segmentationUpdateMap, segmentationTemporalUpdate := segmentationParams(primaryRefFrame, r)
 	deltaQRes, deltaQPresent := deltaQParams(quantizationParams.baseQIdx, r)
 	deltaLfPresent, deltaLfRes, deltaLfMulti := deltaLfParams(deltaQPresent, allowIntrabc, r)
 
 	if primaryRefFrame == PRIMARY_REF_NONE {
-		log.Println("todo: init_coeff_cdfs()")
+		r.log().Warn("not implemented", "process", "init_coeff_cdfs")
 	} else {
-		panic("load previous segment ids")
+		loadPreviousSegmentIds(refFrameIdx[primaryRefFrame], segmentationEnabled)
 	}
 
 	CodedLossless = true
@@ -1041,45 +1381,62 @@ func uncompressedHeader(r *Reader) UncompressedHeader {
 	}
 
 	AllLossless = CodedLossless && (FrameWidth == UpscaledWidth)
-	loopFilterParams := loopFilterParams(allowIntrabc, r)
+	loopFilterParams := loopFilterParams(allowIntrabc, loopFilterDeltaEnabled, loopFilterRefDeltas, loopFilterModeDeltas, r)
 	cdefParams := cdefParams(allowIntrabc, r)
 	lrParams(allowIntrabc, r)
 	readTxMode(r)
 	referenceSelect := frameReferenceMode(r)
-	skipmodeParams := skipModeParams(referenceSelect)
+	skipmodeParams := skipModeParams(referenceSelect, refFrameIdx, r)
 
 	var allowWarpedMotion bool
 	if FrameIsIntra || errorResilientMode || !sh.enableWarpedMotion {
 		allowWarpedMotion = false
 	} else {
-		allowWarpedMotion = r.f(1) != 0
+		allowWarpedMotion = r.named("allow_warped_motion").f(1) != 0
 	}
 
-	reducedTxSet := r.f(1) != 0
-	globalMotionParams := globalMotionParams()
-	filmGrainParams(showFrame, showableFrame)
+	reducedTxSet := r.named("reduced_tx_set").f(1) != 0
+	globalMotionParams := globalMotionParams(allowHighPrecisionMv, r)
+	filmGrainParams := filmGrainParams(frameType, showFrame, showableFrame, r)
 
 	return UncompressedHeader{
-		framePresentationTime:    framePresentationTime,
-		forceIntegerMv:           forceIntegerMv,
-		disableFrameEndUpdateCdf: disableFrameEndUpdateCdf,
-		loopFilterDeltaEnabled:   loopFilterDeltaEnabled,
-		contextUpdateTileId:      contextUpdateTileId,
-		deltaQRes:                deltaQRes,
-		deltaLfPresent:           deltaLfPresent,
-		deltaLfRes:               deltaLfRes,
-		deltaLfMulti:             deltaLfMulti,
-		loopFilterParams:         loopFilterParams,
-		cdefParams:               cdefParams,
-		skipmodeParams:           skipmodeParams,
-		allowWarpedMotion:        allowWarpedMotion,
-		reducedTxSet:             reducedTxSet,
-		globalMotionParams:       globalMotionParams,
-		showExistingFrame:        showExistingFrame,
-		quantizationParams:       quantizationParams,
-		deltaQPresent:            deltaQPresent,
-		allowIntrabc:             allowIntrabc,
-		useSuperres:              useSuperres,
+		frameType:                  frameType,
+		showFrame:                  showFrame,
+		showableFrame:              showableFrame,
+		errorResilientMode:         errorResilientMode,
+		disableCdfUpdate:           disableCdfUpdate,
+		primaryRefFrame:            primaryRefFrame,
+		refreshFrameFlags:          refreshFrameFlags,
+		refFrameIdx:                refFrameIdx,
+		allowHighPrecisionMv:       allowHighPrecisionMv,
+		interpolationFilter:        interpolationFilter,
+		isMotionModeSwitchable:     isMotionModeSwitchable,
+		useRefFrameMvs:             useRefFrameMvs,
+		framePresentationTime:      framePresentationTime,
+		forceIntegerMv:             forceIntegerMv,
+		disableFrameEndUpdateCdf:   disableFrameEndUpdateCdf,
+		loopFilterDeltaEnabled:     loopFilterDeltaEnabled,
+		contextUpdateTileId:        contextUpdateTileId,
+		deltaQRes:                  deltaQRes,
+		deltaLfPresent:             deltaLfPresent,
+		deltaLfRes:                 deltaLfRes,
+		deltaLfMulti:               deltaLfMulti,
+		loopFilterParams:           loopFilterParams,
+		cdefParams:                 cdefParams,
+		referenceSelect:            referenceSelect,
+		skipmodeParams:             skipmodeParams,
+		allowWarpedMotion:          allowWarpedMotion,
+		reducedTxSet:               reducedTxSet,
+		globalMotionParams:         globalMotionParams,
+		showExistingFrame:          showExistingFrame,
+		quantizationParams:         quantizationParams,
+		deltaQPresent:              deltaQPresent,
+		allowIntrabc:               allowIntrabc,
+		useSuperres:                useSuperres,
+		segmentationEnabled:        segmentationEnabled,
+		segmentationUpdateMap:      segmentationUpdateMap,
+		segmentationTemporalUpdate: segmentationTemporalUpdate,
+		filmGrainParams:            filmGrainParams,
 	}
 }
 
@@ -1092,7 +1449,7 @@ type QuantizationParams struct {
 }
 
 func quantizationParams(r *Reader) QuantizationParams {
-	baseQIdx := r.f(8)
+	baseQIdx := r.named("base_q_idx").f(8)
 	DeltaQYDc = readDeltaQ(r)
 
 	DeltaQUDc = 0
@@ -1103,7 +1460,7 @@ func quantizationParams(r *Reader) QuantizationParams {
 	if NumPlanes > 1 {
 		diffUvDelta := false
 		if sh.colorConfig.separateUvDeltaQ {
-			diffUvDelta = r.f(1) != 0
+			diffUvDelta = r.named("diff_uv_delta").f(1) != 0
 		}
 
 		DeltaQUDc = readDeltaQ(r)
@@ -1122,15 +1479,15 @@ func quantizationParams(r *Reader) QuantizationParams {
 	var qmU int
 	var qmV int
 
-	usingQMatrix := r.f(1) != 0
+	usingQMatrix := r.named("using_qmatrix").f(1) != 0
 	if usingQMatrix {
-		qmY = r.f(4)
-		qmU = r.f(4)
+		qmY = r.named("qm_y").f(4)
+		qmU = r.named("qm_u").f(4)
 
 		if !sh.colorConfig.separateUvDeltaQ {
 			qmV = qmU
 		} else {
-			qmV = r.f(4)
+			qmV = r.named("qm_v").f(4)
 		}
 	}
 
@@ -1139,8 +1496,8 @@ func quantizationParams(r *Reader) QuantizationParams {
 }
 
 func readDeltaQ(r *Reader) int {
-	if r.f(1) != 0 {
-		return r.su(7)
+	if r.named("delta_coded").f(1) != 0 {
+		return r.named("delta_q").su(7)
 	} else {
 		return 0
 	}
@@ -1176,11 +1533,11 @@ func tileInfo(r *Reader) int {
 	maxLog2TileRows := tileLog2(1, min(sbRows, MAX_TILE_ROWS))
 	minLog2Tiles := max(minLog2TileCols, tileLog2(maxTileAreaSb, sbRows*sbCols))
 
-	uniformTileSpacingFlag := r.f(1) != 0
+	uniformTileSpacingFlag := r.named("uniform_tile_spacing_flag").f(1) != 0
 	if uniformTileSpacingFlag {
 		TileColsLog2 = minLog2TileCols
 		for TileColsLog2 < maxLog2TileCols {
-			if r.f(1) == 1 {
+			if r.named("increment_tile_cols_log2").f(1) == 1 {
 				TileColsLog2++
 			} else {
 				break
@@ -1202,7 +1559,7 @@ func tileInfo(r *Reader) int {
 		TileRowsLog2 = minLog2TileRows
 
 		for TileRowsLog2 < maxLog2TileRows {
-			if r.f(1) == 1 {
+			if r.named("increment_tile_rows_log2").f(1) == 1 {
 				TileRowsLog2++
 			} else {
 				break
@@ -1220,12 +1577,47 @@ func tileInfo(r *Reader) int {
 		MiRowStarts[i] = MiRows
 		TileRows = i
 	} else {
-		panic("no uniformTileSpacingFlag")
+		widestTileSb := 0
+		startSb := 0
+		i := 0
+		MiColStarts = make([]int, sbCols+1)
+		for ; startSb < sbCols; i++ {
+			MiColStarts[i] = startSb << sbShift
+			maxWidth := min(sbCols-startSb, maxTileWidthSb)
+			widthInSbsMinusOne := r.named("width_in_sbs_minus_1").ns(maxWidth)
+			sizeSb := widthInSbsMinusOne + 1
+			widestTileSb = max(sizeSb, widestTileSb)
+			startSb += sizeSb
+		}
+		MiColStarts[i] = MiCols
+		TileCols = i
+		TileColsLog2 = tileLog2(1, TileCols)
+
+		if minLog2Tiles > 0 {
+			maxTileAreaSb = (sbRows * sbCols) >> (minLog2Tiles + 1)
+		} else {
+			maxTileAreaSb = sbRows * sbCols
+		}
+		maxTileHeightSb := max(maxTileAreaSb/widestTileSb, 1)
+
+		startSb = 0
+		i = 0
+		MiRowStarts = make([]int, sbRows+1)
+		for ; startSb < sbRows; i++ {
+			MiRowStarts[i] = startSb << sbShift
+			maxHeight := min(sbRows-startSb, maxTileHeightSb)
+			heightInSbsMinusOne := r.named("height_in_sbs_minus_1").ns(maxHeight)
+			sizeSb := heightInSbsMinusOne + 1
+			startSb += sizeSb
+		}
+		MiRowStarts[i] = MiRows
+		TileRows = i
+		TileRowsLog2 = tileLog2(1, TileRows)
 	}
 
 	if TileColsLog2 > 0 || TileRowsLog2 > 0 {
-		contextUpdateTileId := r.f(TileRowsLog2 + TileColsLog2)
-		tileSizeBytesMinusOne := r.f(2)
+		contextUpdateTileId := r.named("context_update_tile_id").f(TileRowsLog2 + TileColsLog2)
+		tileSizeBytesMinusOne := r.named("tile_size_bytes_minus_1").f(2)
 		TileSizeBytes = tileSizeBytesMinusOne + 1
 		return contextUpdateTileId
 	} else {
@@ -1259,8 +1651,8 @@ func markRefRames(idLen int) {
 
 func frameSize(r *Reader, frameSizeOverrideFlag bool) bool {
 	if frameSizeOverrideFlag {
-		frameWidthMinusOne := r.f(sh.frameWidthBitsMinusOne + 1)
-		frameHeightMinusOne := r.f(sh.frameHeightBitsMinusOne + 1)
+		frameWidthMinusOne := r.named("frame_width_minus_1").f(sh.frameWidthBitsMinusOne + 1)
+		frameHeightMinusOne := r.named("frame_height_minus_1").f(sh.frameHeightBitsMinusOne + 1)
 		FrameWidth = frameWidthMinusOne + 1
 		FrameHeight = frameHeightMinusOne + 1
 	} else {
@@ -1270,6 +1662,7 @@ func frameSize(r *Reader, frameSizeOverrideFlag bool) bool {
 
 	useSuperres := superresParams(r)
 	computeImageSize()
+	checkFrameLimits(r)
 	return useSuperres
 }
 
@@ -1280,11 +1673,11 @@ const SUPERRES_NUM = 8
 func superresParams(r *Reader) bool {
 	useSuperres := false
 	if sh.enableSuperres {
-		useSuperres = r.f(1) != 0
+		useSuperres = r.named("use_superres").f(1) != 0
 	}
 
 	if useSuperres {
-		SuperresDenom = r.f(SUPERRES_DENOM_BITS) + SUPERRES_DENOM_MIN
+		SuperresDenom = r.named("coded_denom").f(SUPERRES_DENOM_BITS) + SUPERRES_DENOM_MIN
 	} else {
 		SuperresDenom = SUPERRES_NUM
 	}
@@ -1295,23 +1688,159 @@ func superresParams(r *Reader) bool {
 	return useSuperres
 }
 
+func frameSizeWithRefs(r *Reader, frameSizeOverrideFlag bool, refFrameIdx []int) bool {
+	foundRef := false
+	for i := 0; i < REFS_PER_FRAME; i++ {
+		foundRef = r.named("found_ref").f(1) != 0
+		if foundRef {
+			UpscaledWidth = RefUpscaledWidth[refFrameIdx[i]]
+			FrameWidth = UpscaledWidth
+			FrameHeight = RefFrameHeight[refFrameIdx[i]]
+			RenderWidth = RefRenderWidth[refFrameIdx[i]]
+			RenderHeight = RefRenderHeight[refFrameIdx[i]]
+			break
+		}
+	}
+
+	if !foundRef {
+		useSuperres := frameSize(r, frameSizeOverrideFlag)
+		renderSize(r)
+		return useSuperres
+	}
+
+	useSuperres := superresParams(r)
+	computeImageSize()
+	checkFrameLimits(r)
+	return useSuperres
+}
+
 func computeImageSize() {
 	MiCols = 2 * ((FrameWidth + 7) >> 3)
 	MiRows = 2 * ((FrameHeight + 7) >> 3)
 }
 
 func renderSize(r *Reader) {
-	if r.f(1) != 0 {
-		RenderWidth = r.f(16) + 1
-		RenderHeight = r.f(16) + 1
+	if r.named("render_and_frame_size_different").f(1) != 0 {
+		RenderWidth = r.named("render_width_minus_1").f(16) + 1
+		RenderHeight = r.named("render_height_minus_1").f(16) + 1
 	} else {
 		RenderWidth = UpscaledWidth
 		RenderHeight = FrameHeight
 	}
 }
 
+const EIGHTTAP = 0
+const EIGHTTAP_SMOOTH = 1
+const EIGHTTAP_SHARP = 2
+const BILINEAR = 3
+const SWITCHABLE = 4
+
+func readInterpolationFilter(r *Reader) int {
+	isFilterSwitchable := r.named("is_filter_switchable").f(1) != 0
+	if isFilterSwitchable {
+		return SWITCHABLE
+	}
+
+	return r.named("interpolation_filter").f(2)
+}
+
+func getRelativeDist(a int, b int) int {
+	if !sh.enableOrderHint {
+		return 0
+	}
+
+	diff := a - b
+	m := 1 << (OrderHintBits - 1)
+	diff = (diff & (m - 1)) - (diff & m)
+	return diff
+}
+
 const WARPEDMODEL_PREC_BITS = 16
 
+// setFrameRefs derives ref_frame_idx from the last and golden frame
+// indices and the order hints of the reference slots, for frames that use
+// frame_refs_short_signaling.
+func setFrameRefs(lastFrameIdx int, goldFrameIdx int, r *Reader) []int {
+	refFrameIdx := make([]int, REFS_PER_FRAME)
+	for i := 0; i < REFS_PER_FRAME; i++ {
+		refFrameIdx[i] = -1
+	}
+	refFrameIdx[LAST_FRAME-LAST_FRAME] = lastFrameIdx
+	refFrameIdx[GOLDEN_FRAME-LAST_FRAME] = goldFrameIdx
+
+	usedFrame := make([]bool, NUM_REF_FRAMES)
+	usedFrame[lastFrameIdx] = true
+	usedFrame[goldFrameIdx] = true
+
+	curFrameHint := 1 << (OrderHintBits - 1)
+	shiftedOrderHints := make([]int, NUM_REF_FRAMES)
+	for i := 0; i < NUM_REF_FRAMES; i++ {
+		shiftedOrderHints[i] = curFrameHint + getRelativeDist(RefOrderHint[i], OrderHint)
+	}
+
+	if shiftedOrderHints[lastFrameIdx] >= curFrameHint {
+		conformanceError("last_frame_idx must refer to a forward reference", r)
+	}
+	if shiftedOrderHints[goldFrameIdx] >= curFrameHint {
+		conformanceError("gold_frame_idx must refer to a forward reference", r)
+	}
+
+	// findRef returns the unused slot whose shifted order hint is the
+	// latest (or earliest) among those on the backward (or forward) side of
+	// the current frame, or -1.
+	findRef := func(backward bool, latest bool) int {
+		ref := -1
+		var refHint int
+		for i := 0; i < NUM_REF_FRAMES; i++ {
+			hint := shiftedOrderHints[i]
+			if usedFrame[i] || (hint >= curFrameHint) != backward {
+				continue
+			}
+
+			if ref < 0 || (latest && hint >= refHint) || (!latest && hint < refHint) {
+				ref = i
+				refHint = hint
+			}
+		}
+		return ref
+	}
+
+	use := func(refFrame int, ref int) {
+		if ref >= 0 {
+			refFrameIdx[refFrame-LAST_FRAME] = ref
+			usedFrame[ref] = true
+		}
+	}
+
+	use(ALTREF_FRAME, findRef(true, true))
+	use(BWDREF_FRAME, findRef(true, false))
+	use(ALTREF2_FRAME, findRef(true, false))
+
+	for _, refFrame := range []int{LAST2_FRAME, LAST3_FRAME, BWDREF_FRAME, ALTREF2_FRAME, ALTREF_FRAME} {
+		if refFrameIdx[refFrame-LAST_FRAME] < 0 {
+			use(refFrame, findRef(false, true))
+		}
+	}
+
+	// Whatever is still unset refers to the slot with the earliest hint.
+	ref := -1
+	var earliestOrderHint int
+	for i := 0; i < NUM_REF_FRAMES; i++ {
+		hint := shiftedOrderHints[i]
+		if ref < 0 || hint < earliestOrderHint {
+			ref = i
+			earliestOrderHint = hint
+		}
+	}
+	for i := 0; i < REFS_PER_FRAME; i++ {
+		if refFrameIdx[i] < 0 {
+			refFrameIdx[i] = ref
+		}
+	}
+
+	return refFrameIdx
+}
+
 func setupPastIndependence() {
 	for i := 0; i < MAX_SEGMENTS; i++ {
 		for j := 0; j < SEG_LVL_MAX; j++ {
@@ -1329,7 +1858,7 @@ func setupPastIndependence() {
 	for ref := LAST_FRAME; ref <= ALTREF_FRAME; ref++ {
 		PrevGmParams[ref] = make([]int, 6)
 		for i := 0; i <= 5; i++ {
-			if ref%3 == 2 {
+			if i%3 == 2 {
 				PrevGmParams[ref][i] = 1 << WARPEDMODEL_PREC_BITS
 			} else {
 				PrevGmParams[ref][i] = 0
@@ -1341,11 +1870,43 @@ func setupPastIndependence() {
 
 const SEG_LVL_REF_FRAME = 5
 
-func segmentationParams(r *Reader) bool {
-	segmentationEnabled := r.f(1) != 0
+func segmentationParams(primaryRefFrame int, r *Reader) (segmentationEnabled bool, segmentationUpdateMap bool, segmentationTemporalUpdate bool) {
+	segmentationEnabled = r.named("segmentation_enabled").f(1) != 0
 
 	if segmentationEnabled {
-		panic("segmentation enabled")
+		var segmentationUpdateData bool
+		if primaryRefFrame == PRIMARY_REF_NONE {
+			segmentationUpdateMap = true
+			segmentationTemporalUpdate = false
+			segmentationUpdateData = true
+		} else {
+			segmentationUpdateMap = r.named("segmentation_update_map").f(1) != 0
+			if segmentationUpdateMap {
+				segmentationTemporalUpdate = r.named("segmentation_temporal_update").f(1) != 0
+			}
+			segmentationUpdateData = r.named("segmentation_update_data").f(1) != 0
+		}
+
+		if segmentationUpdateData {
+			for i := 0; i < MAX_SEGMENTS; i++ {
+				for j := 0; j < SEG_LVL_MAX; j++ {
+					featureEnabled := r.named("feature_enabled").f(1) != 0
+					FeatureEnabled[i][j] = featureEnabled
+
+					clippedValue := 0
+					if featureEnabled {
+						bitsToRead := SegmentationFeatureBits[j]
+						limit := SegmentationFeatureMax[j]
+						if SegmentationFeatureSigned[j] {
+							clippedValue = clip3(-limit, limit, r.named("feature_value").su(1+bitsToRead))
+						} else {
+							clippedValue = clip3(0, limit, r.named("feature_value").f(bitsToRead))
+						}
+					}
+					FeatureData[i][j] = clippedValue
+				}
+			}
+		}
 	} else {
 		for i := 0; i < MAX_SEGMENTS; i++ {
 			for j := 0; j < SEG_LVL_MAX; j++ {
@@ -1369,7 +1930,7 @@ func segmentationParams(r *Reader) bool {
 		}
 	}
 
-	return segmentationEnabled
+	return segmentationEnabled, segmentationUpdateMap, segmentationTemporalUpdate
 }
 
 func deltaQParams(baseQIdx int, r *Reader) (deltaQRes int, deltaQPresent bool) {
@@ -1377,11 +1938,11 @@ func deltaQParams(baseQIdx int, r *Reader) (deltaQRes int, deltaQPresent bool) {
 	deltaQPresent = false
 
 	if baseQIdx > 0 {
-		deltaQPresent = r.f(1) != 0
+		deltaQPresent = r.named("delta_q_present").f(1) != 0
 	}
 
 	if deltaQPresent {
-		deltaQRes = r.f(2)
+		deltaQRes = r.named("delta_q_res").f(2)
 	}
 
 	return deltaQRes, deltaQPresent
@@ -1394,11 +1955,11 @@ func deltaLfParams(deltaQPresent bool, allowIntrabc bool, r *Reader) (deltaLfPre
 
 	if deltaQPresent {
 		if !allowIntrabc {
-			deltaLfPresent = r.f(1) != 0
+			deltaLfPresent = r.named("delta_lf_present").f(1) != 0
 		}
 		if deltaLfPresent {
-			deltaLfRes = r.f(2)
-			deltaLfMulti = r.f(1) != 0
+			deltaLfRes = r.named("delta_lf_res").f(2)
+			deltaLfMulti = r.named("delta_lf_multi").f(1) != 0
 		}
 	}
 
@@ -1409,7 +1970,13 @@ const SEG_LVL_ALT_Q = 0
 
 func getQIndex(ignoreDeltaQ bool, segmentId int, segmentationEnabled bool, deltaQPresent bool, baseQIdx int) int {
 	if segFeatureActiveIdx(segmentId, SEG_LVL_ALT_Q, segmentationEnabled) {
-		panic("segFeatureActiveIdx")
+		data := FeatureData[segmentId][SEG_LVL_ALT_Q]
+		qIndex := baseQIdx + data
+		if !ignoreDeltaQ && deltaQPresent {
+			qIndex = CurrentQIndex + data
+		}
+
+		return clip3(0, 255, qIndex)
 	}
 
 	if !ignoreDeltaQ && deltaQPresent {
@@ -1433,43 +2000,63 @@ type LoopFilterParams struct {
 
 const TOTAL_REFS_PER_FRAME = 8
 
-func loopFilterParams(allowIntrabc bool, r *Reader) LoopFilterParams {
+func loopFilterParams(allowIntrabc bool, loopFilterDeltaEnabled bool, loopFilterRefDeltas []int, loopFilterModeDeltas []int, r *Reader) LoopFilterParams {
 	loopFilterLevel := make([]int, 4)
 
 	if CodedLossless || allowIntrabc {
-		panic("todo")
+		loopFilterLevel[0] = 0
+		loopFilterLevel[1] = 0
+
+		loopFilterRefDeltas = make([]int, TOTAL_REFS_PER_FRAME)
+		loopFilterRefDeltas[INTRA_FRAME] = 1
+		loopFilterRefDeltas[LAST_FRAME] = 0
+		loopFilterRefDeltas[LAST2_FRAME] = 0
+		loopFilterRefDeltas[LAST3_FRAME] = 0
+		loopFilterRefDeltas[BWDREF_FRAME] = 0
+		loopFilterRefDeltas[GOLDEN_FRAME] = -1
+		loopFilterRefDeltas[ALTREF_FRAME] = -1
+		loopFilterRefDeltas[ALTREF2_FRAME] = -1
+
+		loopFilterModeDeltas = make([]int, 2)
+
+		return LoopFilterParams{
+			loopFilterLevel:        loopFilterLevel,
+			loopFilterDeltaEnabled: loopFilterDeltaEnabled,
+			loopFilterRefDeltas:    loopFilterRefDeltas,
+			loopFilterModeDeltas:   loopFilterModeDeltas,
+		}
 	}
 
-	loopFilterLevel[0] = r.f(6)
-	loopFilterLevel[1] = r.f(6)
+	loopFilterLevel[0] = r.named("loop_filter_level").f(6)
+	loopFilterLevel[1] = r.named("loop_filter_level").f(6)
 
 	if NumPlanes > 1 {
 		if loopFilterLevel[0] != 0 || loopFilterLevel[1] != 0 {
-			loopFilterLevel[2] = r.f(6)
-			loopFilterLevel[3] = r.f(6)
+			loopFilterLevel[2] = r.named("loop_filter_level").f(6)
+			loopFilterLevel[3] = r.named("loop_filter_level").f(6)
 		}
 	}
 
-	loopFilterSharpness := r.f(3)
-	loopFilterDeltaEnabled := r.f(1) != 0
+	loopFilterSharpness := r.named("loop_filter_sharpness").f(3)
+	loopFilterDeltaEnabled = r.named("loop_filter_delta_enabled").f(1) != 0
 
-	loopFilterRefDeltas := make([]int, 8)
-	loopFilterModeDeltas := make([]int, 2)
+	loopFilterRefDeltas = append([]int(nil), loopFilterRefDeltas...)
+	loopFilterModeDeltas = append([]int(nil), loopFilterModeDeltas...)
 
 	if loopFilterDeltaEnabled {
-		loopFilterDeltaUpdate := r.f(1) != 0
+		loopFilterDeltaUpdate := r.named("loop_filter_delta_update").f(1) != 0
 		if loopFilterDeltaUpdate {
 			for i := 0; i < TOTAL_REFS_PER_FRAME; i++ {
-				updateRefDelta := r.f(1) != 0
+				updateRefDelta := r.named("update_ref_delta").f(1) != 0
 				if updateRefDelta {
-					loopFilterRefDeltas[i] = r.su(7)
+					loopFilterRefDeltas[i] = r.named("loop_filter_ref_deltas").su(7)
 				}
 			}
 
 			for i := 0; i < 2; i++ {
-				updateModeDelta := r.f(1) != 0
+				updateModeDelta := r.named("update_mode_delta").f(1) != 0
 				if updateModeDelta {
-					loopFilterModeDeltas[i] = r.su(7)
+					loopFilterModeDeltas[i] = r.named("loop_filter_mode_deltas").su(7)
 				}
 			}
 		}
@@ -1492,12 +2079,12 @@ type CdefParams struct {
 	cdefUvSecStrength []int
 }
 
-func cdefParams(allowIntrabc bool, _ *Reader) CdefParams {
+func cdefParams(allowIntrabc bool, r *Reader) CdefParams {
 	if CodedLossless || allowIntrabc || !sh.enableCdef {
 		CdefDamping = 3
 
 		return CdefParams{
-			cdefBits:          3,
+			cdefBits:          0,
 			cdefYPriStrength:  make([]int, 1),
 			cdefYSecStrength:  make([]int, 1),
 			cdefUvPriStrength: make([]int, 1),
@@ -1505,13 +2092,44 @@ func cdefParams(allowIntrabc bool, _ *Reader) CdefParams {
 		}
 	}
 
-	panic("cdefParams")
+	cdefDampingMinus3 := r.named("cdef_damping_minus_3").f(2)
+	CdefDamping = cdefDampingMinus3 + 3
+	cdefBits := r.named("cdef_bits").f(2)
+
+	cdefYPriStrength := make([]int, 1<<cdefBits)
+	cdefYSecStrength := make([]int, 1<<cdefBits)
+	cdefUvPriStrength := make([]int, 1<<cdefBits)
+	cdefUvSecStrength := make([]int, 1<<cdefBits)
+
+	for i := 0; i < (1 << cdefBits); i++ {
+		cdefYPriStrength[i] = r.named("cdef_y_pri_strength").f(4)
+		cdefYSecStrength[i] = r.named("cdef_y_sec_strength").f(2)
+		if cdefYSecStrength[i] == 3 {
+			cdefYSecStrength[i] += 1
+		}
+
+		if NumPlanes > 1 {
+			cdefUvPriStrength[i] = r.named("cdef_uv_pri_strength").f(4)
+			cdefUvSecStrength[i] = r.named("cdef_uv_sec_strength").f(2)
+			if cdefUvSecStrength[i] == 3 {
+				cdefUvSecStrength[i] += 1
+			}
+		}
+	}
+
+	return CdefParams{
+		cdefBits:          cdefBits,
+		cdefYPriStrength:  cdefYPriStrength,
+		cdefYSecStrength:  cdefYSecStrength,
+		cdefUvPriStrength: cdefUvPriStrength,
+		cdefUvSecStrength: cdefUvSecStrength,
+	}
 }
 
 const RESTORE_NONE = 0
 
 func lrParams(allowIntrabc bool, r *Reader) {
-	LoopRestorationSize = make([]int, NumPlanes)
+	LoopRestorationSize = make([]int, 3)
 
 	if AllLossless || allowIntrabc || !sh.enableRestoration {
 		FrameRestorationType[0] = RESTORE_NONE
@@ -1521,7 +2139,44 @@ func lrParams(allowIntrabc bool, r *Reader) {
 		return
 	}
 
-	panic("lrParams")
+	UsesLr = false
+	usesChromaLr := false
+	for i := 0; i < NumPlanes; i++ {
+		lrType := r.named("lr_type").f(2)
+		FrameRestorationType[i] = RemapLrType[lrType]
+		if FrameRestorationType[i] != RESTORE_NONE {
+			UsesLr = true
+			if i > 0 {
+				usesChromaLr = true
+			}
+		}
+	}
+
+	if UsesLr {
+		var lrUnitShift int
+		if sh.use128x128Superblock {
+			lrUnitShift = r.named("lr_unit_shift").f(1)
+			lrUnitShift++
+		} else {
+			lrUnitShift = r.named("lr_unit_shift").f(1)
+			if lrUnitShift != 0 {
+				lrUnitExtraShift := r.named("lr_unit_extra_shift").f(1)
+				lrUnitShift += lrUnitExtraShift
+			}
+		}
+
+		LoopRestorationSize[0] = RESTORATION_TILESIZE_MAX >> (2 - lrUnitShift)
+
+		lrUvShift := 0
+		if sh.colorConfig.subsamplingX != 0 && sh.colorConfig.subsamplingY != 0 && usesChromaLr {
+			lrUvShift = r.named("lr_uv_shift").f(1)
+		}
+
+		LoopRestorationSize[1] = LoopRestorationSize[0] >> lrUvShift
+		LoopRestorationSize[2] = LoopRestorationSize[0] >> lrUvShift
+
+		allocLrUnits()
+	}
 }
 
 const ONLY_4X4 = 0
@@ -1532,7 +2187,7 @@ func readTxMode(r *Reader) {
 	if CodedLossless {
 		TxMode = ONLY_4X4
 	} else {
-		if r.f(1) != 0 {
+		if r.named("tx_mode_select").f(1) != 0 {
 			TxMode = TX_MODE_SELECT
 		} else {
 			TxMode = TX_MODE_LARGEST
@@ -1544,35 +2199,99 @@ func frameReferenceMode(r *Reader) bool {
 	if FrameIsIntra {
 		return false
 	} else {
-		return r.f(1) != 0
+		return r.named("reference_select").f(1) != 0
 	}
 }
 
 type SkipModeParams struct {
 	skipModeAllowed bool
+	skipModePresent bool
+	skipModeFrame   [2]int
 }
 
-func skipModeParams(referenceSelect bool) SkipModeParams {
+// skipModeParams picks the two references used by skip mode: the nearest
+// forward and backward references, or the two nearest forward ones when
+// there is no backward reference.
+func skipModeParams(referenceSelect bool, refFrameIdx []int, r *Reader) SkipModeParams {
 	if FrameIsIntra || !referenceSelect || !sh.enableOrderHint {
 		return SkipModeParams{skipModeAllowed: false}
 	}
 
-	panic("skipModeParams")
+	forwardIdx, forwardHint := -1, 0
+	backwardIdx, backwardHint := -1, 0
+	for i := 0; i < REFS_PER_FRAME; i++ {
+		refHint := RefOrderHint[refFrameIdx[i]]
+		if getRelativeDist(refHint, OrderHint) < 0 {
+			if forwardIdx < 0 || getRelativeDist(refHint, forwardHint) > 0 {
+				forwardIdx = i
+				forwardHint = refHint
+			}
+		} else if getRelativeDist(refHint, OrderHint) > 0 {
+			if backwardIdx < 0 || getRelativeDist(refHint, backwardHint) < 0 {
+				backwardIdx = i
+				backwardHint = refHint
+			}
+		}
+	}
+
+	var skipModeFrame [2]int
+	if forwardIdx < 0 {
+		return SkipModeParams{skipModeAllowed: false}
+	} else if backwardIdx >= 0 {
+		skipModeFrame[0] = LAST_FRAME + min(forwardIdx, backwardIdx)
+		skipModeFrame[1] = LAST_FRAME + max(forwardIdx, backwardIdx)
+	} else {
+		secondForwardIdx, secondForwardHint := -1, 0
+		for i := 0; i < REFS_PER_FRAME; i++ {
+			refHint := RefOrderHint[refFrameIdx[i]]
+			if getRelativeDist(refHint, forwardHint) < 0 {
+				if secondForwardIdx < 0 || getRelativeDist(refHint, secondForwardHint) > 0 {
+					secondForwardIdx = i
+					secondForwardHint = refHint
+				}
+			}
+		}
+
+		if secondForwardIdx < 0 {
+			return SkipModeParams{skipModeAllowed: false}
+		}
+
+		skipModeFrame[0] = LAST_FRAME + min(forwardIdx, secondForwardIdx)
+		skipModeFrame[1] = LAST_FRAME + max(forwardIdx, secondForwardIdx)
+	}
+
+	return SkipModeParams{
+		skipModeAllowed: true,
+		skipModePresent: r.named("skip_mode_present").f(1) != 0,
+		skipModeFrame:   skipModeFrame,
+	}
 }
 
 const IDENTITY = 0
 
+const GM_ABS_ALPHA_BITS = 12
+const GM_ALPHA_PREC_BITS = 15
+const GM_ABS_TRANS_ONLY_BITS = 9
+const GM_TRANS_ONLY_PREC_BITS = 3
+const GM_ABS_TRANS_BITS = 12
+const GM_TRANS_PREC_BITS = 6
+
 type GlobalMotionParams struct {
 	gmParams [][]int
+	// warpValid records per reference whether gmParams passes the shear
+	// check. Blocks fall back to translation when it does not.
+	warpValid []bool
 }
 
-func globalMotionParams() GlobalMotionParams {
+func globalMotionParams(allowHighPrecisionMv bool, r *Reader) GlobalMotionParams {
 	gmParams := make([][]int, ALTREF_FRAME+1)
+	warpValid := make([]bool, ALTREF_FRAME+1)
 	for ref := LAST_FRAME; ref <= ALTREF_FRAME; ref++ {
 		GmType[ref] = IDENTITY
+		warpValid[ref] = true
 
+		gmParams[ref] = make([]int, 6)
 		for i := 0; i < 6; i++ {
-			gmParams[ref] = make([]int, 6)
 			if i%3 == 2 {
 				gmParams[ref][i] = 1 << WARPEDMODEL_PREC_BITS
 			} else {
@@ -1582,19 +2301,238 @@ func globalMotionParams() GlobalMotionParams {
 	}
 
 	if FrameIsIntra {
-		return GlobalMotionParams{gmParams: gmParams}
+		return GlobalMotionParams{gmParams: gmParams, warpValid: warpValid}
+	}
+
+	for ref := LAST_FRAME; ref <= ALTREF_FRAME; ref++ {
+		var typ int
+		isGlobal := r.named("is_global").f(1) != 0
+		if isGlobal {
+			isRotZoom := r.named("is_rot_zoom").f(1) != 0
+			if isRotZoom {
+				typ = ROTZOOM
+			} else {
+				isTranslation := r.named("is_translation").f(1) != 0
+				if isTranslation {
+					typ = TRANSLATION
+				} else {
+					typ = AFFINE
+				}
+			}
+		} else {
+			typ = IDENTITY
+		}
+		GmType[ref] = typ
+
+		if typ >= ROTZOOM {
+			readGlobalParam(gmParams, typ, ref, 2, allowHighPrecisionMv, r)
+			readGlobalParam(gmParams, typ, ref, 3, allowHighPrecisionMv, r)
+			if typ == AFFINE {
+				readGlobalParam(gmParams, typ, ref, 4, allowHighPrecisionMv, r)
+				readGlobalParam(gmParams, typ, ref, 5, allowHighPrecisionMv, r)
+			} else {
+				gmParams[ref][4] = -gmParams[ref][3]
+				gmParams[ref][5] = gmParams[ref][2]
+			}
+		}
+
+		if typ >= TRANSLATION {
+			readGlobalParam(gmParams, typ, ref, 0, allowHighPrecisionMv, r)
+			readGlobalParam(gmParams, typ, ref, 1, allowHighPrecisionMv, r)
+		}
+
+		if typ > TRANSLATION {
+			warpValid[ref], _, _, _, _ = setupShear(gmParams[ref])
+		}
 	}
 
-	panic("globalMotionParams")
+	return GlobalMotionParams{gmParams: gmParams, warpValid: warpValid}
 }
 
-func filmGrainParams(showFrame bool, showableFrame bool) {
+// readGlobalParam reads gm_params[ref][idx] coded relative to the value the
+// previous frame used.
+func readGlobalParam(gmParams [][]int, typ int, ref int, idx int, allowHighPrecisionMv bool, r *Reader) {
+	absBits := GM_ABS_ALPHA_BITS
+	precBits := GM_ALPHA_PREC_BITS
+	if idx < 2 {
+		if typ == TRANSLATION {
+			hp := 0
+			if !allowHighPrecisionMv {
+				hp = 1
+			}
+			absBits = GM_ABS_TRANS_ONLY_BITS - hp
+			precBits = GM_TRANS_ONLY_PREC_BITS - hp
+		} else {
+			absBits = GM_ABS_TRANS_BITS
+			precBits = GM_TRANS_PREC_BITS
+		}
+	}
+
+	precDiff := WARPEDMODEL_PREC_BITS - precBits
+	round := 0
+	sub := 0
+	if idx%3 == 2 {
+		round = 1 << WARPEDMODEL_PREC_BITS
+		sub = 1 << precBits
+	}
+
+	mx := 1 << absBits
+	ref0 := (PrevGmParams[ref][idx] >> precDiff) - sub
+	gmParams[ref][idx] = (decodeSignedSubexpWithRef(r, -mx, mx+1, ref0) << precDiff) + round
+}
+
+type FilmGrainParams struct {
+	applyGrain            bool
+	grainSeed             int
+	updateGrain           bool
+	numYPoints            int
+	pointYValue           []int
+	pointYScaling         []int
+	chromaScalingFromLuma bool
+	numCbPoints           int
+	pointCbValue          []int
+	pointCbScaling        []int
+	numCrPoints           int
+	pointCrValue          []int
+	pointCrScaling        []int
+	grainScalingMinus8    int
+	arCoeffLag            int
+	arCoeffsYPlus128      []int
+	arCoeffsCbPlus128     []int
+	arCoeffsCrPlus128     []int
+	arCoeffShiftMinus6    int
+	grainScaleShift       int
+	cbMult                int
+	cbLumaMult            int
+	cbOffset              int
+	crMult                int
+	crLumaMult            int
+	crOffset              int
+	overlapFlag           bool
+	clipToRestrictedRange bool
+}
+
+// filmGrainParams returns the zero value, which is reset_grain_params(),
+// whenever grain is not applied to the frame.
+func filmGrainParams(frameType int, showFrame bool, showableFrame bool, r *Reader) FilmGrainParams {
 	if !sh.filmGrainParamsPresent || (!showFrame && !showableFrame) {
-		log.Println("todo: reset_grain_params")
-		return
+		return FilmGrainParams{}
+	}
+
+	applyGrain := r.named("apply_grain").f(1) != 0
+	if !applyGrain {
+		return FilmGrainParams{}
+	}
+
+	grainSeed := r.named("grain_seed").f(16)
+
+	updateGrain := true
+	if frameType == INTER_FRAME {
+		updateGrain = r.named("update_grain").f(1) != 0
+	}
+
+	if !updateGrain {
+		filmGrainParamsRefIdx := r.named("film_grain_params_ref_idx").f(3)
+		tempGrainSeed := grainSeed
+		p := loadGrainParams(filmGrainParamsRefIdx)
+		p.grainSeed = tempGrainSeed
+		return p
+	}
+
+	p := FilmGrainParams{
+		applyGrain:  applyGrain,
+		grainSeed:   grainSeed,
+		updateGrain: updateGrain,
+	}
+
+	p.numYPoints = r.named("num_y_points").f(4)
+	p.pointYValue = make([]int, p.numYPoints)
+	p.pointYScaling = make([]int, p.numYPoints)
+	for i := 0; i < p.numYPoints; i++ {
+		p.pointYValue[i] = r.named("point_y_value").f(8)
+		p.pointYScaling[i] = r.named("point_y_scaling").f(8)
+	}
+
+	cc := sh.colorConfig
+	if cc.monoChrome {
+		p.chromaScalingFromLuma = false
+	} else {
+		p.chromaScalingFromLuma = r.named("chroma_scaling_from_luma").f(1) != 0
+	}
+
+	if cc.monoChrome || p.chromaScalingFromLuma || (cc.subsamplingX == 1 && cc.subsamplingY == 1 && p.numYPoints == 0) {
+		p.numCbPoints = 0
+		p.numCrPoints = 0
+	} else {
+		p.numCbPoints = r.named("num_cb_points").f(4)
+		p.pointCbValue = make([]int, p.numCbPoints)
+		p.pointCbScaling = make([]int, p.numCbPoints)
+		for i := 0; i < p.numCbPoints; i++ {
+			p.pointCbValue[i] = r.named("point_cb_value").f(8)
+			p.pointCbScaling[i] = r.named("point_cb_scaling").f(8)
+		}
+
+		p.numCrPoints = r.named("num_cr_points").f(4)
+		p.pointCrValue = make([]int, p.numCrPoints)
+		p.pointCrScaling = make([]int, p.numCrPoints)
+		for i := 0; i < p.numCrPoints; i++ {
+			p.pointCrValue[i] = r.named("point_cr_value").f(8)
+			p.pointCrScaling[i] = r.named("point_cr_scaling").f(8)
+		}
+	}
+
+	p.grainScalingMinus8 = r.named("grain_scaling_minus_8").f(2)
+	p.arCoeffLag = r.named("ar_coeff_lag").f(2)
+
+	numPosLuma := 2 * p.arCoeffLag * (p.arCoeffLag + 1)
+	var numPosChroma int
+	p.arCoeffsYPlus128 = make([]int, numPosLuma)
+	if p.numYPoints != 0 {
+		numPosChroma = numPosLuma + 1
+		for i := 0; i < numPosLuma; i++ {
+			p.arCoeffsYPlus128[i] = r.named("ar_coeffs_y_plus_128").f(8)
+		}
+	} else {
+		numPosChroma = numPosLuma
+	}
+
+	p.arCoeffsCbPlus128 = make([]int, numPosChroma)
+	if p.chromaScalingFromLuma || p.numCbPoints != 0 {
+		for i := 0; i < numPosChroma; i++ {
+			p.arCoeffsCbPlus128[i] = r.named("ar_coeffs_cb_plus_128").f(8)
+		}
 	}
 
-	panic("filmGrainParams")
+	p.arCoeffsCrPlus128 = make([]int, numPosChroma)
+	if p.chromaScalingFromLuma || p.numCrPoints != 0 {
+		for i := 0; i < numPosChroma; i++ {
+			p.arCoeffsCrPlus128[i] = r.named("ar_coeffs_cr_plus_128").f(8)
+		}
+	}
+
+	p.arCoeffShiftMinus6 = r.named("ar_coeff_shift_minus_6").f(2)
+	p.grainScaleShift = r.named("grain_scale_shift").f(2)
+
+	if p.numCbPoints != 0 {
+		p.cbMult = r.named("cb_mult").f(8)
+		p.cbLumaMult = r.named("cb_luma_mult").f(8)
+		p.cbOffset = r.named("cb_offset").f(9)
+	}
+
+	if p.numCrPoints != 0 {
+		p.crMult = r.named("cr_mult").f(8)
+		p.crLumaMult = r.named("cr_luma_mult").f(8)
+		p.crOffset = r.named("cr_offset").f(9)
+	}
+
+	p.overlapFlag = r.named("overlap_flag").f(1) != 0
+	p.clipToRestrictedRange = r.named("clip_to_restricted_range").f(1) != 0
+
+	return p
+}
+
+func loadGrainParams(idx int) FilmGrainParams {
+	return RefFilmGrainParams[idx]
 }
 
 func tileGroup(sz int, r *Reader) {
@@ -1604,7 +2542,7 @@ func tileGroup(sz int, r *Reader) {
 	tileStartAndEndPresentFlag := false
 
 	if NumTiles > 1 {
-		tileStartAndEndPresentFlag = r.f(1) != 0
+		tileStartAndEndPresentFlag = r.named("tile_start_and_end_present_flag").f(1) != 0
 	}
 
 	var tgStart int
@@ -1613,8 +2551,8 @@ func tileGroup(sz int, r *Reader) {
 		tgStart = 0
 		tgEnd = NumTiles - 1
 	} else {
-		tgStart = r.f(TileColsLog2 + TileRowsLog2)
-		tgEnd = r.f(TileColsLog2 + TileRowsLog2)
+		tgStart = r.named("tg_start").f(TileColsLog2 + TileRowsLog2)
+		tgEnd = r.named("tg_end").f(TileColsLog2 + TileRowsLog2)
 	}
 
 	byteAlignment(r)
@@ -1624,6 +2562,18 @@ func tileGroup(sz int, r *Reader) {
 	headerBytes := (endBitPos - startBitPos) / 8
 	sz -= headerBytes
 
+	if headersOnly {
+		r.discard(sz)
+		if tgEnd == NumTiles-1 {
+			referenceFrameUpdate()
+			SeenFrameHeader = false
+			if frameHeaderSink != nil {
+				frameHeaderSink()
+			}
+		}
+		return
+	}
+
 	for TileNum = tgStart; TileNum <= tgEnd; TileNum++ {
 		tileRow := TileNum / TileCols
 		tileCol := TileNum % TileCols
@@ -1633,7 +2583,8 @@ func tileGroup(sz int, r *Reader) {
 		if lastTile {
 			tileSize = sz
 		} else {
-			tileSize = r.f(TileSizeBytes)
+			tileSizeMinusOne := r.named("tile_size_minus_1").le(TileSizeBytes)
+			tileSize = tileSizeMinusOne + 1
 			sz -= tileSize + TileSizeBytes
 		}
 
@@ -1646,12 +2597,82 @@ func tileGroup(sz int, r *Reader) {
 		decodeTile(r)
 	}
 
-	panic("tileGroup")
+	if tgEnd == NumTiles-1 {
+		if !uh.disableFrameEndUpdateCdf {
+			panic(notImplemented("frame_end_update_cdf"))
+		}
+
+		decodeFrameWrapup(r)
+		SeenFrameHeader = false
+		if frameHeaderSink != nil {
+			frameHeaderSink()
+		}
+	}
+}
+
+func decodeFrameWrapup(r *Reader) {
+	if uh.segmentationEnabled && !uh.segmentationUpdateMap {
+		for row := 0; row < MiRows; row++ {
+			copy(SegmentIds[row], PrevSegmentIds[row])
+		}
+	}
+
+	loopFilterProcess()
+	cdefProcess(r.options.Threads)
+	superresProcess()
+	lrProcess()
+	releasePostFilterFrames()
+	motionFieldMotionVectorStorage()
+	referenceFrameUpdate()
+
+	if uh.showFrame {
+		outputProcess(r)
+	}
+}
+
+func referenceFrameUpdate() {
+	displaced := make([]*Frame, 0, NUM_REF_FRAMES)
+	for i := 0; i < NUM_REF_FRAMES; i++ {
+		if (uh.refreshFrameFlags>>i)&1 == 1 {
+			RefValid[i] = 1
+			RefFrameId[i] = currentFrameId
+			RefUpscaledWidth[i] = UpscaledWidth
+			RefFrameWidth[i] = FrameWidth
+			RefFrameHeight[i] = FrameHeight
+			RefRenderWidth[i] = RenderWidth
+			RefRenderHeight[i] = RenderHeight
+			RefMiCols[i] = MiCols
+			RefMiRows[i] = MiRows
+			RefFrameType[i] = uh.frameType
+			RefOrderHint[i] = OrderHint
+
+			SavedOrderHints[i] = make([]int, len(OrderHints))
+			copy(SavedOrderHints[i], OrderHints)
+
+			SavedRefFrames[i] = MfRefFrames
+			SavedMvs[i] = MfMvs
+			RefFilmGrainParams[i] = uh.filmGrainParams
+			SavedLoopFilterRefDeltas[i] = uh.loopFilterParams.loopFilterRefDeltas
+			SavedLoopFilterModeDeltas[i] = uh.loopFilterParams.loopFilterModeDeltas
+			SavedFeatureEnabled[i] = FeatureEnabled
+			SavedFeatureData[i] = FeatureData
+			SavedSegmentIds[i] = SegmentIds
+			SavedGmParams[i] = uh.globalMotionParams.gmParams
+
+			displaced = append(displaced, FrameStore[i])
+			FrameStore[i] = CurrFrame
+			saveCdfs(i)
+		}
+	}
+
+	for _, f := range displaced {
+		releaseFrame(f)
+	}
 }
 
 func byteAlignment(r *Reader) {
 	for (r.bitIndex & 7) != 0 {
-		r.f(1)
+		r.named("zero_bit").f(1)
 	}
 }
 
@@ -1663,14 +2684,35 @@ func initSymbol(sz int, r *Reader) {
 	SymbolRange = 1 << 15
 	SymbolMaxBits = 8*sz - 15
 
-	log.Println("todo: tile copy of cdf arrays")
+	r.log().Warn("not implemented", "process", "tile copy of cdf arrays")
 }
 
 const FRAME_LF_COUNT = 4
 const WIENER_COEFFS = 3
 
-const BLOCK_128X128 = 15
+const BLOCK_4X4 = 0
+const BLOCK_4X8 = 1
+const BLOCK_8X4 = 2
+const BLOCK_8X8 = 3
+const BLOCK_8X16 = 4
+const BLOCK_16X8 = 5
+const BLOCK_16X16 = 6
+const BLOCK_16X32 = 7
+const BLOCK_32X16 = 8
+const BLOCK_32X32 = 9
+const BLOCK_32X64 = 10
+const BLOCK_64X32 = 11
 const BLOCK_64X64 = 12
+const BLOCK_64X128 = 13
+const BLOCK_128X64 = 14
+const BLOCK_128X128 = 15
+const BLOCK_4X16 = 16
+const BLOCK_16X4 = 17
+const BLOCK_8X32 = 18
+const BLOCK_32X8 = 19
+const BLOCK_16X64 = 20
+const BLOCK_64X16 = 21
+const BLOCK_INVALID = 22
 
 func decodeTile(r *Reader) {
 	clearAboveContext()
@@ -1704,45 +2746,47 @@ func decodeTile(r *Reader) {
 
 	sbSize4 := Num4x4BlocksWide[sbSize]
 
-	cdefIdx = make([][]int, MiRowEnd+Num4x4BlocksWide[BLOCK_64X64])
-	for r := MiRowStart; r < MiRowEnd; r += sbSize4 {
+	for row := MiRowStart; row < MiRowEnd; row += sbSize4 {
 		clearLeftContext()
 
-		for c := MiColStart; c < MiColEnd; c += sbSize4 {
+		for col := MiColStart; col < MiColEnd; col += sbSize4 {
 			ReadDeltas = uh.deltaQPresent
 
-			cdefIdx[r] = make([]int, c+Num4x4BlocksWide[BLOCK_64X64])
-			clearCdef(r, c)
-			clearBlockDecodedFlags(r, c, sbSize4)
-			readLr(r, c, sbSize)
+			clearCdef(row, col)
+			clearBlockDecodedFlags(row, col, sbSize4)
+			readLr(r, row, col, sbSize)
+
+			// decode_partition is not implemented, so no block of a
+			// stream is decoded yet. Mode info, motion vector prediction,
+			// inter and intra block copy prediction only run in tests
+			// until it is.
+			panic(notImplemented("decode_partition"))
 		}
 	}
-
-	panic("decodeTile")
 }
 
 func clearAboveContext() {
 	AboveLevelContext = make([][]int, 2)
 	AboveDcContext = make([][]int, 2)
-	AboveSegPredContext = make([][]int, 2)
 
 	for i := 0; i < 2; i++ {
 		AboveLevelContext[i] = make([]int, MiCols)
 		AboveDcContext[i] = make([]int, MiCols)
-		AboveSegPredContext[i] = make([]int, MiCols)
 	}
+
+	AboveSegPredContext = make([]int, MiCols)
 }
 
 func clearLeftContext() {
 	LeftLevelContext = make([][]int, 2)
 	LeftDcContext = make([][]int, 2)
-	LeftSegPredContext = make([][]int, 2)
 
 	for i := 0; i < 2; i++ {
 		LeftLevelContext[i] = make([]int, MiRows)
 		LeftDcContext[i] = make([]int, MiRows)
-		LeftSegPredContext[i] = make([]int, MiRows)
 	}
+
+	LeftSegPredContext = make([]int, MiRows)
 }
 
 func clearCdef(r int, c int) {
@@ -1791,7 +2835,7 @@ func clearBlockDecodedFlags(r int, c int, sbSize4 int) {
 
 const MI_SIZE = 4
 
-func readLr(r int, c int, bSize int) {
+func readLr(rd *Reader, r int, c int, bSize int) {
 	if uh.allowIntrabc {
 		return
 	}
@@ -1829,24 +2873,20 @@ func readLr(r int, c int, bSize int) {
 
 			for unitRow := unitRowStart; unitRow < unitRowEnd; unitRow++ {
 				for unitCol := unitColStart; unitCol < unitColEnd; unitCol++ {
-					readLrUnit(plane, unitRow, unitCol)
+					readLrUnit(rd, plane, unitRow, unitCol)
 				}
 			}
 		}
 	}
 }
 
-func readLrUnit(plane int, unitRow int, unitCol int) {
-	panic("readLrUnit")
-}
-
 func countUnitsInFrame(unitSize int, frameSize int) int {
 	return max((frameSize+(unitSize>>1))/unitSize, 1)
 }
 
 func round2(x int, n int) int {
 	if n == 0 {
-		return 0
+		return x
 	}
 
 	return (x + (1 << (n - 1))) >> n
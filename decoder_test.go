@@ -1,37 +1,411 @@
 package boulder
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// TestDecode decodes test10001 up to the first block, which is as far as
+// decoding goes without decode_partition, and checks the OBUs of each
+// temporal unit through Probe.
 func TestDecode(t *testing.T) {
-	decoder := NewDecoder()
-
 	filePath := "data/argon_coveragetool_av1_base_and_extended_profiles_v2.1/profile0_core/streams/test10001.obu"
-	result := decoder.Decode(filePath)
-
-	assert.Equal(t, 9, len(result.temporalUnits))
-
-	assert.Equal(t, 1, len(result.temporalUnits[0].frameUnits))
-	assert.Equal(t, 1, len(result.temporalUnits[1].frameUnits))
-	assert.Equal(t, 1, len(result.temporalUnits[2].frameUnits))
-	assert.Equal(t, 1, len(result.temporalUnits[3].frameUnits))
-	assert.Equal(t, 2, len(result.temporalUnits[4].frameUnits))
-	assert.Equal(t, 1, len(result.temporalUnits[5].frameUnits))
-	assert.Equal(t, 1, len(result.temporalUnits[6].frameUnits))
-	assert.Equal(t, 1, len(result.temporalUnits[7].frameUnits))
-	assert.Equal(t, 1, len(result.temporalUnits[8].frameUnits))
-
-	assert.Equal(t, 7, len(result.temporalUnits[0].frameUnits[0].obus))
-	assert.Equal(t, 6, len(result.temporalUnits[1].frameUnits[0].obus))
-	assert.Equal(t, 3, len(result.temporalUnits[2].frameUnits[0].obus))
-	assert.Equal(t, 4, len(result.temporalUnits[3].frameUnits[0].obus))
-	assert.Equal(t, 5, len(result.temporalUnits[4].frameUnits[0].obus))
-	assert.Equal(t, 2, len(result.temporalUnits[4].frameUnits[1].obus))
-	assert.Equal(t, 6, len(result.temporalUnits[5].frameUnits[0].obus))
-	assert.Equal(t, 2, len(result.temporalUnits[6].frameUnits[0].obus))
-	assert.Equal(t, 4, len(result.temporalUnits[7].frameUnits[0].obus))
-	assert.Equal(t, 2, len(result.temporalUnits[8].frameUnits[0].obus))
+
+	d := NewDecoder(Options{})
+	_, err := d.Decode(filePath)
+	assert.ErrorIs(t, err, ErrNotImplemented)
+
+	result, err := d.Probe(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, result.TemporalUnits)
+
+	obus := make([]int, result.TemporalUnits)
+	for _, obu := range result.OBUs {
+		obus[obu.TemporalUnit]++
+	}
+	assert.Equal(t, []int{7, 6, 3, 4, 5 + 2, 6, 2, 4, 2}, obus)
+}
+
+func TestDecodeMissingFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "missing.obu")
+
+	d := NewDecoder(Options{})
+	_, err := d.Decode(filePath)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = d.Probe(filePath)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestUncompressedHeaderKeyFrameResetsOrderHints(t *testing.T) {
+	sh = SequenceHeader{reducedStillPictureHeader: true}
+	defer func() { sh = SequenceHeader{} }()
+	for i := range OrderHints {
+		OrderHints[i] = 3
+	}
+
+	// Only the reset at the start of the header matters here; whatever
+	// the zero bits after it parse into is irrelevant.
+	func() {
+		defer func() { recover() }()
+		uncompressedHeader(&Reader{data: make([]byte, 64)})
+	}()
+
+	for i := 0; i < REFS_PER_FRAME; i++ {
+		assert.Equal(t, 0, OrderHints[LAST_FRAME+i], "OrderHints[%d]", LAST_FRAME+i)
+	}
+}
+
+func TestTileInfoNonUniform(t *testing.T) {
+	sh = SequenceHeader{}
+	MiCols = 80
+	MiRows = 48
+
+	// Columns of 2 and 3 superblocks, rows of 1 and 2, then
+	// context_update_tile_id and tile_size_bytes_minus_1.
+	r := Reader{data: bitsToBytes("0 01 11 0 1 10 11")}
+	contextUpdateTileId := tileInfo(&r)
+
+	assert.Equal(t, 2, TileCols)
+	assert.Equal(t, 1, TileColsLog2)
+	assert.Equal(t, []int{0, 32, 80}, MiColStarts[:TileCols+1])
+	assert.Equal(t, 2, TileRows)
+	assert.Equal(t, 1, TileRowsLog2)
+	assert.Equal(t, []int{0, 16, 48}, MiRowStarts[:TileRows+1])
+	assert.Equal(t, 2, contextUpdateTileId)
+	assert.Equal(t, 4, TileSizeBytes)
+	assert.Equal(t, 11, r.bitIndex)
+}
+
+// tileLayoutTracer collects the tile_info of every frame header from the
+// syntax elements it reads.
+type tileLayoutTracer struct {
+	sb128   bool
+	layouts []tileLayout
+}
+
+type tileLayout struct {
+	uniform bool
+	sb128   bool
+	widths  []int
+	heights []int
+}
+
+func (t *tileLayoutTracer) Element(name string, bitPos int, width int, value int) {
+	switch name {
+	case "use_128x128_superblock":
+		t.sb128 = value == 1
+	case "uniform_tile_spacing_flag":
+		t.layouts = append(t.layouts, tileLayout{uniform: value == 1, sb128: t.sb128})
+	case "width_in_sbs_minus_1":
+		l := &t.layouts[len(t.layouts)-1]
+		l.widths = append(l.widths, value+1)
+	case "height_in_sbs_minus_1":
+		l := &t.layouts[len(t.layouts)-1]
+		l.heights = append(l.heights, value+1)
+	}
+}
+
+// TestArgonTileInfoNonUniform probes every Argon stream and checks that the
+// explicit tile sizes of each frame header without uniform tile spacing
+// cover the frame and agree with its TileCols and TileRows.
+func TestArgonTileInfoNonUniform(t *testing.T) {
+	obuPaths := argonStreams(t)
+
+	total := func(sizes []int) int {
+		n := 0
+		for _, size := range sizes {
+			n += size
+		}
+		return n
+	}
+
+	found := false
+	for _, obuPath := range obuPaths {
+		tracer := &tileLayoutTracer{}
+		d := NewDecoder(Options{Tracer: tracer})
+		result, err := d.Probe(obuPath)
+		name := filepath.Base(obuPath)
+
+		var headers []*ProbeFrameHeader
+		var frames []ProbeFrame
+		for _, frame := range result.Frames {
+			if frame.Header != nil {
+				headers = append(headers, frame.Header)
+				frames = append(frames, frame)
+			}
+		}
+
+		nonUniform := false
+		for i, layout := range tracer.layouts {
+			if layout.uniform || i >= len(headers) {
+				continue
+			}
+			nonUniform = true
+
+			sbShift := 4
+			if layout.sb128 {
+				sbShift = 5
+			}
+			miCols := 2 * ((frames[i].FrameWidth + 7) >> 3)
+			miRows := 2 * ((frames[i].FrameHeight + 7) >> 3)
+			sbCols := (miCols + (1 << sbShift) - 1) >> sbShift
+			sbRows := (miRows + (1 << sbShift) - 1) >> sbShift
+
+			assert.Len(t, layout.widths, headers[i].TileCols, "%s frame %d", name, i)
+			assert.Len(t, layout.heights, headers[i].TileRows, "%s frame %d", name, i)
+			assert.Equal(t, sbCols, total(layout.widths), "%s frame %d", name, i)
+			assert.Equal(t, sbRows, total(layout.heights), "%s frame %d", name, i)
+		}
+
+		if nonUniform {
+			found = true
+			assert.NoError(t, err, name)
+		}
+	}
+
+	assert.True(t, found, "no Argon stream uses non-uniform tile spacing")
+}
+
+func TestSkipModeParams(t *testing.T) {
+	sh = SequenceHeader{enableOrderHint: true}
+	OrderHintBits = 7
+	OrderHint = 10
+	FrameIsIntra = false
+	refFrameIdx := []int{0, 1, 2, 3, 4, 5, 6}
+
+	// Nearest forward and backward references.
+	copy(RefOrderHint, []int{8, 6, 9, 12, 14, 5, 4})
+	r := Reader{data: bitsToBytes("1")}
+	params := skipModeParams(true, refFrameIdx, &r)
+	assert.True(t, params.skipModeAllowed)
+	assert.True(t, params.skipModePresent)
+	assert.Equal(t, [2]int{LAST_FRAME + 2, LAST_FRAME + 3}, params.skipModeFrame)
+
+	// Without a backward reference the two nearest forward ones are used.
+	copy(RefOrderHint, []int{8, 6, 9, 5, 4, 3, 2})
+	r = Reader{data: bitsToBytes("0")}
+	params = skipModeParams(true, refFrameIdx, &r)
+	assert.True(t, params.skipModeAllowed)
+	assert.False(t, params.skipModePresent)
+	assert.Equal(t, [2]int{LAST_FRAME, LAST_FRAME + 2}, params.skipModeFrame)
+
+	// A single forward reference does not allow skip mode.
+	copy(RefOrderHint, []int{9, 10, 10, 10, 10, 10, 10})
+	r = Reader{data: bitsToBytes("1")}
+	params = skipModeParams(true, refFrameIdx, &r)
+	assert.False(t, params.skipModeAllowed)
+	assert.Equal(t, 0, r.bitIndex)
+
+	params = skipModeParams(false, refFrameIdx, &r)
+	assert.False(t, params.skipModeAllowed)
+}
+
+func TestReplaceMissingRef(t *testing.T) {
+	sh = SequenceHeader{
+		maxFrameWidthMinusOne:  15,
+		maxFrameHeightMinusOne: 7,
+		colorConfig:            ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1},
+	}
+	RefValid[3] = 1
+	RefOrderHint[3] = 5
+
+	replaceMissingRef(3, 9)
+	defer func() { FrameStore[3] = nil }()
+
+	assert.Equal(t, 0, RefValid[3])
+	assert.Equal(t, 9, RefOrderHint[3])
+	assert.Equal(t, 16, RefFrameWidth[3])
+	assert.Equal(t, 8, RefFrameHeight[3])
+	assert.Equal(t, 4, RefMiCols[3])
+	assert.Equal(t, 2, RefMiRows[3])
+	assert.Equal(t, 128, FrameStore[3].Planes[0].At(15, 7))
+	assert.Equal(t, 128, FrameStore[3].Planes[2].At(7, 3))
+}
+
+func TestSetupPastIndependenceGmParams(t *testing.T) {
+	MiRows, MiCols = 1, 1
+	setupPastIndependence()
+
+	for ref := LAST_FRAME; ref <= ALTREF_FRAME; ref++ {
+		assert.Equal(t, []int{0, 0, 1 << WARPEDMODEL_PREC_BITS, 0, 0, 1 << WARPEDMODEL_PREC_BITS}, PrevGmParams[ref])
+	}
+}
+
+func TestGlobalMotionParams(t *testing.T) {
+	MiRows, MiCols = 1, 1
+	setupPastIndependence()
+	FrameIsIntra = false
+	defer func() {
+		for ref := range GmType {
+			GmType[ref] = IDENTITY
+		}
+	}()
+
+	// LAST_FRAME is a translation by (3, -2) at 1/4 pel, LAST2_FRAME a
+	// rotzoom equal to the identity and every other reference is IDENTITY.
+	bits := "101 0110 0011" + "11 0000 0000 0000 0000" + "00000"
+	r := Reader{data: bitsToBytes(bits)}
+	params := globalMotionParams(false, &r)
+
+	assert.Equal(t, 34, r.bitIndex)
+	assert.Equal(t, TRANSLATION, GmType[LAST_FRAME])
+	assert.Equal(t, []int{3 << 14, -2 << 14, 1 << WARPEDMODEL_PREC_BITS, 0, 0, 1 << WARPEDMODEL_PREC_BITS}, params.gmParams[LAST_FRAME])
+	assert.Equal(t, ROTZOOM, GmType[LAST2_FRAME])
+	assert.Equal(t, []int{0, 0, 1 << WARPEDMODEL_PREC_BITS, 0, 0, 1 << WARPEDMODEL_PREC_BITS}, params.gmParams[LAST2_FRAME])
+	assert.True(t, params.warpValid[LAST2_FRAME])
+	assert.Equal(t, IDENTITY, GmType[ALTREF_FRAME])
+}
+
+func TestColorConfigHighBitdepth(t *testing.T) {
+	// high_bitdepth alone selects 10 bits outside of profile 2, without a
+	// twelve_bit flag.
+	r := Reader{data: bitsToBytes("1 0 0000000 00000000 00000000 00000000")}
+	colorConfig(&r, 0)
+	assert.Equal(t, 10, BitDepth)
+}
+
+func TestColorConfigColorDescription(t *testing.T) {
+	// BT.2020 primaries and matrix with PQ transfer, full range and
+	// colocated chroma samples.
+	r := Reader{data: bitsToBytes("0 0 1 00001001 00010000 00001001 1 10 0")}
+	cc := colorConfig(&r, 0)
+	assert.Equal(t, CP_BT_2020, cc.colorPrimaries)
+	assert.Equal(t, 16, cc.transferCharacteristics)
+	assert.Equal(t, 9, cc.matrixCoefficients)
+	assert.Equal(t, 1, cc.colorRange)
+	assert.Equal(t, 2, cc.chromaSamplePosition)
+	assert.Equal(t, 31, r.bitIndex)
+
+	// Without a color description everything is unspecified.
+	r = Reader{data: bitsToBytes("0 0 0 0 01 0")}
+	cc = colorConfig(&r, 0)
+	assert.Equal(t, CP_UNSPECIFIED, cc.colorPrimaries)
+	assert.Equal(t, TC_UNSPECIFIED, cc.transferCharacteristics)
+	assert.Equal(t, MC_UNSPECIFIED, cc.matrixCoefficients)
+	assert.Equal(t, 0, cc.colorRange)
+	assert.Equal(t, 1, cc.chromaSamplePosition)
+	assert.Equal(t, 7, r.bitIndex)
+}
+
+func TestSequenceHeaderWithoutTimingInfo(t *testing.T) {
+	// Two operating points and no timing info, so no
+	// decoder_model_info_present_flag, then a 16x16 frame size with order
+	// hints of 7 bits.
+	bits := "000 0 0 0 0 00001" +
+		"000000000000 00100" + "000000000000 00100" +
+		"0011 0011 1111 1111" +
+		"0 0 0 0" + "0000 1 00" + "1 1 110" + "000" +
+		"0 0 0 1 10 0" + "1"
+	r := Reader{data: bitsToBytes(bits)}
+	seqHeader := sequenceHeader(&r)
+
+	assert.Equal(t, 15, seqHeader.maxFrameWidthMinusOne)
+	assert.Equal(t, 15, seqHeader.maxFrameHeightMinusOne)
+	assert.True(t, seqHeader.enableOrderHint)
+	assert.Equal(t, 7, OrderHintBits)
+	assert.Equal(t, 1, seqHeader.colorConfig.colorRange)
+	assert.True(t, seqHeader.filmGrainParamsPresent)
+	assert.Equal(t, 89, r.bitIndex)
+}
+
+func TestSetFrameRefs(t *testing.T) {
+	sh = SequenceHeader{enableOrderHint: true}
+	OrderHintBits = 7
+	OrderHint = 10
+	defer func() { OrderHintBits, OrderHint = 0, 0 }()
+
+	defer copy(RefOrderHint, make([]int, NUM_REF_FRAMES))
+
+	copy(RefOrderHint, []int{8, 9, 6, 12, 14, 4, 11, 2})
+	assert.Equal(t, []int{1, 0, 5, 2, 6, 3, 4}, setFrameRefs(1, 2, &Reader{}))
+
+	// Without backward references the remaining slots are used latest
+	// first.
+	copy(RefOrderHint, []int{1, 2, 3, 4, 5, 6, 7, 8})
+	assert.Equal(t, []int{7, 6, 5, 0, 4, 3, 2}, setFrameRefs(7, 0, &Reader{}))
+
+	RefOrderHint[0] = 12
+	assert.Panics(t, func() { setFrameRefs(7, 0, &Reader{}) })
+}
+
+func TestDecoderLogger(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewDecoder(Options{
+		Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+
+	_, err := d.Probe(writeProbeStream(t))
+	assert.NoError(t, err)
+
+	var records []map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var record map[string]any
+		assert.NoError(t, dec.Decode(&record))
+		records = append(records, record)
+	}
+
+	var obus []map[string]any
+	for _, record := range records {
+		assert.Contains(t, record, "tu")
+		if record["msg"] == "obu" {
+			obus = append(obus, record)
+		}
+	}
+	if assert.Len(t, obus, 10) {
+		assert.Equal(t, map[string]any{
+			"time": obus[0]["time"], "level": "DEBUG", "msg": "obu",
+			"tu": 0.0, "obu_offset": 3.0, "type": float64(OBU_TEMPORAL_DELIMITER),
+			"size": 0.0, "temporal_id": 0.0, "spatial_id": 0.0,
+		}, obus[0])
+		assert.Equal(t, 2.0, obus[8]["tu"])
+		assert.Equal(t, 2.0, obus[8]["temporal_id"])
+	}
+
+	assert.Equal(t, "sequence header", records[3]["msg"])
+	assert.Equal(t, 8.0, records[3]["bit_depth"])
+}
+
+func TestDecoderLoggerSilentByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	d := NewDecoder(Options{})
+	_, err := d.Probe(writeProbeStream(t))
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
+
+func TestResetDecoderState(t *testing.T) {
+	OperatingPointIdc = 0x101
+	SeenFrameHeader = true
+	RefValid[3] = 1
+	FrameStore[3] = NewFrame(16, 16, ColorConfig{bitDepth: 8})
+	heldFrame = FrameStore[3]
+	headersOnly = true
+
+	resetDecoderState()
+
+	assert.Equal(t, 0, OperatingPointIdc)
+	assert.False(t, SeenFrameHeader)
+	assert.Equal(t, make([]int, NUM_REF_FRAMES), RefValid)
+	assert.Nil(t, FrameStore[3])
+	assert.Nil(t, heldFrame)
+	assert.False(t, headersOnly)
+}
+
+func TestDecodeNotImplemented(t *testing.T) {
+	d := NewDecoder(Options{})
+	result, err := d.Decode(writeProbeStream(t))
+	assert.ErrorIs(t, err, ErrNotImplemented)
+	assert.EqualError(t, err, "decode: temporal unit 0: not implemented: decode_partition")
+	assert.Empty(t, result.temporalUnits)
 }
@@ -0,0 +1,427 @@
+package boulder
+
+import "math"
+
+const GAUSSIAN_SEQUENCE_SIZE = 2048
+
+// GaussianSequence stands in for the normative Gaussian_Sequence table of
+// the spec: 2048 zero mean samples with a standard deviation of about 512,
+// quantised to multiples of 4 like the original. Grain produced with it has
+// the intended statistics but is not bit exact with other decoders until
+// the spec table is transcribed here.
+var GaussianSequence = initialiseGaussianSequence()
+
+var (
+	RandomRegister int
+	GrainCenter    int
+	GrainMin       int
+	GrainMax       int
+	ScalingShift   int
+
+	LumaGrain  [73][82]int
+	CbGrain    [73][82]int
+	CrGrain    [73][82]int
+	ScalingLut [3][256]int
+)
+
+func initialiseGaussianSequence() [GAUSSIAN_SEQUENCE_SIZE]int {
+	var seq [GAUSSIAN_SEQUENCE_SIZE]int
+
+	// Inverse CDF sampling at evenly spaced quantiles, interleaved by a
+	// fixed stride so that neighbouring entries are uncorrelated.
+	for i := 0; i < GAUSSIAN_SEQUENCE_SIZE; i++ {
+		q := (float64(i) + 0.5) / GAUSSIAN_SEQUENCE_SIZE
+		v := 512 * math.Sqrt2 * math.Erfinv(2*q-1)
+		v = math.Max(-2048, math.Min(2044, 4*math.Round(v/4)))
+		seq[(i*1237)%GAUSSIAN_SEQUENCE_SIZE] = int(v)
+	}
+
+	return seq
+}
+
+func getRandomNumber(bits int) int {
+	r := RandomRegister
+	bit := ((r >> 0) ^ (r >> 1) ^ (r >> 3) ^ (r >> 12)) & 1
+	r = (r >> 1) | (bit << 15)
+	result := (r >> (16 - bits)) & ((1 << bits) - 1)
+	RandomRegister = r
+
+	return result
+}
+
+// filmGrainSynthesis returns a copy of frame, w x h luma samples of which
+// carry grain synthesised from params.
+func filmGrainSynthesis(frame *Frame, params FilmGrainParams, w int, h int) *Frame {
+	subX := sh.colorConfig.subsamplingX
+	subY := sh.colorConfig.subsamplingY
+
+	RandomRegister = params.grainSeed
+	GrainCenter = 128 << (BitDepth - 8)
+	GrainMin = -GrainCenter
+	GrainMax = (256 << (BitDepth - 8)) - 1 - GrainCenter
+
+	generateGrain(params, subX, subY)
+	scalingLookupInit(params)
+
+	out := framePool.Get(frame.Width, frame.Height, sh.colorConfig)
+	out.CopyFrom(frame)
+	addNoise(out, params, w, h, subX, subY)
+
+	return out
+}
+
+func generateGrain(params FilmGrainParams, subX int, subY int) {
+	shift := 12 - BitDepth + params.grainScaleShift
+	for y := 0; y < 73; y++ {
+		for x := 0; x < 82; x++ {
+			g := 0
+			if params.numYPoints > 0 {
+				g = GaussianSequence[getRandomNumber(11)]
+			}
+			LumaGrain[y][x] = round2(g, shift)
+		}
+	}
+
+	shift = params.arCoeffShiftMinus6 + 6
+	for y := 3; y < 73; y++ {
+		for x := 3; x < 82-3; x++ {
+			sum := 0
+			pos := 0
+			for deltaRow := -params.arCoeffLag; deltaRow <= 0; deltaRow++ {
+				for deltaCol := -params.arCoeffLag; deltaCol <= params.arCoeffLag; deltaCol++ {
+					if deltaRow == 0 && deltaCol == 0 {
+						break
+					}
+					c := params.arCoeffsYPlus128[pos] - 128
+					sum += LumaGrain[y+deltaRow][x+deltaCol] * c
+					pos++
+				}
+			}
+			LumaGrain[y][x] = clip3(GrainMin, GrainMax, LumaGrain[y][x]+round2(sum, shift))
+		}
+	}
+
+	if sh.colorConfig.monoChrome {
+		return
+	}
+
+	chromaW := 82
+	if subX != 0 {
+		chromaW = 44
+	}
+	chromaH := 73
+	if subY != 0 {
+		chromaH = 38
+	}
+
+	shift = 12 - BitDepth + params.grainScaleShift
+	RandomRegister = params.grainSeed ^ 0xb524
+	for y := 0; y < chromaH; y++ {
+		for x := 0; x < chromaW; x++ {
+			g := 0
+			if params.numCbPoints != 0 || params.chromaScalingFromLuma {
+				g = GaussianSequence[getRandomNumber(11)]
+			}
+			CbGrain[y][x] = round2(g, shift)
+		}
+	}
+
+	RandomRegister = params.grainSeed ^ 0x49d8
+	for y := 0; y < chromaH; y++ {
+		for x := 0; x < chromaW; x++ {
+			g := 0
+			if params.numCrPoints != 0 || params.chromaScalingFromLuma {
+				g = GaussianSequence[getRandomNumber(11)]
+			}
+			CrGrain[y][x] = round2(g, shift)
+		}
+	}
+
+	shift = params.arCoeffShiftMinus6 + 6
+	for y := 3; y < chromaH; y++ {
+		for x := 3; x < chromaW-3; x++ {
+			sum0 := 0
+			sum1 := 0
+			pos := 0
+			for deltaRow := -params.arCoeffLag; deltaRow <= 0; deltaRow++ {
+				for deltaCol := -params.arCoeffLag; deltaCol <= params.arCoeffLag; deltaCol++ {
+					c0 := params.arCoeffsCbPlus128[pos] - 128
+					c1 := params.arCoeffsCrPlus128[pos] - 128
+
+					if deltaRow == 0 && deltaCol == 0 {
+						if params.numYPoints > 0 {
+							luma := 0
+							lumaX := ((x - 3) << subX) + 3
+							lumaY := ((y - 3) << subY) + 3
+							for i := 0; i <= subY; i++ {
+								for j := 0; j <= subX; j++ {
+									luma += LumaGrain[lumaY+i][lumaX+j]
+								}
+							}
+							luma = round2(luma, subX+subY)
+							sum0 += luma * c0
+							sum1 += luma * c1
+						}
+						break
+					}
+
+					sum0 += c0 * CbGrain[y+deltaRow][x+deltaCol]
+					sum1 += c1 * CrGrain[y+deltaRow][x+deltaCol]
+					pos++
+				}
+			}
+			CbGrain[y][x] = clip3(GrainMin, GrainMax, CbGrain[y][x]+round2(sum0, shift))
+			CrGrain[y][x] = clip3(GrainMin, GrainMax, CrGrain[y][x]+round2(sum1, shift))
+		}
+	}
+}
+
+func scalingLookupInit(params FilmGrainParams) {
+	for plane := 0; plane < NumPlanes; plane++ {
+		var numPoints int
+		var value, scaling []int
+		if plane == 0 || params.chromaScalingFromLuma {
+			numPoints, value, scaling = params.numYPoints, params.pointYValue, params.pointYScaling
+		} else if plane == 1 {
+			numPoints, value, scaling = params.numCbPoints, params.pointCbValue, params.pointCbScaling
+		} else {
+			numPoints, value, scaling = params.numCrPoints, params.pointCrValue, params.pointCrScaling
+		}
+
+		if numPoints == 0 {
+			for x := 0; x < 256; x++ {
+				ScalingLut[plane][x] = 0
+			}
+			continue
+		}
+
+		for x := 0; x < value[0]; x++ {
+			ScalingLut[plane][x] = scaling[0]
+		}
+
+		for i := 0; i < numPoints-1; i++ {
+			deltaY := scaling[i+1] - scaling[i]
+			deltaX := value[i+1] - value[i]
+			delta := deltaY * ((65536 + (deltaX >> 1)) / deltaX)
+			for x := 0; x < deltaX; x++ {
+				v := scaling[i] + ((x*delta + 32768) >> 16)
+				ScalingLut[plane][value[i]+x] = v
+			}
+		}
+
+		for x := value[numPoints-1]; x < 256; x++ {
+			ScalingLut[plane][x] = scaling[numPoints-1]
+		}
+	}
+}
+
+func scaleLut(plane int, index int) int {
+	shift := BitDepth - 8
+	x := index >> shift
+	rem := index - (x << shift)
+
+	if BitDepth == 8 || x == 255 {
+		return ScalingLut[plane][x]
+	}
+
+	start := ScalingLut[plane][x]
+	end := ScalingLut[plane][x+1]
+	return start + round2((end-start)*rem, shift)
+}
+
+func addNoise(out *Frame, params FilmGrainParams, w int, h int, subX int, subY int) {
+	noiseImage := noiseImage(params, w, h, subX, subY)
+
+	var minValue, maxLuma, maxChroma int
+	if params.clipToRestrictedRange {
+		minValue = 16 << (BitDepth - 8)
+		maxLuma = 235 << (BitDepth - 8)
+		if sh.colorConfig.matrixCoefficients == MC_IDENTITY {
+			maxChroma = maxLuma
+		} else {
+			maxChroma = 240 << (BitDepth - 8)
+		}
+	} else {
+		minValue = 0
+		maxLuma = (256 << (BitDepth - 8)) - 1
+		maxChroma = maxLuma
+	}
+
+	ScalingShift = params.grainScalingMinus8 + 8
+
+	outY := &out.Planes[0]
+
+	if NumPlanes > 1 {
+		outU := &out.Planes[1]
+		outV := &out.Planes[2]
+
+		for y := 0; y < (h+subY)>>subY; y++ {
+			for x := 0; x < (w+subX)>>subX; x++ {
+				lumaX := x << subX
+				lumaY := y << subY
+				lumaNextX := min(lumaX+1, w-1)
+
+				var averageLuma int
+				if subX != 0 {
+					averageLuma = round2(outY.At(lumaX, lumaY)+outY.At(lumaNextX, lumaY), 1)
+				} else {
+					averageLuma = outY.At(lumaX, lumaY)
+				}
+
+				if params.numCbPoints > 0 || params.chromaScalingFromLuma {
+					orig := outU.At(x, y)
+					merged := averageLuma
+					if !params.chromaScalingFromLuma {
+						combined := averageLuma*(params.cbLumaMult-128) + orig*(params.cbMult-128)
+						merged = clip1((combined >> 6) + ((params.cbOffset - 256) << (BitDepth - 8)))
+					}
+					noise := noiseImage[1][y][x]
+					noise = round2(scaleLut(1, merged)*noise, ScalingShift)
+					outU.Set(x, y, clip3(minValue, maxChroma, orig+noise))
+				}
+
+				if params.numCrPoints > 0 || params.chromaScalingFromLuma {
+					orig := outV.At(x, y)
+					merged := averageLuma
+					if !params.chromaScalingFromLuma {
+						combined := averageLuma*(params.crLumaMult-128) + orig*(params.crMult-128)
+						merged = clip1((combined >> 6) + ((params.crOffset - 256) << (BitDepth - 8)))
+					}
+					noise := noiseImage[2][y][x]
+					noise = round2(scaleLut(2, merged)*noise, ScalingShift)
+					outV.Set(x, y, clip3(minValue, maxChroma, orig+noise))
+				}
+			}
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			orig := outY.At(x, y)
+			noise := noiseImage[0][y][x]
+			noise = round2(scaleLut(0, orig)*noise, ScalingShift)
+			if params.numYPoints > 0 {
+				outY.Set(x, y, clip3(minValue, maxLuma, orig+noise))
+			}
+		}
+	}
+}
+
+// noiseImage assembles the grain templates into 32 luma row stripes of
+// randomly offset 32x32 blocks, blending the overlaps when requested.
+func noiseImage(params FilmGrainParams, w int, h int, subX int, subY int) [3][][]int {
+	numStripes := ((h+1)/2 + 15) / 16
+	stripeW := ((w+1)/2+15)/16*32 + 34
+
+	noiseStripe := make([][3][][]int, numStripes)
+	for lumaNum := range noiseStripe {
+		for plane := 0; plane < NumPlanes; plane++ {
+			noiseStripe[lumaNum][plane] = make([][]int, 34)
+			for i := range noiseStripe[lumaNum][plane] {
+				noiseStripe[lumaNum][plane][i] = make([]int, stripeW)
+			}
+		}
+	}
+
+	lumaNum := 0
+	for y := 0; y < (h+1)/2; y += 16 {
+		RandomRegister = params.grainSeed
+		RandomRegister ^= ((lumaNum*37 + 178) & 255) << 8
+		RandomRegister ^= (lumaNum*173 + 105) & 255
+
+		for x := 0; x < (w+1)/2; x += 16 {
+			rand := getRandomNumber(8)
+			offsetX := rand >> 4
+			offsetY := rand & 15
+
+			for plane := 0; plane < NumPlanes; plane++ {
+				planeSubX, planeSubY := 0, 0
+				if plane > 0 {
+					planeSubX, planeSubY = subX, subY
+				}
+
+				planeOffsetX := 9 + offsetX*2
+				if planeSubX != 0 {
+					planeOffsetX = 6 + offsetX
+				}
+				planeOffsetY := 9 + offsetY*2
+				if planeSubY != 0 {
+					planeOffsetY = 6 + offsetY
+				}
+
+				stripe := noiseStripe[lumaNum][plane]
+				for i := 0; i < (34 >> planeSubY); i++ {
+					for j := 0; j < (34 >> planeSubX); j++ {
+						var g int
+						switch plane {
+						case 0:
+							g = LumaGrain[planeOffsetY+i][planeOffsetX+j]
+						case 1:
+							g = CbGrain[planeOffsetY+i][planeOffsetX+j]
+						default:
+							g = CrGrain[planeOffsetY+i][planeOffsetX+j]
+						}
+
+						if planeSubX == 0 {
+							if j < 2 && params.overlapFlag && x > 0 {
+								old := stripe[i][x*2+j]
+								if j == 0 {
+									g = old*27 + g*17
+								} else {
+									g = old*17 + g*27
+								}
+								g = clip3(GrainMin, GrainMax, round2(g, 5))
+							}
+							stripe[i][x*2+j] = g
+						} else {
+							if j == 0 && params.overlapFlag && x > 0 {
+								old := stripe[i][x+j]
+								g = old*23 + g*22
+								g = clip3(GrainMin, GrainMax, round2(g, 5))
+							}
+							stripe[i][x+j] = g
+						}
+					}
+				}
+			}
+		}
+		lumaNum++
+	}
+
+	var noise [3][][]int
+	for plane := 0; plane < NumPlanes; plane++ {
+		planeSubX, planeSubY := 0, 0
+		if plane > 0 {
+			planeSubX, planeSubY = subX, subY
+		}
+
+		noise[plane] = make([][]int, (h+planeSubY)>>planeSubY)
+		for y := range noise[plane] {
+			noise[plane][y] = make([]int, (w+planeSubX)>>planeSubX)
+
+			lumaNum := y >> (5 - planeSubY)
+			i := y - (lumaNum << (5 - planeSubY))
+			for x := range noise[plane][y] {
+				g := noiseStripe[lumaNum][plane][i][x]
+				if planeSubY == 0 {
+					if i < 2 && lumaNum > 0 && params.overlapFlag {
+						old := noiseStripe[lumaNum-1][plane][i+32][x]
+						if i == 0 {
+							g = old*27 + g*17
+						} else {
+							g = old*17 + g*27
+						}
+						g = clip3(GrainMin, GrainMax, round2(g, 5))
+					}
+				} else if i < 1 && lumaNum > 0 && params.overlapFlag {
+					old := noiseStripe[lumaNum-1][plane][i+16][x]
+					g = old*23 + g*22
+					g = clip3(GrainMin, GrainMax, round2(g, 5))
+				}
+				noise[plane][y][x] = g
+			}
+		}
+	}
+
+	return noise
+}
@@ -0,0 +1,113 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupFilmGrainTest(t *testing.T) {
+	saveGlobals(t, &sh, &uh, &BitDepth, &OperatingPointIdc, &NumPlanes, &CurrFrame,
+		&UpscaledWidth, &FrameHeight, &RandomRegister, &GrainCenter, &GrainMin,
+		&GrainMax, &ScalingShift, &LumaGrain, &CbGrain, &CrGrain, &ScalingLut)
+
+	sh = SequenceHeader{colorConfig: ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1}}
+	uh = UncompressedHeader{}
+	BitDepth = 8
+	OperatingPointIdc = 0
+	NumPlanes = 3
+	CurrFrame = NewFrame(64, 48, sh.colorConfig)
+	for plane := 0; plane < NumPlanes; plane++ {
+		p := &CurrFrame.Planes[plane]
+		for y := 0; y < p.Height; y++ {
+			for x := 0; x < p.Width; x++ {
+				p.Set(x, y, 128)
+			}
+		}
+	}
+}
+
+func grainParams() FilmGrainParams {
+	return FilmGrainParams{
+		applyGrain:            true,
+		grainSeed:             1234,
+		numYPoints:            2,
+		pointYValue:           []int{0, 255},
+		pointYScaling:         []int{64, 64},
+		chromaScalingFromLuma: true,
+		arCoeffLag:            1,
+		arCoeffsYPlus128:      []int{128, 128, 128, 140},
+		arCoeffsCbPlus128:     []int{128, 128, 128, 128, 128},
+		arCoeffsCrPlus128:     []int{128, 128, 128, 128, 128},
+		overlapFlag:           true,
+		clipToRestrictedRange: true,
+	}
+}
+
+func TestGetRandomNumber(t *testing.T) {
+	saveGlobals(t, &RandomRegister)
+	RandomRegister = 1
+	assert.Equal(t, 128, getRandomNumber(8))
+	assert.Equal(t, 32768, RandomRegister)
+}
+
+func TestGaussianSequence(t *testing.T) {
+	sum := 0
+	for _, v := range GaussianSequence {
+		assert.Zero(t, v%4)
+		assert.True(t, v >= -2048 && v < 2048)
+		sum += v
+	}
+	assert.InDelta(t, 0, sum/GAUSSIAN_SEQUENCE_SIZE, 4)
+}
+
+func TestScalingLookupInit(t *testing.T) {
+	saveGlobals(t, &NumPlanes, &BitDepth, &ScalingLut)
+	NumPlanes = 1
+	BitDepth = 8
+	scalingLookupInit(FilmGrainParams{
+		numYPoints:    2,
+		pointYValue:   []int{64, 192},
+		pointYScaling: []int{20, 84},
+	})
+
+	assert.Equal(t, 20, ScalingLut[0][0])
+	assert.Equal(t, 20, ScalingLut[0][64])
+	assert.Equal(t, 52, ScalingLut[0][128])
+	assert.Equal(t, 53, ScalingLut[0][129])
+	assert.Equal(t, 84, ScalingLut[0][255])
+
+	assert.Equal(t, 52, scaleLut(0, 128))
+	BitDepth = 10
+	assert.Equal(t, 53, scaleLut(0, 4*128+2))
+}
+
+func TestFilmGrainSynthesis(t *testing.T) {
+	setupFilmGrainTest(t)
+	params := grainParams()
+
+	out := filmGrainSynthesis(CurrFrame, params, 64, 48)
+	again := filmGrainSynthesis(CurrFrame, params, 64, 48)
+
+	changed := 0
+	for plane := 0; plane < NumPlanes; plane++ {
+		p := &out.Planes[plane]
+		for y := 0; y < p.Height; y++ {
+			for x := 0; x < p.Width; x++ {
+				v := p.At(x, y)
+				assert.Equal(t, again.Planes[plane].At(x, y), v)
+				assert.GreaterOrEqual(t, v, 16)
+				if plane == 0 {
+					assert.LessOrEqual(t, v, 235)
+				} else {
+					assert.LessOrEqual(t, v, 240)
+				}
+				if v != 128 {
+					changed++
+				}
+			}
+		}
+	}
+	assert.Greater(t, changed, 0)
+	assert.Equal(t, 128, CurrFrame.Planes[0].At(10, 10))
+}
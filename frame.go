@@ -0,0 +1,262 @@
+package boulder
+
+import (
+	"slices"
+	"sync"
+)
+
+// FRAME_BORDER is the number of luma samples every plane is padded with on
+// each side. Chroma planes use the border shifted by their subsampling in
+// each direction.
+const FRAME_BORDER = 64
+
+// MAX_FREE_FRAMES bounds the number of released frames a FramePool keeps.
+const MAX_FREE_FRAMES = 16
+
+// Plane is a single color plane of a Frame. Samples are stored row by row
+// with Stride elements per row, offset by BorderY rows and BorderX columns
+// so that coordinates in [-BorderX, Width+BorderX) x [-BorderY,
+// Height+BorderY) are addressable.
+type Plane struct {
+	Width   int
+	Height  int
+	Stride  int
+	BorderX int
+	BorderY int
+
+	// Pix8 holds the samples of 8-bit frames, Pix16 the samples of 10 and
+	// 12-bit frames. Only one of them is allocated.
+	Pix8  []uint8
+	Pix16 []uint16
+}
+
+func newPlane(width int, height int, borderX int, borderY int, highBitDepth bool) Plane {
+	stride := width + 2*borderX
+	size := stride * (height + 2*borderY)
+
+	p := Plane{
+		Width:   width,
+		Height:  height,
+		Stride:  stride,
+		BorderX: borderX,
+		BorderY: borderY,
+	}
+
+	if highBitDepth {
+		p.Pix16 = make([]uint16, size)
+	} else {
+		p.Pix8 = make([]uint8, size)
+	}
+
+	return p
+}
+
+func (p *Plane) offset(x int, y int) int {
+	return (y+p.BorderY)*p.Stride + x + p.BorderX
+}
+
+// At returns the sample at (x, y). Coordinates may reach into the border.
+func (p *Plane) At(x int, y int) int {
+	if p.Pix16 != nil {
+		return int(p.Pix16[p.offset(x, y)])
+	}
+
+	return int(p.Pix8[p.offset(x, y)])
+}
+
+// Set stores v at (x, y). Coordinates may reach into the border.
+func (p *Plane) Set(x int, y int, v int) {
+	if p.Pix16 != nil {
+		p.Pix16[p.offset(x, y)] = uint16(v)
+	} else {
+		p.Pix8[p.offset(x, y)] = uint8(v)
+	}
+}
+
+// Row8 returns the visible samples of row y of an 8-bit plane.
+func (p *Plane) Row8(y int) []uint8 {
+	o := p.offset(0, y)
+	return p.Pix8[o : o+p.Width]
+}
+
+// Row16 returns the visible samples of row y of a high bit depth plane.
+func (p *Plane) Row16(y int) []uint16 {
+	o := p.offset(0, y)
+	return p.Pix16[o : o+p.Width]
+}
+
+// ExtendBorders replicates the outermost visible samples into the border.
+func (p *Plane) ExtendBorders() {
+	for y := 0; y < p.Height; y++ {
+		left := p.At(0, y)
+		right := p.At(p.Width-1, y)
+		for x := 1; x <= p.BorderX; x++ {
+			p.Set(-x, y, left)
+			p.Set(p.Width-1+x, y, right)
+		}
+	}
+
+	top := p.offset(-p.BorderX, 0)
+	bottom := p.offset(-p.BorderX, p.Height-1)
+	for y := 1; y <= p.BorderY; y++ {
+		above := p.offset(-p.BorderX, -y)
+		below := p.offset(-p.BorderX, p.Height-1+y)
+		if p.Pix16 != nil {
+			copy(p.Pix16[above:above+p.Stride], p.Pix16[top:top+p.Stride])
+			copy(p.Pix16[below:below+p.Stride], p.Pix16[bottom:bottom+p.Stride])
+		} else {
+			copy(p.Pix8[above:above+p.Stride], p.Pix8[top:top+p.Stride])
+			copy(p.Pix8[below:below+p.Stride], p.Pix8[bottom:bottom+p.Stride])
+		}
+	}
+}
+
+// Frame holds the Y, U and V planes of a frame. Monochrome frames only
+// have a luma plane.
+type Frame struct {
+	Width        int
+	Height       int
+	BitDepth     int
+	NumPlanes    int
+	SubsamplingX int
+	SubsamplingY int
+	Planes       [3]Plane
+
+	// RenderWidth and RenderHeight are the render size signalled for the
+	// frame, which may be smaller than its decoded size. They equal Width
+	// and Height until the frame is output.
+	RenderWidth  int
+	RenderHeight int
+
+	// The color description signalled in the sequence header, using the
+	// values of the AV1 color_config syntax.
+	ColorPrimaries          int
+	TransferCharacteristics int
+	MatrixCoefficients      int
+	FullRange               bool
+	ChromaSamplePosition    int
+}
+
+// NewFrame allocates a frame of the given luma dimensions whose bit depth,
+// plane count and chroma subsampling follow cc.
+func NewFrame(width int, height int, cc ColorConfig) *Frame {
+	f := &Frame{
+		Width:        width,
+		Height:       height,
+		BitDepth:     cc.bitDepth,
+		NumPlanes:    3,
+		SubsamplingX: cc.subsamplingX,
+		SubsamplingY: cc.subsamplingY,
+		RenderWidth:  width,
+		RenderHeight: height,
+	}
+
+	if cc.monoChrome {
+		f.NumPlanes = 1
+	}
+	f.setColorDescription(cc)
+
+	for plane := 0; plane < f.NumPlanes; plane++ {
+		subX := 0
+		subY := 0
+		if plane > 0 {
+			subX = f.SubsamplingX
+			subY = f.SubsamplingY
+		}
+
+		f.Planes[plane] = newPlane(
+			(width+subX)>>subX,
+			(height+subY)>>subY,
+			FRAME_BORDER>>subX,
+			FRAME_BORDER>>subY,
+			f.BitDepth > 8,
+		)
+	}
+
+	return f
+}
+
+// ExtendBorders pads every plane with its edge samples.
+func (f *Frame) ExtendBorders() {
+	for plane := 0; plane < f.NumPlanes; plane++ {
+		f.Planes[plane].ExtendBorders()
+	}
+}
+
+// CopyFrom overwrites the samples of f, borders included, with those of src.
+// Both frames must have the same geometry.
+func (f *Frame) CopyFrom(src *Frame) {
+	for plane := 0; plane < f.NumPlanes; plane++ {
+		copy(f.Planes[plane].Pix8, src.Planes[plane].Pix8)
+		copy(f.Planes[plane].Pix16, src.Planes[plane].Pix16)
+	}
+}
+
+func (f *Frame) setColorDescription(cc ColorConfig) {
+	f.ColorPrimaries = cc.colorPrimaries
+	f.TransferCharacteristics = cc.transferCharacteristics
+	f.MatrixCoefficients = cc.matrixCoefficients
+	f.FullRange = cc.colorRange == 1
+	f.ChromaSamplePosition = cc.chromaSamplePosition
+}
+
+func (f *Frame) matches(width int, height int, cc ColorConfig) bool {
+	numPlanes := 3
+	if cc.monoChrome {
+		numPlanes = 1
+	}
+
+	return f.Width == width &&
+		f.Height == height &&
+		f.BitDepth == cc.bitDepth &&
+		f.NumPlanes == numPlanes &&
+		f.SubsamplingX == cc.subsamplingX &&
+		f.SubsamplingY == cc.subsamplingY
+}
+
+// FramePool recycles frames between temporal units so that steady state
+// decoding does not allocate sample buffers. It keeps at most
+// MAX_FREE_FRAMES released frames, dropping the ones released longest ago
+// first, so that frames of a size no longer decoded are not kept forever.
+type FramePool struct {
+	mu   sync.Mutex
+	free []*Frame
+}
+
+func NewFramePool() *FramePool {
+	return &FramePool{}
+}
+
+// Get returns a frame with the requested geometry, reusing a previously
+// released one if possible. The sample contents are undefined.
+func (p *FramePool) Get(width int, height int, cc ColorConfig) *Frame {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, f := range p.free {
+		if f.matches(width, height, cc) {
+			p.free = slices.Delete(p.free, i, i+1)
+			f.RenderWidth = width
+			f.RenderHeight = height
+			f.setColorDescription(cc)
+			return f
+		}
+	}
+
+	return NewFrame(width, height, cc)
+}
+
+// Put hands f back to the pool. f must not be used afterwards.
+func (p *FramePool) Put(f *Frame) {
+	if f == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.free) == MAX_FREE_FRAMES {
+		p.free = slices.Delete(p.free, 0, 1)
+	}
+	p.free = append(p.free, f)
+}
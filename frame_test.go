@@ -0,0 +1,114 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFrame420(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1}
+	f := NewFrame(33, 17, cc)
+
+	assert.Equal(t, 3, f.NumPlanes)
+	assert.Equal(t, 33, f.Planes[0].Width)
+	assert.Equal(t, 17, f.Planes[0].Height)
+	assert.Equal(t, 17, f.Planes[1].Width)
+	assert.Equal(t, 9, f.Planes[1].Height)
+	assert.Equal(t, FRAME_BORDER, f.Planes[0].BorderX)
+	assert.Equal(t, FRAME_BORDER, f.Planes[0].BorderY)
+	assert.Equal(t, FRAME_BORDER/2, f.Planes[2].BorderX)
+	assert.Equal(t, FRAME_BORDER/2, f.Planes[2].BorderY)
+	assert.NotNil(t, f.Planes[0].Pix8)
+	assert.Nil(t, f.Planes[0].Pix16)
+}
+
+func TestNewFrameHighBitDepthMono(t *testing.T) {
+	cc := ColorConfig{bitDepth: 10, monoChrome: true, subsamplingX: 1, subsamplingY: 1}
+	f := NewFrame(16, 16, cc)
+
+	assert.Equal(t, 1, f.NumPlanes)
+	assert.NotNil(t, f.Planes[0].Pix16)
+	assert.Nil(t, f.Planes[1].Pix16)
+
+	f.Planes[0].Set(3, 4, 1023)
+	assert.Equal(t, 1023, f.Planes[0].At(3, 4))
+	assert.Equal(t, uint16(1023), f.Planes[0].Row16(4)[3])
+}
+
+func TestPlaneExtendBorders(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8}
+	f := NewFrame(4, 4, cc)
+	p := &f.Planes[0]
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			p.Set(x, y, 10*y+x)
+		}
+	}
+	p.ExtendBorders()
+
+	assert.Equal(t, 0, p.At(-p.BorderX, -p.BorderY))
+	assert.Equal(t, 3, p.At(p.Width+p.BorderX-1, -1))
+	assert.Equal(t, 30, p.At(-5, 10))
+	assert.Equal(t, 33, p.At(20, 20))
+	assert.Equal(t, 20, p.At(-1, 2))
+	assert.Equal(t, 13, p.At(4, 1))
+}
+
+func TestFramePoolReuse(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1}
+	pool := NewFramePool()
+
+	f := pool.Get(64, 64, cc)
+	pool.Put(f)
+
+	assert.Same(t, f, pool.Get(64, 64, cc))
+
+	pool.Put(f)
+	other := pool.Get(32, 64, cc)
+	assert.NotSame(t, f, other)
+	assert.Equal(t, 32, other.Width)
+}
+
+func TestFrameCopyFrom(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1}
+	src := NewFrame(8, 8, cc)
+	src.Planes[0].Set(-1, 2, 7)
+	src.Planes[2].Set(3, 3, 9)
+
+	dst := NewFrame(8, 8, cc)
+	dst.CopyFrom(src)
+
+	assert.Equal(t, 7, dst.Planes[0].At(-1, 2))
+	assert.Equal(t, 9, dst.Planes[2].At(3, 3))
+}
+
+func TestNewFrame422Borders(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8, subsamplingX: 1}
+	f := NewFrame(16, 16, cc)
+
+	assert.Equal(t, FRAME_BORDER/2, f.Planes[1].BorderX)
+	assert.Equal(t, FRAME_BORDER, f.Planes[1].BorderY)
+
+	p := &f.Planes[1]
+	p.Set(0, 0, 9)
+	p.ExtendBorders()
+	assert.Equal(t, 9, p.At(-p.BorderX, -p.BorderY))
+	assert.Equal(t, (8+2*FRAME_BORDER/2)*(16+2*FRAME_BORDER), len(p.Pix8))
+}
+
+func TestFramePoolBounded(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1}
+	pool := NewFramePool()
+
+	old := pool.Get(64, 64, cc)
+	pool.Put(old)
+	for i := 0; i < MAX_FREE_FRAMES; i++ {
+		pool.Put(NewFrame(32, 32, cc))
+	}
+
+	assert.Len(t, pool.free, MAX_FREE_FRAMES)
+	assert.NotContains(t, pool.free, old)
+	assert.NotSame(t, old, pool.Get(64, 64, cc))
+}
@@ -0,0 +1,587 @@
+package boulder
+
+const SIMPLE = 0
+const OBMC = 1
+const LOCALWARP = 2
+
+const FILTER_BITS = 7
+const SUBPEL_BITS = 4
+const SUBPEL_MASK = 15
+const SCALE_SUBPEL_BITS = 10
+const REF_SCALE_SHIFT = 14
+
+var (
+	InterRound0    int
+	InterRound1    int
+	InterPostRound int
+	HasChroma      bool
+	IsInterIntra   bool
+	MiWidthLog2    = [BLOCK_SIZES]int{
+		0, 0, 1, 1, 1, 2, 2, 2, 3, 3, 3,
+		4, 4, 4, 5, 5, 0, 2, 1, 3, 2, 4,
+	}
+	MiHeightLog2 = [BLOCK_SIZES]int{
+		0, 1, 0, 1, 2, 1, 2, 3, 2, 3, 4,
+		3, 4, 5, 4, 5, 2, 0, 3, 1, 4, 2,
+	}
+	ObmcMask2  = [2]int{45, 64}
+	ObmcMask4  = [4]int{39, 50, 59, 64}
+	ObmcMask8  = [8]int{36, 42, 48, 53, 57, 61, 64, 64}
+	ObmcMask16 = [16]int{34, 37, 40, 43, 46, 49, 52, 54, 56, 58, 60, 61, 64, 64, 64, 64}
+	ObmcMask32 = [32]int{
+		33, 35, 36, 38, 40, 41, 43, 44, 45, 47, 48, 50, 51, 52, 53, 55,
+		56, 57, 58, 59, 60, 60, 61, 62, 64, 64, 64, 64, 64, 64, 64, 64,
+	}
+	SubsampledSize = [BLOCK_SIZES][2][2]int{
+		{{BLOCK_4X4, BLOCK_4X4}, {BLOCK_4X4, BLOCK_4X4}},
+		{{BLOCK_4X8, BLOCK_4X4}, {BLOCK_INVALID, BLOCK_4X4}},
+		{{BLOCK_8X4, BLOCK_INVALID}, {BLOCK_4X4, BLOCK_4X4}},
+		{{BLOCK_8X8, BLOCK_8X4}, {BLOCK_4X8, BLOCK_4X4}},
+		{{BLOCK_8X16, BLOCK_8X8}, {BLOCK_INVALID, BLOCK_4X8}},
+		{{BLOCK_16X8, BLOCK_INVALID}, {BLOCK_8X8, BLOCK_8X4}},
+		{{BLOCK_16X16, BLOCK_16X8}, {BLOCK_8X16, BLOCK_8X8}},
+		{{BLOCK_16X32, BLOCK_16X16}, {BLOCK_INVALID, BLOCK_8X16}},
+		{{BLOCK_32X16, BLOCK_INVALID}, {BLOCK_16X16, BLOCK_16X8}},
+		{{BLOCK_32X32, BLOCK_32X16}, {BLOCK_16X32, BLOCK_16X16}},
+		{{BLOCK_32X64, BLOCK_32X32}, {BLOCK_INVALID, BLOCK_16X32}},
+		{{BLOCK_64X32, BLOCK_INVALID}, {BLOCK_32X32, BLOCK_32X16}},
+		{{BLOCK_64X64, BLOCK_64X32}, {BLOCK_32X64, BLOCK_32X32}},
+		{{BLOCK_64X128, BLOCK_64X64}, {BLOCK_INVALID, BLOCK_32X64}},
+		{{BLOCK_128X64, BLOCK_INVALID}, {BLOCK_64X64, BLOCK_64X32}},
+		{{BLOCK_128X128, BLOCK_128X64}, {BLOCK_64X128, BLOCK_64X64}},
+		{{BLOCK_4X16, BLOCK_4X8}, {BLOCK_INVALID, BLOCK_4X8}},
+		{{BLOCK_16X4, BLOCK_INVALID}, {BLOCK_8X4, BLOCK_8X4}},
+		{{BLOCK_8X32, BLOCK_8X16}, {BLOCK_INVALID, BLOCK_4X16}},
+		{{BLOCK_32X8, BLOCK_INVALID}, {BLOCK_16X8, BLOCK_16X4}},
+		{{BLOCK_16X64, BLOCK_16X32}, {BLOCK_INVALID, BLOCK_8X32}},
+		{{BLOCK_64X16, BLOCK_INVALID}, {BLOCK_32X16, BLOCK_32X8}},
+	}
+	SubpelFilters = [6][16][8]int{
+		{
+			{0, 0, 0, 128, 0, 0, 0, 0}, {0, 2, -6, 126, 8, -2, 0, 0},
+			{0, 2, -10, 122, 18, -4, 0, 0}, {0, 2, -12, 116, 28, -8, 2, 0},
+			{0, 2, -14, 110, 38, -10, 2, 0}, {0, 2, -14, 102, 48, -12, 2, 0},
+			{0, 2, -16, 94, 58, -12, 2, 0}, {0, 2, -14, 84, 66, -12, 2, 0},
+			{0, 2, -14, 76, 76, -14, 2, 0}, {0, 2, -12, 66, 84, -14, 2, 0},
+			{0, 2, -12, 58, 94, -16, 2, 0}, {0, 2, -12, 48, 102, -14, 2, 0},
+			{0, 2, -10, 38, 110, -14, 2, 0}, {0, 2, -8, 28, 116, -12, 2, 0},
+			{0, 0, -4, 18, 122, -10, 2, 0}, {0, 0, -2, 8, 126, -6, 2, 0},
+		},
+		{
+			{0, 0, 0, 128, 0, 0, 0, 0}, {0, 2, 28, 62, 34, 2, 0, 0},
+			{0, 0, 26, 62, 36, 4, 0, 0}, {0, 0, 22, 62, 40, 4, 0, 0},
+			{0, 0, 20, 60, 42, 6, 0, 0}, {0, 0, 18, 58, 44, 8, 0, 0},
+			{0, 0, 16, 56, 46, 10, 0, 0}, {0, -2, 16, 54, 48, 12, 0, 0},
+			{0, -2, 14, 52, 52, 14, -2, 0}, {0, 0, 12, 48, 54, 16, -2, 0},
+			{0, 0, 10, 46, 56, 16, 0, 0}, {0, 0, 8, 44, 58, 18, 0, 0},
+			{0, 0, 6, 42, 60, 20, 0, 0}, {0, 0, 4, 40, 62, 22, 0, 0},
+			{0, 0, 4, 36, 62, 26, 0, 0}, {0, 0, 2, 34, 62, 28, 2, 0},
+		},
+		{
+			{0, 0, 0, 128, 0, 0, 0, 0}, {-2, 2, -6, 126, 8, -2, 2, 0},
+			{-2, 6, -12, 124, 16, -6, 4, -2}, {-2, 8, -18, 120, 26, -10, 6, -2},
+			{-4, 10, -22, 116, 38, -14, 6, -2}, {-4, 10, -22, 108, 48, -18, 8, -2},
+			{-4, 10, -24, 100, 60, -20, 8, -2}, {-4, 10, -24, 90, 70, -22, 10, -2},
+			{-4, 12, -24, 80, 80, -24, 12, -4}, {-2, 10, -22, 70, 90, -24, 10, -4},
+			{-2, 8, -20, 60, 100, -24, 10, -4}, {-2, 8, -18, 48, 108, -22, 10, -4},
+			{-2, 6, -14, 38, 116, -22, 10, -4}, {-2, 6, -10, 26, 120, -18, 8, -2},
+			{-2, 4, -6, 16, 124, -12, 6, -2}, {0, 2, -2, 8, 126, -6, 2, -2},
+		},
+		{
+			{0, 0, 0, 128, 0, 0, 0, 0}, {0, 0, 0, 120, 8, 0, 0, 0},
+			{0, 0, 0, 112, 16, 0, 0, 0}, {0, 0, 0, 104, 24, 0, 0, 0},
+			{0, 0, 0, 96, 32, 0, 0, 0}, {0, 0, 0, 88, 40, 0, 0, 0},
+			{0, 0, 0, 80, 48, 0, 0, 0}, {0, 0, 0, 72, 56, 0, 0, 0},
+			{0, 0, 0, 64, 64, 0, 0, 0}, {0, 0, 0, 56, 72, 0, 0, 0},
+			{0, 0, 0, 48, 80, 0, 0, 0}, {0, 0, 0, 40, 88, 0, 0, 0},
+			{0, 0, 0, 32, 96, 0, 0, 0}, {0, 0, 0, 24, 104, 0, 0, 0},
+			{0, 0, 0, 16, 112, 0, 0, 0}, {0, 0, 0, 8, 120, 0, 0, 0},
+		},
+		{
+			{0, 0, 0, 128, 0, 0, 0, 0}, {0, 0, -4, 126, 8, -2, 0, 0},
+			{0, 0, -8, 122, 18, -4, 0, 0}, {0, 0, -10, 116, 28, -6, 0, 0},
+			{0, 0, -12, 110, 38, -8, 0, 0}, {0, 0, -12, 102, 48, -10, 0, 0},
+			{0, 0, -14, 94, 58, -10, 0, 0}, {0, 0, -12, 84, 66, -10, 0, 0},
+			{0, 0, -12, 76, 76, -12, 0, 0}, {0, 0, -10, 66, 84, -12, 0, 0},
+			{0, 0, -10, 58, 94, -14, 0, 0}, {0, 0, -10, 48, 102, -12, 0, 0},
+			{0, 0, -8, 38, 110, -12, 0, 0}, {0, 0, -6, 28, 116, -10, 0, 0},
+			{0, 0, -4, 18, 122, -8, 0, 0}, {0, 0, -2, 8, 126, -4, 0, 0},
+		},
+		{
+			{0, 0, 0, 128, 0, 0, 0, 0}, {0, 0, 30, 62, 34, 2, 0, 0},
+			{0, 0, 26, 62, 36, 4, 0, 0}, {0, 0, 22, 62, 40, 4, 0, 0},
+			{0, 0, 20, 60, 42, 6, 0, 0}, {0, 0, 18, 58, 44, 8, 0, 0},
+			{0, 0, 16, 56, 46, 10, 0, 0}, {0, 0, 14, 54, 48, 12, 0, 0},
+			{0, 0, 12, 52, 52, 12, 0, 0}, {0, 0, 12, 48, 54, 14, 0, 0},
+			{0, 0, 10, 46, 56, 16, 0, 0}, {0, 0, 8, 44, 58, 18, 0, 0},
+			{0, 0, 6, 42, 60, 20, 0, 0}, {0, 0, 4, 40, 62, 22, 0, 0},
+			{0, 0, 4, 36, 62, 26, 0, 0}, {0, 0, 2, 34, 62, 30, 0, 0},
+		},
+	}
+)
+
+func getPlaneResidualSize(subsize int, plane int) int {
+	subX := 0
+	subY := 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	return SubsampledSize[subsize][subX][subY]
+}
+
+// computeInterPrediction is the inter half of the prediction process run
+// for every decoded block: it splits the block per plane into the units
+// predicted by predictInter, handling chroma of sub 8x8 blocks whose
+// neighbours contribute their own motion vectors. The intra prediction of
+// inter-intra blocks is made first, for predictInter to blend with.
+func computeInterPrediction() {
+	numPlanes := 1
+	if HasChroma {
+		numPlanes = NumPlanes
+	}
+
+	sbMask := 15
+	if sh.use128x128Superblock {
+		sbMask = 31
+	}
+	subBlockMiRow := MiRow & sbMask
+	subBlockMiCol := MiCol & sbMask
+
+	for plane := 0; plane < numPlanes; plane++ {
+		planeSz := getPlaneResidualSize(MiSize, plane)
+		num4x4W := Num4x4BlocksWide[planeSz]
+		num4x4H := Num4x4BlocksHigh[planeSz]
+
+		subX := 0
+		subY := 0
+		if plane > 0 {
+			subX = sh.colorConfig.subsamplingX
+			subY = sh.colorConfig.subsamplingY
+		}
+
+		baseX := (MiCol >> subX) * MI_SIZE
+		baseY := (MiRow >> subY) * MI_SIZE
+		candRow := (MiRow >> subY) << subY
+		candCol := (MiCol >> subX) << subX
+
+		IsInterIntra = IsInter && RefFrame[1] == INTRA_FRAME
+		if IsInterIntra {
+			haveAboveRight := get3d(plane, (subBlockMiRow>>subY)-1, (subBlockMiCol>>subX)+num4x4W, BlockDecoded) == 1
+			haveBelowLeft := get3d(plane, (subBlockMiRow>>subY)+num4x4H, (subBlockMiCol>>subX)-1, BlockDecoded) == 1
+			log2W := MI_SIZE_LOG2 + MiWidthLog2[planeSz]
+			log2H := MI_SIZE_LOG2 + MiHeightLog2[planeSz]
+			interIntraPrediction(plane, baseX, baseY, haveAboveRight, haveBelowLeft, log2W, log2H)
+		}
+
+		someUseIntra := false
+		for r := 0; r < (num4x4H << subY); r++ {
+			for c := 0; c < (num4x4W << subX); c++ {
+				if RefFrames[candRow+r][candCol+c][0] == INTRA_FRAME {
+					someUseIntra = true
+				}
+			}
+		}
+
+		var predW int
+		var predH int
+		if someUseIntra {
+			predW = num4x4W * 4
+			predH = num4x4H * 4
+			candRow = MiRow
+			candCol = MiCol
+		} else {
+			predW = BlockWidth[MiSize] >> subX
+			predH = BlockHeight[MiSize] >> subY
+		}
+
+		r := 0
+		for y := 0; y < num4x4H*4; y += predH {
+			c := 0
+			for x := 0; x < num4x4W*4; x += predW {
+				predictInter(plane, baseX+x, baseY+y, predW, predH, candRow+r, candCol+c)
+				c++
+			}
+			r++
+		}
+	}
+}
+
+func roundingVariablesDerivation(isCompound bool) {
+	InterRound0 = 3
+	if isCompound {
+		InterRound1 = 7
+	} else {
+		InterRound1 = 11
+	}
+
+	if BitDepth == 12 {
+		InterRound0 = InterRound0 + 2
+	}
+	if BitDepth == 12 && !isCompound {
+		InterRound1 = InterRound1 - 2
+	}
+
+	InterPostRound = 2*FILTER_BITS - (InterRound0 + InterRound1)
+}
+
+func predictInter(plane int, x int, y int, w int, h int, candRow int, candCol int) {
+	isCompound := RefFrames[candRow][candCol][1] > INTRA_FRAME
+	roundingVariablesDerivation(isCompound)
+
+	if plane == 0 && MotionMode == LOCALWARP {
+		warpEstimation()
+		if LocalValid {
+			LocalValid, _, _, _, _ = setupShear(LocalWarpParams[:])
+		}
+	}
+
+	numRefs := 1
+	if isCompound {
+		numRefs = 2
+	}
+
+	var preds [2][][]int
+	for refList := 0; refList < numRefs; refList++ {
+		refFrame := RefFrames[candRow][candCol][refList]
+
+		isGlobal := (YMode == GLOBALMV || YMode == GLOBAL_GLOBALMV) && GmType[refFrame] > TRANSLATION
+
+		globalValid := false
+		if isGlobal {
+			globalValid, _, _, _, _ = setupShear(uh.globalMotionParams.gmParams[refFrame])
+		}
+
+		useWarp := 0
+		if w < 8 || h < 8 {
+			useWarp = 0
+		} else if uh.forceIntegerMv {
+			useWarp = 0
+		} else if MotionMode == LOCALWARP && LocalValid {
+			useWarp = 1
+		} else if isGlobal && !isScaled(refFrame) && globalValid {
+			useWarp = 2
+		}
+
+		mv := Mvs[candRow][candCol][refList]
+
+		refIdx := -1
+		if !UseIntrabc {
+			refIdx = uh.refFrameIdx[refFrame-LAST_FRAME]
+		}
+
+		if useWarp != 0 {
+			preds[refList] = make([][]int, h)
+			for i := range preds[refList] {
+				preds[refList][i] = make([]int, w)
+			}
+
+			for i8 := 0; i8 <= (h-1)>>3; i8++ {
+				for j8 := 0; j8 <= (w-1)>>3; j8++ {
+					blockWarp(useWarp, plane, refFrame, x, y, i8, j8, w, h, preds[refList])
+				}
+			}
+		} else {
+			startX, startY, xStep, yStep := motionVectorScaling(plane, refIdx, x, y, mv)
+			preds[refList] = blockInterPrediction(refIdx, plane, startX, startY, xStep, yStep, w, h, candRow, candCol)
+		}
+	}
+
+	if CompoundType == COMPOUND_WEDGE && plane == 0 {
+		wedgeMask(w, h)
+	} else if CompoundType == COMPOUND_INTRA {
+		intraModeVariantMask(w, h)
+	} else if CompoundType == COMPOUND_DIFFWTD && plane == 0 {
+		differenceWeightMask(preds, w, h)
+	}
+
+	if CompoundType == COMPOUND_DISTANCE {
+		distanceWeights(candRow, candCol)
+	}
+
+	p := &CurrFrame.Planes[plane]
+	if !isCompound && !IsInterIntra {
+		for i := 0; i < h; i++ {
+			for j := 0; j < w; j++ {
+				setSample(p, x+j, y+i, clip1(round2(preds[0][i][j], InterPostRound)))
+			}
+		}
+	} else if CompoundType == COMPOUND_AVERAGE {
+		for i := 0; i < h; i++ {
+			for j := 0; j < w; j++ {
+				setSample(p, x+j, y+i, clip1(round2(preds[0][i][j]+preds[1][i][j], 1+InterPostRound)))
+			}
+		}
+	} else if CompoundType == COMPOUND_DISTANCE {
+		for i := 0; i < h; i++ {
+			for j := 0; j < w; j++ {
+				v := FwdWeight*preds[0][i][j] + BckWeight*preds[1][i][j]
+				setSample(p, x+j, y+i, clip1(round2(v, 4+InterPostRound)))
+			}
+		}
+	} else {
+		maskBlend(preds, plane, x, y, w, h)
+	}
+
+	if MotionMode == OBMC {
+		overlappedMotionCompensation(plane, w, h)
+	}
+}
+
+// isScaled reports whether the reference used for refFrame differs in size
+// from the current frame.
+func isScaled(refFrame int) bool {
+	refIdx := uh.refFrameIdx[refFrame-LAST_FRAME]
+	refUpscaledWidth, refFrameHeight := refDimensions(refIdx)
+
+	xScale := ((refUpscaledWidth << REF_SCALE_SHIFT) + (FrameWidth / 2)) / FrameWidth
+	yScale := ((refFrameHeight << REF_SCALE_SHIFT) + (FrameHeight / 2)) / FrameHeight
+	noScale := 1 << REF_SCALE_SHIFT
+
+	return xScale != noScale || yScale != noScale
+}
+
+// overlappedMotionCompensation blends the prediction of the current block
+// with predictions made from the motion vectors of the blocks above and
+// to the left of it.
+func overlappedMotionCompensation(plane int, w int, h int) {
+	subX := 0
+	subY := 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	if AvailU && getPlaneResidualSize(MiSize, plane) >= BLOCK_8X8 {
+		w4 := Num4x4BlocksWide[MiSize]
+		x4 := MiCol
+		y4 := MiRow
+		nCount := 0
+		nLimit := min(4, MiWidthLog2[MiSize])
+
+		for nCount < nLimit && x4 < min(MiCols, MiCol+w4) {
+			candRow := MiRow - 1
+			candCol := x4 | 1
+			candSz := MiSizes[candRow][candCol]
+			step4 := clip3(2, 16, Num4x4BlocksWide[candSz])
+
+			if RefFrames[candRow][candCol][0] > INTRA_FRAME {
+				nCount++
+				predW := min(w4, step4) * MI_SIZE >> subX
+				predH := min(h>>1, 32>>subY)
+				mask := obmcMask(predH)
+				predictOverlap(plane, 0, candRow, candCol, x4, y4, predW, predH, mask)
+			}
+
+			x4 += step4
+		}
+	}
+
+	if AvailL && getPlaneResidualSize(MiSize, plane) >= BLOCK_8X8 {
+		h4 := Num4x4BlocksHigh[MiSize]
+		x4 := MiCol
+		y4 := MiRow
+		nCount := 0
+		nLimit := min(4, MiHeightLog2[MiSize])
+
+		for nCount < nLimit && y4 < min(MiRows, MiRow+h4) {
+			candCol := MiCol - 1
+			candRow := y4 | 1
+			candSz := MiSizes[candRow][candCol]
+			step4 := clip3(2, 16, Num4x4BlocksHigh[candSz])
+
+			if RefFrames[candRow][candCol][0] > INTRA_FRAME {
+				nCount++
+				predW := min(w>>1, 32>>subX)
+				predH := min(h4, step4) * MI_SIZE >> subY
+				mask := obmcMask(predW)
+				predictOverlap(plane, 1, candRow, candCol, x4, y4, predW, predH, mask)
+			}
+
+			y4 += step4
+		}
+	}
+}
+
+func predictOverlap(plane int, pass int, candRow int, candCol int, x4 int, y4 int, predW int, predH int, mask []int) {
+	subX := 0
+	subY := 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	mv := Mvs[candRow][candCol][0]
+	refIdx := uh.refFrameIdx[RefFrames[candRow][candCol][0]-LAST_FRAME]
+	predX := (x4 * 4) >> subX
+	predY := (y4 * 4) >> subY
+
+	startX, startY, xStep, yStep := motionVectorScaling(plane, refIdx, predX, predY, mv)
+	obmcPred := blockInterPrediction(refIdx, plane, startX, startY, xStep, yStep, predW, predH, candRow, candCol)
+
+	p := &CurrFrame.Planes[plane]
+	for i := 0; i < predH; i++ {
+		for j := 0; j < predW; j++ {
+			obmc := clip1(round2(obmcPred[i][j], InterPostRound))
+
+			var m int
+			if pass == 0 {
+				m = mask[i]
+			} else {
+				m = mask[j]
+			}
+
+			v := round2(m*p.At(predX+j, predY+i)+(64-m)*obmc, 6)
+			setSample(p, predX+j, predY+i, v)
+		}
+	}
+}
+
+func obmcMask(length int) []int {
+	switch length {
+	case 2:
+		return ObmcMask2[:]
+	case 4:
+		return ObmcMask4[:]
+	case 8:
+		return ObmcMask8[:]
+	case 16:
+		return ObmcMask16[:]
+	default:
+		return ObmcMask32[:]
+	}
+}
+
+// setSample writes v into p, dropping samples of blocks that extend beyond
+// the padded plane.
+func setSample(p *Plane, x int, y int, v int) {
+	if x >= p.Width+p.BorderX || y >= p.Height+p.BorderY {
+		return
+	}
+
+	p.Set(x, y, v)
+}
+
+// checkRefFrameScale checks that reference slot refIdx is at most twice
+// as large and at most 16 times smaller than the current frame, the range
+// of scales motionVectorScaling supports.
+func checkRefFrameScale(refIdx int, r *Reader) {
+	if 2*FrameWidth < RefUpscaledWidth[refIdx] ||
+		2*FrameHeight < RefFrameHeight[refIdx] ||
+		FrameWidth > 16*RefUpscaledWidth[refIdx] ||
+		FrameHeight > 16*RefFrameHeight[refIdx] {
+		conformanceError("invalid reference frame scale", r)
+	}
+}
+
+// refDimensions returns the upscaled width and height of the reference
+// frame refIdx, where -1 denotes the frame currently being decoded.
+func refDimensions(refIdx int) (int, int) {
+	if refIdx == -1 {
+		return UpscaledWidth, FrameHeight
+	}
+
+	return RefUpscaledWidth[refIdx], RefFrameHeight[refIdx]
+}
+
+func refPlane(refIdx int, plane int) *Plane {
+	if refIdx == -1 {
+		return &CurrFrame.Planes[plane]
+	}
+
+	return &FrameStore[refIdx].Planes[plane]
+}
+
+func motionVectorScaling(plane int, refIdx int, x int, y int, mv [2]int) (startX int, startY int, xStep int, yStep int) {
+	subX := 0
+	subY := 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	refUpscaledWidth, refFrameHeight := refDimensions(refIdx)
+
+	halfSample := 1 << (SUBPEL_BITS - 1)
+	origX := (x << SUBPEL_BITS) + ((2 * mv[1]) >> subX) + halfSample
+	origY := (y << SUBPEL_BITS) + ((2 * mv[0]) >> subY) + halfSample
+
+	xScale := ((refUpscaledWidth << REF_SCALE_SHIFT) + (FrameWidth / 2)) / FrameWidth
+	yScale := ((refFrameHeight << REF_SCALE_SHIFT) + (FrameHeight / 2)) / FrameHeight
+
+	baseX := origX*xScale - (halfSample << REF_SCALE_SHIFT)
+	baseY := origY*yScale - (halfSample << REF_SCALE_SHIFT)
+
+	off := (1 << (SCALE_SUBPEL_BITS - SUBPEL_BITS)) / 2
+
+	startX = round2Signed(baseX, REF_SCALE_SHIFT+SUBPEL_BITS-SCALE_SUBPEL_BITS) + off
+	startY = round2Signed(baseY, REF_SCALE_SHIFT+SUBPEL_BITS-SCALE_SUBPEL_BITS) + off
+	xStep = round2Signed(xScale, REF_SCALE_SHIFT-SCALE_SUBPEL_BITS)
+	yStep = round2Signed(yScale, REF_SCALE_SHIFT-SCALE_SUBPEL_BITS)
+
+	return startX, startY, xStep, yStep
+}
+
+func filterIdx(interpFilter int, size int) int {
+	if size <= 4 {
+		if interpFilter == EIGHTTAP || interpFilter == EIGHTTAP_SHARP {
+			return 4
+		} else if interpFilter == EIGHTTAP_SMOOTH {
+			return 5
+		}
+	}
+
+	return interpFilter
+}
+
+func blockInterPrediction(refIdx int, plane int, x int, y int, xStep int, yStep int, w int, h int, candRow int, candCol int) [][]int {
+	subX := 0
+	subY := 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	ref := refPlane(refIdx, plane)
+	refUpscaledWidth, refFrameHeight := refDimensions(refIdx)
+
+	lastX := ((refUpscaledWidth + subX) >> subX) - 1
+	lastY := ((refFrameHeight + subY) >> subY) - 1
+
+	intermediateHeight := (((h-1)*yStep + (1 << SCALE_SUBPEL_BITS) - 1) >> SCALE_SUBPEL_BITS) + 8
+
+	interpFilter := InterpFilters[candRow][candCol]
+	filterIdxX := filterIdx(interpFilter[1], w)
+	filterIdxY := filterIdx(interpFilter[0], h)
+
+	intermediate := make([][]int, intermediateHeight)
+	for r := 0; r < intermediateHeight; r++ {
+		intermediate[r] = make([]int, w)
+		refY := clip3(0, lastY, (y>>10)+r-3)
+		for c := 0; c < w; c++ {
+			s := 0
+			p := x + xStep*c
+			for t := 0; t < 8; t++ {
+				s += SubpelFilters[filterIdxX][(p>>6)&SUBPEL_MASK][t] *
+					ref.At(clip3(0, lastX, (p>>10)+t-3), refY)
+			}
+			intermediate[r][c] = round2(s, InterRound0)
+		}
+	}
+
+	pred := make([][]int, h)
+	for r := 0; r < h; r++ {
+		pred[r] = make([]int, w)
+		for c := 0; c < w; c++ {
+			s := 0
+			p := (y & 1023) + yStep*r
+			for t := 0; t < 8; t++ {
+				s += SubpelFilters[filterIdxY][(p>>6)&SUBPEL_MASK][t] * intermediate[(p>>10)+t][c]
+			}
+			pred[r][c] = round2(s, InterRound1)
+		}
+	}
+
+	return pred
+}
@@ -0,0 +1,172 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubpelFiltersSumTo128(t *testing.T) {
+	for f := range SubpelFilters {
+		for p := range SubpelFilters[f] {
+			sum := 0
+			for _, tap := range SubpelFilters[f][p] {
+				sum += tap
+			}
+			assert.Equal(t, 128, sum, "filter %d position %d", f, p)
+		}
+	}
+}
+
+func TestRoundingVariablesDerivation(t *testing.T) {
+	saveGlobals(t, &BitDepth, &InterRound0, &InterRound1, &InterPostRound)
+	BitDepth = 8
+	roundingVariablesDerivation(false)
+	assert.Equal(t, 3, InterRound0)
+	assert.Equal(t, 11, InterRound1)
+	assert.Equal(t, 0, InterPostRound)
+
+	roundingVariablesDerivation(true)
+	assert.Equal(t, 7, InterRound1)
+	assert.Equal(t, 4, InterPostRound)
+
+	BitDepth = 12
+	roundingVariablesDerivation(false)
+	assert.Equal(t, 5, InterRound0)
+	assert.Equal(t, 9, InterRound1)
+	assert.Equal(t, 0, InterPostRound)
+
+	roundingVariablesDerivation(true)
+	assert.Equal(t, 7, InterRound1)
+	assert.Equal(t, 2, InterPostRound)
+}
+
+// setupInterTest installs a 32x32 8-bit 4:2:0 reference in slot 0 whose
+// luma samples are x + 2*y.
+func setupInterTest(t *testing.T) {
+	saveGlobals(t, &sh, &uh, &BitDepth, &FrameWidth, &FrameHeight, &UpscaledWidth,
+		&MiCols, &MiRows, &MiRow, &MiCol, &MiSize, &AvailU, &AvailL,
+		&RefUpscaledWidth, &RefFrameHeight, &FrameStore, &CurrFrame,
+		&YMode, &MotionMode, &CompoundType, &IsInterIntra, &Mask,
+		&FwdWeight, &BckWeight, &InterRound0, &InterRound1, &InterPostRound,
+		&LocalValid, &LocalWarpParams)
+	saveModeInfo(t)
+
+	BitDepth = 8
+	sh = SequenceHeader{colorConfig: ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1}}
+	uh = UncompressedHeader{refFrameIdx: []int{0, 0, 0, 0, 0, 0, 0}}
+	FrameWidth = 32
+	FrameHeight = 32
+	UpscaledWidth = 32
+	MiCols = 8
+	MiRows = 8
+	RefUpscaledWidth[0] = 32
+	RefFrameHeight[0] = 32
+
+	FrameStore[0] = NewFrame(32, 32, sh.colorConfig)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			FrameStore[0].Planes[0].Set(x, y, x+2*y)
+		}
+	}
+	CurrFrame = NewFrame(32, 32, sh.colorConfig)
+	allocModeInfo()
+
+	YMode = NEWMV
+	MotionMode = SIMPLE
+	CompoundType = COMPOUND_AVERAGE
+	IsInterIntra = false
+}
+
+func TestMotionVectorScalingUnscaled(t *testing.T) {
+	setupInterTest(t)
+
+	startX, startY, xStep, yStep := motionVectorScaling(0, 0, 8, 4, [2]int{-16, 24})
+	assert.Equal(t, 1<<SCALE_SUBPEL_BITS, xStep)
+	assert.Equal(t, 1<<SCALE_SUBPEL_BITS, yStep)
+	off := 1 << (SCALE_SUBPEL_BITS - SUBPEL_BITS - 1)
+	assert.Equal(t, (8<<SCALE_SUBPEL_BITS)+(24<<7)+off, startX)
+	assert.Equal(t, (4<<SCALE_SUBPEL_BITS)-(16<<7)+off, startY)
+}
+
+func TestCheckRefFrameScale(t *testing.T) {
+	setupInterTest(t)
+
+	assert.NotPanics(t, func() { checkRefFrameScale(0, &Reader{}) })
+
+	RefUpscaledWidth[0] = 2*FrameWidth + 1
+	assert.PanicsWithValue(t, "invalid reference frame scale", func() { checkRefFrameScale(0, &Reader{}) })
+
+	r := Reader{options: Options{Lenient: true}}
+	assert.NotPanics(t, func() { checkRefFrameScale(0, &r) })
+}
+
+func TestPredictInterIntegerMv(t *testing.T) {
+	setupInterTest(t)
+
+	RefFrames[0][0] = [2]int{LAST_FRAME, NONE}
+	Mvs[0][0][0] = [2]int{2 * 8, 3 * 8}
+	InterpFilters[0][0] = [2]int{EIGHTTAP, EIGHTTAP}
+
+	predictInter(0, 4, 4, 8, 8, 0, 0)
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			assert.Equal(t, (x+4+3)+2*(y+4+2), CurrFrame.Planes[0].At(x+4, y+4))
+		}
+	}
+}
+
+func TestPredictInterClampsToFrame(t *testing.T) {
+	setupInterTest(t)
+
+	RefFrames[0][0] = [2]int{LAST_FRAME, NONE}
+	Mvs[0][0][0] = [2]int{-8 * 8, -8 * 8}
+	InterpFilters[0][0] = [2]int{EIGHTTAP_SHARP, EIGHTTAP_SHARP}
+
+	predictInter(0, 0, 0, 4, 4, 0, 0)
+
+	assert.Equal(t, 0, CurrFrame.Planes[0].At(0, 0))
+	assert.Equal(t, 0, CurrFrame.Planes[0].At(3, 3))
+}
+
+func TestPredictInterCompoundAverage(t *testing.T) {
+	setupInterTest(t)
+
+	RefFrames[0][0] = [2]int{LAST_FRAME, GOLDEN_FRAME}
+	Mvs[0][0][0] = [2]int{0, 0}
+	Mvs[0][0][1] = [2]int{0, 2 * 8}
+	InterpFilters[0][0] = [2]int{EIGHTTAP, EIGHTTAP}
+
+	predictInter(0, 8, 8, 4, 4, 0, 0)
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			assert.Equal(t, (x+8+1)+2*(y+8), CurrFrame.Planes[0].At(x+8, y+8))
+		}
+	}
+}
+
+func TestPredictInterObmcAbove(t *testing.T) {
+	setupInterTest(t)
+
+	setInterBlock(0, 2, BLOCK_8X8, LAST_FRAME, [2]int{0, 8 * 8})
+	setInterBlock(2, 2, BLOCK_8X8, LAST_FRAME, [2]int{0, 0})
+
+	MiRow = 2
+	MiCol = 2
+	MiSize = BLOCK_8X8
+	AvailU = true
+	AvailL = false
+	MotionMode = OBMC
+	defer func() { MotionMode = SIMPLE }()
+
+	predictInter(0, 8, 8, 8, 8, 2, 2)
+
+	deltas := []int{3, 2, 1, 0, 0, 0, 0, 0}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			assert.Equal(t, (x+8)+2*(y+8)+deltas[y], CurrFrame.Planes[0].At(x+8, y+8))
+		}
+	}
+}
@@ -0,0 +1,544 @@
+package boulder
+
+const DC_PRED = 0
+const V_PRED = 1
+const H_PRED = 2
+const D45_PRED = 3
+const D135_PRED = 4
+const D113_PRED = 5
+const D157_PRED = 6
+const D203_PRED = 7
+const D67_PRED = 8
+const SMOOTH_PRED = 9
+const SMOOTH_V_PRED = 10
+const SMOOTH_H_PRED = 11
+const PAETH_PRED = 12
+const INTRA_MODES = 13
+
+const ANGLE_STEP = 3
+const INTRA_EDGE_TAPS = 5
+const INTRA_EDGE_KERNELS = 3
+
+// INTRA_EDGE_OFFSET is where index 0 of AboveRow and LeftCol is stored.
+const INTRA_EDGE_OFFSET = 16
+
+var (
+	ModeToAngle = [INTRA_MODES]int{0, 90, 180, 45, 135, 113, 157, 203, 67, 0, 0, 0, 0}
+
+	DrIntraDerivative = [90]int{
+		3: 1023, 6: 547, 9: 372, 14: 273, 17: 215, 20: 178, 23: 151, 26: 132,
+		29: 116, 32: 102, 36: 90, 39: 80, 42: 71, 45: 64, 48: 57, 51: 51,
+		54: 45, 58: 40, 61: 35, 64: 31, 67: 27, 70: 23, 73: 19, 76: 15,
+		81: 11, 84: 7, 87: 3,
+	}
+
+	IntraEdgeKernel = [INTRA_EDGE_KERNELS][INTRA_EDGE_TAPS]int{
+		{0, 4, 8, 4, 0},
+		{0, 5, 6, 5, 0},
+		{2, 4, 4, 4, 2},
+	}
+
+	SmWeightsTx4x4   = []int{255, 149, 85, 64}
+	SmWeightsTx8x8   = []int{255, 197, 146, 105, 73, 50, 37, 32}
+	SmWeightsTx16x16 = []int{
+		255, 225, 196, 170, 145, 123, 102, 84, 68, 54, 43, 33, 26, 20, 17, 16,
+	}
+	SmWeightsTx32x32 = []int{
+		255, 240, 225, 210, 196, 182, 169, 157, 145, 133, 122, 111, 101, 92, 83, 74,
+		66, 59, 52, 45, 39, 34, 29, 25, 21, 17, 14, 12, 10, 9, 8, 8,
+	}
+	SmWeightsTx64x64 = []int{
+		255, 248, 240, 233, 225, 218, 210, 203, 196, 189, 182, 176, 169, 163, 156, 150,
+		144, 138, 133, 127, 121, 116, 111, 106, 101, 96, 91, 86, 82, 77, 73, 69,
+		65, 61, 57, 54, 50, 47, 44, 41, 38, 35, 32, 29, 27, 25, 22, 20,
+		18, 16, 15, 13, 12, 11, 10, 9, 8, 7, 6, 6, 5, 5, 4, 4,
+	}
+
+	AvailUChroma bool
+	AvailLChroma bool
+
+	PaletteSizeY  int
+	PaletteSizeUV int
+
+	AngleDeltaY  int
+	AngleDeltaUV int
+)
+
+// interIntraPrediction writes the intra half of an inter-intra prediction
+// of the block at (baseX, baseY) to CurrFrame, for maskBlend to combine
+// with the inter prediction.
+func interIntraPrediction(plane int, baseX int, baseY int, haveAboveRight bool, haveBelowLeft bool, log2W int, log2H int) {
+	var mode int
+	switch InterIntraMode {
+	case II_DC_PRED:
+		mode = DC_PRED
+	case II_V_PRED:
+		mode = V_PRED
+	case II_H_PRED:
+		mode = H_PRED
+	default:
+		mode = SMOOTH_PRED
+	}
+
+	haveLeft, haveAbove := AvailL, AvailU
+	if plane > 0 {
+		haveLeft, haveAbove = AvailLChroma, AvailUChroma
+	}
+
+	predictIntra(plane, baseX, baseY, haveLeft, haveAbove, haveAboveRight, haveBelowLeft, mode, log2W, log2H)
+}
+
+// predictIntra is the intra prediction process for a 2^log2W x 2^log2H
+// block of plane at (x, y). Filter intra is not implemented yet.
+func predictIntra(plane int, x int, y int, haveLeft bool, haveAbove bool, haveAboveRight bool, haveBelowLeft bool, mode int, log2W int, log2H int) {
+	subX, subY := 0, 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	w := 1 << log2W
+	h := 1 << log2H
+	maxX := ((MiCols * MI_SIZE) - 1) >> subX
+	maxY := ((MiRows * MI_SIZE) - 1) >> subY
+	p := &CurrFrame.Planes[plane]
+
+	// AboveRow[i] and LeftCol[i] are stored at index i+INTRA_EDGE_OFFSET,
+	// which leaves room for the above left sample at -1 and the one edge
+	// upsampling adds before it. Upsampling doubles the number of samples.
+	aboveRow := make([]int, INTRA_EDGE_OFFSET+2*(w+h))
+	leftCol := make([]int, INTRA_EDGE_OFFSET+2*(w+h))
+	o := INTRA_EDGE_OFFSET
+
+	for i := 0; i < w+h; i++ {
+		if !haveAbove && haveLeft {
+			aboveRow[o+i] = p.At(x-1, y)
+		} else if !haveAbove && !haveLeft {
+			aboveRow[o+i] = (1 << (BitDepth - 1)) - 1
+		} else {
+			aboveLimit := x + w - 1
+			if haveAboveRight {
+				aboveLimit = x + 2*w - 1
+			}
+			aboveLimit = min(maxX, aboveLimit)
+			aboveRow[o+i] = p.At(min(aboveLimit, x+i), y-1)
+		}
+
+		if !haveLeft && haveAbove {
+			leftCol[o+i] = p.At(x, y-1)
+		} else if !haveLeft && !haveAbove {
+			leftCol[o+i] = (1 << (BitDepth - 1)) + 1
+		} else {
+			leftLimit := y + h - 1
+			if haveBelowLeft {
+				leftLimit = y + 2*h - 1
+			}
+			leftLimit = min(maxY, leftLimit)
+			leftCol[o+i] = p.At(x-1, min(leftLimit, y+i))
+		}
+	}
+
+	switch {
+	case haveAbove && haveLeft:
+		aboveRow[o-1] = p.At(x-1, y-1)
+	case haveAbove:
+		aboveRow[o-1] = p.At(x, y-1)
+	case haveLeft:
+		aboveRow[o-1] = p.At(x-1, y)
+	default:
+		aboveRow[o-1] = 1 << (BitDepth - 1)
+	}
+	leftCol[o-1] = aboveRow[o-1]
+
+	above := aboveRow[o:]
+	left := leftCol[o:]
+	aboveLeft := aboveRow[o-1]
+
+	var pred func(i int, j int) int
+	switch mode {
+	case DC_PRED:
+		avg := dcPrediction(above, left, haveAbove, haveLeft, log2W, log2H)
+		pred = func(i int, j int) int { return avg }
+	case SMOOTH_PRED:
+		weightsX := smWeights(log2W)
+		weightsY := smWeights(log2H)
+		pred = func(i int, j int) int {
+			smoothPred := weightsY[i]*above[j] + (256-weightsY[i])*left[h-1] +
+				weightsX[j]*left[i] + (256-weightsX[j])*above[w-1]
+			return round2(smoothPred, 9)
+		}
+	case SMOOTH_V_PRED:
+		weights := smWeights(log2H)
+		pred = func(i int, j int) int {
+			return round2(weights[i]*above[j]+(256-weights[i])*left[h-1], 8)
+		}
+	case SMOOTH_H_PRED:
+		weights := smWeights(log2W)
+		pred = func(i int, j int) int {
+			return round2(weights[j]*left[i]+(256-weights[j])*above[w-1], 8)
+		}
+	case PAETH_PRED:
+		pred = func(i int, j int) int {
+			base := above[j] + left[i] - aboveLeft
+			pLeft := abs(base - left[i])
+			pTop := abs(base - above[j])
+			pTopLeft := abs(base - aboveLeft)
+			if pLeft <= pTop && pLeft <= pTopLeft {
+				return left[i]
+			} else if pTop <= pTopLeft {
+				return above[j]
+			}
+			return aboveLeft
+		}
+	default:
+		pred = directionalIntraPrediction(plane, x, y, haveLeft, haveAbove, mode, w, h, maxX, maxY, aboveRow, leftCol)
+	}
+
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			setSample(p, x+j, y+i, pred(i, j))
+		}
+	}
+}
+
+// directionalIntraPrediction filters and upsamples the edges in aboveRow
+// and leftCol as the angle of mode needs, and returns the prediction of
+// sample (j, i) of the block along that angle.
+func directionalIntraPrediction(plane int, x int, y int, haveLeft bool, haveAbove bool, mode int, w int, h int, maxX int, maxY int, aboveRow []int, leftCol []int) func(i int, j int) int {
+	o := INTRA_EDGE_OFFSET
+
+	angleDelta := AngleDeltaY
+	if plane > 0 {
+		angleDelta = AngleDeltaUV
+	}
+	pAngle := ModeToAngle[mode] + angleDelta*ANGLE_STEP
+
+	upsampleAbove := 0
+	upsampleLeft := 0
+	if sh.enableIntraEdgeFilter {
+		filterType := getFilterType(plane)
+
+		if pAngle != 90 && pAngle != 180 {
+			if pAngle > 90 && pAngle < 180 && w+h >= 24 {
+				s := leftCol[o]*5 + aboveRow[o-1]*6 + aboveRow[o]*5
+				aboveRow[o-1] = round2(s, 4)
+				leftCol[o-1] = aboveRow[o-1]
+			}
+
+			if haveAbove {
+				strength := intraEdgeFilterStrengthSelection(w, h, filterType, pAngle-90)
+				numPx := min(w, maxX-x+1) + 1
+				if pAngle < 90 {
+					numPx += h
+				}
+				intraEdgeFilter(aboveRow, numPx, strength)
+			}
+
+			if haveLeft {
+				strength := intraEdgeFilterStrengthSelection(w, h, filterType, pAngle-180)
+				numPx := min(h, maxY-y+1) + 1
+				if pAngle > 180 {
+					numPx += w
+				}
+				intraEdgeFilter(leftCol, numPx, strength)
+			}
+		}
+
+		if intraEdgeUpsampleSelection(w, h, filterType, pAngle-90) {
+			upsampleAbove = 1
+			numPx := w
+			if pAngle < 90 {
+				numPx += h
+			}
+			intraEdgeUpsample(aboveRow, numPx)
+		}
+
+		if intraEdgeUpsampleSelection(w, h, filterType, pAngle-180) {
+			upsampleLeft = 1
+			numPx := h
+			if pAngle > 180 {
+				numPx += w
+			}
+			intraEdgeUpsample(leftCol, numPx)
+		}
+	}
+
+	var dx, dy int
+	if pAngle < 90 {
+		dx = DrIntraDerivative[pAngle]
+	} else if pAngle > 90 && pAngle < 180 {
+		dx = DrIntraDerivative[180-pAngle]
+	}
+	if pAngle > 90 && pAngle < 180 {
+		dy = DrIntraDerivative[pAngle-90]
+	} else if pAngle > 180 {
+		dy = DrIntraDerivative[270-pAngle]
+	}
+
+	interpolate := func(edge []int, base int, shift int) int {
+		return round2(edge[o+base]*(32-shift)+edge[o+base+1]*shift, 5)
+	}
+
+	switch {
+	case pAngle < 90:
+		maxBaseX := (w + h - 1) << upsampleAbove
+		return func(i int, j int) int {
+			idx := (i + 1) * dx
+			base := (idx >> (6 - upsampleAbove)) + (j << upsampleAbove)
+			if base >= maxBaseX {
+				return aboveRow[o+maxBaseX]
+			}
+			shift := ((idx << upsampleAbove) >> 1) & 0x1F
+			return interpolate(aboveRow, base, shift)
+		}
+	case pAngle > 90 && pAngle < 180:
+		return func(i int, j int) int {
+			idx := (j << 6) - (i+1)*dx
+			base := idx >> (6 - upsampleAbove)
+			if base >= -(1 << upsampleAbove) {
+				shift := ((idx << upsampleAbove) >> 1) & 0x1F
+				return interpolate(aboveRow, base, shift)
+			}
+
+			idx = (i << 6) - (j+1)*dy
+			base = idx >> (6 - upsampleLeft)
+			shift := ((idx << upsampleLeft) >> 1) & 0x1F
+			return interpolate(leftCol, base, shift)
+		}
+	case pAngle > 180:
+		return func(i int, j int) int {
+			idx := (j + 1) * dy
+			base := (idx >> (6 - upsampleLeft)) + (i << upsampleLeft)
+			shift := ((idx << upsampleLeft) >> 1) & 0x1F
+			return interpolate(leftCol, base, shift)
+		}
+	case pAngle == 90:
+		return func(i int, j int) int { return aboveRow[o+j] }
+	default:
+		return func(i int, j int) int { return leftCol[o+i] }
+	}
+}
+
+// getFilterType reports whether the block above or to the left of the
+// current one in plane uses a smooth prediction mode.
+func getFilterType(plane int) bool {
+	subX, subY := 0, 0
+	availU, availL := AvailU, AvailL
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+		availU, availL = AvailUChroma, AvailLChroma
+	}
+
+	aboveSmooth := false
+	if availU {
+		r := MiRow - 1
+		c := MiCol
+		if plane > 0 {
+			if subX != 0 && (MiCol&1) == 0 {
+				c++
+			}
+			if subY != 0 && (MiRow&1) != 0 {
+				r--
+			}
+		}
+		aboveSmooth = isSmooth(r, c, plane)
+	}
+
+	leftSmooth := false
+	if availL {
+		r := MiRow
+		c := MiCol - 1
+		if plane > 0 {
+			if subX != 0 && (MiCol&1) != 0 {
+				c--
+			}
+			if subY != 0 && (MiRow&1) == 0 {
+				r++
+			}
+		}
+		leftSmooth = isSmooth(r, c, plane)
+	}
+
+	return aboveSmooth || leftSmooth
+}
+
+func isSmooth(row int, col int, plane int) bool {
+	var mode int
+	if plane == 0 {
+		mode = YModes[row][col]
+	} else {
+		if RefFrames[row][col][0] > INTRA_FRAME {
+			return false
+		}
+		mode = UVModes[row][col]
+	}
+
+	return mode == SMOOTH_PRED || mode == SMOOTH_V_PRED || mode == SMOOTH_H_PRED
+}
+
+func intraEdgeFilterStrengthSelection(w int, h int, filterType bool, delta int) int {
+	d := abs(delta)
+	blkWh := w + h
+
+	strength := 0
+	if !filterType {
+		switch {
+		case blkWh <= 8:
+			if d >= 56 {
+				strength = 1
+			}
+		case blkWh <= 16:
+			if d >= 40 {
+				strength = 1
+			}
+		case blkWh <= 24:
+			if d >= 8 {
+				strength = 1
+			}
+			if d >= 16 {
+				strength = 2
+			}
+			if d >= 32 {
+				strength = 3
+			}
+		case blkWh <= 32:
+			if d >= 1 {
+				strength = 1
+			}
+			if d >= 4 {
+				strength = 2
+			}
+			if d >= 32 {
+				strength = 3
+			}
+		default:
+			if d >= 1 {
+				strength = 3
+			}
+		}
+	} else {
+		switch {
+		case blkWh <= 8:
+			if d >= 40 {
+				strength = 1
+			}
+			if d >= 64 {
+				strength = 2
+			}
+		case blkWh <= 16:
+			if d >= 20 {
+				strength = 1
+			}
+			if d >= 48 {
+				strength = 2
+			}
+		case blkWh <= 24:
+			if d >= 4 {
+				strength = 3
+			}
+		default:
+			if d >= 1 {
+				strength = 3
+			}
+		}
+	}
+
+	return strength
+}
+
+// intraEdgeFilter smooths the first sz samples of edge, starting at the
+// above left sample.
+func intraEdgeFilter(edge []int, sz int, strength int) {
+	if strength == 0 {
+		return
+	}
+
+	o := INTRA_EDGE_OFFSET
+	filtered := make([]int, sz)
+	copy(filtered, edge[o-1:o-1+sz])
+	for i := 1; i < sz; i++ {
+		s := 0
+		for j := 0; j < INTRA_EDGE_TAPS; j++ {
+			k := clip3(0, sz-1, i-2+j)
+			s += IntraEdgeKernel[strength-1][j] * edge[o-1+k]
+		}
+		filtered[i] = (s + 8) >> 4
+	}
+	copy(edge[o-1:], filtered)
+}
+
+func intraEdgeUpsampleSelection(w int, h int, filterType bool, delta int) bool {
+	d := abs(delta)
+	blkWh := w + h
+
+	if d <= 0 || d >= 40 {
+		return false
+	} else if !filterType {
+		return blkWh <= 16
+	}
+	return blkWh <= 8
+}
+
+// intraEdgeUpsample doubles the resolution of the first numPx samples of
+// edge, so that they and the interpolated ones start at index -2.
+func intraEdgeUpsample(edge []int, numPx int) {
+	o := INTRA_EDGE_OFFSET
+
+	dup := make([]int, numPx+3)
+	dup[0] = edge[o-1]
+	for i := -1; i < numPx; i++ {
+		dup[i+2] = edge[o+i]
+	}
+	dup[numPx+2] = edge[o+numPx-1]
+
+	edge[o-2] = dup[0]
+	for i := 0; i < numPx; i++ {
+		s := -dup[i] + 9*dup[i+1] + 9*dup[i+2] - dup[i+3]
+		edge[o+2*i-1] = clip1(round2(s, 4))
+		edge[o+2*i] = dup[i+2]
+	}
+}
+
+func dcPrediction(above []int, left []int, haveAbove bool, haveLeft bool, log2W int, log2H int) int {
+	w := 1 << log2W
+	h := 1 << log2H
+
+	sum := 0
+	if haveAbove {
+		for k := 0; k < w; k++ {
+			sum += above[k]
+		}
+	}
+	if haveLeft {
+		for k := 0; k < h; k++ {
+			sum += left[k]
+		}
+	}
+
+	switch {
+	case haveAbove && haveLeft:
+		return (sum + ((w + h) >> 1)) / (w + h)
+	case haveLeft:
+		return (sum + (h >> 1)) >> log2H
+	case haveAbove:
+		return (sum + (w >> 1)) >> log2W
+	default:
+		return 1 << (BitDepth - 1)
+	}
+}
+
+func smWeights(log2Size int) []int {
+	switch log2Size {
+	case 2:
+		return SmWeightsTx4x4
+	case 3:
+		return SmWeightsTx8x8
+	case 4:
+		return SmWeightsTx16x16
+	case 5:
+		return SmWeightsTx32x32
+	default:
+		return SmWeightsTx64x64
+	}
+}
@@ -0,0 +1,161 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupIntraTest sets up a 32x32 8-bit monochrome frame whose row 7 holds
+// 10 + x and whose column 7 holds 100 + y, the edges of a block at (8, 8).
+func setupIntraTest(t *testing.T) *Plane {
+	saveGlobals(t, &BitDepth, &sh, &MiCols, &MiRows, &CurrFrame, &AngleDeltaY, &AngleDeltaUV)
+
+	BitDepth = 8
+	sh = SequenceHeader{colorConfig: ColorConfig{bitDepth: 8, monoChrome: true}}
+	MiCols = 8
+	MiRows = 8
+	CurrFrame = NewFrame(32, 32, sh.colorConfig)
+
+	p := &CurrFrame.Planes[0]
+	for i := 0; i < 32; i++ {
+		p.Set(i, 7, 10+i)
+		p.Set(7, i, 100+i)
+	}
+	return p
+}
+
+func intraBlock(p *Plane, x int, y int, w int, h int) [][]int {
+	block := make([][]int, h)
+	for i := range block {
+		block[i] = make([]int, w)
+		for j := range block[i] {
+			block[i][j] = p.At(x+j, y+i)
+		}
+	}
+	return block
+}
+
+func TestPredictIntraDc(t *testing.T) {
+	p := setupIntraTest(t)
+
+	predictIntra(0, 8, 8, false, false, false, false, DC_PRED, 2, 2)
+	assert.Equal(t, 128, p.At(8, 8))
+	assert.Equal(t, 128, p.At(11, 11))
+
+	// Above 18..21 and left 108..111 average to (78 + 438 + 4) / 8.
+	predictIntra(0, 8, 8, true, true, false, false, DC_PRED, 2, 2)
+	assert.Equal(t, 65, p.At(10, 9))
+
+	predictIntra(0, 8, 8, false, true, false, false, DC_PRED, 3, 2)
+	assert.Equal(t, (18+19+20+21+22+23+24+25+4)>>3, p.At(15, 11))
+}
+
+func TestPredictIntraVerticalHorizontal(t *testing.T) {
+	p := setupIntraTest(t)
+
+	predictIntra(0, 8, 8, true, true, false, false, V_PRED, 2, 3)
+	assert.Equal(t, [][]int{
+		{18, 19, 20, 21}, {18, 19, 20, 21}, {18, 19, 20, 21}, {18, 19, 20, 21},
+		{18, 19, 20, 21}, {18, 19, 20, 21}, {18, 19, 20, 21}, {18, 19, 20, 21},
+	}, intraBlock(p, 8, 8, 4, 8))
+
+	predictIntra(0, 8, 8, true, true, false, false, H_PRED, 2, 2)
+	assert.Equal(t, [][]int{
+		{108, 108, 108, 108}, {109, 109, 109, 109}, {110, 110, 110, 110}, {111, 111, 111, 111},
+	}, intraBlock(p, 8, 8, 4, 4))
+
+	// Without a left edge the left column repeats the sample above the
+	// block.
+	predictIntra(0, 8, 8, false, true, false, false, H_PRED, 2, 2)
+	assert.Equal(t, 18, p.At(11, 11))
+}
+
+func TestPredictIntraSmooth(t *testing.T) {
+	p := setupIntraTest(t)
+
+	predictIntra(0, 8, 8, true, true, false, false, SMOOTH_PRED, 2, 2)
+	assert.Equal(t, round2(255*18+1*111+255*108+1*21, 9), p.At(8, 8))
+	assert.Equal(t, round2(64*21+192*111+64*111+192*21, 9), p.At(11, 11))
+
+	predictIntra(0, 8, 8, true, true, false, false, SMOOTH_V_PRED, 2, 2)
+	assert.Equal(t, round2(149*19+107*111, 8), p.At(9, 9))
+
+	predictIntra(0, 8, 8, true, true, false, false, SMOOTH_H_PRED, 2, 2)
+	assert.Equal(t, round2(149*109+107*21, 8), p.At(9, 9))
+}
+
+func TestPredictIntraPaeth(t *testing.T) {
+	p := setupIntraTest(t)
+	p.Set(7, 7, 20)
+
+	predictIntra(0, 8, 8, true, true, false, false, PAETH_PRED, 2, 2)
+
+	// base = 18 + 108 - 20 is closest to the left sample.
+	assert.Equal(t, 108, p.At(8, 8))
+}
+
+func TestPredictIntraDirectional(t *testing.T) {
+	p := setupIntraTest(t)
+
+	// D45 copies the above row one sample further right on every row.
+	predictIntra(0, 8, 8, true, true, true, false, D45_PRED, 2, 2)
+	assert.Equal(t, [][]int{
+		{19, 20, 21, 22},
+		{20, 21, 22, 23},
+		{21, 22, 23, 24},
+		{22, 23, 24, 25},
+	}, intraBlock(p, 8, 8, 4, 4))
+
+	// D135 continues the above row below the diagonal from the above left
+	// sample and the left column above it.
+	predictIntra(0, 8, 8, true, true, false, false, D135_PRED, 2, 2)
+	assert.Equal(t, [][]int{
+		{107, 18, 19, 20},
+		{108, 107, 18, 19},
+		{109, 108, 107, 18},
+		{110, 109, 108, 107},
+	}, intraBlock(p, 8, 8, 4, 4))
+
+	// D203 interpolates down the left column, which is repeated past its
+	// last sample.
+	predictIntra(0, 8, 8, true, true, false, false, D203_PRED, 2, 2)
+	assert.Equal(t, []int{108, 109, 109, 110}, intraBlock(p, 8, 8, 4, 4)[0])
+	assert.Equal(t, []int{110, 111, 111, 111}, intraBlock(p, 8, 8, 4, 4)[2])
+	assert.Equal(t, []int{111, 111, 111, 111}, intraBlock(p, 8, 8, 4, 4)[3])
+
+	// An angle delta of -3 steps turns D45 into 36 degrees.
+	AngleDeltaY = -3
+	predictIntra(0, 8, 8, true, true, true, false, D45_PRED, 2, 2)
+	assert.Equal(t, []int{19, 20, 21, 22}, intraBlock(p, 8, 8, 4, 4)[0])
+	assert.Equal(t, []int{21, 22, 23, 24}, intraBlock(p, 8, 8, 4, 4)[1])
+}
+
+func TestPredictIntraEdgeFilter(t *testing.T) {
+	p := setupIntraTest(t)
+	sh.enableIntraEdgeFilter = true
+
+	// The filter pulls the first above sample towards the above left one
+	// and leaves the linear ramps alone.
+	predictIntra(0, 8, 8, true, true, false, false, D135_PRED, 3, 3)
+	assert.Equal(t, []int{107, 41, 19, 20, 21, 22, 23, 24}, intraBlock(p, 8, 8, 8, 1)[0])
+	assert.Equal(t, []int{108, 107, 41, 19, 20, 21, 22, 23}, intraBlock(p, 8, 9, 8, 1)[0])
+}
+
+func TestPredictIntraEdgeUpsample(t *testing.T) {
+	p := setupIntraTest(t)
+	sh.enableIntraEdgeFilter = true
+
+	// D203 on a 4x4 block upsamples the left column.
+	predictIntra(0, 8, 8, true, true, false, false, D203_PRED, 2, 2)
+	assert.Equal(t, []int{109, 109, 110, 110}, intraBlock(p, 8, 8, 4, 4)[0])
+	assert.Equal(t, []int{110, 110, 111, 111}, intraBlock(p, 8, 8, 4, 4)[1])
+}
+
+func TestIntraEdgeFilterStrengthSelection(t *testing.T) {
+	assert.Equal(t, 0, intraEdgeFilterStrengthSelection(4, 4, false, 45))
+	assert.Equal(t, 1, intraEdgeFilterStrengthSelection(4, 4, false, 56))
+	assert.Equal(t, 1, intraEdgeFilterStrengthSelection(16, 16, false, 1))
+	assert.Equal(t, 3, intraEdgeFilterStrengthSelection(16, 16, true, 1))
+	assert.Equal(t, 2, intraEdgeFilterStrengthSelection(4, 4, true, -64))
+}
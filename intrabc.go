@@ -0,0 +1,145 @@
+package boulder
+
+const INTRABC_DELAY_PIXELS = 256
+const INTRABC_DELAY_SB64 = 4
+
+var (
+	DefaultIntrabcCdf = [3]int{30531, 32768, 0}
+	IntrabcCdf        [3]int
+	SavedIntrabcCdf   [NUM_REF_FRAMES][3]int
+)
+
+// intrabcModeInfo reads use_intrabc for a block of an intra frame and, when
+// it is set, sets the block up as an inter block predicting from the
+// already decoded part of the current frame and reads its displacement
+// vector.
+func intrabcModeInfo(r *Reader) {
+	RefFrame[0] = INTRA_FRAME
+	RefFrame[1] = NONE
+
+	if uh.allowIntrabc {
+		UseIntrabc = readSymbol(r, IntrabcCdf[:]) == 1
+	} else {
+		UseIntrabc = false
+	}
+
+	if !UseIntrabc {
+		return
+	}
+
+	IsInter = true
+	MotionMode = SIMPLE
+	CompoundType = COMPOUND_AVERAGE
+	PaletteSizeY = 0
+	PaletteSizeUV = 0
+	InterpFilter[0] = BILINEAR
+	InterpFilter[1] = BILINEAR
+
+	findMvStack(false)
+	assignMv(r, false)
+}
+
+// predictDv sets PredMv[0] for an intra block copy. When the stack holds no
+// usable vector the prediction points one superblock up, or to the left
+// when that would leave the tile.
+func predictDv() {
+	PredMv[0] = RefStackMv[0][0]
+	if PredMv[0][0] == 0 && PredMv[0][1] == 0 {
+		PredMv[0] = RefStackMv[1][0]
+	}
+
+	if PredMv[0][0] == 0 && PredMv[0][1] == 0 {
+		sbSize := BLOCK_64X64
+		if sh.use128x128Superblock {
+			sbSize = BLOCK_128X128
+		}
+		sbSize4 := Num4x4BlocksHigh[sbSize]
+
+		if MiRow-sbSize4 < MiRowStart {
+			PredMv[0][0] = 0
+			PredMv[0][1] = -(sbSize4*MI_SIZE + INTRABC_DELAY_PIXELS) * 8
+		} else {
+			PredMv[0][0] = -(sbSize4 * MI_SIZE * 8)
+			PredMv[0][1] = 0
+		}
+	}
+}
+
+// isMvValid checks the range of the motion vectors of the current block
+// and, for intra block copy, that the vector only references samples of
+// the tile that are decoded and far enough away from the current
+// superblock to not be affected by the pipeline delay of a decoder.
+func isMvValid(isCompound bool) bool {
+	numMvs := 1
+	if isCompound {
+		numMvs = 2
+	}
+
+	for i := 0; i < numMvs; i++ {
+		for comp := 0; comp < 2; comp++ {
+			if abs(Mv[i][comp]) >= (1 << 14) {
+				return false
+			}
+		}
+	}
+
+	if !UseIntrabc {
+		return true
+	}
+
+	bw := BlockWidth[MiSize]
+	bh := BlockHeight[MiSize]
+
+	if (Mv[0][0]&7) != 0 || (Mv[0][1]&7) != 0 {
+		return false
+	}
+
+	deltaRow := Mv[0][0] >> 3
+	deltaCol := Mv[0][1] >> 3
+	srcTopEdge := MiRow*MI_SIZE + deltaRow
+	srcLeftEdge := MiCol*MI_SIZE + deltaCol
+	srcBottomEdge := srcTopEdge + bh
+	srcRightEdge := srcLeftEdge + bw
+
+	if HasChroma {
+		if bw < 8 && sh.colorConfig.subsamplingX != 0 {
+			srcLeftEdge -= 4
+		}
+		if bh < 8 && sh.colorConfig.subsamplingY != 0 {
+			srcTopEdge -= 4
+		}
+	}
+
+	if srcTopEdge < MiRowStart*MI_SIZE ||
+		srcLeftEdge < MiColStart*MI_SIZE ||
+		srcBottomEdge > MiRowEnd*MI_SIZE ||
+		srcRightEdge > MiColEnd*MI_SIZE {
+		return false
+	}
+
+	sbSize := BLOCK_64X64
+	if sh.use128x128Superblock {
+		sbSize = BLOCK_128X128
+	}
+	sbH := BlockHeight[sbSize]
+
+	activeSbRow := (MiRow * MI_SIZE) / sbH
+	activeSb64Col := (MiCol * MI_SIZE) >> 6
+	srcSbRow := (srcBottomEdge - 1) / sbH
+	srcSb64Col := (srcRightEdge - 1) >> 6
+	totalSb64PerRow := ((MiColEnd - MiColStart - 1) >> 4) + 1
+	activeSb64 := activeSbRow*totalSb64PerRow + activeSb64Col
+	srcSb64 := srcSbRow*totalSb64PerRow + srcSb64Col
+
+	if srcSb64 >= activeSb64-INTRABC_DELAY_SB64 {
+		return false
+	}
+
+	gradient := 1 + INTRABC_DELAY_SB64 + boolToInt(sbH > 64)
+	wfOffset := gradient * (activeSbRow - srcSbRow)
+	if srcSbRow > activeSbRow || srcSb64Col >= activeSb64Col-INTRABC_DELAY_SB64+wfOffset {
+		return false
+	}
+
+	return true
+}
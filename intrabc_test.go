@@ -0,0 +1,108 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupIntrabcTest(t *testing.T) {
+	setupMvPredTest(t)
+	saveGlobals(t, &UseIntrabc, &HasChroma, &Mv, &PredMv)
+	MiRows = 64
+	MiCols = 64
+	MiRowEnd = MiRows
+	MiColEnd = MiCols
+	allocModeInfo()
+
+	UseIntrabc = true
+	HasChroma = false
+	MiSize = BLOCK_8X8
+	MiRow = 16
+	MiCol = 32
+}
+
+func TestIsMvValidIntrabc(t *testing.T) {
+	setupIntrabcTest(t)
+	defer func() { UseIntrabc = false }()
+
+	Mv[0] = [2]int{-64 * 8, -128 * 8}
+	assert.True(t, isMvValid(false))
+
+	Mv[0] = [2]int{-64*8 + 4, -128 * 8}
+	assert.False(t, isMvValid(false), "sub pixel vector")
+
+	Mv[0] = [2]int{-80 * 8, -128 * 8}
+	assert.False(t, isMvValid(false), "above the tile")
+
+	Mv[0] = [2]int{-8 * 8, 0}
+	assert.False(t, isMvValid(false), "inside the delayed region")
+
+	Mv[0] = [2]int{-64 * 8, 128 * 8}
+	assert.False(t, isMvValid(false), "right of the tile")
+
+	MiColEnd = 256
+	MiCol = 0
+	Mv[0] = [2]int{-64 * 8, 640 * 8}
+	assert.False(t, isMvValid(false), "ahead of the wavefront")
+
+	Mv[0] = [2]int{-64 * 8, 0}
+	assert.True(t, isMvValid(false))
+}
+
+func TestIsMvValidRange(t *testing.T) {
+	UseIntrabc = false
+
+	Mv[0] = [2]int{(1 << 14) - 1, 0}
+	assert.True(t, isMvValid(false))
+
+	Mv[1] = [2]int{0, -(1 << 14)}
+	assert.True(t, isMvValid(false))
+	assert.False(t, isMvValid(true))
+}
+
+func TestPredictDv(t *testing.T) {
+	setupIntrabcTest(t)
+	defer func() { UseIntrabc = false }()
+
+	RefStackMv[0][0] = [2]int{0, 0}
+	RefStackMv[1][0] = [2]int{0, 0}
+	predictDv()
+	assert.Equal(t, [2]int{-64 * 8, 0}, PredMv[0])
+
+	MiRow = 4
+	predictDv()
+	assert.Equal(t, [2]int{0, -(64 + INTRABC_DELAY_PIXELS) * 8}, PredMv[0])
+
+	RefStackMv[1][0] = [2]int{-8, 16}
+	predictDv()
+	assert.Equal(t, [2]int{-8, 16}, PredMv[0])
+
+	RefStackMv[0][0] = [2]int{24, -32}
+	predictDv()
+	assert.Equal(t, [2]int{24, -32}, PredMv[0])
+}
+
+func TestPredictInterIntrabcCopiesCurrentFrame(t *testing.T) {
+	setupInterTest(t)
+	UseIntrabc = true
+	defer func() { UseIntrabc = false }()
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			CurrFrame.Planes[0].Set(x, y, 10*y+x)
+		}
+	}
+
+	RefFrames[4][4] = [2]int{INTRA_FRAME, NONE}
+	Mvs[4][4][0] = [2]int{-16 * 8, -16 * 8}
+	InterpFilters[4][4] = [2]int{BILINEAR, BILINEAR}
+
+	predictInter(0, 16, 16, 8, 8, 4, 4)
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			assert.Equal(t, 10*y+x, CurrFrame.Planes[0].At(x+16, y+16))
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package boulder
+
+const MAX_LOOP_FILTER = 63
+const SEG_LVL_ALT_LF_Y_V = 1
+
+const (
+	TX_4X4 = iota
+	TX_8X8
+	TX_16X16
+	TX_32X32
+	TX_64X64
+	TX_4X8
+	TX_8X4
+	TX_8X16
+	TX_16X8
+	TX_16X32
+	TX_32X16
+	TX_32X64
+	TX_64X32
+	TX_4X16
+	TX_16X4
+	TX_8X32
+	TX_32X8
+	TX_16X64
+	TX_64X16
+	TX_SIZES_ALL
+)
+
+var (
+	TxWidth  = [TX_SIZES_ALL]int{4, 8, 16, 32, 64, 4, 8, 8, 16, 16, 32, 32, 64, 4, 16, 8, 32, 16, 64}
+	TxHeight = [TX_SIZES_ALL]int{4, 8, 16, 32, 64, 8, 4, 16, 8, 32, 16, 64, 32, 16, 4, 32, 8, 64, 16}
+
+	Skip              bool
+	Skips             [][]bool
+	SegmentIds        [][]int
+	DeltaLFs          [][][FRAME_LF_COUNT]int
+	LoopfilterTxSizes [3][][]int
+)
+
+// loopFilterProcess applies the deblocking filter to CurrFrame, first
+// across all vertical edges of a plane and then across all horizontal ones.
+func loopFilterProcess() {
+	lf := uh.loopFilterParams
+	if lf.loopFilterLevel[0] == 0 && lf.loopFilterLevel[1] == 0 {
+		return
+	}
+
+	for plane := 0; plane < NumPlanes; plane++ {
+		if plane != 0 && lf.loopFilterLevel[1+plane] == 0 {
+			continue
+		}
+
+		rowStep, colStep := 1, 1
+		if plane > 0 {
+			rowStep = 1 << sh.colorConfig.subsamplingY
+			colStep = 1 << sh.colorConfig.subsamplingX
+		}
+
+		for pass := 0; pass < 2; pass++ {
+			for row := 0; row < MiRows; row += rowStep {
+				for col := 0; col < MiCols; col += colStep {
+					edgeLoopFilter(plane, pass, row, col)
+				}
+			}
+		}
+	}
+}
+
+func edgeLoopFilter(plane int, pass int, row int, col int) {
+	subX, subY := 0, 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	dx, dy := 1, 0
+	if pass == 1 {
+		dx, dy = 0, 1
+	}
+
+	x := col * MI_SIZE
+	y := row * MI_SIZE
+	row |= subY
+	col |= subX
+
+	onScreen := true
+	if x >= FrameWidth || y >= FrameHeight {
+		onScreen = false
+	} else if pass == 0 && x == 0 {
+		onScreen = false
+	} else if pass == 1 && y == 0 {
+		onScreen = false
+	}
+	if !onScreen {
+		return
+	}
+
+	xP := x >> subX
+	yP := y >> subY
+
+	prevRow := row - (dy << subY)
+	prevCol := col - (dx << subX)
+
+	miSize := MiSizes[row][col]
+	txSz := LoopfilterTxSizes[plane][row>>subY][col>>subX]
+	planeSize := getPlaneResidualSize(miSize, plane)
+	skip := Skips[row][col]
+	isIntra := RefFrames[row][col][0] <= INTRA_FRAME
+	prevTxSz := LoopfilterTxSizes[plane][prevRow>>subY][prevCol>>subX]
+
+	isBlockEdge := false
+	if pass == 0 && xP%BlockWidth[planeSize] == 0 {
+		isBlockEdge = true
+	}
+	if pass == 1 && yP%BlockHeight[planeSize] == 0 {
+		isBlockEdge = true
+	}
+
+	isTxEdge := false
+	if pass == 0 && xP%TxWidth[txSz] == 0 {
+		isTxEdge = true
+	}
+	if pass == 1 && yP%TxHeight[txSz] == 0 {
+		isTxEdge = true
+	}
+
+	applyFilter := isTxEdge && (isBlockEdge || !skip || isIntra)
+
+	filterSize := filterSizeProcess(txSz, prevTxSz, pass, plane)
+
+	lvl, limit, blimit, thresh := adaptiveFilterStrength(row, col, plane, pass)
+	if lvl == 0 {
+		lvl, limit, blimit, thresh = adaptiveFilterStrength(prevRow, prevCol, plane, pass)
+	}
+
+	for i := 0; i < MI_SIZE; i++ {
+		if applyFilter && lvl > 0 {
+			sampleFiltering(xP+dy*i, yP+dx*i, plane, limit, blimit, thresh, dx, dy, filterSize)
+		}
+	}
+}
+
+func filterSizeProcess(txSz int, prevTxSz int, pass int, plane int) int {
+	var baseSize int
+	if pass == 0 {
+		baseSize = min(TxWidth[prevTxSz], TxWidth[txSz])
+	} else {
+		baseSize = min(TxHeight[prevTxSz], TxHeight[txSz])
+	}
+
+	if plane == 0 {
+		return min(16, baseSize)
+	}
+	return min(8, baseSize)
+}
+
+func adaptiveFilterStrength(row int, col int, plane int, pass int) (lvl int, limit int, blimit int, thresh int) {
+	segment := SegmentIds[row][col]
+	ref := RefFrames[row][col][0]
+	mode := YModes[row][col]
+
+	modeType := 0
+	if mode >= NEARESTMV && mode != GLOBALMV && mode != GLOBAL_GLOBALMV {
+		modeType = 1
+	}
+
+	var deltaLF int
+	if !uh.deltaLfMulti {
+		deltaLF = DeltaLFs[row][col][0]
+	} else if plane == 0 {
+		deltaLF = DeltaLFs[row][col][pass]
+	} else {
+		deltaLF = DeltaLFs[row][col][plane+1]
+	}
+
+	lvl = adaptiveFilterStrengthSelection(segment, ref, modeType, deltaLF, plane, pass)
+
+	sharpness := uh.loopFilterParams.loopFilterSharpness
+	shift := 0
+	if sharpness > 4 {
+		shift = 2
+	} else if sharpness > 0 {
+		shift = 1
+	}
+
+	if sharpness > 0 {
+		limit = clip3(1, 9-sharpness, lvl>>shift)
+	} else {
+		limit = max(1, lvl>>shift)
+	}
+	blimit = 2*(lvl+2) + limit
+	thresh = lvl >> 4
+
+	return lvl, limit, blimit, thresh
+}
+
+func adaptiveFilterStrengthSelection(segment int, ref int, modeType int, deltaLF int, plane int, pass int) int {
+	lf := uh.loopFilterParams
+
+	i := plane + 1
+	if plane == 0 {
+		i = pass
+	}
+
+	baseFilterLevel := clip3(0, MAX_LOOP_FILTER, deltaLF+lf.loopFilterLevel[i])
+
+	lvlSeg := baseFilterLevel
+	feature := SEG_LVL_ALT_LF_Y_V + i
+	if segFeatureActiveIdx(segment, feature, uh.segmentationEnabled) {
+		lvlSeg = FeatureData[segment][feature]
+		lvlSeg = clip3(0, MAX_LOOP_FILTER, baseFilterLevel+lvlSeg)
+	}
+
+	if lf.loopFilterDeltaEnabled {
+		nShift := lvlSeg >> 5
+		if ref == INTRA_FRAME {
+			lvlSeg += lf.loopFilterRefDeltas[INTRA_FRAME] << nShift
+		} else {
+			lvlSeg += (lf.loopFilterRefDeltas[ref] << nShift) + (lf.loopFilterModeDeltas[modeType] << nShift)
+		}
+		lvlSeg = clip3(0, MAX_LOOP_FILTER, lvlSeg)
+	}
+
+	return lvlSeg
+}
+
+func sampleFiltering(x int, y int, plane int, limit int, blimit int, thresh int, dx int, dy int, filterSize int) {
+	hevMask, filterMask, flatMask, flatMask2 := filterMaskProcess(x, y, plane, limit, blimit, thresh, dx, dy, filterSize)
+
+	if !filterMask {
+		return
+	}
+
+	if filterSize == 4 || !flatMask {
+		narrowFilter(hevMask, x, y, plane, dx, dy)
+	} else if filterSize == 8 || !flatMask2 {
+		wideFilter(x, y, plane, dx, dy, 3)
+	} else {
+		wideFilter(x, y, plane, dx, dy, 4)
+	}
+}
+
+func filterMaskProcess(x int, y int, plane int, limit int, blimit int, thresh int, dx int, dy int, filterSize int) (hevMask bool, filterMask bool, flatMask bool, flatMask2 bool) {
+	p := &CurrFrame.Planes[plane]
+
+	// q[i] is the i-th sample after the edge and pp[i] the i-th before it.
+	var q, pp [7]int
+	n := 4
+	if filterSize >= 16 {
+		n = 7
+	}
+	for i := 0; i < n; i++ {
+		q[i] = p.At(x+dx*i, y+dy*i)
+		pp[i] = p.At(x-dx*(i+1), y-dy*(i+1))
+	}
+
+	threshBd := thresh << (BitDepth - 8)
+	hevMask = abs(pp[1]-pp[0]) > threshBd || abs(q[1]-q[0]) > threshBd
+
+	var filterLen int
+	if filterSize == 4 {
+		filterLen = 4
+	} else if plane != 0 {
+		filterLen = 6
+	} else if filterSize == 8 {
+		filterLen = 8
+	} else {
+		filterLen = 16
+	}
+
+	limitBd := limit << (BitDepth - 8)
+	blimitBd := blimit << (BitDepth - 8)
+
+	mask := abs(pp[1]-pp[0]) > limitBd ||
+		abs(q[1]-q[0]) > limitBd ||
+		abs(pp[0]-q[0])*2+abs(pp[1]-q[1])/2 > blimitBd
+	if filterLen >= 6 {
+		mask = mask || abs(pp[2]-pp[1]) > limitBd || abs(q[2]-q[1]) > limitBd
+	}
+	if filterLen >= 8 {
+		mask = mask || abs(pp[3]-pp[2]) > limitBd || abs(q[3]-q[2]) > limitBd
+	}
+	filterMask = !mask
+
+	thresholdBd := 1 << (BitDepth - 8)
+
+	if filterSize >= 8 {
+		mask = abs(pp[1]-pp[0]) > thresholdBd ||
+			abs(q[1]-q[0]) > thresholdBd ||
+			abs(pp[2]-pp[0]) > thresholdBd ||
+			abs(q[2]-q[0]) > thresholdBd
+		if filterLen >= 8 {
+			mask = mask || abs(pp[3]-pp[0]) > thresholdBd || abs(q[3]-q[0]) > thresholdBd
+		}
+		flatMask = !mask
+	}
+
+	if filterSize >= 16 {
+		mask = false
+		for i := 4; i < 7; i++ {
+			mask = mask || abs(pp[i]-pp[0]) > thresholdBd || abs(q[i]-q[0]) > thresholdBd
+		}
+		flatMask2 = !mask
+	}
+
+	return hevMask, filterMask, flatMask, flatMask2
+}
+
+func filter4Clamp(x int) int {
+	return clip3(-(1 << (BitDepth - 1)), (1<<(BitDepth-1))-1, x)
+}
+
+func narrowFilter(hevMask bool, x int, y int, plane int, dx int, dy int) {
+	p := &CurrFrame.Planes[plane]
+
+	offset := 0x80 << (BitDepth - 8)
+
+	q0 := p.At(x, y)
+	q1 := p.At(x+dx, y+dy)
+	p0 := p.At(x-dx, y-dy)
+	p1 := p.At(x-2*dx, y-2*dy)
+
+	ps1 := p1 - offset
+	ps0 := p0 - offset
+	qs0 := q0 - offset
+	qs1 := q1 - offset
+
+	filter := 0
+	if hevMask {
+		filter = filter4Clamp(ps1 - qs1)
+	}
+	filter = filter4Clamp(filter + 3*(qs0-ps0))
+	filter1 := filter4Clamp(filter+4) >> 3
+	filter2 := filter4Clamp(filter+3) >> 3
+
+	p.Set(x, y, filter4Clamp(qs0-filter1)+offset)
+	p.Set(x-dx, y-dy, filter4Clamp(ps0+filter2)+offset)
+
+	if !hevMask {
+		filter = round2(filter1, 1)
+		p.Set(x+dx, y+dy, filter4Clamp(qs1-filter)+offset)
+		p.Set(x-2*dx, y-2*dy, filter4Clamp(ps1+filter)+offset)
+	}
+}
+
+func wideFilter(x int, y int, plane int, dx int, dy int, log2Size int) {
+	p := &CurrFrame.Planes[plane]
+
+	var n int
+	if log2Size == 4 {
+		n = 6
+	} else if plane == 0 {
+		n = 3
+	} else {
+		n = 2
+	}
+
+	n2 := 1
+	if log2Size == 3 && plane == 0 {
+		n2 = 0
+	}
+
+	// F holds the samples at offsets -(n+1)..n from the edge.
+	F := make([]int, 2*n+2)
+	for i := -(n + 1); i <= n; i++ {
+		F[i+n+1] = p.At(x+i*dx, y+i*dy)
+	}
+
+	F2 := make([]int, 2*n)
+	for i := -n; i < n; i++ {
+		t := 0
+		for j := -n; j <= n; j++ {
+			k := clip3(-(n + 1), n, i+j)
+			tap := 1
+			if abs(j) <= n2 {
+				tap = 2
+			}
+			t += F[k+n+1] * tap
+		}
+		F2[i+n] = round2(t, log2Size)
+	}
+
+	for i := -n; i < n; i++ {
+		p.Set(x+i*dx, y+i*dy, F2[i+n])
+	}
+}
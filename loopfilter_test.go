@@ -0,0 +1,104 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupLoopFilterTest(t *testing.T, width int, height int) {
+	saveGlobals(t, &sh, &uh, &BitDepth, &NumPlanes, &FrameWidth, &FrameHeight,
+		&MiRows, &MiCols, &CurrFrame, &FeatureEnabled, &FeatureData)
+	saveModeInfo(t)
+
+	sh = SequenceHeader{colorConfig: ColorConfig{bitDepth: 8, monoChrome: true}}
+	uh = UncompressedHeader{}
+	BitDepth = 8
+	NumPlanes = 1
+	FrameWidth = width
+	FrameHeight = height
+	MiRows = height / MI_SIZE
+	MiCols = width / MI_SIZE
+	CurrFrame = NewFrame(width, height, sh.colorConfig)
+	allocModeInfo()
+}
+
+func setLoopFilterRow(y int, x int, values ...int) {
+	for i, v := range values {
+		CurrFrame.Planes[0].Set(x+i, y, v)
+	}
+}
+
+func loopFilterRow(y int, x int, n int) []int {
+	row := make([]int, n)
+	for i := range row {
+		row[i] = CurrFrame.Planes[0].At(x+i, y)
+	}
+	return row
+}
+
+func TestNarrowFilter(t *testing.T) {
+	setupLoopFilterTest(t, 8, 8)
+
+	setLoopFilterRow(0, 2, 90, 100, 110, 120)
+	narrowFilter(false, 4, 0, 0, 1, 0)
+	assert.Equal(t, []int{92, 104, 106, 118}, loopFilterRow(0, 2, 4))
+
+	setLoopFilterRow(0, 2, 90, 100, 110, 120)
+	narrowFilter(true, 4, 0, 0, 1, 0)
+	assert.Equal(t, []int{90, 100, 110, 120}, loopFilterRow(0, 2, 4))
+}
+
+func TestWideFilter(t *testing.T) {
+	setupLoopFilterTest(t, 16, 8)
+
+	setLoopFilterRow(0, 4, 0, 0, 0, 0, 8, 8, 8, 8)
+	wideFilter(8, 0, 0, 1, 0, 3)
+	assert.Equal(t, []int{0, 1, 2, 3, 5, 6, 7, 8}, loopFilterRow(0, 4, 8))
+}
+
+func TestAdaptiveFilterStrengthSelection(t *testing.T) {
+	setupLoopFilterTest(t, 8, 8)
+	uh.loopFilterParams = LoopFilterParams{
+		loopFilterLevel:        []int{10, 20, 30, 40},
+		loopFilterDeltaEnabled: true,
+		loopFilterRefDeltas:    []int{1, 0, 0, 0, -1, 0, -1, -1},
+		loopFilterModeDeltas:   []int{0, 2},
+	}
+
+	assert.Equal(t, 21, adaptiveFilterStrengthSelection(0, INTRA_FRAME, 0, 0, 0, 1))
+	assert.Equal(t, 15, adaptiveFilterStrengthSelection(0, GOLDEN_FRAME, 1, -26, 2, 0))
+	// Levels of 32 and above scale the deltas by two.
+	assert.Equal(t, 33, adaptiveFilterStrengthSelection(0, GOLDEN_FRAME, 0, 5, 1, 0))
+
+	uh.segmentationEnabled = true
+	FeatureEnabled[1][SEG_LVL_ALT_LF_Y_V] = true
+	FeatureData[1][SEG_LVL_ALT_LF_Y_V] = -15
+	assert.Equal(t, 1, adaptiveFilterStrengthSelection(1, INTRA_FRAME, 0, 0, 0, 0))
+}
+
+func TestLoopFilterProcess(t *testing.T) {
+	setupLoopFilterTest(t, 16, 16)
+	uh.loopFilterParams = LoopFilterParams{
+		loopFilterLevel:      []int{32, 0, 0, 0},
+		loopFilterRefDeltas:  make([]int, TOTAL_REFS_PER_FRAME),
+		loopFilterModeDeltas: make([]int, 2),
+	}
+
+	for row := 0; row < MiRows; row++ {
+		for col := 0; col < MiCols; col++ {
+			MiSizes[row][col] = BLOCK_8X8
+			RefFrames[row][col] = [2]int{INTRA_FRAME, NONE}
+			LoopfilterTxSizes[0][row][col] = TX_8X8
+		}
+	}
+	for y := 0; y < 16; y++ {
+		setLoopFilterRow(y, 0, 60, 60, 60, 60, 60, 60, 60, 60, 80, 80, 80, 80, 80, 80, 80, 80)
+	}
+
+	loopFilterProcess()
+
+	for y := 0; y < 16; y++ {
+		assert.Equal(t, []int{60, 60, 60, 60, 60, 63, 65, 68, 73, 75, 78, 80, 80, 80, 80, 80}, loopFilterRow(y, 0, 16))
+	}
+}
@@ -0,0 +1,47 @@
+package boulder
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// MD5Sink hashes shown frames in the byte layout of libaom's --rawvideo
+// output: the planes of each frame one after another, one byte per sample
+// for 8-bit streams and two little endian bytes otherwise. It keeps the
+// MD5 of every frame as well as of the whole stream, the two forms
+// conformance suites ship reference hashes in.
+type MD5Sink struct {
+	stream hash.Hash
+	frames []string
+}
+
+func NewMD5Sink() *MD5Sink {
+	return &MD5Sink{stream: md5.New()}
+}
+
+// WriteFrame adds f to the stream hash and records its own hash. It is
+// meant to be called from Options.OnFrame.
+func (m *MD5Sink) WriteFrame(f *Frame) {
+	frame := md5.New()
+	w := io.MultiWriter(m.stream, frame)
+
+	for plane := 0; plane < f.NumPlanes; plane++ {
+		p := &f.Planes[plane]
+		// Writes to a hash never fail.
+		_ = writePlaneSamples(w, p, p.Width, p.Height)
+	}
+
+	m.frames = append(m.frames, hex.EncodeToString(frame.Sum(nil)))
+}
+
+// Frames returns the hex MD5 of every frame written so far.
+func (m *MD5Sink) Frames() []string {
+	return m.frames
+}
+
+// Sum returns the hex MD5 of all frames written so far.
+func (m *MD5Sink) Sum() string {
+	return hex.EncodeToString(m.stream.Sum(nil))
+}
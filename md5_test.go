@@ -0,0 +1,125 @@
+package boulder
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// referenceMD5s reads the hashes shipped with a conformance stream:
+// streams/foo.obu is checked against foo.md5 next to it or, as in the
+// Argon layout, md5_ref/foo.md5 beside the streams directory. Each line
+// holds one hex digest optionally followed by a file name.
+func referenceMD5s(obuPath string) ([]string, error) {
+	base := strings.TrimSuffix(filepath.Base(obuPath), filepath.Ext(obuPath)) + ".md5"
+	dir := filepath.Dir(obuPath)
+
+	file, err := os.Open(filepath.Join(dir, base))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(filepath.Dir(dir), "md5_ref", base))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sums []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			sums = append(sums, strings.ToLower(fields[0]))
+		}
+	}
+
+	return sums, scanner.Err()
+}
+
+// md5Matches compares sink against the reference hashes of obuPath. A
+// single reference is the whole stream hash, several are per frame.
+func md5Matches(obuPath string, sink *MD5Sink) (bool, error) {
+	sums, err := referenceMD5s(obuPath)
+	if err != nil {
+		return false, err
+	}
+
+	if len(sums) == 1 {
+		return sums[0] == sink.Sum(), nil
+	}
+
+	frames := sink.Frames()
+	if len(sums) != len(frames) {
+		return false, nil
+	}
+	for i := range sums {
+		if sums[i] != frames[i] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func TestMD5Sink(t *testing.T) {
+	f := NewFrame(2, 1, ColorConfig{bitDepth: 8, monoChrome: true})
+	f.Planes[0].Set(0, 0, 'a')
+	f.Planes[0].Set(1, 0, 'b')
+
+	sink := NewMD5Sink()
+	sink.WriteFrame(f)
+	f.Planes[0].Set(1, 0, 'c')
+	sink.WriteFrame(f)
+
+	// md5("ab"), md5("ac") and md5("abac").
+	assert.Equal(t, []string{"187ef4436122d1cc2f40dc2b92f0eba0", "e2075474294983e013ee4dd2201c7a73"}, sink.Frames())
+	assert.Equal(t, "6624a35d3fedaacec13f7af3e51b491f", sink.Sum())
+}
+
+func TestMD5SinkHighBitDepth(t *testing.T) {
+	f := NewFrame(1, 1, ColorConfig{bitDepth: 10, monoChrome: true})
+	f.Planes[0].Set(0, 0, 0x6261)
+
+	sink := NewMD5Sink()
+	sink.WriteFrame(f)
+
+	// Samples are hashed little endian, so this is md5("ab").
+	assert.Equal(t, []string{"187ef4436122d1cc2f40dc2b92f0eba0"}, sink.Frames())
+}
+
+func TestMD5Matches(t *testing.T) {
+	root := t.TempDir()
+	streams := filepath.Join(root, "streams")
+	assert.NoError(t, os.Mkdir(streams, 0o755))
+	obuPath := filepath.Join(streams, "test1.obu")
+
+	f := NewFrame(2, 1, ColorConfig{bitDepth: 8, monoChrome: true})
+	f.Planes[0].Set(0, 0, 'a')
+	f.Planes[0].Set(1, 0, 'b')
+	sink := NewMD5Sink()
+	sink.WriteFrame(f)
+
+	_, err := md5Matches(obuPath, sink)
+	assert.Error(t, err)
+
+	// Argon layout: md5_ref/ beside streams/.
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "md5_ref"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "md5_ref", "test1.md5"), []byte("187ef4436122d1cc2f40dc2b92f0eba0\n"), 0o644))
+	ok, err := md5Matches(obuPath, sink)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// A hash next to the stream takes precedence.
+	assert.NoError(t, os.WriteFile(filepath.Join(streams, "test1.md5"), []byte("187ef4436122d1cc2f40dc2b92f0eba0\n00000000000000000000000000000000\n"), 0o644))
+	ok, err = md5Matches(obuPath, sink)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(streams, "test1.md5"), []byte("187EF4436122D1CC2F40DC2B92F0EBA0  test1.obu\n"), 0o644))
+	ok, err = md5Matches(obuPath, sink)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
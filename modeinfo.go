@@ -0,0 +1,134 @@
+package boulder
+
+const DELTA_Q_SMALL = 3
+const DELTA_LF_SMALL = 3
+const SKIP_CONTEXTS = 3
+
+var (
+	DefaultSkipCdf = [SKIP_CONTEXTS][3]int{
+		{31671, 32768, 0},
+		{16515, 32768, 0},
+		{4576, 32768, 0},
+	}
+	DefaultDeltaQAbsCdf  = [5]int{28160, 32120, 32677, 32768, 0}
+	DefaultDeltaLfAbsCdf = [5]int{28160, 32120, 32677, 32768, 0}
+
+	SkipCdf              [SKIP_CONTEXTS][3]int
+	DeltaQAbsCdf         [5]int
+	DeltaLfAbsCdf        [5]int
+	DeltaLfMultiCdf      [FRAME_LF_COUNT][5]int
+	SavedSkipCdf         [NUM_REF_FRAMES][SKIP_CONTEXTS][3]int
+	SavedDeltaQAbsCdf    [NUM_REF_FRAMES][5]int
+	SavedDeltaLfAbsCdf   [NUM_REF_FRAMES][5]int
+	SavedDeltaLfMultiCdf [NUM_REF_FRAMES][FRAME_LF_COUNT][5]int
+)
+
+// intraFrameModeInfo reads the mode info of a block of an intra frame.
+// Blocks that use intra block copy are read completely; the intra modes of
+// the others are not implemented yet.
+func intraFrameModeInfo(r *Reader) {
+	Skip = false
+	if SegIdPreSkip {
+		intraSegmentId(r)
+	}
+	readSkip(r)
+	if !SegIdPreSkip {
+		intraSegmentId(r)
+	}
+	readCdef(r)
+	readDeltaQIndex(r)
+	readDeltaLf(r)
+	ReadDeltas = false
+
+	intrabcModeInfo(r)
+	if !UseIntrabc {
+		IsInter = false
+		panic(notImplemented("intra_frame_y_mode"))
+	}
+}
+
+func readSkip(r *Reader) {
+	if SegIdPreSkip && segFeatureActiveIdx(SegmentId, SEG_LVL_SKIP, uh.segmentationEnabled) {
+		Skip = true
+		return
+	}
+
+	ctx := 0
+	if AvailU && Skips[MiRow-1][MiCol] {
+		ctx++
+	}
+	if AvailL && Skips[MiRow][MiCol-1] {
+		ctx++
+	}
+	Skip = readSymbol(r, SkipCdf[ctx][:]) == 1
+}
+
+// readDeltaQIndex reads the change of CurrentQIndex at the first block of a
+// superblock, unless that block covers the superblock and is skipped.
+func readDeltaQIndex(r *Reader) {
+	sbSize := BLOCK_64X64
+	if sh.use128x128Superblock {
+		sbSize = BLOCK_128X128
+	}
+	if (MiSize == sbSize && Skip) || !ReadDeltas {
+		return
+	}
+
+	deltaQAbs := readSymbol(r, DeltaQAbsCdf[:])
+	if deltaQAbs == DELTA_Q_SMALL {
+		deltaQRemBits := readLiteral(r, 3) + 1
+		deltaQAbsBits := readLiteral(r, deltaQRemBits)
+		deltaQAbs = deltaQAbsBits + (1 << deltaQRemBits) + 1
+	}
+
+	if deltaQAbs != 0 {
+		reducedDeltaQIndex := deltaQAbs
+		if readLiteral(r, 1) == 1 {
+			reducedDeltaQIndex = -deltaQAbs
+		}
+		CurrentQIndex = clip3(1, 255, CurrentQIndex+(reducedDeltaQIndex<<uh.deltaQRes))
+	}
+}
+
+// readDeltaLf reads the changes of DeltaLF at the first block of a
+// superblock, one shared by all loop filter edges or, with delta_lf_multi,
+// one per edge type.
+func readDeltaLf(r *Reader) {
+	sbSize := BLOCK_64X64
+	if sh.use128x128Superblock {
+		sbSize = BLOCK_128X128
+	}
+	if (MiSize == sbSize && Skip) || !ReadDeltas || !uh.deltaLfPresent {
+		return
+	}
+
+	frameLfCount := 1
+	if uh.deltaLfMulti {
+		frameLfCount = FRAME_LF_COUNT
+		if sh.colorConfig.monoChrome {
+			frameLfCount = FRAME_LF_COUNT - 2
+		}
+	}
+
+	for i := 0; i < frameLfCount; i++ {
+		cdf := DeltaLfAbsCdf[:]
+		if uh.deltaLfMulti {
+			cdf = DeltaLfMultiCdf[i][:]
+		}
+
+		deltaLfAbs := readSymbol(r, cdf)
+		if deltaLfAbs == DELTA_LF_SMALL {
+			n := readLiteral(r, 3) + 1
+			deltaLfAbsBits := readLiteral(r, n)
+			deltaLfAbs = deltaLfAbsBits + (1 << n) + 1
+		}
+
+		if deltaLfAbs != 0 {
+			reducedDeltaLfLevel := deltaLfAbs
+			if readLiteral(r, 1) == 1 {
+				reducedDeltaLfLevel = -deltaLfAbs
+			}
+			DeltaLF[i] = clip3(-MAX_LOOP_FILTER, MAX_LOOP_FILTER, DeltaLF[i]+(reducedDeltaLfLevel<<uh.deltaLfRes))
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupModeInfoTest(t *testing.T) {
+	setupIntrabcTest(t)
+	saveGlobals(t, &SegIdPreSkip, &ReadDeltas, &AvailU, &AvailL, &Skip, &IsInter,
+		&SegmentId, &Lossless, &CurrentQIndex, &DeltaLF, &PaletteSizeY,
+		&PaletteSizeUV, &MotionMode, &CompoundType, &InterpFilter, &MvCtx,
+		&SymbolValue, &SymbolRange, &SymbolMaxBits)
+	saveGlobals(t, &SkipCdf, &DeltaQAbsCdf, &DeltaLfAbsCdf, &DeltaLfMultiCdf,
+		&IntrabcCdf, &MvJointCdf, &MvClassCdf, &MvSignCdf, &MvClass0BitCdf,
+		&MvClass0FrCdf, &MvClass0HpCdf, &MvBitCdf, &MvFrCdf, &MvHpCdf)
+	UseIntrabc = false
+	uh = UncompressedHeader{}
+	sh.enableCdef = false
+	SegIdPreSkip = false
+	ReadDeltas = false
+	AvailU, AvailL = false, false
+	initNonCoeffCdfs()
+}
+
+func TestReadSkipContext(t *testing.T) {
+	setupModeInfoTest(t)
+
+	Skips[MiRow-1][MiCol] = true
+	Skips[MiRow][MiCol-1] = true
+	AvailU, AvailL = true, true
+
+	enc := newSymbolEncoder()
+	cdf := DefaultSkipCdf[2]
+	enc.encode(cdf[:], 1)
+	data := enc.bytes()
+
+	r := Reader{data: data}
+	initSymbol(len(data), &r)
+	readSkip(&r)
+	assert.True(t, Skip)
+	assert.NotEqual(t, DefaultSkipCdf[2], SkipCdf[2])
+	assert.Equal(t, DefaultSkipCdf[0], SkipCdf[0])
+}
+
+func TestReadDeltaQIndex(t *testing.T) {
+	setupModeInfoTest(t)
+	uh.deltaQRes = 1
+	CurrentQIndex = 100
+	ReadDeltas = true
+	Skip = false
+
+	// delta_q_abs of DELTA_Q_SMALL with 2 remaining bits of value 1 gives
+	// an absolute value of 1 + (1 << 2) + 1.
+	enc := newSymbolEncoder()
+	cdf := DefaultDeltaQAbsCdf
+	enc.encode(cdf[:], DELTA_Q_SMALL)
+	for _, b := range []bool{false, false, true, false, true, true} {
+		enc.encodeBool(b)
+	}
+	data := enc.bytes()
+
+	r := Reader{data: data}
+	initSymbol(len(data), &r)
+	readDeltaQIndex(&r)
+	assert.Equal(t, 100-(6<<1), CurrentQIndex)
+
+	ReadDeltas = false
+	readDeltaQIndex(nil)
+	assert.Equal(t, 88, CurrentQIndex)
+}
+
+func TestReadDeltaLfMulti(t *testing.T) {
+	setupModeInfoTest(t)
+	uh.deltaLfPresent = true
+	uh.deltaLfMulti = true
+	sh.colorConfig.monoChrome = true
+	ReadDeltas = true
+	Skip = false
+	for i := range DeltaLF {
+		DeltaLF[i] = 0
+	}
+
+	enc := newSymbolEncoder()
+	cdf0 := DefaultDeltaLfAbsCdf
+	cdf1 := DefaultDeltaLfAbsCdf
+	enc.encode(cdf0[:], 2)
+	enc.encodeBool(false)
+	enc.encode(cdf1[:], 1)
+	enc.encodeBool(true)
+	data := enc.bytes()
+
+	r := Reader{data: data}
+	initSymbol(len(data), &r)
+	readDeltaLf(&r)
+	assert.Equal(t, []int{2, -1, 0, 0}, DeltaLF)
+}
+
+func TestIntraFrameModeInfoIntrabc(t *testing.T) {
+	setupModeInfoTest(t)
+	uh.allowIntrabc = true
+	PaletteSizeY, PaletteSizeUV = 4, 4
+
+	// The predicted vector points one superblock up, which is only far
+	// enough behind the wavefront in a frame eight superblocks wide.
+	MiCols = 128
+	MiColEnd = MiCols
+	allocModeInfo()
+
+	enc := newSymbolEncoder()
+	skipCdf := DefaultSkipCdf[0]
+	intrabcCdf := DefaultIntrabcCdf
+	jointCdf := DefaultMvJointCdf
+	enc.encode(skipCdf[:], 1)
+	enc.encode(intrabcCdf[:], 1)
+	enc.encode(jointCdf[:], MV_JOINT_ZERO)
+	data := enc.bytes()
+
+	r := Reader{data: data}
+	initSymbol(len(data), &r)
+	intraFrameModeInfo(&r)
+
+	assert.True(t, Skip)
+	assert.True(t, UseIntrabc)
+	assert.True(t, IsInter)
+	assert.Equal(t, 0, PaletteSizeY)
+	assert.Equal(t, 0, PaletteSizeUV)
+	assert.Equal(t, [2]int{-64 * 8, 0}, Mv[0])
+}
@@ -0,0 +1,193 @@
+package boulder
+
+const MFMV_STACK_SIZE = 3
+const MAX_OFFSET_WIDTH = 8
+const MAX_OFFSET_HEIGHT = 0
+const REFMVS_LIMIT = (1 << 12) - 1
+const MI_SIZE_LOG2 = 2
+
+var (
+	MfRefFrames    [][]int
+	MfMvs          [][][2]int
+	SavedRefFrames = make([][][]int, NUM_REF_FRAMES)
+	SavedMvs       = make([][][][2]int, NUM_REF_FRAMES)
+	DivMult        = [32]int{
+		0, 16384, 8192, 5461, 4096, 3276, 2730, 2340, 2048, 1820, 1638,
+		1489, 1365, 1260, 1170, 1092, 1024, 963, 910, 862, 819, 780,
+		744, 712, 682, 655, 630, 606, 585, 564, 546, 528,
+	}
+)
+
+// motionFieldEstimation projects the motion vectors saved with the
+// reference frames onto the current frame, filling MotionFieldMvs with the
+// temporal candidates used by findMvStack.
+func motionFieldEstimation(refFrameIdx []int) {
+	w8 := MiCols >> 1
+	h8 := MiRows >> 1
+
+	for ref := LAST_FRAME; ref <= ALTREF_FRAME; ref++ {
+		MotionFieldMvs[ref] = make([][][2]int, h8)
+		for y := 0; y < h8; y++ {
+			MotionFieldMvs[ref][y] = make([][2]int, w8)
+			for x := 0; x < w8; x++ {
+				MotionFieldMvs[ref][y][x] = [2]int{INVALID_MV, INVALID_MV}
+			}
+		}
+	}
+
+	lastIdx := refFrameIdx[0]
+	curGoldHint := OrderHints[GOLDEN_FRAME]
+	lastAltHint := SavedOrderHints[lastIdx][ALTREF_FRAME]
+	useLast := lastAltHint != curGoldHint
+
+	refStamp := MFMV_STACK_SIZE - 1
+
+	if useLast {
+		projection(refFrameIdx, LAST_FRAME, -1)
+	}
+	refStamp--
+
+	if getRelativeDist(OrderHints[BWDREF_FRAME], OrderHint) > 0 {
+		if projection(refFrameIdx, BWDREF_FRAME, 1) {
+			refStamp--
+		}
+	}
+
+	if getRelativeDist(OrderHints[ALTREF2_FRAME], OrderHint) > 0 {
+		if projection(refFrameIdx, ALTREF2_FRAME, 1) {
+			refStamp--
+		}
+	}
+
+	if getRelativeDist(OrderHints[ALTREF_FRAME], OrderHint) > 0 && refStamp >= 0 {
+		if projection(refFrameIdx, ALTREF_FRAME, 1) {
+			refStamp--
+		}
+	}
+
+	if refStamp >= 0 {
+		projection(refFrameIdx, LAST2_FRAME, -1)
+	}
+}
+
+// projection projects the saved motion vectors of the reference src along
+// their trajectory onto the current frame. dstSign is -1 for references
+// that precede the current frame and 1 for those that follow it. It
+// reports whether src could be used.
+func projection(refFrameIdx []int, src int, dstSign int) bool {
+	srcIdx := refFrameIdx[src-LAST_FRAME]
+	w8 := MiCols >> 1
+	h8 := MiRows >> 1
+
+	if RefMiRows[srcIdx] != MiRows ||
+		RefMiCols[srcIdx] != MiCols ||
+		RefFrameType[srcIdx] == KEY_FRAME ||
+		RefFrameType[srcIdx] == INTRA_ONLY_FRAME {
+		return false
+	}
+
+	for y8 := 0; y8 < h8; y8++ {
+		for x8 := 0; x8 < w8; x8++ {
+			row := 2*y8 + 1
+			col := 2*x8 + 1
+
+			srcRef := SavedRefFrames[srcIdx][row][col]
+			if srcRef <= INTRA_FRAME {
+				continue
+			}
+
+			refToCur := getRelativeDist(OrderHints[src], OrderHint)
+			refOffset := getRelativeDist(OrderHints[src], SavedOrderHints[srcIdx][srcRef])
+
+			posValid := abs(refToCur) <= MAX_FRAME_DISTANCE &&
+				abs(refOffset) <= MAX_FRAME_DISTANCE &&
+				refOffset > 0
+			if !posValid {
+				continue
+			}
+
+			mv := SavedMvs[srcIdx][row][col]
+			projMv := getMvProjection(mv, refToCur*dstSign, refOffset)
+			posY8 := project(y8, projMv[0], dstSign, h8, MAX_OFFSET_HEIGHT)
+			posX8 := project(x8, projMv[1], dstSign, w8, MAX_OFFSET_WIDTH)
+			if posY8 < 0 || posX8 < 0 {
+				continue
+			}
+
+			for dst := LAST_FRAME; dst <= ALTREF_FRAME; dst++ {
+				refToDst := getRelativeDist(OrderHint, OrderHints[dst])
+				MotionFieldMvs[dst][posY8][posX8] = getMvProjection(mv, refToDst, refOffset)
+			}
+		}
+	}
+
+	return true
+}
+
+func getMvProjection(mv [2]int, numerator int, denominator int) [2]int {
+	clippedDenominator := min(denominator, MAX_FRAME_DISTANCE)
+	clippedNumerator := clip3(-MAX_FRAME_DISTANCE, MAX_FRAME_DISTANCE, numerator)
+
+	var projMv [2]int
+	for i := 0; i < 2; i++ {
+		scaled := round2Signed(mv[i]*clippedNumerator*DivMult[clippedDenominator], 14)
+		projMv[i] = clip3(-(1<<14)+1, (1<<14)-1, scaled)
+	}
+
+	return projMv
+}
+
+// project moves the 8x8 position v8 by delta, returning -1 when the result
+// leaves the frame or strays too far from the 64x64 block it started in.
+func project(v8 int, delta int, dstSign int, max8 int, maxOff8 int) int {
+	base8 := (v8 >> 3) << 3
+
+	var offset8 int
+	if delta >= 0 {
+		offset8 = delta >> (3 + 1 + MI_SIZE_LOG2)
+	} else {
+		offset8 = -((-delta) >> (3 + 1 + MI_SIZE_LOG2))
+	}
+
+	v8 += dstSign * offset8
+	if v8 < 0 || v8 >= max8 || v8 < base8-maxOff8 || v8 >= base8+8+maxOff8 {
+		return -1
+	}
+
+	return v8
+}
+
+// motionFieldMotionVectorStorage keeps, for every 4x4 block, one motion
+// vector pointing backwards in time so that later frames can project it.
+func motionFieldMotionVectorStorage() {
+	MfRefFrames = make([][]int, MiRows)
+	MfMvs = make([][][2]int, MiRows)
+
+	for row := 0; row < MiRows; row++ {
+		MfRefFrames[row] = make([]int, MiCols)
+		MfMvs[row] = make([][2]int, MiCols)
+
+		for col := 0; col < MiCols; col++ {
+			MfRefFrames[row][col] = NONE
+
+			for list := 0; list < 2; list++ {
+				r := RefFrames[row][col][list]
+				if r <= INTRA_FRAME {
+					continue
+				}
+
+				refIdx := uh.refFrameIdx[r-LAST_FRAME]
+				dist := getRelativeDist(RefOrderHint[refIdx], OrderHint)
+				if dist >= 0 {
+					continue
+				}
+
+				mv := Mvs[row][col][list]
+				if abs(mv[0]) <= REFMVS_LIMIT && abs(mv[1]) <= REFMVS_LIMIT {
+					MfRefFrames[row][col] = r
+					MfMvs[row][col] = mv
+				}
+			}
+		}
+	}
+}
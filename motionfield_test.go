@@ -0,0 +1,110 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMvProjection(t *testing.T) {
+	assert.Equal(t, [2]int{128, -64}, getMvProjection([2]int{64, -32}, 2, 1))
+	assert.Equal(t, [2]int{21, -11}, getMvProjection([2]int{64, -32}, 1, 3))
+	assert.Equal(t, [2]int{-64, 32}, getMvProjection([2]int{64, -32}, -1, 1))
+	assert.Equal(t, [2]int{(1 << 14) - 1, 0}, getMvProjection([2]int{1 << 13, 0}, 4, 1))
+}
+
+func TestProject(t *testing.T) {
+	assert.Equal(t, 4, project(3, 64, 1, 16, MAX_OFFSET_WIDTH))
+	assert.Equal(t, 2, project(3, 64, -1, 16, MAX_OFFSET_WIDTH))
+	assert.Equal(t, 3, project(3, 63, 1, 16, MAX_OFFSET_WIDTH))
+	assert.Equal(t, -1, project(7, 64, 1, 16, MAX_OFFSET_HEIGHT))
+	assert.Equal(t, 8, project(7, 64, 1, 16, MAX_OFFSET_WIDTH))
+	assert.Equal(t, -1, project(0, -64, 1, 16, MAX_OFFSET_WIDTH))
+}
+
+func setupMotionFieldTest(t *testing.T) []int {
+	saveGlobals(t, &sh, &uh, &OrderHintBits, &MiRows, &MiCols, &OrderHint,
+		&OrderHints, &RefMiRows, &RefMiCols, &RefFrameType, &RefOrderHint,
+		&SavedOrderHints, &SavedRefFrames, &SavedMvs, &MotionFieldMvs,
+		&MfRefFrames, &MfMvs)
+	saveModeInfo(t)
+
+	sh = SequenceHeader{enableOrderHint: true}
+	OrderHintBits = 7
+	MiRows = 8
+	MiCols = 8
+	OrderHint = 4
+	for ref := LAST_FRAME; ref <= ALTREF_FRAME; ref++ {
+		OrderHints[ref] = 3
+	}
+
+	RefMiRows[0] = MiRows
+	RefMiCols[0] = MiCols
+	RefFrameType[0] = INTER_FRAME
+	RefOrderHint[0] = 3
+	SavedOrderHints[0] = []int{0, 2, 2, 2, 2, 2, 2, 2}
+
+	SavedRefFrames[0] = make([][]int, MiRows)
+	SavedMvs[0] = make([][][2]int, MiRows)
+	for row := 0; row < MiRows; row++ {
+		SavedRefFrames[0][row] = make([]int, MiCols)
+		SavedMvs[0][row] = make([][2]int, MiCols)
+		for col := 0; col < MiCols; col++ {
+			SavedRefFrames[0][row][col] = NONE
+		}
+	}
+
+	return []int{0, 0, 0, 0, 0, 0, 0}
+}
+
+func TestMotionFieldEstimationProjectsLast(t *testing.T) {
+	refFrameIdx := setupMotionFieldTest(t)
+
+	SavedRefFrames[0][1][1] = LAST_FRAME
+	SavedMvs[0][1][1] = [2]int{-64, -128}
+
+	motionFieldEstimation(refFrameIdx)
+
+	for ref := LAST_FRAME; ref <= ALTREF_FRAME; ref++ {
+		assert.Equal(t, [2]int{-64, -128}, MotionFieldMvs[ref][1][2])
+		assert.Equal(t, [2]int{INVALID_MV, INVALID_MV}, MotionFieldMvs[ref][0][0])
+	}
+}
+
+func TestMotionFieldEstimationSkipsIntraReference(t *testing.T) {
+	refFrameIdx := setupMotionFieldTest(t)
+	RefFrameType[0] = KEY_FRAME
+
+	SavedRefFrames[0][1][1] = LAST_FRAME
+	SavedMvs[0][1][1] = [2]int{-64, -128}
+
+	motionFieldEstimation(refFrameIdx)
+
+	assert.Equal(t, [2]int{INVALID_MV, INVALID_MV}, MotionFieldMvs[LAST_FRAME][1][2])
+}
+
+func TestMotionFieldMotionVectorStorage(t *testing.T) {
+	setupMotionFieldTest(t)
+	uh = UncompressedHeader{refFrameIdx: []int{0, 1, 1, 1, 1, 1, 1}}
+	RefOrderHint[1] = 6
+	allocModeInfo()
+
+	RefFrames[0][0] = [2]int{LAST_FRAME, NONE}
+	Mvs[0][0][0] = [2]int{8, -8}
+	RefFrames[0][1] = [2]int{ALTREF_FRAME, NONE}
+	Mvs[0][1][0] = [2]int{8, -8}
+	RefFrames[0][2] = [2]int{LAST_FRAME, NONE}
+	Mvs[0][2][0] = [2]int{REFMVS_LIMIT + 1, 0}
+	RefFrames[0][3] = [2]int{ALTREF_FRAME, LAST_FRAME}
+	Mvs[0][3] = [2][2]int{{16, 16}, {-24, 24}}
+
+	motionFieldMotionVectorStorage()
+
+	assert.Equal(t, LAST_FRAME, MfRefFrames[0][0])
+	assert.Equal(t, [2]int{8, -8}, MfMvs[0][0])
+	assert.Equal(t, NONE, MfRefFrames[0][1])
+	assert.Equal(t, NONE, MfRefFrames[0][2])
+	assert.Equal(t, LAST_FRAME, MfRefFrames[0][3])
+	assert.Equal(t, [2]int{-24, 24}, MfMvs[0][3])
+	assert.Equal(t, NONE, MfRefFrames[5][5])
+}
@@ -0,0 +1,365 @@
+package boulder
+
+const MV_CONTEXTS = 2
+const MV_INTRABC_CONTEXT = 1
+const MV_JOINTS = 4
+const MV_CLASSES = 11
+const MV_CLASS_0 = 0
+const CLASS0_SIZE = 2
+const MV_OFFSET_BITS = 10
+
+const MV_JOINT_ZERO = 0
+const MV_JOINT_HNZVZ = 1
+const MV_JOINT_HZVNZ = 2
+const MV_JOINT_HNZVNZ = 3
+
+var (
+	DefaultMvJointCdf      = [MV_JOINTS + 1]int{4096, 11264, 19328, 32768, 0}
+	DefaultMvClassCdf      = [MV_CLASSES + 1]int{28672, 30976, 31858, 32320, 32551, 32656, 32740, 32757, 32762, 32767, 32768, 0}
+	DefaultMvClass0BitCdf  = [3]int{27648, 32768, 0}
+	DefaultMvClass0FrCdf   = [2][5]int{{16384, 24576, 26624, 32768, 0}, {12288, 21248, 24128, 32768, 0}}
+	DefaultMvClass0HpCdf   = [3]int{20480, 32768, 0}
+	DefaultMvSignCdf       = [3]int{16384, 32768, 0}
+	DefaultMvBitCdf        = [MV_OFFSET_BITS][3]int{{17408, 32768, 0}, {17920, 32768, 0}, {18944, 32768, 0}, {20480, 32768, 0}, {22528, 32768, 0}, {24576, 32768, 0}, {28672, 32768, 0}, {29952, 32768, 0}, {29952, 32768, 0}, {30720, 32768, 0}}
+	DefaultMvFrCdf         = [5]int{8192, 17408, 21248, 32768, 0}
+	DefaultMvHpCdf         = [3]int{16384, 32768, 0}
+	MvJointCdf             [MV_CONTEXTS][MV_JOINTS + 1]int
+	MvClassCdf             [MV_CONTEXTS][2][MV_CLASSES + 1]int
+	MvClass0BitCdf         [MV_CONTEXTS][2][3]int
+	MvClass0FrCdf          [MV_CONTEXTS][2][2][5]int
+	MvClass0HpCdf          [MV_CONTEXTS][2][3]int
+	MvSignCdf              [MV_CONTEXTS][2][3]int
+	MvBitCdf               [MV_CONTEXTS][2][MV_OFFSET_BITS][3]int
+	MvFrCdf                [MV_CONTEXTS][2][5]int
+	MvHpCdf                [MV_CONTEXTS][2][3]int
+	SavedMvJointCdf        [NUM_REF_FRAMES][MV_CONTEXTS][MV_JOINTS + 1]int
+	SavedMvClassCdf        [NUM_REF_FRAMES][MV_CONTEXTS][2][MV_CLASSES + 1]int
+	SavedMvClass0BitCdf    [NUM_REF_FRAMES][MV_CONTEXTS][2][3]int
+	SavedMvClass0FrCdf     [NUM_REF_FRAMES][MV_CONTEXTS][2][2][5]int
+	SavedMvClass0HpCdf     [NUM_REF_FRAMES][MV_CONTEXTS][2][3]int
+	SavedMvSignCdf         [NUM_REF_FRAMES][MV_CONTEXTS][2][3]int
+	SavedMvBitCdf          [NUM_REF_FRAMES][MV_CONTEXTS][2][MV_OFFSET_BITS][3]int
+	SavedMvFrCdf           [NUM_REF_FRAMES][MV_CONTEXTS][2][5]int
+	SavedMvHpCdf           [NUM_REF_FRAMES][MV_CONTEXTS][2][3]int
+	MvCtx                  int
+	Mv                     [2][2]int
+	PredMv                 [2][2]int
+	RefMvIdx               int
+	UseIntrabc             bool
+	InterpFilter           [2]int
+	InterpFilterCdf        [INTERP_FILTER_CONTEXTS][4]int
+	SavedInterpFilterCdf   [NUM_REF_FRAMES][INTERP_FILTER_CONTEXTS][4]int
+	DefaultInterpFilterCdf = [INTERP_FILTER_CONTEXTS][4]int{
+		{31935, 32720, 32768, 0}, {5568, 32719, 32768, 0}, {422, 2938, 32768, 0}, {28244, 32608, 32768, 0},
+		{31206, 31953, 32768, 0}, {4862, 32121, 32768, 0}, {770, 1152, 32768, 0}, {20889, 25637, 32768, 0},
+		{31910, 32724, 32768, 0}, {4120, 32712, 32768, 0}, {305, 2247, 32768, 0}, {27403, 32636, 32768, 0},
+		{31022, 32009, 32768, 0}, {2963, 32093, 32768, 0}, {601, 943, 32768, 0}, {14969, 21398, 32768, 0},
+	}
+)
+
+const INTERP_FILTER_CONTEXTS = 16
+
+// initNonCoeffCdfs loads the default probabilities of the non coefficient
+// syntax elements that are decoded so far.
+func initNonCoeffCdfs() {
+	for ctx := 0; ctx < MV_CONTEXTS; ctx++ {
+		MvJointCdf[ctx] = DefaultMvJointCdf
+		for comp := 0; comp < 2; comp++ {
+			MvClassCdf[ctx][comp] = DefaultMvClassCdf
+			MvClass0BitCdf[ctx][comp] = DefaultMvClass0BitCdf
+			MvClass0FrCdf[ctx][comp] = DefaultMvClass0FrCdf
+			MvClass0HpCdf[ctx][comp] = DefaultMvClass0HpCdf
+			MvSignCdf[ctx][comp] = DefaultMvSignCdf
+			MvBitCdf[ctx][comp] = DefaultMvBitCdf
+			MvFrCdf[ctx][comp] = DefaultMvFrCdf
+			MvHpCdf[ctx][comp] = DefaultMvHpCdf
+		}
+	}
+
+	InterpFilterCdf = DefaultInterpFilterCdf
+	IntrabcCdf = DefaultIntrabcCdf
+	SkipCdf = DefaultSkipCdf
+	DeltaQAbsCdf = DefaultDeltaQAbsCdf
+	DeltaLfAbsCdf = DefaultDeltaLfAbsCdf
+	for i := 0; i < FRAME_LF_COUNT; i++ {
+		DeltaLfMultiCdf[i] = DefaultDeltaLfAbsCdf
+	}
+	UseWienerCdf = DefaultUseWienerCdf
+	UseSgrprojCdf = DefaultUseSgrprojCdf
+	RestorationTypeCdf = DefaultRestorationTypeCdf
+	SegmentIdCdf = DefaultSegmentIdCdf
+	SegmentIdPredictedCdf = DefaultSegmentIdPredictedCdf
+}
+
+func saveCdfs(ctx int) {
+	SavedMvJointCdf[ctx] = MvJointCdf
+	SavedMvClassCdf[ctx] = MvClassCdf
+	SavedMvClass0BitCdf[ctx] = MvClass0BitCdf
+	SavedMvClass0FrCdf[ctx] = MvClass0FrCdf
+	SavedMvClass0HpCdf[ctx] = MvClass0HpCdf
+	SavedMvSignCdf[ctx] = MvSignCdf
+	SavedMvBitCdf[ctx] = MvBitCdf
+	SavedMvFrCdf[ctx] = MvFrCdf
+	SavedMvHpCdf[ctx] = MvHpCdf
+	SavedInterpFilterCdf[ctx] = InterpFilterCdf
+	SavedIntrabcCdf[ctx] = IntrabcCdf
+	SavedSkipCdf[ctx] = SkipCdf
+	SavedDeltaQAbsCdf[ctx] = DeltaQAbsCdf
+	SavedDeltaLfAbsCdf[ctx] = DeltaLfAbsCdf
+	SavedDeltaLfMultiCdf[ctx] = DeltaLfMultiCdf
+	SavedUseWienerCdf[ctx] = UseWienerCdf
+	SavedUseSgrprojCdf[ctx] = UseSgrprojCdf
+	SavedRestorationTypeCdf[ctx] = RestorationTypeCdf
+	SavedSegmentIdCdf[ctx] = SegmentIdCdf
+	SavedSegmentIdPredictedCdf[ctx] = SegmentIdPredictedCdf
+}
+
+func loadCdfs(ctx int) {
+	MvJointCdf = SavedMvJointCdf[ctx]
+	MvClassCdf = SavedMvClassCdf[ctx]
+	MvClass0BitCdf = SavedMvClass0BitCdf[ctx]
+	MvClass0FrCdf = SavedMvClass0FrCdf[ctx]
+	MvClass0HpCdf = SavedMvClass0HpCdf[ctx]
+	MvSignCdf = SavedMvSignCdf[ctx]
+	MvBitCdf = SavedMvBitCdf[ctx]
+	MvFrCdf = SavedMvFrCdf[ctx]
+	MvHpCdf = SavedMvHpCdf[ctx]
+	InterpFilterCdf = SavedInterpFilterCdf[ctx]
+	IntrabcCdf = SavedIntrabcCdf[ctx]
+	SkipCdf = SavedSkipCdf[ctx]
+	DeltaQAbsCdf = SavedDeltaQAbsCdf[ctx]
+	DeltaLfAbsCdf = SavedDeltaLfAbsCdf[ctx]
+	DeltaLfMultiCdf = SavedDeltaLfMultiCdf[ctx]
+	UseWienerCdf = SavedUseWienerCdf[ctx]
+	UseSgrprojCdf = SavedUseSgrprojCdf[ctx]
+	RestorationTypeCdf = SavedRestorationTypeCdf[ctx]
+	SegmentIdCdf = SavedSegmentIdCdf[ctx]
+	SegmentIdPredictedCdf = SavedSegmentIdPredictedCdf[ctx]
+}
+
+const NEARESTMV = 13
+const NEARMV = 14
+const GLOBALMV = 15
+const NEWMV = 16
+const NEAREST_NEARESTMV = 17
+const NEAR_NEARMV = 18
+const NEAREST_NEWMV = 19
+const NEW_NEARESTMV = 20
+const NEAR_NEWMV = 21
+const NEW_NEARMV = 22
+const GLOBAL_GLOBALMV = 23
+const NEW_NEWMV = 24
+
+func assignMv(r *Reader, isCompound bool) {
+	numMvs := 1
+	if isCompound {
+		numMvs = 2
+	}
+
+	for i := 0; i < numMvs; i++ {
+		var compMode int
+		if UseIntrabc {
+			compMode = NEWMV
+		} else {
+			compMode = getMode(i)
+		}
+
+		if UseIntrabc {
+			predictDv()
+			readMv(r, 0)
+		} else if compMode == GLOBALMV {
+			PredMv[i] = GlobalMvs[i]
+			Mv[i] = PredMv[i]
+		} else {
+			pos := RefMvIdx
+			if compMode == NEARESTMV {
+				pos = 0
+			}
+			if compMode == NEWMV && NumMvFound <= 1 {
+				pos = 0
+			}
+
+			PredMv[i] = RefStackMv[pos][i]
+			if compMode == NEWMV {
+				readMv(r, i)
+			} else {
+				Mv[i] = PredMv[i]
+			}
+		}
+	}
+
+	if !isMvValid(isCompound) {
+		conformanceError("invalid motion vector", r)
+	}
+}
+
+func getMode(refList int) int {
+	if refList == 0 {
+		if YMode < NEAREST_NEARESTMV {
+			return YMode
+		} else if YMode == NEW_NEWMV || YMode == NEW_NEARESTMV || YMode == NEW_NEARMV {
+			return NEWMV
+		} else if YMode == NEAREST_NEARESTMV || YMode == NEAREST_NEWMV {
+			return NEARESTMV
+		} else if YMode == NEAR_NEARMV || YMode == NEAR_NEWMV {
+			return NEARMV
+		}
+
+		return GLOBALMV
+	}
+
+	if YMode == NEW_NEWMV || YMode == NEAREST_NEWMV || YMode == NEAR_NEWMV {
+		return NEWMV
+	} else if YMode == NEAREST_NEARESTMV || YMode == NEW_NEARESTMV {
+		return NEARESTMV
+	} else if YMode == NEAR_NEARMV || YMode == NEW_NEARMV {
+		return NEARMV
+	}
+
+	return GLOBALMV
+}
+
+func readMv(r *Reader, ref int) {
+	diffMv := [2]int{0, 0}
+
+	if UseIntrabc {
+		MvCtx = MV_INTRABC_CONTEXT
+	} else {
+		MvCtx = 0
+	}
+
+	mvJoint := readSymbol(r, MvJointCdf[MvCtx][:])
+	if mvJoint == MV_JOINT_HZVNZ || mvJoint == MV_JOINT_HNZVNZ {
+		diffMv[0] = readMvComponent(r, 0)
+	}
+	if mvJoint == MV_JOINT_HNZVZ || mvJoint == MV_JOINT_HNZVNZ {
+		diffMv[1] = readMvComponent(r, 1)
+	}
+
+	Mv[ref][0] = PredMv[ref][0] + diffMv[0]
+	Mv[ref][1] = PredMv[ref][1] + diffMv[1]
+}
+
+func readMvComponent(r *Reader, comp int) int {
+	mvSign := readSymbol(r, MvSignCdf[MvCtx][comp][:])
+	mvClass := readSymbol(r, MvClassCdf[MvCtx][comp][:])
+
+	var mag int
+	if mvClass == MV_CLASS_0 {
+		mvClass0Bit := readSymbol(r, MvClass0BitCdf[MvCtx][comp][:])
+
+		mvClass0Fr := 3
+		if !uh.forceIntegerMv {
+			mvClass0Fr = readSymbol(r, MvClass0FrCdf[MvCtx][comp][mvClass0Bit][:])
+		}
+
+		mvClass0Hp := 1
+		if uh.allowHighPrecisionMv {
+			mvClass0Hp = readSymbol(r, MvClass0HpCdf[MvCtx][comp][:])
+		}
+
+		mag = ((mvClass0Bit << 3) | (mvClass0Fr << 1) | mvClass0Hp) + 1
+	} else {
+		d := 0
+		for i := 0; i < mvClass; i++ {
+			mvBit := readSymbol(r, MvBitCdf[MvCtx][comp][i][:])
+			d |= mvBit << i
+		}
+
+		mag = CLASS0_SIZE << (mvClass + 2)
+
+		mvFr := 3
+		if !uh.forceIntegerMv {
+			mvFr = readSymbol(r, MvFrCdf[MvCtx][comp][:])
+		}
+
+		mvHp := 1
+		if uh.allowHighPrecisionMv {
+			mvHp = readSymbol(r, MvHpCdf[MvCtx][comp][:])
+		}
+
+		mag += ((d << 3) | (mvFr << 1) | mvHp) + 1
+	}
+
+	if mvSign != 0 {
+		return -mag
+	}
+
+	return mag
+}
+
+// readInterpFilter reads the per block interpolation filters once the
+// reference frames and motion mode of the block are known.
+func readInterpFilter(r *Reader) {
+	if uh.interpolationFilter != SWITCHABLE {
+		InterpFilter[0] = uh.interpolationFilter
+		InterpFilter[1] = uh.interpolationFilter
+		return
+	}
+
+	dirs := 1
+	if sh.enableDualFilter {
+		dirs = 2
+	}
+
+	for dir := 0; dir < dirs; dir++ {
+		if needsInterpFilter() {
+			InterpFilter[dir] = readSymbol(r, InterpFilterCdf[interpFilterCtx(dir)][:])
+		} else {
+			InterpFilter[dir] = EIGHTTAP
+		}
+	}
+
+	if !sh.enableDualFilter {
+		InterpFilter[1] = InterpFilter[0]
+	}
+}
+
+func needsInterpFilter() bool {
+	large := min(BlockWidth[MiSize], BlockHeight[MiSize]) >= 8
+
+	if SkipMode || MotionMode == LOCALWARP {
+		return false
+	} else if large && YMode == GLOBALMV {
+		return GmType[RefFrame[0]] == TRANSLATION
+	} else if large && YMode == GLOBAL_GLOBALMV {
+		return GmType[RefFrame[0]] == TRANSLATION || GmType[RefFrame[1]] == TRANSLATION
+	}
+
+	return true
+}
+
+func interpFilterCtx(dir int) int {
+	ctx := (dir & 1) * 2
+	if RefFrame[1] > INTRA_FRAME {
+		ctx++
+	}
+	ctx *= 4
+
+	leftType := 3
+	aboveType := 3
+
+	if AvailL {
+		if RefFrames[MiRow][MiCol-1][0] == RefFrame[0] || RefFrames[MiRow][MiCol-1][1] == RefFrame[0] {
+			leftType = InterpFilters[MiRow][MiCol-1][dir]
+		}
+	}
+
+	if AvailU {
+		if RefFrames[MiRow-1][MiCol][0] == RefFrame[0] || RefFrames[MiRow-1][MiCol][1] == RefFrame[0] {
+			aboveType = InterpFilters[MiRow-1][MiCol][dir]
+		}
+	}
+
+	if leftType == aboveType {
+		ctx += leftType
+	} else if leftType == 3 {
+		ctx += aboveType
+	} else if aboveType == 3 {
+		ctx += leftType
+	} else {
+		ctx += 3
+	}
+
+	return ctx
+}
@@ -0,0 +1,796 @@
+package boulder
+
+const MAX_REF_MV_STACK_SIZE = 8
+const REF_CAT_LEVEL = 640
+const MV_BORDER = 128
+const INVALID_MV = -1 << 15
+
+const TRANSLATION = 1
+const ROTZOOM = 2
+const AFFINE = 3
+
+var (
+	BlockWidth = [BLOCK_SIZES]int{
+		4, 4, 8, 8, 8, 16, 16, 16, 32, 32, 32,
+		64, 64, 64, 128, 128, 4, 16, 8, 32, 16, 64,
+	}
+	BlockHeight = [BLOCK_SIZES]int{
+		4, 8, 4, 8, 16, 8, 16, 32, 16, 32, 64,
+		32, 64, 128, 64, 128, 16, 4, 32, 8, 64, 16,
+	}
+	MiRow          int
+	MiCol          int
+	MiSize         int
+	YMode          int
+	RefFrame       [2]int
+	IsInter        bool
+	SkipMode       bool
+	MotionMode     int
+	AvailU         bool
+	AvailL         bool
+	MiSizes        [][]int
+	YModes         [][]int
+	UVModes        [][]int
+	IsInters       [][]bool
+	RefFrames      [][][2]int
+	Mvs            [][][2][2]int
+	InterpFilters  [][][2]int
+	MotionFieldMvs [ALTREF_FRAME + 1][][][2]int
+	NumMvFound     int
+	NewMvCount     int
+	RefStackMv     [MAX_REF_MV_STACK_SIZE][2][2]int
+	WeightStack    [MAX_REF_MV_STACK_SIZE]int
+	DrlCtxStack    [MAX_REF_MV_STACK_SIZE]int
+	GlobalMvs      [2][2]int
+	FoundMatch     bool
+	CloseMatches   int
+	TotalMatches   int
+	NewMvContext   int
+	RefMvContext   int
+	ZeroMvContext  int
+	RefIdCount     [2]int
+	RefDiffCount   [2]int
+	RefIdMvs       [2][2][2]int
+	RefDiffMvs     [2][2][2]int
+)
+
+// allocModeInfo sets up the per 4x4 mode info of the frame about to be
+// decoded. RefFrames[row][col][0] is -1 until the block covering that
+// position has been decoded.
+func allocModeInfo() {
+	MiSizes = make([][]int, MiRows)
+	YModes = make([][]int, MiRows)
+	UVModes = make([][]int, MiRows)
+	IsInters = make([][]bool, MiRows)
+	RefFrames = make([][][2]int, MiRows)
+	Mvs = make([][][2][2]int, MiRows)
+	InterpFilters = make([][][2]int, MiRows)
+	Skips = make([][]bool, MiRows)
+	SegmentIds = make([][]int, MiRows)
+	DeltaLFs = make([][][FRAME_LF_COUNT]int, MiRows)
+	for plane := 0; plane < 3; plane++ {
+		LoopfilterTxSizes[plane] = make([][]int, MiRows)
+	}
+
+	// cdef_idx is stored per 64x64 block, so round up to a whole 128x128
+	// superblock to let clearCdef touch all four quadrants.
+	cdefIdx = make([][]int, (MiRows+31)&^31)
+	for row := range cdefIdx {
+		cdefIdx[row] = make([]int, (MiCols+31)&^31)
+	}
+
+	for row := 0; row < MiRows; row++ {
+		MiSizes[row] = make([]int, MiCols)
+		YModes[row] = make([]int, MiCols)
+		UVModes[row] = make([]int, MiCols)
+		IsInters[row] = make([]bool, MiCols)
+		RefFrames[row] = make([][2]int, MiCols)
+		Mvs[row] = make([][2][2]int, MiCols)
+		InterpFilters[row] = make([][2]int, MiCols)
+		Skips[row] = make([]bool, MiCols)
+		SegmentIds[row] = make([]int, MiCols)
+		DeltaLFs[row] = make([][FRAME_LF_COUNT]int, MiCols)
+		for plane := 0; plane < 3; plane++ {
+			LoopfilterTxSizes[plane][row] = make([]int, MiCols)
+		}
+
+		for col := 0; col < MiCols; col++ {
+			RefFrames[row][col] = [2]int{-1, -1}
+		}
+	}
+}
+
+func isInside(candR int, candC int) bool {
+	return candC >= MiColStart &&
+		candC < MiColEnd &&
+		candR >= MiRowStart &&
+		candR < MiRowEnd
+}
+
+func findMvStack(isCompound bool) {
+	bw4 := Num4x4BlocksWide[MiSize]
+	bh4 := Num4x4BlocksHigh[MiSize]
+
+	NumMvFound = 0
+	NewMvCount = 0
+
+	GlobalMvs[0] = setupGlobalMv(0)
+	if isCompound {
+		GlobalMvs[1] = setupGlobalMv(1)
+	}
+
+	FoundMatch = false
+	scanRow(-1, isCompound)
+	foundAboveMatch := FoundMatch
+	FoundMatch = false
+
+	scanCol(-1, isCompound)
+	foundLeftMatch := FoundMatch
+	FoundMatch = false
+
+	if max(bw4, bh4) <= 16 {
+		scanPoint(-1, bw4, isCompound)
+	}
+	if FoundMatch {
+		foundAboveMatch = true
+	}
+
+	CloseMatches = boolToInt(foundAboveMatch) + boolToInt(foundLeftMatch)
+
+	numNearest := NumMvFound
+	numNew := NewMvCount
+	if numNearest > 0 {
+		for idx := 0; idx < numNearest; idx++ {
+			WeightStack[idx] += REF_CAT_LEVEL
+		}
+	}
+
+	ZeroMvContext = 0
+	if uh.useRefFrameMvs {
+		temporalScan(isCompound)
+	}
+
+	scanPoint(-1, -1, isCompound)
+	if FoundMatch {
+		foundAboveMatch = true
+	}
+	FoundMatch = false
+
+	scanRow(-3, isCompound)
+	if FoundMatch {
+		foundAboveMatch = true
+	}
+	FoundMatch = false
+
+	scanCol(-3, isCompound)
+	if FoundMatch {
+		foundLeftMatch = true
+	}
+	FoundMatch = false
+
+	if bh4 > 1 {
+		scanRow(-5, isCompound)
+	}
+	if FoundMatch {
+		foundAboveMatch = true
+	}
+	FoundMatch = false
+
+	if bw4 > 1 {
+		scanCol(-5, isCompound)
+	}
+	if FoundMatch {
+		foundLeftMatch = true
+	}
+
+	TotalMatches = boolToInt(foundAboveMatch) + boolToInt(foundLeftMatch)
+
+	sorting(0, numNearest)
+	sorting(numNearest, NumMvFound)
+
+	if NumMvFound < 2 {
+		extraSearch(isCompound)
+	}
+
+	contextAndClamping(isCompound, numNew)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func setupGlobalMv(refList int) [2]int {
+	ref := RefFrame[refList]
+
+	var typ int
+	if ref != INTRA_FRAME {
+		typ = GmType[ref]
+	}
+
+	bw := BlockWidth[MiSize]
+	bh := BlockHeight[MiSize]
+
+	var mv [2]int
+	if ref == INTRA_FRAME || typ == IDENTITY {
+		mv = [2]int{0, 0}
+	} else if typ == TRANSLATION {
+		gm := uh.globalMotionParams.gmParams[ref]
+		mv[0] = gm[0] >> (WARPEDMODEL_PREC_BITS - 3)
+		mv[1] = gm[1] >> (WARPEDMODEL_PREC_BITS - 3)
+	} else {
+		gm := uh.globalMotionParams.gmParams[ref]
+		x := MiCol*MI_SIZE + bw/2 - 1
+		y := MiRow*MI_SIZE + bh/2 - 1
+
+		xc := (gm[2]-(1<<WARPEDMODEL_PREC_BITS))*x + gm[3]*y + gm[0]
+		yc := gm[4]*x + (gm[5]-(1<<WARPEDMODEL_PREC_BITS))*y + gm[1]
+
+		if uh.allowHighPrecisionMv {
+			mv[0] = round2Signed(yc, WARPEDMODEL_PREC_BITS-3)
+			mv[1] = round2Signed(xc, WARPEDMODEL_PREC_BITS-3)
+		} else {
+			mv[0] = round2Signed(yc, WARPEDMODEL_PREC_BITS-2) * 2
+			mv[1] = round2Signed(xc, WARPEDMODEL_PREC_BITS-2) * 2
+		}
+	}
+
+	return lowerMvPrecision(mv)
+}
+
+func lowerMvPrecision(candMv [2]int) [2]int {
+	if uh.allowHighPrecisionMv {
+		return candMv
+	}
+
+	for i := 0; i < 2; i++ {
+		if uh.forceIntegerMv {
+			a := abs(candMv[i])
+			aInt := (a + 3) >> 3
+			if candMv[i] > 0 {
+				candMv[i] = aInt << 3
+			} else {
+				candMv[i] = -(aInt << 3)
+			}
+		} else {
+			if candMv[i]&1 != 0 {
+				if candMv[i] > 0 {
+					candMv[i]--
+				} else {
+					candMv[i]++
+				}
+			}
+		}
+	}
+
+	return candMv
+}
+
+func scanRow(deltaRow int, isCompound bool) {
+	bw4 := Num4x4BlocksWide[MiSize]
+	end4 := min(min(bw4, MiCols-MiCol), 16)
+	deltaCol := 0
+	useStep16 := bw4 >= 16
+
+	if abs(deltaRow) > 1 {
+		deltaRow += MiRow & 1
+		deltaCol = 1 - (MiCol & 1)
+	}
+
+	i := 0
+	for i < end4 {
+		mvRow := MiRow + deltaRow
+		mvCol := MiCol + deltaCol + i
+		if !isInside(mvRow, mvCol) {
+			break
+		}
+
+		length := min(bw4, Num4x4BlocksWide[MiSizes[mvRow][mvCol]])
+		if abs(deltaRow) > 1 {
+			length = max(2, length)
+		}
+		if useStep16 {
+			length = max(4, length)
+		}
+
+		weight := length * 2
+		addRefMvCandidate(mvRow, mvCol, isCompound, weight)
+		i += length
+	}
+}
+
+func scanCol(deltaCol int, isCompound bool) {
+	bh4 := Num4x4BlocksHigh[MiSize]
+	end4 := min(min(bh4, MiRows-MiRow), 16)
+	deltaRow := 0
+	useStep16 := bh4 >= 16
+
+	if abs(deltaCol) > 1 {
+		deltaRow = 1 - (MiRow & 1)
+		deltaCol += MiCol & 1
+	}
+
+	i := 0
+	for i < end4 {
+		mvRow := MiRow + deltaRow + i
+		mvCol := MiCol + deltaCol
+		if !isInside(mvRow, mvCol) {
+			break
+		}
+
+		length := min(bh4, Num4x4BlocksHigh[MiSizes[mvRow][mvCol]])
+		if abs(deltaCol) > 1 {
+			length = max(2, length)
+		}
+		if useStep16 {
+			length = max(4, length)
+		}
+
+		weight := length * 2
+		addRefMvCandidate(mvRow, mvCol, isCompound, weight)
+		i += length
+	}
+}
+
+func scanPoint(deltaRow int, deltaCol int, isCompound bool) {
+	mvRow := MiRow + deltaRow
+	mvCol := MiCol + deltaCol
+	weight := 4
+
+	if isInside(mvRow, mvCol) && RefFrames[mvRow][mvCol][0] != -1 {
+		addRefMvCandidate(mvRow, mvCol, isCompound, weight)
+	}
+}
+
+func temporalScan(isCompound bool) {
+	bw4 := Num4x4BlocksWide[MiSize]
+	bh4 := Num4x4BlocksHigh[MiSize]
+
+	stepW4 := 2
+	if bw4 >= 16 {
+		stepW4 = 4
+	}
+	stepH4 := 2
+	if bh4 >= 16 {
+		stepH4 = 4
+	}
+
+	for deltaRow := 0; deltaRow < min(bh4, 16); deltaRow += stepH4 {
+		for deltaCol := 0; deltaCol < min(bw4, 16); deltaCol += stepW4 {
+			addTplRefMv(deltaRow, deltaCol, isCompound)
+		}
+	}
+
+	allowExtension := bh4 >= Num4x4BlocksHigh[BLOCK_8X8] &&
+		bh4 < Num4x4BlocksHigh[BLOCK_64X64] &&
+		bw4 >= Num4x4BlocksWide[BLOCK_8X8] &&
+		bw4 < Num4x4BlocksWide[BLOCK_64X64]
+
+	if allowExtension {
+		tplSamplePos := [3][2]int{{bh4, -2}, {bh4, bw4}, {bh4 - 2, bw4}}
+		for i := 0; i < 3; i++ {
+			deltaRow := tplSamplePos[i][0]
+			deltaCol := tplSamplePos[i][1]
+			if checkSbBorder(deltaRow, deltaCol) {
+				addTplRefMv(deltaRow, deltaCol, isCompound)
+			}
+		}
+	}
+}
+
+func checkSbBorder(deltaRow int, deltaCol int) bool {
+	row := (MiRow & 15) + deltaRow
+	col := (MiCol & 15) + deltaCol
+
+	return row >= 0 && row < 16 && col >= 0 && col < 16
+}
+
+func addTplRefMv(deltaRow int, deltaCol int, isCompound bool) {
+	mvRow := (MiRow + deltaRow) | 1
+	mvCol := (MiCol + deltaCol) | 1
+	if !isInside(mvRow, mvCol) {
+		return
+	}
+
+	x8 := mvCol >> 1
+	y8 := mvRow >> 1
+
+	if deltaRow == 0 && deltaCol == 0 {
+		ZeroMvContext = 1
+	}
+
+	if !isCompound {
+		candMv := MotionFieldMvs[RefFrame[0]][y8][x8]
+		if candMv[0] == INVALID_MV {
+			return
+		}
+
+		candMv = lowerMvPrecision(candMv)
+		if deltaRow == 0 && deltaCol == 0 {
+			if abs(candMv[0]-GlobalMvs[0][0]) >= 16 || abs(candMv[1]-GlobalMvs[0][1]) >= 16 {
+				ZeroMvContext = 1
+			} else {
+				ZeroMvContext = 0
+			}
+		}
+
+		idx := 0
+		for idx = 0; idx < NumMvFound; idx++ {
+			if candMv == RefStackMv[idx][0] {
+				break
+			}
+		}
+
+		if idx < NumMvFound {
+			WeightStack[idx] += 2
+		} else if NumMvFound < MAX_REF_MV_STACK_SIZE {
+			RefStackMv[NumMvFound][0] = candMv
+			WeightStack[NumMvFound] = 2
+			NumMvFound++
+		}
+	} else {
+		candMv0 := MotionFieldMvs[RefFrame[0]][y8][x8]
+		if candMv0[0] == INVALID_MV {
+			return
+		}
+
+		candMv1 := MotionFieldMvs[RefFrame[1]][y8][x8]
+		if candMv1[0] == INVALID_MV {
+			return
+		}
+
+		candMv0 = lowerMvPrecision(candMv0)
+		candMv1 = lowerMvPrecision(candMv1)
+
+		if deltaRow == 0 && deltaCol == 0 {
+			if abs(candMv0[0]-GlobalMvs[0][0]) >= 16 ||
+				abs(candMv0[1]-GlobalMvs[0][1]) >= 16 ||
+				abs(candMv1[0]-GlobalMvs[1][0]) >= 16 ||
+				abs(candMv1[1]-GlobalMvs[1][1]) >= 16 {
+				ZeroMvContext = 1
+			} else {
+				ZeroMvContext = 0
+			}
+		}
+
+		idx := 0
+		for idx = 0; idx < NumMvFound; idx++ {
+			if candMv0 == RefStackMv[idx][0] && candMv1 == RefStackMv[idx][1] {
+				break
+			}
+		}
+
+		if idx < NumMvFound {
+			WeightStack[idx] += 2
+		} else if NumMvFound < MAX_REF_MV_STACK_SIZE {
+			RefStackMv[NumMvFound][0] = candMv0
+			RefStackMv[NumMvFound][1] = candMv1
+			WeightStack[NumMvFound] = 2
+			NumMvFound++
+		}
+	}
+}
+
+func addRefMvCandidate(mvRow int, mvCol int, isCompound bool, weight int) {
+	if !IsInters[mvRow][mvCol] {
+		return
+	}
+
+	if !isCompound {
+		for candList := 0; candList < 2; candList++ {
+			if RefFrames[mvRow][mvCol][candList] == RefFrame[0] {
+				searchStack(mvRow, mvCol, candList, weight)
+			}
+		}
+	} else {
+		if RefFrames[mvRow][mvCol][0] == RefFrame[0] && RefFrames[mvRow][mvCol][1] == RefFrame[1] {
+			compoundSearchStack(mvRow, mvCol, weight)
+		}
+	}
+}
+
+func isGlobalMvBlock(candMode int, candSize int, ref int) bool {
+	large := min(BlockWidth[candSize], BlockHeight[candSize]) >= 8
+
+	return (candMode == GLOBALMV || candMode == GLOBAL_GLOBALMV) &&
+		GmType[ref] > TRANSLATION &&
+		large
+}
+
+func hasNewmv(mode int) bool {
+	return mode == NEWMV ||
+		mode == NEW_NEWMV ||
+		mode == NEAR_NEWMV ||
+		mode == NEW_NEARMV ||
+		mode == NEAREST_NEWMV ||
+		mode == NEW_NEARESTMV
+}
+
+func searchStack(mvRow int, mvCol int, candList int, weight int) {
+	candMode := YModes[mvRow][mvCol]
+	candSize := MiSizes[mvRow][mvCol]
+
+	var candMv [2]int
+	if isGlobalMvBlock(candMode, candSize, RefFrame[0]) {
+		candMv = GlobalMvs[0]
+	} else {
+		candMv = Mvs[mvRow][mvCol][candList]
+	}
+
+	candMv = lowerMvPrecision(candMv)
+
+	if hasNewmv(candMode) {
+		NewMvCount++
+	}
+
+	FoundMatch = true
+
+	idx := 0
+	for idx = 0; idx < NumMvFound; idx++ {
+		if candMv == RefStackMv[idx][0] {
+			break
+		}
+	}
+
+	if idx < NumMvFound {
+		WeightStack[idx] += weight
+	} else if NumMvFound < MAX_REF_MV_STACK_SIZE {
+		RefStackMv[NumMvFound][0] = candMv
+		WeightStack[NumMvFound] = weight
+		NumMvFound++
+	}
+}
+
+func compoundSearchStack(mvRow int, mvCol int, weight int) {
+	candMvs := Mvs[mvRow][mvCol]
+	candMode := YModes[mvRow][mvCol]
+	candSize := MiSizes[mvRow][mvCol]
+
+	for refList := 0; refList < 2; refList++ {
+		if isGlobalMvBlock(candMode, candSize, RefFrame[refList]) {
+			candMvs[refList] = GlobalMvs[refList]
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		candMvs[i] = lowerMvPrecision(candMvs[i])
+	}
+
+	FoundMatch = true
+
+	idx := 0
+	for idx = 0; idx < NumMvFound; idx++ {
+		if candMvs[0] == RefStackMv[idx][0] && candMvs[1] == RefStackMv[idx][1] {
+			break
+		}
+	}
+
+	if idx < NumMvFound {
+		WeightStack[idx] += weight
+	} else if NumMvFound < MAX_REF_MV_STACK_SIZE {
+		RefStackMv[NumMvFound][0] = candMvs[0]
+		RefStackMv[NumMvFound][1] = candMvs[1]
+		WeightStack[NumMvFound] = weight
+		NumMvFound++
+	}
+
+	if hasNewmv(candMode) {
+		NewMvCount++
+	}
+}
+
+func sorting(start int, end int) {
+	for end > start {
+		newEnd := start
+		for idx := start + 1; idx < end; idx++ {
+			if WeightStack[idx-1] < WeightStack[idx] {
+				swapStack(idx-1, idx)
+				newEnd = idx
+			}
+		}
+		end = newEnd
+	}
+}
+
+func swapStack(i int, j int) {
+	WeightStack[i], WeightStack[j] = WeightStack[j], WeightStack[i]
+	RefStackMv[i], RefStackMv[j] = RefStackMv[j], RefStackMv[i]
+}
+
+func extraSearch(isCompound bool) {
+	for list := 0; list < 2; list++ {
+		RefIdCount[list] = 0
+		RefDiffCount[list] = 0
+	}
+
+	w4 := min(16, Num4x4BlocksWide[MiSize])
+	h4 := min(16, Num4x4BlocksHigh[MiSize])
+	w4 = min(w4, MiCols-MiCol)
+	h4 = min(h4, MiRows-MiRow)
+	num4x4 := min(w4, h4)
+
+	for pass := 0; pass < 2 && NumMvFound < 2; pass++ {
+		idx := 0
+		for idx < num4x4 && NumMvFound < 2 {
+			var mvRow int
+			var mvCol int
+			if pass == 0 {
+				mvRow = MiRow - 1
+				mvCol = MiCol + idx
+			} else {
+				mvRow = MiRow + idx
+				mvCol = MiCol - 1
+			}
+
+			if !isInside(mvRow, mvCol) {
+				break
+			}
+
+			addExtraMvCandidate(mvRow, mvCol, isCompound)
+
+			if pass == 0 {
+				idx += Num4x4BlocksWide[MiSizes[mvRow][mvCol]]
+			} else {
+				idx += Num4x4BlocksHigh[MiSizes[mvRow][mvCol]]
+			}
+		}
+	}
+
+	if isCompound {
+		var combinedMvs [2][2][2]int
+
+		for list := 0; list < 2; list++ {
+			compCount := 0
+			for idx := 0; idx < RefIdCount[list]; idx++ {
+				combinedMvs[compCount][list] = RefIdMvs[list][idx]
+				compCount++
+			}
+
+			for idx := 0; idx < RefDiffCount[list] && compCount < 2; idx++ {
+				combinedMvs[compCount][list] = RefDiffMvs[list][idx]
+				compCount++
+			}
+
+			for compCount < 2 {
+				combinedMvs[compCount][list] = GlobalMvs[list]
+				compCount++
+			}
+		}
+
+		if NumMvFound == 1 {
+			if combinedMvs[0][0] == RefStackMv[0][0] && combinedMvs[0][1] == RefStackMv[0][1] {
+				RefStackMv[NumMvFound][0] = combinedMvs[1][0]
+				RefStackMv[NumMvFound][1] = combinedMvs[1][1]
+			} else {
+				RefStackMv[NumMvFound][0] = combinedMvs[0][0]
+				RefStackMv[NumMvFound][1] = combinedMvs[0][1]
+			}
+
+			WeightStack[NumMvFound] = 2
+			NumMvFound++
+		} else {
+			for idx := 0; idx < 2; idx++ {
+				RefStackMv[NumMvFound][0] = combinedMvs[idx][0]
+				RefStackMv[NumMvFound][1] = combinedMvs[idx][1]
+				WeightStack[NumMvFound] = 2
+				NumMvFound++
+			}
+		}
+	} else {
+		for idx := NumMvFound; idx < 2; idx++ {
+			RefStackMv[idx][0] = GlobalMvs[0]
+		}
+	}
+}
+
+func addExtraMvCandidate(mvRow int, mvCol int, isCompound bool) {
+	if isCompound {
+		for candList := 0; candList < 2; candList++ {
+			candRef := RefFrames[mvRow][mvCol][candList]
+			if candRef > INTRA_FRAME {
+				for list := 0; list < 2; list++ {
+					candMv := Mvs[mvRow][mvCol][candList]
+					if candRef == RefFrame[list] && RefIdCount[list] < 2 {
+						RefIdMvs[list][RefIdCount[list]] = candMv
+						RefIdCount[list]++
+					} else if RefDiffCount[list] < 2 {
+						if RefFrameSignBias[candRef] != RefFrameSignBias[RefFrame[list]] {
+							candMv[0] *= -1
+							candMv[1] *= -1
+						}
+
+						RefDiffMvs[list][RefDiffCount[list]] = candMv
+						RefDiffCount[list]++
+					}
+				}
+			}
+		}
+	} else {
+		for candList := 0; candList < 2; candList++ {
+			candRef := RefFrames[mvRow][mvCol][candList]
+			if candRef > INTRA_FRAME {
+				candMv := Mvs[mvRow][mvCol][candList]
+				if RefFrameSignBias[candRef] != RefFrameSignBias[RefFrame[0]] {
+					candMv[0] *= -1
+					candMv[1] *= -1
+				}
+
+				idx := 0
+				for idx = 0; idx < NumMvFound; idx++ {
+					if candMv == RefStackMv[idx][0] {
+						break
+					}
+				}
+
+				if idx == NumMvFound {
+					RefStackMv[idx][0] = candMv
+					WeightStack[idx] = 2
+					NumMvFound++
+				}
+			}
+		}
+	}
+}
+
+func contextAndClamping(isCompound bool, numNew int) {
+	bw4 := Num4x4BlocksWide[MiSize]
+	bh4 := Num4x4BlocksHigh[MiSize]
+
+	numLists := 1
+	if isCompound {
+		numLists = 2
+	}
+
+	for idx := 0; idx < NumMvFound; idx++ {
+		z := 0
+		if idx+1 < NumMvFound {
+			w0 := WeightStack[idx]
+			w1 := WeightStack[idx+1]
+			if w0 >= REF_CAT_LEVEL {
+				if w1 < REF_CAT_LEVEL {
+					z = 1
+				}
+			} else {
+				z = 2
+			}
+		}
+		DrlCtxStack[idx] = z
+
+		for list := 0; list < numLists; list++ {
+			refMv := RefStackMv[idx][list]
+			refMv[0] = clampMvRow(refMv[0], MV_BORDER+bh4*4*8)
+			refMv[1] = clampMvCol(refMv[1], MV_BORDER+bw4*4*8)
+			RefStackMv[idx][list] = refMv
+		}
+	}
+
+	if CloseMatches == 0 {
+		NewMvContext = min(TotalMatches, 1)
+		RefMvContext = TotalMatches
+	} else if CloseMatches == 1 {
+		NewMvContext = 3 - min(numNew, 1)
+		RefMvContext = 2 + TotalMatches
+	} else {
+		NewMvContext = 5 - min(numNew, 1)
+		RefMvContext = 5
+	}
+}
+
+func clampMvRow(mvec int, border int) int {
+	bh4 := Num4x4BlocksHigh[MiSize]
+	mbToTopEdge := -((MiRow * MI_SIZE) * 8)
+	mbToBottomEdge := ((MiRows - bh4 - MiRow) * MI_SIZE) * 8
+
+	return clip3(mbToTopEdge-border, mbToBottomEdge+border, mvec)
+}
+
+func clampMvCol(mvec int, border int) int {
+	bw4 := Num4x4BlocksWide[MiSize]
+	mbToLeftEdge := -((MiCol * MI_SIZE) * 8)
+	mbToRightEdge := ((MiCols - bw4 - MiCol) * MI_SIZE) * 8
+
+	return clip3(mbToLeftEdge-border, mbToRightEdge+border, mvec)
+}
@@ -0,0 +1,120 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// saveModeInfo restores the per-block arrays that allocModeInfo replaces.
+func saveModeInfo(t *testing.T) {
+	saveGlobals(t, &MiSizes, &YModes, &UVModes, &IsInters, &RefFrames, &Mvs,
+		&InterpFilters, &Skips, &SegmentIds, &DeltaLFs, &LoopfilterTxSizes,
+		&cdefIdx)
+}
+
+func setupMvPredTest(t *testing.T) {
+	saveGlobals(t, &sh, &uh, &MiRows, &MiCols, &MiRowStart, &MiRowEnd,
+		&MiColStart, &MiColEnd, &MiRow, &MiCol, &MiSize, &GmType, &OrderHintBits,
+		&RefFrame, &NumMvFound, &NewMvCount, &RefStackMv, &WeightStack,
+		&GlobalMvs, &FoundMatch, &CloseMatches, &TotalMatches,
+		&NewMvContext, &RefMvContext, &ZeroMvContext, &DrlCtxStack,
+		&RefIdCount, &RefDiffCount, &RefIdMvs, &RefDiffMvs)
+	saveModeInfo(t)
+
+	sh = SequenceHeader{}
+	uh = UncompressedHeader{allowHighPrecisionMv: true}
+	MiRows = 16
+	MiCols = 16
+	MiRowStart = 0
+	MiRowEnd = MiRows
+	MiColStart = 0
+	MiColEnd = MiCols
+	for ref := range GmType {
+		GmType[ref] = IDENTITY
+	}
+	allocModeInfo()
+}
+
+func setInterBlock(row int, col int, size int, ref int, mv [2]int) {
+	for r := row; r < row+Num4x4BlocksHigh[size]; r++ {
+		for c := col; c < col+Num4x4BlocksWide[size]; c++ {
+			MiSizes[r][c] = size
+			IsInters[r][c] = true
+			YModes[r][c] = NEARESTMV
+			RefFrames[r][c] = [2]int{ref, NONE}
+			Mvs[r][c][0] = mv
+		}
+	}
+}
+
+func TestFindMvStackNearestNeighbours(t *testing.T) {
+	setupMvPredTest(t)
+
+	setInterBlock(0, 2, BLOCK_8X8, LAST_FRAME, [2]int{8, -16})
+	setInterBlock(2, 0, BLOCK_8X8, LAST_FRAME, [2]int{8, -16})
+	setInterBlock(0, 0, BLOCK_8X8, GOLDEN_FRAME, [2]int{40, 40})
+
+	MiRow = 2
+	MiCol = 2
+	MiSize = BLOCK_8X8
+	RefFrame = [2]int{LAST_FRAME, NONE}
+
+	findMvStack(false)
+
+	assert.Equal(t, 1, NumMvFound)
+	assert.Equal(t, [2]int{8, -16}, RefStackMv[0][0])
+	assert.Equal(t, REF_CAT_LEVEL+8, WeightStack[0])
+	assert.Equal(t, [2]int{0, 0}, RefStackMv[1][0])
+	assert.Equal(t, 2, CloseMatches)
+	assert.Equal(t, 5, NewMvContext)
+	assert.Equal(t, 5, RefMvContext)
+}
+
+func TestFindMvStackSortsByWeight(t *testing.T) {
+	setupMvPredTest(t)
+
+	setInterBlock(0, 4, BLOCK_8X8, LAST_FRAME, [2]int{4, 4})
+	setInterBlock(3, 4, BLOCK_8X4, LAST_FRAME, [2]int{-4, 0})
+	setInterBlock(4, 2, BLOCK_8X8, LAST_FRAME, [2]int{-4, 0})
+
+	MiRow = 4
+	MiCol = 4
+	MiSize = BLOCK_8X8
+	RefFrame = [2]int{LAST_FRAME, NONE}
+
+	findMvStack(false)
+
+	assert.Equal(t, 2, NumMvFound)
+	assert.Equal(t, [2]int{-4, 0}, RefStackMv[0][0])
+	assert.Equal(t, [2]int{4, 4}, RefStackMv[1][0])
+	assert.Equal(t, REF_CAT_LEVEL+8, WeightStack[0])
+	assert.Equal(t, 4, WeightStack[1])
+}
+
+func TestLowerMvPrecision(t *testing.T) {
+	saveGlobals(t, &uh)
+	uh = UncompressedHeader{}
+	assert.Equal(t, [2]int{2, -2}, lowerMvPrecision([2]int{3, -3}))
+
+	uh = UncompressedHeader{forceIntegerMv: true}
+	assert.Equal(t, [2]int{8, -8}, lowerMvPrecision([2]int{5, -5}))
+	assert.Equal(t, [2]int{0, 0}, lowerMvPrecision([2]int{4, -4}))
+
+	uh = UncompressedHeader{allowHighPrecisionMv: true}
+	assert.Equal(t, [2]int{3, -3}, lowerMvPrecision([2]int{3, -3}))
+}
+
+func TestGetRelativeDist(t *testing.T) {
+	saveGlobals(t, &sh, &OrderHintBits)
+	sh = SequenceHeader{enableOrderHint: true}
+	OrderHintBits = 7
+
+	assert.Equal(t, 1, getRelativeDist(5, 4))
+	assert.Equal(t, -1, getRelativeDist(4, 5))
+	assert.Equal(t, 2, getRelativeDist(0, 126))
+	assert.Equal(t, -2, getRelativeDist(126, 0))
+
+	sh = SequenceHeader{}
+	assert.Equal(t, 0, getRelativeDist(5, 4))
+}
@@ -0,0 +1,120 @@
+package boulder
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Options configure a Decoder. The zero value decodes operating point 0
+// strictly and without limits, outputs the highest spatial layer of every
+// temporal unit with film grain applied and logs nothing.
+type Options struct {
+	// OperatingPoint is the operating point to decode, an index into the
+	// operating points of the sequence header. Streams with fewer
+	// operating points fall back to operating point 0.
+	OperatingPoint int
+
+	// OutputAllLayers outputs every shown frame of a temporal unit instead
+	// of only the last one, which is the frame of the highest spatial layer
+	// when the operating point selects several.
+	OutputAllLayers bool
+
+	// DisableFilmGrain outputs frames without synthesised film grain, for
+	// comparing against the reconstruction itself.
+	DisableFilmGrain bool
+
+	// Threads is the number of goroutines CDEF may use to filter rows of
+	// superblocks in parallel, the only post filter that does so yet.
+	// Values below 2 filter on the calling goroutine. Decode and Probe of
+	// different Decoders still run one at a time.
+	Threads int
+
+	// MaxFrameWidth and MaxFrameHeight, if positive, reject frames whose
+	// upscaled width or height exceed them.
+	MaxFrameWidth  int
+	MaxFrameHeight int
+
+	// MaxMemory, if positive, rejects frames for which the decoder could
+	// need more than MaxMemory bytes of samples, counting the reference
+	// frames and the frames of the post filter pipeline.
+	MaxMemory int
+
+	// Lenient logs violated bitstream conformance requirements that the
+	// decoder can recover from as warnings instead of failing.
+	Lenient bool
+
+	// OnFrame, if set, is called with every shown frame. The frame is only
+	// valid until OnFrame returns.
+	OnFrame func(f *Frame)
+
+	// Logger, if set, receives the decoder's log records. Every record
+	// carries the index of its temporal unit and the byte offset of its
+	// OBU. Nothing is logged when Logger is nil.
+	Logger *slog.Logger
+
+	// Tracer, if set, receives every syntax element read outside of tile
+	// data. Symbols read from tile data are not traced.
+	Tracer Tracer
+}
+
+// framesInUse is the number of frames the decoder may hold at once: the
+// reference slots, CurrFrame and the four other stages of the post filter
+// pipeline, the film grain output and the frame held back for output.
+const framesInUse = NUM_REF_FRAMES + 7
+
+// conformanceError reports a violated bitstream conformance requirement
+// the decoder can carry on after. It panics unless the Options of r are
+// Lenient, in which case it logs a warning to the logger of r.
+func conformanceError(requirement string, r *Reader) {
+	if !r.options.Lenient {
+		panic(requirement)
+	}
+
+	r.log().Warn("conformance violation", "requirement", requirement)
+}
+
+// checkFrameLimits panics if the frame size just computed exceeds the
+// limits of the Options of r.
+func checkFrameLimits(r *Reader) {
+	if (r.options.MaxFrameWidth > 0 && UpscaledWidth > r.options.MaxFrameWidth) ||
+		(r.options.MaxFrameHeight > 0 && FrameHeight > r.options.MaxFrameHeight) {
+		panic(fmt.Sprintf("frame size %dx%d exceeds the limit of %dx%d",
+			UpscaledWidth, FrameHeight, r.options.MaxFrameWidth, r.options.MaxFrameHeight))
+	}
+
+	if r.options.MaxMemory > 0 {
+		memory := framesInUse * frameMemory(UpscaledWidth, FrameHeight, sh.colorConfig)
+		if memory > r.options.MaxMemory {
+			panic(fmt.Sprintf("frame size %dx%d needs %d bytes, more than the limit of %d",
+				UpscaledWidth, FrameHeight, memory, r.options.MaxMemory))
+		}
+	}
+}
+
+// frameMemory returns the number of bytes NewFrame allocates for the
+// samples of a frame, borders included.
+func frameMemory(width int, height int, cc ColorConfig) int {
+	numPlanes := 3
+	if cc.monoChrome {
+		numPlanes = 1
+	}
+
+	bytesPerSample := 1
+	if cc.bitDepth > 8 {
+		bytesPerSample = 2
+	}
+
+	memory := 0
+	for plane := 0; plane < numPlanes; plane++ {
+		subX, subY := 0, 0
+		if plane > 0 {
+			subX, subY = cc.subsamplingX, cc.subsamplingY
+		}
+
+		w := (width + subX) >> subX
+		h := (height + subY) >> subY
+		memory += (w + 2*(FRAME_BORDER>>subX)) * (h + 2*(FRAME_BORDER>>subY)) * bytesPerSample
+	}
+
+	return memory
+}
@@ -0,0 +1,88 @@
+package boulder
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChooseOperatingPoint(t *testing.T) {
+	assert.Equal(t, 0, chooseOperatingPoint(2, &Reader{}))
+
+	r := Reader{options: Options{OperatingPoint: 1}}
+	assert.Equal(t, 1, chooseOperatingPoint(2, &r))
+	assert.Equal(t, 0, chooseOperatingPoint(1, &r))
+}
+
+func TestConformanceError(t *testing.T) {
+	assert.PanicsWithValue(t, "reserved bit must be 0", func() {
+		conformanceError("reserved bit must be 0", &Reader{})
+	})
+
+	var buf bytes.Buffer
+	r := Reader{logger: slog.New(slog.NewTextHandler(&buf, nil)), options: Options{Lenient: true}}
+	assert.NotPanics(t, func() {
+		conformanceError("reserved bit must be 0", &r)
+	})
+	assert.Contains(t, buf.String(), `msg="conformance violation" requirement="reserved bit must be 0"`)
+}
+
+func TestObuHeaderLenient(t *testing.T) {
+	// An OBU_TEMPORAL_DELIMITER header with obu_reserved_1bit set.
+	data := []byte{OBU_TEMPORAL_DELIMITER<<3 | 1}
+	assert.Panics(t, func() { obuHeader(&Reader{data: data}) })
+
+	header := obuHeader(&Reader{data: data, options: Options{Lenient: true}})
+	assert.Equal(t, OBU_TEMPORAL_DELIMITER, header.typ)
+}
+
+func TestFrameMemory(t *testing.T) {
+	for _, cc := range []ColorConfig{
+		{bitDepth: 8, subsamplingX: 1, subsamplingY: 1},
+		{bitDepth: 10, subsamplingX: 1},
+		{bitDepth: 12, monoChrome: true},
+	} {
+		f := NewFrame(35, 17, cc)
+
+		memory := 0
+		for plane := 0; plane < f.NumPlanes; plane++ {
+			memory += len(f.Planes[plane].Pix8) + 2*len(f.Planes[plane].Pix16)
+		}
+		assert.Equal(t, memory, frameMemory(35, 17, cc))
+	}
+}
+
+func TestCheckFrameLimits(t *testing.T) {
+	saveGlobals(t, &sh, &UpscaledWidth, &FrameHeight)
+	sh = SequenceHeader{colorConfig: ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1}}
+	UpscaledWidth = 1920
+	FrameHeight = 1080
+	check := func(options Options) func() {
+		return func() { checkFrameLimits(&Reader{options: options}) }
+	}
+
+	assert.NotPanics(t, check(Options{}))
+	assert.NotPanics(t, check(Options{MaxFrameWidth: 1920, MaxFrameHeight: 1080}))
+	assert.PanicsWithValue(t, "frame size 1920x1080 exceeds the limit of 1280x0", check(Options{MaxFrameWidth: 1280}))
+
+	memory := framesInUse * frameMemory(1920, 1080, sh.colorConfig)
+	assert.NotPanics(t, check(Options{MaxMemory: memory}))
+	assert.Panics(t, check(Options{MaxMemory: memory - 1}))
+}
+
+func TestProbeFrameLimits(t *testing.T) {
+	d := NewDecoder(Options{MaxFrameWidth: 32})
+	result, err := d.Probe(writeProbeStream(t))
+	assert.EqualError(t, err, "probe: temporal unit 0: frame size 64x64 exceeds the limit of 32x0")
+	assert.Equal(t, 64, result.MaxFrameWidth)
+	assert.Empty(t, result.Frames)
+}
+
+func TestDecodeFrameLimits(t *testing.T) {
+	d := NewDecoder(Options{MaxFrameWidth: 32})
+	_, err := d.Decode(writeProbeStream(t))
+	assert.EqualError(t, err, "decode: temporal unit 0: frame size 64x64 exceeds the limit of 32x0")
+	assert.NotErrorIs(t, err, ErrNotImplemented)
+}
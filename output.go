@@ -0,0 +1,58 @@
+package boulder
+
+// outputProcess hands the shown frame to the OnFrame callback of the
+// Options of r, with film grain applied when the frame header asks for it
+// and the Options allow it.
+func outputProcess(r *Reader) {
+	if r.options.OnFrame == nil {
+		return
+	}
+
+	params := uh.filmGrainParams
+	if r.options.DisableFilmGrain || !params.applyGrain {
+		emitFrame(CurrFrame, r)
+		return
+	}
+
+	out := filmGrainSynthesis(CurrFrame, params, UpscaledWidth, FrameHeight)
+	emitFrame(out, r)
+	framePool.Put(out)
+}
+
+// heldFrame is a copy of the last shown frame of the temporal unit being
+// decoded, kept back until the temporal unit ends when only the highest
+// spatial layer is output.
+var heldFrame *Frame
+
+// emitFrame records the current render size on f and hands f to OnFrame.
+// When the operating point has several layers and OutputAllLayers is not
+// set a copy of f is held back instead, replacing the frame of any lower
+// layer, for flushHeldFrame to output.
+func emitFrame(f *Frame, r *Reader) {
+	f.RenderWidth = RenderWidth
+	f.RenderHeight = RenderHeight
+	if r.options.OutputAllLayers || OperatingPointIdc == 0 {
+		r.options.OnFrame(f)
+		return
+	}
+
+	held := framePool.Get(f.Width, f.Height, sh.colorConfig)
+	held.CopyFrom(f)
+	held.RenderWidth = f.RenderWidth
+	held.RenderHeight = f.RenderHeight
+	framePool.Put(heldFrame)
+
+	heldFrame = held
+}
+
+// flushHeldFrame outputs the frame held back by emitFrame, if any, at the
+// end of a temporal unit.
+func flushHeldFrame(r *Reader) {
+	if heldFrame == nil {
+		return
+	}
+
+	r.options.OnFrame(heldFrame)
+	framePool.Put(heldFrame)
+	heldFrame = nil
+}
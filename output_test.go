@@ -0,0 +1,56 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputProcessDisableFilmGrain(t *testing.T) {
+	setupFilmGrainTest(t)
+	saveGlobals(t, &RenderWidth, &RenderHeight, &heldFrame)
+	uh.filmGrainParams = grainParams()
+	UpscaledWidth = 64
+	FrameHeight = 48
+
+	var got *Frame
+	onFrame := func(f *Frame) { got = f }
+	outputProcess(&Reader{options: Options{DisableFilmGrain: true, OnFrame: onFrame}})
+	assert.Same(t, CurrFrame, got)
+
+	outputProcess(&Reader{options: Options{OnFrame: onFrame}})
+	assert.NotSame(t, CurrFrame, got)
+}
+
+func TestOutputProcessHighestLayer(t *testing.T) {
+	setupFilmGrainTest(t)
+	saveGlobals(t, &RenderWidth, &RenderHeight, &heldFrame)
+	UpscaledWidth = 64
+	FrameHeight = 48
+	RenderWidth = 60
+	RenderHeight = 40
+	OperatingPointIdc = 0x301
+
+	var got []*Frame
+	r := Reader{options: Options{OnFrame: func(f *Frame) { got = append(got, f) }}}
+	outputProcess(&r)
+	CurrFrame.Planes[0].Set(0, 0, 7)
+	outputProcess(&r)
+	assert.Empty(t, got)
+
+	flushHeldFrame(&r)
+	if assert.Len(t, got, 1) {
+		assert.NotSame(t, CurrFrame, got[0])
+		assert.Equal(t, 7, got[0].Planes[0].At(0, 0))
+		assert.Equal(t, 64, got[0].Width)
+		assert.Equal(t, 60, got[0].RenderWidth)
+		assert.Equal(t, 40, got[0].RenderHeight)
+	}
+
+	got = nil
+	r.options.OutputAllLayers = true
+	outputProcess(&r)
+	outputProcess(&r)
+	flushHeldFrame(&r)
+	assert.Equal(t, []*Frame{CurrFrame, CurrFrame}, got)
+}
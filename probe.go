@@ -0,0 +1,357 @@
+package boulder
+
+import "fmt"
+
+var (
+	// headersOnly makes the parser skip everything that needs tile data:
+	// no frames are allocated, tile group payloads are skipped by size and
+	// only the header state of the reference slots is updated.
+	headersOnly bool
+
+	// frameHeaderSink, if set, is called once every frame has been parsed,
+	// either on its last tile group or on a show_existing_frame header.
+	frameHeaderSink func()
+
+	// obuSink, if set, is called with the header, byte offset and total
+	// size of every OBU, including the ones dropped for the operating
+	// point.
+	obuSink func(header ObuHeader, offset int, size int)
+
+	// frameBytes counts the bytes of the frame header, frame and tile group
+	// OBUs of the frame being parsed, OBU headers included.
+	frameBytes int
+)
+
+// ProbeResult describes a stream as signalled by its sequence and frame
+// headers.
+type ProbeResult struct {
+	Profile                   int                   `json:"seq_profile"`
+	StillPicture              bool                  `json:"still_picture"`
+	ReducedStillPictureHeader bool                  `json:"reduced_still_picture_header"`
+	MaxFrameWidth             int                   `json:"max_frame_width"`
+	MaxFrameHeight            int                   `json:"max_frame_height"`
+	OperatingPoints           []ProbeOperatingPoint `json:"operating_points"`
+
+	BitDepth                int  `json:"bit_depth"`
+	MonoChrome              bool `json:"mono_chrome"`
+	SubsamplingX            int  `json:"subsampling_x"`
+	SubsamplingY            int  `json:"subsampling_y"`
+	ColorPrimaries          int  `json:"color_primaries"`
+	TransferCharacteristics int  `json:"transfer_characteristics"`
+	MatrixCoefficients      int  `json:"matrix_coefficients"`
+	FullRange               bool `json:"full_range"`
+	ChromaSamplePosition    int  `json:"chroma_sample_position"`
+	FilmGrainParamsPresent  bool `json:"film_grain_params_present"`
+
+	// Timing is nil unless the sequence header carries timing info.
+	Timing *ProbeTiming `json:"timing_info,omitempty"`
+
+	TemporalUnits int          `json:"temporal_units"`
+	Frames        []ProbeFrame `json:"frames,omitempty"`
+	OBUs          []ProbeObu   `json:"obus,omitempty"`
+}
+
+type ProbeOperatingPoint struct {
+	Idc         int `json:"operating_point_idc"`
+	SeqLevelIdx int `json:"seq_level_idx"`
+	Tier        int `json:"seq_tier"`
+}
+
+// Level returns the level as written in Annex A, such as "5.1", or "max"
+// for the unconstrained level 31.
+func (op ProbeOperatingPoint) Level() string {
+	if op.SeqLevelIdx == 31 {
+		return "max"
+	}
+
+	return fmt.Sprintf("%d.%d", 2+(op.SeqLevelIdx>>2), op.SeqLevelIdx&3)
+}
+
+type ProbeTiming struct {
+	NumUnitsInDisplayTick int  `json:"num_units_in_display_tick"`
+	TimeScale             int  `json:"time_scale"`
+	EqualPictureInterval  bool `json:"equal_picture_interval"`
+	NumTicksPerPicture    int  `json:"num_ticks_per_picture"`
+}
+
+// FrameRate returns the frame rate as a fraction, or 0, 0 when pictures
+// are not evenly spaced.
+func (t *ProbeTiming) FrameRate() (int, int) {
+	if !t.EqualPictureInterval || t.TimeScale == 0 || t.NumUnitsInDisplayTick == 0 {
+		return 0, 0
+	}
+
+	return t.TimeScale, t.NumUnitsInDisplayTick * t.NumTicksPerPicture
+}
+
+type ProbeFrame struct {
+	// TemporalUnit is the index of the temporal unit the frame is in.
+	TemporalUnit int `json:"temporal_unit"`
+	TemporalId   int `json:"temporal_id"`
+	SpatialId    int `json:"spatial_id"`
+
+	FrameType         int  `json:"frame_type"`
+	ShowFrame         bool `json:"show_frame"`
+	ShowableFrame     bool `json:"showable_frame"`
+	ShowExistingFrame bool `json:"show_existing_frame"`
+	// FrameToShowMapIdx is the slot shown by a show_existing_frame header.
+	FrameToShowMapIdx int `json:"frame_to_show_map_idx"`
+	OrderHint         int `json:"order_hint"`
+
+	FrameWidth    int `json:"frame_width"`
+	FrameHeight   int `json:"frame_height"`
+	UpscaledWidth int `json:"upscaled_width"`
+	RenderWidth   int `json:"render_width"`
+	RenderHeight  int `json:"render_height"`
+
+	// Size is the number of bytes of the OBUs that make up the frame.
+	Size int `json:"size"`
+
+	// Header holds the remaining uncompressed header fields. It is nil for
+	// show_existing_frame headers.
+	Header *ProbeFrameHeader `json:"header,omitempty"`
+}
+
+// ProbeFrameHeader holds the uncompressed header fields of a frame that
+// ProbeFrame does not cover.
+type ProbeFrameHeader struct {
+	ErrorResilientMode       bool  `json:"error_resilient_mode"`
+	DisableCdfUpdate         bool  `json:"disable_cdf_update"`
+	DisableFrameEndUpdateCdf bool  `json:"disable_frame_end_update_cdf"`
+	PrimaryRefFrame          int   `json:"primary_ref_frame"`
+	RefreshFrameFlags        int   `json:"refresh_frame_flags"`
+	RefFrameIdx              []int `json:"ref_frame_idx,omitempty"`
+	AllowIntrabc             bool  `json:"allow_intrabc"`
+	ForceIntegerMv           bool  `json:"force_integer_mv"`
+	AllowHighPrecisionMv     bool  `json:"allow_high_precision_mv"`
+	InterpolationFilter      int   `json:"interpolation_filter"`
+	IsMotionModeSwitchable   bool  `json:"is_motion_mode_switchable"`
+	UseRefFrameMvs           bool  `json:"use_ref_frame_mvs"`
+	UseSuperres              bool  `json:"use_superres"`
+	SuperresDenom            int   `json:"superres_denom"`
+
+	TileCols int `json:"tile_cols"`
+	TileRows int `json:"tile_rows"`
+
+	BaseQIdx     int  `json:"base_q_idx"`
+	DeltaQYDc    int  `json:"delta_q_y_dc"`
+	DeltaQUDc    int  `json:"delta_q_u_dc"`
+	DeltaQUAc    int  `json:"delta_q_u_ac"`
+	DeltaQVDc    int  `json:"delta_q_v_dc"`
+	DeltaQVAc    int  `json:"delta_q_v_ac"`
+	UsingQMatrix bool `json:"using_qmatrix"`
+
+	SegmentationEnabled bool `json:"segmentation_enabled"`
+	DeltaQPresent       bool `json:"delta_q_present"`
+	DeltaLfPresent      bool `json:"delta_lf_present"`
+
+	LoopFilterLevel      [4]int `json:"loop_filter_level"`
+	LoopFilterSharpness  int    `json:"loop_filter_sharpness"`
+	CdefDamping          int    `json:"cdef_damping"`
+	CdefBits             int    `json:"cdef_bits"`
+	FrameRestorationType [3]int `json:"frame_restoration_type"`
+
+	TxMode            int  `json:"tx_mode"`
+	ReferenceSelect   bool `json:"reference_select"`
+	SkipModePresent   bool `json:"skip_mode_present"`
+	AllowWarpedMotion bool `json:"allow_warped_motion"`
+	ReducedTxSet      bool `json:"reduced_tx_set"`
+	ApplyGrain        bool `json:"apply_grain"`
+}
+
+// ProbeObu describes one OBU of the stream.
+type ProbeObu struct {
+	TemporalUnit int `json:"temporal_unit"`
+	// Offset is the byte offset of the OBU header in the file.
+	Offset       int  `json:"offset"`
+	Type         int  `json:"obu_type"`
+	Size         int  `json:"size"`
+	HasExtension bool `json:"obu_extension_flag"`
+	TemporalId   int  `json:"temporal_id"`
+	SpatialId    int  `json:"spatial_id"`
+}
+
+// Probe parses the sequence and frame headers of the Annex B stream in
+// filePath without decoding any tile data. A malformed stream is reported
+// as an error, along with whatever was parsed up to that point.
+func (d *Decoder) Probe(filePath string) (result ProbeResult, err error) {
+	decoderMu.Lock()
+	defer decoderMu.Unlock()
+
+	r, err := NewReader(filePath)
+	if err != nil {
+		return result, fmt.Errorf("probe: %w", err)
+	}
+	r.tracer = d.options.Tracer
+	r.options = d.options
+	// Probe decodes no samples, so there are no frames to output.
+	r.options.OnFrame = nil
+
+	resetDecoderState()
+	headersOnly = true
+
+	tu := 0
+	var frames []ProbeFrame
+	var obus []ProbeObu
+	frameHeaderSink = func() {
+		frames = append(frames, probeFrame(tu))
+		frameBytes = 0
+	}
+	obuSink = func(header ObuHeader, offset int, size int) {
+		obus = append(obus, ProbeObu{
+			TemporalUnit: tu,
+			Offset:       offset,
+			Type:         header.typ,
+			Size:         size,
+			HasExtension: header.extensionFlag == 1,
+			TemporalId:   header.temporalId,
+			SpatialId:    header.spatialId,
+		})
+	}
+
+	defer func() {
+		headersOnly = false
+		frameHeaderSink = nil
+		obuSink = nil
+
+		if v := recover(); v != nil {
+			err = fmt.Errorf("probe: temporal unit %d: %v", tu, v)
+		}
+
+		if sh.operatingPointIdc != nil {
+			result = probeSequence()
+		} else if err == nil {
+			err = fmt.Errorf("probe: no sequence header")
+		}
+		result.TemporalUnits = tu
+		result.Frames = frames
+		result.OBUs = obus
+	}()
+
+	for ; r.hasRemainingData(); tu++ {
+		r.logger = d.logger.With("tu", tu)
+		temporalUnitSize := r.named("temporal_unit_size").leb128()
+		r.logger.Debug("temporal unit", "offset", r.position()/8-Leb128Bytes, "size", temporalUnitSize)
+		temporalUnit(&r, temporalUnitSize)
+	}
+
+	return result, nil
+}
+
+func probeSequence() ProbeResult {
+	cc := sh.colorConfig
+
+	result := ProbeResult{
+		Profile:                   sh.seqProfile,
+		StillPicture:              sh.stillPicture,
+		ReducedStillPictureHeader: sh.reducedStillPictureHeader,
+		MaxFrameWidth:             sh.maxFrameWidthMinusOne + 1,
+		MaxFrameHeight:            sh.maxFrameHeightMinusOne + 1,
+		BitDepth:                  cc.bitDepth,
+		MonoChrome:                cc.monoChrome,
+		SubsamplingX:              cc.subsamplingX,
+		SubsamplingY:              cc.subsamplingY,
+		ColorPrimaries:            cc.colorPrimaries,
+		TransferCharacteristics:   cc.transferCharacteristics,
+		MatrixCoefficients:        cc.matrixCoefficients,
+		FullRange:                 cc.colorRange == 1,
+		ChromaSamplePosition:      cc.chromaSamplePosition,
+		FilmGrainParamsPresent:    sh.filmGrainParamsPresent,
+	}
+
+	for i := range sh.operatingPointIdc {
+		result.OperatingPoints = append(result.OperatingPoints, ProbeOperatingPoint{
+			Idc:         sh.operatingPointIdc[i],
+			SeqLevelIdx: sh.seqLevelIdx[i],
+			Tier:        sh.seqTier[i],
+		})
+	}
+
+	if sh.timingInfoPresentFlag {
+		result.Timing = &ProbeTiming{
+			NumUnitsInDisplayTick: sh.timingInfo.numUnitsInDisplayTick,
+			TimeScale:             sh.timingInfo.timeScale,
+			EqualPictureInterval:  sh.timingInfo.equalPictureInterval,
+			NumTicksPerPicture:    sh.timingInfo.numTicksPerPictureMinusOne + 1,
+		}
+	}
+
+	return result
+}
+
+func probeFrame(tu int) ProbeFrame {
+	orderHint := OrderHint
+	if uh.showExistingFrame {
+		orderHint = RefOrderHint[uh.frameToShowMapIdx]
+	}
+
+	return ProbeFrame{
+		TemporalUnit:      tu,
+		TemporalId:        temporalId,
+		SpatialId:         spatialId,
+		FrameType:         uh.frameType,
+		ShowFrame:         uh.showFrame,
+		ShowableFrame:     uh.showableFrame,
+		ShowExistingFrame: uh.showExistingFrame,
+		FrameToShowMapIdx: uh.frameToShowMapIdx,
+		OrderHint:         orderHint,
+		FrameWidth:        FrameWidth,
+		FrameHeight:       FrameHeight,
+		UpscaledWidth:     UpscaledWidth,
+		RenderWidth:       RenderWidth,
+		RenderHeight:      RenderHeight,
+		Size:              frameBytes,
+		Header:            probeFrameHeader(),
+	}
+}
+
+func probeFrameHeader() *ProbeFrameHeader {
+	if uh.showExistingFrame {
+		return nil
+	}
+
+	h := &ProbeFrameHeader{
+		ErrorResilientMode:       uh.errorResilientMode,
+		DisableCdfUpdate:         uh.disableCdfUpdate,
+		DisableFrameEndUpdateCdf: uh.disableFrameEndUpdateCdf,
+		PrimaryRefFrame:          uh.primaryRefFrame,
+		RefreshFrameFlags:        uh.refreshFrameFlags,
+		AllowIntrabc:             uh.allowIntrabc,
+		ForceIntegerMv:           uh.forceIntegerMv,
+		AllowHighPrecisionMv:     uh.allowHighPrecisionMv,
+		InterpolationFilter:      uh.interpolationFilter,
+		IsMotionModeSwitchable:   uh.isMotionModeSwitchable,
+		UseRefFrameMvs:           uh.useRefFrameMvs,
+		UseSuperres:              uh.useSuperres,
+		SuperresDenom:            SuperresDenom,
+		TileCols:                 TileCols,
+		TileRows:                 TileRows,
+		BaseQIdx:                 uh.quantizationParams.baseQIdx,
+		DeltaQYDc:                DeltaQYDc,
+		DeltaQUDc:                DeltaQUDc,
+		DeltaQUAc:                DeltaQUAc,
+		DeltaQVDc:                DeltaQVDc,
+		DeltaQVAc:                DeltaQVAc,
+		UsingQMatrix:             uh.quantizationParams.usingQMatrix,
+		SegmentationEnabled:      uh.segmentationEnabled,
+		DeltaQPresent:            uh.deltaQPresent,
+		DeltaLfPresent:           uh.deltaLfPresent,
+		LoopFilterSharpness:      uh.loopFilterParams.loopFilterSharpness,
+		CdefDamping:              CdefDamping,
+		CdefBits:                 uh.cdefParams.cdefBits,
+		TxMode:                   TxMode,
+		ReferenceSelect:          uh.referenceSelect,
+		SkipModePresent:          uh.skipmodeParams.skipModePresent,
+		AllowWarpedMotion:        uh.allowWarpedMotion,
+		ReducedTxSet:             uh.reducedTxSet,
+		ApplyGrain:               uh.filmGrainParams.applyGrain,
+	}
+
+	if !FrameIsIntra {
+		h.RefFrameIdx = append([]int(nil), uh.refFrameIdx...)
+	}
+	copy(h.LoopFilterLevel[:], uh.loopFilterParams.loopFilterLevel)
+	copy(h.FrameRestorationType[:], FrameRestorationType)
+
+	return h
+}
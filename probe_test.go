@@ -0,0 +1,221 @@
+package boulder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withTrailingBits returns bits followed by trailing_bits().
+func withTrailingBits(bits string) []byte {
+	bits = strings.ReplaceAll(bits, " ", "") + "1"
+	for len(bits)%8 != 0 {
+		bits += "0"
+	}
+
+	return bitsToBytes(bits)
+}
+
+// annexBObu returns an OBU without obu_size, preceded by its obu_length.
+func annexBObu(header []byte, payload []byte) []byte {
+	obu := append(append([]byte{}, header...), payload...)
+	return append([]byte{byte(len(obu))}, obu...)
+}
+
+// annexBUnit prefixes the concatenated parts with their leb128 length, as
+// Annex B does for frame and temporal units.
+func annexBUnit(parts ...[]byte) []byte {
+	var unit []byte
+	for _, part := range parts {
+		unit = append(unit, part...)
+	}
+
+	return append([]byte{byte(len(unit))}, unit...)
+}
+
+const probeSequenceHeaderBits = "000 0 0" +
+	// timing_info with 30 fps, no decoder model
+	"1 00000000000000000000000000000001 00000000000000000000000000011110 1 1 0" +
+	// two operating points: 0x103 at level 4.0 high tier, 0x101 at 3.1
+	"0 00001 000100000011 01000 1 000100000001 00101" +
+	// 64x64, no frame ids
+	"0101 0101 111111 111111 0" +
+	"0 0 0 0 0 0 0 1 0 0 1 1 110 0 0 0" +
+	// 8-bit 4:2:0, BT.2020 PQ, full range, colocated chroma
+	"0 0 1 00001001 00010000 00001001 1 10 0" +
+	"0"
+
+// probeInterHeaderBits is a hidden inter frame with order hint 4 that
+// refreshes slot 6.
+var probeInterHeaderBits = "0 01 0 1 0 1 0 0 0000100 111 01000000 0" +
+	strings.Repeat("000", REFS_PER_FRAME) +
+	"0 0 1 0 1 01100100 0000 0 0 000000 000000 000 0 0 0 0 0000000"
+
+// probeStream returns an Annex B stream of three temporal units: a key
+// frame with its sequence header, a hidden inter frame, and an OBU outside
+// the operating point followed by a show_existing_frame header.
+func probeStream() []byte {
+	td := annexBObu([]byte{OBU_TEMPORAL_DELIMITER << 3}, nil)
+	seq := annexBObu([]byte{OBU_SEQUENCE_HEADER << 3}, withTrailingBits(probeSequenceHeaderBits))
+
+	// A shown key frame at q 100 with a 3 byte tile.
+	keyHeader := bitsToBytes("0 00 1 1 0 0 0000000 0 1 01100100 0000 0 0 000000 000000 000 0 0 0")
+	key := annexBObu([]byte{OBU_FRAME << 3}, append(keyHeader, 0xaa, 0xbb, 0xcc))
+
+	// The hidden inter frame, its header repeated before the tile group.
+	interHeader := withTrailingBits(probeInterHeaderBits)
+	inter := annexBObu([]byte{OBU_FRAME_HEADER << 3}, interHeader)
+	tiles := annexBObu([]byte{OBU_TILE_GROUP << 3}, []byte{1, 2, 3, 4})
+
+	// An OBU of temporal layer 2, which operating point 0 drops, and a
+	// show_existing_frame header for slot 6.
+	dropped := annexBObu([]byte{OBU_FRAME_HEADER<<3 | 1<<2, 2 << 5}, []byte{0xff})
+	show := annexBObu([]byte{OBU_FRAME_HEADER << 3}, withTrailingBits("1 110"))
+
+	var stream []byte
+	stream = append(stream, annexBUnit(annexBUnit(td, seq, key))...)
+	stream = append(stream, annexBUnit(annexBUnit(td, inter, inter, tiles))...)
+	stream = append(stream, annexBUnit(annexBUnit(td, dropped, show))...)
+
+	return stream
+}
+
+func writeProbeStream(t testing.TB) string {
+	path := filepath.Join(t.TempDir(), "probe.obu")
+	assert.NoError(t, os.WriteFile(path, probeStream(), 0o644))
+
+	return path
+}
+
+func TestProbe(t *testing.T) {
+	d := NewDecoder(Options{})
+	result, err := d.Probe(writeProbeStream(t))
+	assert.NoError(t, err)
+	assert.False(t, headersOnly)
+
+	assert.Equal(t, 0, result.Profile)
+	assert.Equal(t, 64, result.MaxFrameWidth)
+	assert.Equal(t, 64, result.MaxFrameHeight)
+	assert.Equal(t, []ProbeOperatingPoint{
+		{Idc: 0x103, SeqLevelIdx: 8, Tier: 1},
+		{Idc: 0x101, SeqLevelIdx: 5, Tier: 0},
+	}, result.OperatingPoints)
+	assert.Equal(t, "4.0", result.OperatingPoints[0].Level())
+	assert.Equal(t, "3.1", result.OperatingPoints[1].Level())
+
+	assert.Equal(t, 8, result.BitDepth)
+	assert.Equal(t, 1, result.SubsamplingX)
+	assert.Equal(t, 1, result.SubsamplingY)
+	assert.Equal(t, CP_BT_2020, result.ColorPrimaries)
+	assert.Equal(t, TC_SMPTE_2084, result.TransferCharacteristics)
+	assert.Equal(t, MC_BT_2020_NCL, result.MatrixCoefficients)
+	assert.True(t, result.FullRange)
+	assert.Equal(t, CSP_COLOCATED, result.ChromaSamplePosition)
+
+	num, den := result.Timing.FrameRate()
+	assert.Equal(t, 30, num)
+	assert.Equal(t, 1, den)
+
+	assert.Equal(t, 3, result.TemporalUnits)
+	if assert.Len(t, result.Frames, 3) {
+		key, inter, shown := result.Frames[0], result.Frames[1], result.Frames[2]
+
+		assert.Equal(t, 0, key.TemporalUnit)
+		assert.Equal(t, KEY_FRAME, key.FrameType)
+		assert.True(t, key.ShowFrame)
+		assert.Equal(t, 64, key.FrameWidth)
+		assert.Equal(t, 64, key.RenderHeight)
+		assert.Equal(t, 1+6+3, key.Size)
+		assert.Equal(t, 100, key.Header.BaseQIdx)
+		assert.Equal(t, 0xff, key.Header.RefreshFrameFlags)
+		assert.Equal(t, TX_MODE_LARGEST, key.Header.TxMode)
+		assert.Nil(t, key.Header.RefFrameIdx)
+
+		assert.Equal(t, INTER_FRAME, inter.FrameType)
+		assert.Equal(t, 1, inter.TemporalUnit)
+		assert.False(t, inter.ShowFrame)
+		assert.True(t, inter.ShowableFrame)
+		assert.Equal(t, 4, inter.OrderHint)
+		assert.Equal(t, 2*(1+len(withTrailingBits(probeInterHeaderBits)))+1+4, inter.Size)
+		assert.Equal(t, 0x40, inter.Header.RefreshFrameFlags)
+		assert.Equal(t, PRIMARY_REF_NONE, inter.Header.PrimaryRefFrame)
+		assert.Equal(t, make([]int, REFS_PER_FRAME), inter.Header.RefFrameIdx)
+		assert.Equal(t, SWITCHABLE, inter.Header.InterpolationFilter)
+
+		assert.Equal(t, ProbeFrame{
+			TemporalUnit: 2, FrameType: INTER_FRAME, ShowFrame: true,
+			ShowExistingFrame: true, FrameToShowMapIdx: 6, OrderHint: 4,
+			FrameWidth: 64, FrameHeight: 64, UpscaledWidth: 64, RenderWidth: 64, RenderHeight: 64,
+			Size: 1 + 1,
+		}, shown)
+	}
+
+	var types []int
+	for _, obu := range result.OBUs {
+		types = append(types, obu.Type)
+	}
+	assert.Equal(t, []int{
+		OBU_TEMPORAL_DELIMITER, OBU_SEQUENCE_HEADER, OBU_FRAME,
+		OBU_TEMPORAL_DELIMITER, OBU_FRAME_HEADER, OBU_FRAME_HEADER, OBU_TILE_GROUP,
+		OBU_TEMPORAL_DELIMITER, OBU_FRAME_HEADER, OBU_FRAME_HEADER,
+	}, types)
+	assert.Equal(t, ProbeObu{TemporalUnit: 0, Offset: 3, Type: OBU_TEMPORAL_DELIMITER, Size: 1}, result.OBUs[0])
+	assert.Equal(t, 1+6+3, result.OBUs[2].Size)
+
+	dropped := result.OBUs[8]
+	assert.Equal(t, 2, dropped.TemporalUnit)
+	assert.True(t, dropped.HasExtension)
+	assert.Equal(t, 2, dropped.TemporalId)
+	assert.Equal(t, 3, dropped.Size)
+}
+
+func TestProbeTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "truncated.obu")
+	assert.NoError(t, os.WriteFile(path, []byte{5, 4, 3, OBU_SEQUENCE_HEADER << 3, 0}, 0o644))
+
+	d := NewDecoder(Options{})
+	result, err := d.Probe(path)
+	assert.Error(t, err)
+	assert.Len(t, result.OBUs, 1)
+	assert.False(t, headersOnly)
+}
+
+func TestSequenceHeaderReducedStillPicture(t *testing.T) {
+	r := Reader{data: withTrailingBits("000 1 1 01100 0101 0101 111111 011111 0 0 0 0 0 0 0 0 0 00 0 0")}
+	s := sequenceHeader(&r)
+
+	assert.True(t, s.reducedStillPictureHeader)
+	assert.Equal(t, []int{0}, s.operatingPointIdc)
+	assert.Equal(t, []int{12}, s.seqLevelIdx)
+	assert.Equal(t, 63, s.maxFrameWidthMinusOne)
+	assert.Equal(t, 31, s.maxFrameHeightMinusOne)
+	assert.Equal(t, SELECT_SCREEN_CONTENT_TOOLS, s.seqForceScreenContentTools)
+	assert.Equal(t, 0, OrderHintBits)
+}
+
+func TestProbeConcurrent(t *testing.T) {
+	filePath := writeProbeStream(t)
+	d := NewDecoder(Options{})
+	want, err := d.Probe(filePath)
+	assert.NoError(t, err)
+
+	results := make([]ProbeResult, 4)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := NewDecoder(Options{OperatingPoint: i})
+			results[i], _ = d.Probe(filePath)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		assert.Equal(t, want, result)
+	}
+}
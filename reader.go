@@ -0,0 +1,350 @@
+package boulder
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"os"
+)
+
+// Reader reads the bit oriented descriptors of the OBU syntax. Reads are
+// bounded by the end of the current OBU, see limit, or otherwise by the
+// end of data, and panic when they would run past it.
+type Reader struct {
+	data     []byte
+	bitIndex int
+	// end is the bit position reads must stay below. Zero means the end
+	// of data.
+	end int
+
+	// cache holds the 64 bits of data from bit cacheStart up to cacheEnd,
+	// so that f only loads from data when a read leaves that window. A
+	// cacheEnd of zero means nothing is cached yet.
+	cache      uint64
+	cacheStart int
+	cacheEnd   int
+
+	// tracer, if set, receives every read that was given a name with
+	// named.
+	tracer  Tracer
+	element string
+
+	// logger, if set, receives the log records of the stream, tagged with
+	// the temporal unit and OBU being parsed.
+	logger *slog.Logger
+
+	// options are the Options of the Decoder reading the stream.
+	options Options
+}
+
+// discardLogger is the logger of readers that were not given one.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// log returns the logger of the stream being read.
+func (r *Reader) log() *slog.Logger {
+	if r.logger == nil {
+		return discardLogger
+	}
+	return r.logger
+}
+
+// named sets the syntax element name reported to the tracer for the next
+// read.
+func (r *Reader) named(element string) *Reader {
+	r.element = element
+	return r
+}
+
+// traced performs read for the pending named syntax element and reports it
+// to the tracer. Reads that read calls itself are not reported.
+func (r *Reader) traced(read func() int) int {
+	name := r.element
+	r.element = ""
+
+	start := r.bitIndex
+	value := read()
+	r.tracer.Element(name, start, r.bitIndex-start, value)
+
+	return value
+}
+
+func NewReader(filePath string) (Reader, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return Reader{}, err
+	}
+
+	return Reader{
+		data:     data,
+		bitIndex: 0,
+	}, nil
+}
+
+func (r *Reader) endBit() int {
+	if r.end == 0 {
+		return len(r.data) * 8
+	}
+
+	return r.end
+}
+
+// limit bounds further reads to the next n bytes and returns the previous
+// bound for restoreLimit.
+func (r *Reader) limit(n int) int {
+	prev := r.end
+	end := r.bitIndex + n*8
+	if end > r.endBit() {
+		panic("obu size exceeds the available data")
+	}
+
+	r.end = end
+	return prev
+}
+
+func (r *Reader) restoreLimit(prev int) {
+	r.end = prev
+}
+
+// position returns the number of bits read so far.
+func (r *Reader) position() int {
+	return r.bitIndex
+}
+
+// remaining returns the number of bits left before the current bound.
+func (r *Reader) remaining() int {
+	return r.endBit() - r.bitIndex
+}
+
+func (r *Reader) byteAligned() bool {
+	return r.bitIndex&7 == 0
+}
+
+func (r *Reader) discard(n int) {
+	if n*8 > r.remaining() {
+		panic("discard past the end of data")
+	}
+
+	r.bitIndex = r.bitIndex + n*8
+}
+
+func (r *Reader) hasRemainingData() bool {
+	return r.remaining() > 0
+}
+
+func (r *Reader) readBit() int {
+	if r.bitIndex >= r.endBit() {
+		panic("read past the end of data")
+	}
+
+	bit := int(r.data[r.bitIndex>>3]>>(7-(r.bitIndex&7))) & 1
+	r.bitIndex++
+	return bit
+}
+
+// load64 returns the 8 bytes starting at byte i as a big endian word,
+// zero padded past the end of data.
+func (r *Reader) load64(i int) uint64 {
+	if i+8 <= len(r.data) {
+		return binary.BigEndian.Uint64(r.data[i:])
+	}
+
+	var w uint64
+	for k := 0; k < 8; k++ {
+		w <<= 8
+		if i+k < len(r.data) {
+			w |= uint64(r.data[i+k])
+		}
+	}
+
+	return w
+}
+
+// refill caches the 64 bits of data from the byte that holds the next bit.
+func (r *Reader) refill() {
+	r.cacheStart = r.bitIndex &^ 7
+	r.cache = r.load64(r.cacheStart >> 3)
+	r.cacheEnd = r.cacheStart + 64
+}
+
+// f reads n bits most significant first. Reads of up to 56 bits are
+// extracted from the cached word, which is refilled when the read does not
+// fit in it.
+func (r *Reader) f(n int) int {
+	if r.tracer != nil && r.element != "" {
+		return r.traced(func() int { return r.f(n) })
+	}
+
+	if n == 0 {
+		return 0
+	}
+
+	if r.bitIndex+n > r.endBit() {
+		panic("read past the end of data")
+	}
+
+	if n > 56 {
+		x := 0
+		for i := 0; i < n; i++ {
+			x = 2*x + r.readBit()
+		}
+
+		return x
+	}
+
+	if r.bitIndex < r.cacheStart || r.bitIndex+n > r.cacheEnd {
+		r.refill()
+	}
+
+	x := (r.cache << (r.bitIndex - r.cacheStart)) >> (64 - n)
+	r.bitIndex += n
+
+	return int(x)
+}
+
+// readBytes returns the next n bytes. The reader must be byte aligned.
+func (r *Reader) readBytes(n int) []byte {
+	if !r.byteAligned() {
+		panic("readBytes on an unaligned reader")
+	}
+
+	start := r.bitIndex >> 3
+	r.discard(n)
+	return r.data[start : start+n]
+}
+
+func (r *Reader) leb128() int {
+	if r.tracer != nil && r.element != "" {
+		return r.traced(func() int { return r.leb128() })
+	}
+
+	value := 0
+	Leb128Bytes = 0
+	for i := 0; i < 8; i++ {
+		var lebt128_byte int
+		if r.byteAligned() && r.bitIndex+8 <= r.endBit() {
+			lebt128_byte = int(r.data[r.bitIndex>>3])
+			r.bitIndex += 8
+		} else {
+			lebt128_byte = r.f(8)
+		}
+
+		value = value | (lebt128_byte&0x7f)<<(i*7)
+		Leb128Bytes += 1
+
+		if (lebt128_byte & 0x80) == 0 {
+			break
+		}
+	}
+
+	if value > (1<<32)-1 {
+		panic("invalid leb128 value")
+	}
+
+	return value
+}
+
+func (r *Reader) uvlc() int {
+	if r.tracer != nil && r.element != "" {
+		return r.traced(func() int { return r.uvlc() })
+	}
+
+	leadingZeros := 0
+	for {
+		done := r.f(1) != 0
+		if done {
+			break
+		}
+		leadingZeros++
+	}
+
+	if leadingZeros >= 32 {
+		return (1 << 32) - 1
+	}
+
+	value := r.f(leadingZeros)
+	return value + (1 << leadingZeros) - 1
+}
+
+func (r *Reader) le(n int) int {
+	if r.tracer != nil && r.element != "" {
+		return r.traced(func() int { return r.le(n) })
+	}
+
+	t := 0
+	for i := 0; i < n; i++ {
+		b := r.f(8)
+		t += b << (i * 8)
+	}
+
+	return t
+}
+
+func (r *Reader) su(n int) int {
+	if r.tracer != nil && r.element != "" {
+		return r.traced(func() int { return r.su(n) })
+	}
+
+	value := r.f(n)
+	signMask := 1 << (n - 1)
+	if (value & signMask) != 0 {
+		return value - 2*signMask
+	}
+
+	return value
+}
+
+func (r *Reader) ns(n int) int {
+	if r.tracer != nil && r.element != "" {
+		return r.traced(func() int { return r.ns(n) })
+	}
+
+	w := floorLog2(n) + 1
+	m := (1 << w) - n
+	v := r.f(w - 1)
+	if v < m {
+		return v
+	}
+
+	extraBit := r.f(1)
+	return (v << 1) - m + extraBit
+}
+
+func decodeSignedSubexpWithRef(r *Reader, low int, high int, ref int) int {
+	x := decodeUnsignedSubexpWithRef(r, high-low, ref-low)
+	return x + low
+}
+
+func decodeUnsignedSubexpWithRef(r *Reader, mx int, ref int) int {
+	v := decodeSubexp(r, mx)
+	if (ref << 1) <= mx {
+		return inverseRecenter(ref, v)
+	}
+
+	return mx - 1 - inverseRecenter(mx-1-ref, v)
+}
+
+func decodeSubexp(r *Reader, numSyms int) int {
+	i := 0
+	mk := 0
+	k := 3
+	for {
+		b2 := k
+		if i != 0 {
+			b2 = k + i - 1
+		}
+		a := 1 << b2
+
+		if numSyms <= mk+3*a {
+			subexpFinalBits := r.named("subexp_final_bits").ns(numSyms - mk)
+			return subexpFinalBits + mk
+		}
+
+		subexpMoreBits := r.named("subexp_more_bits").f(1) != 0
+		if subexpMoreBits {
+			i++
+			mk += a
+		} else {
+			subexpBits := r.named("subexp_bits").f(b2)
+			return subexpBits + mk
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package boulder
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderF(t *testing.T) {
+	r := Reader{data: []byte{0b10110010, 0xff}}
+	assert.Equal(t, 1, r.f(1))
+	assert.Equal(t, 0b011, r.f(3))
+	assert.Equal(t, 0b0010_1111, r.f(8))
+	assert.Equal(t, 12, r.position())
+	assert.Equal(t, 4, r.remaining())
+	assert.Equal(t, -1, r.su(4))
+	assert.False(t, r.hasRemainingData())
+	assert.Panics(t, func() { r.f(1) })
+}
+
+func TestReaderUvlc(t *testing.T) {
+	// 1 -> 0, 010 -> 1, 00111 -> 6
+	r := Reader{data: bitsToBytes("1 010 00111")}
+	assert.Equal(t, 0, r.uvlc())
+	assert.Equal(t, 1, r.uvlc())
+	assert.Equal(t, 6, r.uvlc())
+	assert.Equal(t, 9, r.position())
+}
+
+func TestReaderLe(t *testing.T) {
+	r := Reader{data: []byte{0x34, 0x12, 0x01}}
+	assert.Equal(t, 0x1234, r.le(2))
+	assert.Equal(t, 0x01, r.le(1))
+}
+
+func TestReaderReadBytes(t *testing.T) {
+	r := Reader{data: []byte{0xaa, 0x01, 0x02, 0x03}}
+	r.f(8)
+	assert.Equal(t, []byte{0x01, 0x02}, r.readBytes(2))
+	assert.Equal(t, 24, r.position())
+
+	r.f(1)
+	assert.Panics(t, func() { r.readBytes(1) })
+}
+
+func TestReaderLimit(t *testing.T) {
+	r := Reader{data: []byte{0x01, 0x02, 0x03, 0x04}}
+	r.f(8)
+
+	prev := r.limit(2)
+	assert.Equal(t, 16, r.remaining())
+	assert.Equal(t, 0x0203, r.f(16))
+	assert.Panics(t, func() { r.f(1) })
+	assert.Panics(t, func() { r.discard(1) })
+
+	r.restoreLimit(prev)
+	assert.Equal(t, 0x04, r.f(8))
+
+	r = Reader{data: []byte{0x01}}
+	assert.Panics(t, func() { r.limit(2) })
+}
+
+func TestReaderNs(t *testing.T) {
+	// ns(5) codes 0..2 in two bits and 3..4 in three.
+	r := Reader{data: bitsToBytes("10 110 111")}
+	assert.Equal(t, 2, r.ns(5))
+	assert.Equal(t, 3, r.ns(5))
+	assert.Equal(t, 4, r.ns(5))
+	assert.Equal(t, 0, r.ns(1))
+	assert.Equal(t, 8, r.bitIndex)
+}
+
+func TestSubexp(t *testing.T) {
+	// numSyms 20 fits in the first 3*8 symbols, so the value is ns() coded.
+	r := Reader{data: bitsToBytes("1110 1")}
+	assert.Equal(t, 17, decodeSubexp(&r, 20))
+
+	// One more_bits step moves to the 8..23 range coded in 3 bits.
+	r = Reader{data: bitsToBytes("1 0 101")}
+	assert.Equal(t, 13, decodeSubexp(&r, 100))
+	assert.Equal(t, 5, r.bitIndex)
+}
+
+// bitByBitF is the original reader: one bit at a time, most significant
+// first. The word based reader must match it exactly.
+func bitByBitF(data []byte, bitIndex *int, n int) int {
+	x := 0
+	for i := 0; i < n; i++ {
+		bit := int(data[*bitIndex>>3]>>(7-(*bitIndex&7))) & 1
+		x = 2*x + bit
+		*bitIndex++
+	}
+
+	return x
+}
+
+func TestReaderFParity(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 4099)
+	rng.Read(data)
+
+	r := Reader{data: data}
+	refIndex := 0
+	for {
+		n := rng.Intn(34)
+		if rng.Intn(50) == 0 {
+			n = 57 + rng.Intn(7)
+		}
+		if refIndex+n > len(data)*8 {
+			break
+		}
+
+		assert.Equal(t, bitByBitF(data, &refIndex, n), r.f(n))
+		assert.Equal(t, refIndex, r.position())
+	}
+
+	assert.Panics(t, func() { r.f(len(data)*8 - r.position() + 1) })
+	assert.Equal(t, bitByBitF(data, &refIndex, len(data)*8-refIndex), r.f(len(data)*8-r.position()))
+}
+
+func TestReaderFCacheFollowsPosition(t *testing.T) {
+	data := []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x0f, 0xed, 0xcb, 0xa9}
+	r := Reader{data: data}
+
+	assert.Equal(t, 0x12, r.f(8))
+
+	// Moving the position without f, forwards past the cached word and
+	// back into it, is picked up by the next read.
+	r.discard(8)
+	assert.Equal(t, 0xed, r.f(8))
+	r.bitIndex = 12
+	assert.Equal(t, 0x456, r.f(12))
+
+	r.bitIndex = 60
+	assert.Equal(t, 0x00f, r.f(12))
+}
+
+func TestReaderLeb128(t *testing.T) {
+	r := Reader{data: []byte{0xe5, 0x8e, 0x26, 0x80}}
+	assert.Equal(t, 624485, r.leb128())
+	assert.Equal(t, 3, Leb128Bytes)
+
+	// An unaligned leb128 decodes the same bits.
+	r = Reader{data: bitsToBytes("1 11100101 10001110 00100110")}
+	r.f(1)
+	assert.Equal(t, 624485, r.leb128())
+	assert.Equal(t, 25, r.position())
+}
+
+type recordingTracer struct {
+	elements []tracedElement
+}
+
+func (t *recordingTracer) Element(name string, bitPos int, width int, value int) {
+	t.elements = append(t.elements, tracedElement{Name: name, BitPos: bitPos, Width: width, Value: value})
+}
+
+func TestReaderTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	r := Reader{data: bitsToBytes("101 00101 1 111 00000011"), tracer: tracer}
+
+	assert.Equal(t, 5, r.named("a").f(3))
+	assert.Equal(t, 4, r.named("b").uvlc())
+	assert.Equal(t, 1, r.f(1))
+	assert.Equal(t, 6, r.named("c").ns(7))
+	assert.Equal(t, 3, r.named("d").le(1))
+
+	// Unnamed reads and the reads making up uvlc, ns and le are not
+	// reported.
+	assert.Equal(t, []tracedElement{
+		{Name: "a", BitPos: 0, Width: 3, Value: 5},
+		{Name: "b", BitPos: 3, Width: 5, Value: 4},
+		{Name: "c", BitPos: 9, Width: 3, Value: 6},
+		{Name: "d", BitPos: 12, Width: 8, Value: 3},
+	}, tracer.elements)
+}
+
+// benchmarkData is the probe stream repeated to 64 KiB.
+func benchmarkData() []byte {
+	stream := probeStream()
+	return bytes.Repeat(stream, (64<<10)/len(stream))
+}
+
+func BenchmarkReaderF(b *testing.B) {
+	data := benchmarkData()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		r := Reader{data: data}
+		for n := 1; r.remaining() >= 32; n = n%32 + 1 {
+			r.f(n)
+		}
+	}
+}
+
+func BenchmarkReaderFBitByBit(b *testing.B) {
+	data := benchmarkData()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		bitIndex := 0
+		for n := 1; len(data)*8-bitIndex >= 32; n = n%32 + 1 {
+			bitByBitF(data, &bitIndex, n)
+		}
+	}
+}
+
+func BenchmarkProbe(b *testing.B) {
+	data := benchmarkData()
+	path := filepath.Join(b.TempDir(), "bench.obu")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+
+	d := NewDecoder(Options{})
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Probe(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
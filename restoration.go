@@ -0,0 +1,466 @@
+package boulder
+
+import "slices"
+
+const RESTORE_WIENER = 1
+const RESTORE_SGRPROJ = 2
+const RESTORE_SWITCHABLE = 3
+
+const RESTORATION_TILESIZE_MAX = 256
+
+const SGRPROJ_PARAMS_BITS = 4
+const SGRPROJ_PRJ_SUBEXP_K = 4
+const SGRPROJ_PRJ_BITS = 7
+const SGRPROJ_RST_BITS = 4
+const SGRPROJ_MTABLE_BITS = 20
+const SGRPROJ_RECIP_BITS = 12
+const SGRPROJ_SGR_BITS = 8
+
+var (
+	RemapLrType = [4]int{RESTORE_NONE, RESTORE_SWITCHABLE, RESTORE_WIENER, RESTORE_SGRPROJ}
+
+	WienerTapsMin = [3]int{-5, -23, -17}
+	WienerTapsMax = [3]int{10, 8, 46}
+	WienerTapsK   = [3]int{1, 2, 3}
+
+	SgrprojXqdMin = [2]int{-96, -32}
+	SgrprojXqdMax = [2]int{31, 95}
+
+	SgrParams = [1 << SGRPROJ_PARAMS_BITS][4]int{
+		{2, 140, 1, 3236}, {2, 112, 1, 2158}, {2, 93, 1, 1618}, {2, 80, 1, 1438},
+		{2, 70, 1, 1295}, {2, 58, 1, 1177}, {2, 47, 1, 1079}, {2, 37, 1, 996},
+		{2, 30, 1, 925}, {2, 25, 1, 863}, {0, -1, 1, 2589}, {0, -1, 1, 1618},
+		{0, -1, 1, 1177}, {0, -1, 1, 925}, {2, 56, 0, -1}, {2, 22, 0, -1},
+	}
+
+	DefaultUseWienerCdf       = [3]int{11570, 32768, 0}
+	DefaultUseSgrprojCdf      = [3]int{16855, 32768, 0}
+	DefaultRestorationTypeCdf = [4]int{9413, 22581, 32768, 0}
+
+	UseWienerCdf       [3]int
+	UseSgrprojCdf      [3]int
+	RestorationTypeCdf [4]int
+
+	SavedUseWienerCdf       [NUM_REF_FRAMES][3]int
+	SavedUseSgrprojCdf      [NUM_REF_FRAMES][3]int
+	SavedRestorationTypeCdf [NUM_REF_FRAMES][4]int
+
+	LrType   [3][][]int
+	LrWiener [3][][][2][3]int
+	LrSgrSet [3][][]int
+	LrSgrXqd [3][][][2]int
+
+	UpscaledCurrFrame *Frame
+	UpscaledCdefFrame *Frame
+	LrFrame           *Frame
+
+	StripeStartY int
+	StripeEndY   int
+	PlaneEndX    int
+	PlaneEndY    int
+)
+
+// allocLrUnits sizes the per restoration unit parameters of every plane
+// that has loop restoration enabled.
+func allocLrUnits() {
+	for plane := 0; plane < NumPlanes; plane++ {
+		if FrameRestorationType[plane] == RESTORE_NONE {
+			continue
+		}
+
+		unitRows, unitCols := lrUnitCounts(plane)
+
+		LrType[plane] = make([][]int, unitRows)
+		LrWiener[plane] = make([][][2][3]int, unitRows)
+		LrSgrSet[plane] = make([][]int, unitRows)
+		LrSgrXqd[plane] = make([][][2]int, unitRows)
+		for row := 0; row < unitRows; row++ {
+			LrType[plane][row] = make([]int, unitCols)
+			LrWiener[plane][row] = make([][2][3]int, unitCols)
+			LrSgrSet[plane][row] = make([]int, unitCols)
+			LrSgrXqd[plane][row] = make([][2]int, unitCols)
+		}
+	}
+}
+
+func lrUnitCounts(plane int) (unitRows int, unitCols int) {
+	subX, subY := 0, 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	unitSize := LoopRestorationSize[plane]
+	unitRows = countUnitsInFrame(unitSize, round2(FrameHeight, subY))
+	unitCols = countUnitsInFrame(unitSize, round2(UpscaledWidth, subX))
+
+	return unitRows, unitCols
+}
+
+func readLrUnit(r *Reader, plane int, unitRow int, unitCol int) {
+	var restorationType int
+	switch FrameRestorationType[plane] {
+	case RESTORE_WIENER:
+		if readSymbol(r, UseWienerCdf[:]) == 1 {
+			restorationType = RESTORE_WIENER
+		} else {
+			restorationType = RESTORE_NONE
+		}
+	case RESTORE_SGRPROJ:
+		if readSymbol(r, UseSgrprojCdf[:]) == 1 {
+			restorationType = RESTORE_SGRPROJ
+		} else {
+			restorationType = RESTORE_NONE
+		}
+	default:
+		restorationType = readSymbol(r, RestorationTypeCdf[:])
+	}
+
+	LrType[plane][unitRow][unitCol] = restorationType
+
+	if restorationType == RESTORE_WIENER {
+		for pass := 0; pass < 2; pass++ {
+			firstCoeff := 0
+			if plane > 0 {
+				firstCoeff = 1
+				LrWiener[plane][unitRow][unitCol][pass][0] = 0
+			}
+
+			for j := firstCoeff; j < 3; j++ {
+				min := WienerTapsMin[j]
+				max := WienerTapsMax[j]
+				k := WienerTapsK[j]
+				v := decodeSignedSubexpWithRefBool(r, min, max+1, k, RefLrWiener[plane][pass][j])
+				LrWiener[plane][unitRow][unitCol][pass][j] = v
+				RefLrWiener[plane][pass][j] = v
+			}
+		}
+	} else if restorationType == RESTORE_SGRPROJ {
+		lrSgrSet := readLiteral(r, SGRPROJ_PARAMS_BITS)
+		LrSgrSet[plane][unitRow][unitCol] = lrSgrSet
+
+		for i := 0; i < 2; i++ {
+			radius := SgrParams[lrSgrSet][i*2]
+			min := SgrprojXqdMin[i]
+			max := SgrprojXqdMax[i]
+
+			var v int
+			if radius != 0 {
+				v = decodeSignedSubexpWithRefBool(r, min, max+1, SGRPROJ_PRJ_SUBEXP_K, RefSgrXqd[plane][i])
+			} else if i == 1 {
+				v = clip3(min, max, (1<<SGRPROJ_PRJ_BITS)-RefSgrXqd[plane][0])
+			}
+
+			LrSgrXqd[plane][unitRow][unitCol][i] = v
+			RefSgrXqd[plane][i] = v
+		}
+	}
+}
+
+func decodeSignedSubexpWithRefBool(r *Reader, low int, high int, k int, ref int) int {
+	x := decodeUnsignedSubexpWithRefBool(r, high-low, k, ref-low)
+	return x + low
+}
+
+func decodeUnsignedSubexpWithRefBool(r *Reader, mx int, k int, ref int) int {
+	v := decodeSubexpBool(r, mx, k)
+	if (ref << 1) <= mx {
+		return inverseRecenter(ref, v)
+	}
+
+	return mx - 1 - inverseRecenter(mx-1-ref, v)
+}
+
+func decodeSubexpBool(r *Reader, numSyms int, k int) int {
+	i := 0
+	mk := 0
+	for {
+		b2 := k
+		if i != 0 {
+			b2 = k + i - 1
+		}
+		a := 1 << b2
+
+		if numSyms <= mk+3*a {
+			return readNs(r, numSyms-mk) + mk
+		}
+
+		if readLiteral(r, 1) != 0 {
+			i++
+			mk += a
+		} else {
+			return readLiteral(r, b2) + mk
+		}
+	}
+}
+
+// lrProcess applies loop restoration to UpscaledCdefFrame, writing the
+// result to LrFrame. When no plane is restored LrFrame is UpscaledCdefFrame.
+func lrProcess() {
+	if !UsesLr {
+		LrFrame = UpscaledCdefFrame
+		return
+	}
+
+	LrFrame = framePool.Get(UpscaledWidth, FrameHeight, sh.colorConfig)
+	LrFrame.CopyFrom(UpscaledCdefFrame)
+
+	for y := 0; y < FrameHeight; y += MI_SIZE {
+		for x := 0; x < UpscaledWidth; x += MI_SIZE {
+			for plane := 0; plane < NumPlanes; plane++ {
+				if FrameRestorationType[plane] != RESTORE_NONE {
+					row := y >> MI_SIZE_LOG2
+					col := x >> MI_SIZE_LOG2
+					loopRestoreBlock(plane, row, col)
+				}
+			}
+		}
+	}
+}
+
+func loopRestoreBlock(plane int, row int, col int) {
+	subX, subY := 0, 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	lumaY := row * MI_SIZE
+	stripeNum := (lumaY + 8) / 64
+
+	StripeStartY = (-8 + stripeNum*64) >> subY
+	StripeEndY = StripeStartY + (64 >> subY) - 1
+
+	unitSize := LoopRestorationSize[plane]
+	unitRows, unitCols := lrUnitCounts(plane)
+	unitRow := min(unitRows-1, ((row*MI_SIZE+8)>>subY)/unitSize)
+	unitCol := min(unitCols-1, ((col*MI_SIZE)>>subX)/unitSize)
+
+	PlaneEndX = round2(UpscaledWidth, subX) - 1
+	PlaneEndY = round2(FrameHeight, subY) - 1
+
+	x := (col * MI_SIZE) >> subX
+	y := (row * MI_SIZE) >> subY
+	w := min(MI_SIZE>>subX, PlaneEndX-x+1)
+	h := min(MI_SIZE>>subY, PlaneEndY-y+1)
+
+	switch LrType[plane][unitRow][unitCol] {
+	case RESTORE_WIENER:
+		wienerFilter(plane, unitRow, unitCol, x, y, w, h)
+	case RESTORE_SGRPROJ:
+		selfGuidedFilter(plane, unitRow, unitCol, x, y, w, h)
+	}
+}
+
+func wienerFilter(plane int, unitRow int, unitCol int, x int, y int, w int, h int) {
+	roundingVariablesDerivation(false)
+
+	vfilter := wienerCoefficient(LrWiener[plane][unitRow][unitCol][0])
+	hfilter := wienerCoefficient(LrWiener[plane][unitRow][unitCol][1])
+
+	offset := 1 << (BitDepth + FILTER_BITS - InterRound0 - 1)
+	limit := (1 << (BitDepth + 1 + FILTER_BITS - InterRound0)) - 1
+
+	intermediate := make([][]int, h+6)
+	for r := 0; r < h+6; r++ {
+		intermediate[r] = make([]int, w)
+		for c := 0; c < w; c++ {
+			s := 0
+			for t := 0; t < 7; t++ {
+				s += hfilter[t] * getSourceSample(plane, x+c+t-3, y+r-3)
+			}
+			v := round2(s, InterRound0)
+			intermediate[r][c] = clip3(-offset, limit-offset, v)
+		}
+	}
+
+	dst := &LrFrame.Planes[plane]
+	for r := 0; r < h; r++ {
+		for c := 0; c < w; c++ {
+			s := 0
+			for t := 0; t < 7; t++ {
+				s += vfilter[t] * intermediate[r+t][c]
+			}
+			v := round2(s, InterRound1)
+			dst.Set(x+c, y+r, clip1(v))
+		}
+	}
+}
+
+// wienerCoefficient expands the three coded taps of a symmetric 7-tap
+// Wiener filter whose taps sum to 128.
+func wienerCoefficient(coeff [3]int) [7]int {
+	var filter [7]int
+	filter[3] = 128
+	for i := 0; i < 3; i++ {
+		c := coeff[i]
+		filter[i] = c
+		filter[6-i] = c
+		filter[3] -= 2 * c
+	}
+
+	return filter
+}
+
+func selfGuidedFilter(plane int, unitRow int, unitCol int, x int, y int, w int, h int) {
+	set := LrSgrSet[plane][unitRow][unitCol]
+
+	r0 := SgrParams[set][0]
+	r1 := SgrParams[set][2]
+
+	var flt0, flt1 [][]int
+	if r0 != 0 {
+		flt0 = boxFilter(plane, x, y, w, h, set, 0)
+	}
+	if r1 != 0 {
+		flt1 = boxFilter(plane, x, y, w, h, set, 1)
+	}
+
+	w0 := LrSgrXqd[plane][unitRow][unitCol][0]
+	w1 := LrSgrXqd[plane][unitRow][unitCol][1]
+	w2 := (1 << SGRPROJ_PRJ_BITS) - w0 - w1
+
+	src := &UpscaledCdefFrame.Planes[plane]
+	dst := &LrFrame.Planes[plane]
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			u := src.At(x+j, y+i) << SGRPROJ_RST_BITS
+			v := w1 * u
+			if r0 != 0 {
+				v += w0 * flt0[i][j]
+			} else {
+				v += w0 * u
+			}
+			if r1 != 0 {
+				v += w2 * flt1[i][j]
+			} else {
+				v += w2 * u
+			}
+
+			s := round2(v, SGRPROJ_RST_BITS+SGRPROJ_PRJ_BITS)
+			dst.Set(x+j, y+i, clip1(s))
+		}
+	}
+}
+
+func boxFilter(plane int, x int, y int, w int, h int, set int, pass int) [][]int {
+	r := SgrParams[set][pass*2]
+	eps := SgrParams[set][pass*2+1]
+
+	n := (2*r + 1) * (2*r + 1)
+	n2e := n * n * eps
+	s := ((1 << SGRPROJ_MTABLE_BITS) + (n2e / 2)) / n2e
+	oneOverN := ((1 << SGRPROJ_RECIP_BITS) + (n / 2)) / n
+
+	// A and B cover the block plus a one sample border, offset by one.
+	A := make([][]int, h+2)
+	B := make([][]int, h+2)
+	for i := -1; i < h+1; i++ {
+		A[i+1] = make([]int, w+2)
+		B[i+1] = make([]int, w+2)
+		for j := -1; j < w+1; j++ {
+			a := 0
+			b := 0
+			for dy := -r; dy <= r; dy++ {
+				for dx := -r; dx <= r; dx++ {
+					c := getSourceSample(plane, x+j+dx, y+i+dy)
+					a += c * c
+					b += c
+				}
+			}
+
+			a = round2(a, 2*(BitDepth-8))
+			d := round2(b, BitDepth-8)
+			p := max(0, a*n-d*d)
+			z := round2(p*s, SGRPROJ_MTABLE_BITS)
+
+			var a2 int
+			if z >= 255 {
+				a2 = 256
+			} else if z == 0 {
+				a2 = 1
+			} else {
+				a2 = ((z << SGRPROJ_SGR_BITS) + (z / 2)) / (z + 1)
+			}
+
+			b2 := ((1 << SGRPROJ_SGR_BITS) - a2) * b * oneOverN
+			A[i+1][j+1] = a2
+			B[i+1][j+1] = round2(b2, SGRPROJ_RECIP_BITS)
+		}
+	}
+
+	src := &UpscaledCdefFrame.Planes[plane]
+	F := make([][]int, h)
+	for i := 0; i < h; i++ {
+		F[i] = make([]int, w)
+
+		shift := 5
+		if pass == 0 && (i&1) != 0 {
+			shift = 4
+		}
+
+		for j := 0; j < w; j++ {
+			a := 0
+			b := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					var weight int
+					if pass == 0 {
+						if ((i + dy) & 1) != 0 {
+							if dx == 0 {
+								weight = 6
+							} else {
+								weight = 5
+							}
+						}
+					} else if dx == 0 || dy == 0 {
+						weight = 4
+					} else {
+						weight = 3
+					}
+
+					a += weight * A[i+dy+1][j+dx+1]
+					b += weight * B[i+dy+1][j+dx+1]
+				}
+			}
+
+			v := a*src.At(x+j, y+i) + b
+			F[i][j] = round2(v, SGRPROJ_SGR_BITS+shift-SGRPROJ_RST_BITS)
+		}
+	}
+
+	return F
+}
+
+// getSourceSample returns the CDEF output at (x, y) clamped to the plane,
+// falling back to the deblocked frame within two rows outside the current
+// stripe.
+func getSourceSample(plane int, x int, y int) int {
+	x = min(PlaneEndX, x)
+	x = max(0, x)
+	y = min(PlaneEndY, y)
+	y = max(0, y)
+
+	if y < StripeStartY {
+		y = max(StripeStartY-2, y)
+		return UpscaledCurrFrame.Planes[plane].At(x, y)
+	} else if y > StripeEndY {
+		y = min(StripeEndY+2, y)
+		return UpscaledCurrFrame.Planes[plane].At(x, y)
+	}
+
+	return UpscaledCdefFrame.Planes[plane].At(x, y)
+}
+
+// releasePostFilterFrames makes LrFrame the current frame and returns the
+// intermediate frames of the post filter pipeline to the pool.
+func releasePostFilterFrames() {
+	stages := []*Frame{CurrFrame, CdefFrame, UpscaledCurrFrame, UpscaledCdefFrame}
+	CurrFrame = LrFrame
+
+	for i, f := range stages {
+		if !slices.Contains(stages[:i], f) {
+			releaseFrame(f)
+		}
+	}
+}
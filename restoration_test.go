@@ -0,0 +1,109 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRestorationTest(t *testing.T) {
+	setupLoopFilterTest(t, 16, 16)
+	saveGlobals(t, &UpscaledWidth, &UsesLr, &FrameRestorationType,
+		&LoopRestorationSize, &LrType, &LrWiener, &LrSgrSet, &LrSgrXqd,
+		&LrFrame, &UpscaledCurrFrame, &UpscaledCdefFrame, &StripeStartY,
+		&StripeEndY, &PlaneEndX, &PlaneEndY, &InterRound0, &InterRound1,
+		&InterPostRound)
+	UpscaledWidth = 16
+	UsesLr = true
+	FrameRestorationType[0] = RESTORE_WIENER
+	LoopRestorationSize = []int{64, 64, 64}
+	allocLrUnits()
+
+	UpscaledCurrFrame = CurrFrame
+	UpscaledCdefFrame = CurrFrame
+}
+
+func TestWienerCoefficient(t *testing.T) {
+	assert.Equal(t, [7]int{3, -7, 15, 106, 15, -7, 3}, wienerCoefficient([3]int{3, -7, 15}))
+}
+
+func TestReadNs(t *testing.T) {
+	saveGlobals(t, &uh, &SymbolValue, &SymbolRange, &SymbolMaxBits)
+	uh = UncompressedHeader{}
+
+	enc := newSymbolEncoder()
+	// 2 fits in two bits, 4 needs the extra bit on top of 3.
+	for _, b := range []bool{true, false, true, true, true} {
+		enc.encodeBool(b)
+	}
+	data := enc.bytes()
+
+	r := Reader{data: data}
+	initSymbol(len(data), &r)
+	assert.Equal(t, 2, readNs(&r, 5))
+	assert.Equal(t, 4, readNs(&r, 5))
+}
+
+func TestInverseRecenter(t *testing.T) {
+	assert.Equal(t, 9, inverseRecenter(3, 9))
+	assert.Equal(t, 2, inverseRecenter(3, 1))
+	assert.Equal(t, 4, inverseRecenter(3, 2))
+}
+
+func TestWienerFilterImpulse(t *testing.T) {
+	setupRestorationTest(t)
+	CurrFrame.Planes[0].Set(8, 8, 100)
+	LrType[0][0][0] = RESTORE_WIENER
+	LrWiener[0][0][0] = [2][3]int{{0, 0, 0}, {0, 0, 16}}
+
+	lrProcess()
+
+	assert.Equal(t, []int{0, 13, 75, 13, 0}, lrRow(8, 6, 5))
+	assert.Equal(t, []int{0, 0, 0, 0, 0}, lrRow(7, 6, 5))
+}
+
+func TestSelfGuidedFilterFlat(t *testing.T) {
+	setupRestorationTest(t)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			CurrFrame.Planes[0].Set(x, y, 100)
+		}
+	}
+	FrameRestorationType[0] = RESTORE_SGRPROJ
+	LrType[0][0][0] = RESTORE_SGRPROJ
+	LrSgrSet[0][0][0] = 0
+	LrSgrXqd[0][0][0] = [2]int{-32, 31}
+
+	lrProcess()
+
+	for y := 0; y < 16; y++ {
+		assert.Equal(t, []int{100, 100, 100, 100}, lrRow(y, 0, 4))
+	}
+}
+
+func TestGetSourceSampleStripe(t *testing.T) {
+	setupRestorationTest(t)
+	UpscaledCdefFrame = NewFrame(16, 16, sh.colorConfig)
+	CurrFrame.Planes[0].Set(3, 5, 7)
+	CurrFrame.Planes[0].Set(3, 12, 9)
+	UpscaledCdefFrame.Planes[0].Set(3, 8, 11)
+	UpscaledCdefFrame.Planes[0].Set(0, 8, 13)
+
+	StripeStartY = 8
+	StripeEndY = 10
+	PlaneEndX = 15
+	PlaneEndY = 15
+
+	assert.Equal(t, 11, getSourceSample(0, 3, 8))
+	assert.Equal(t, 0, getSourceSample(0, 3, 5))
+	assert.Equal(t, 9, getSourceSample(0, 3, 15))
+	assert.Equal(t, 13, getSourceSample(0, -4, 8))
+}
+
+func lrRow(y int, x int, n int) []int {
+	row := make([]int, n)
+	for i := range row {
+		row[i] = LrFrame.Planes[0].At(x+i, y)
+	}
+	return row
+}
@@ -0,0 +1,237 @@
+package boulder
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// RGBOptions controls the YUV to RGB conversion of a Frame.
+type RGBOptions struct {
+	// ToneMap maps PQ and HLG content to SDR BT.709. Without it the
+	// nonlinear HDR signal is converted as is.
+	ToneMap bool
+}
+
+// ToRGBA converts f to 8-bit RGB using the color description it was decoded
+// with.
+func (f *Frame) ToRGBA(opts RGBOptions) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+	f.convert(opts, func(x int, y int, r float64, g float64, b float64) {
+		img.SetRGBA(x, y, color.RGBA{R: quantize(r, 0xff), G: quantize(g, 0xff), B: quantize(b, 0xff), A: 0xff})
+	})
+
+	return img
+}
+
+// ToRGBA64 converts f to 16-bit RGB, keeping the precision of 10 and 12-bit
+// streams.
+func (f *Frame) ToRGBA64(opts RGBOptions) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, f.Width, f.Height))
+	f.convert(opts, func(x int, y int, r float64, g float64, b float64) {
+		img.SetRGBA64(x, y, color.RGBA64{R: quantize16(r), G: quantize16(g), B: quantize16(b), A: 0xffff})
+	})
+
+	return img
+}
+
+func quantize(v float64, max float64) uint8 {
+	return uint8(math.Round(clampUnit(v) * max))
+}
+
+func quantize16(v float64) uint16 {
+	return uint16(math.Round(clampUnit(v) * 0xffff))
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// matrixKrKb returns the luma weights of red and blue for the signalled
+// matrix. Unspecified matrices are treated as BT.601.
+func matrixKrKb(mc int) (float64, float64) {
+	switch mc {
+	case MC_BT_709:
+		return 0.2126, 0.0722
+	case MC_FCC:
+		return 0.30, 0.11
+	case MC_SMPTE_240:
+		return 0.212, 0.087
+	case MC_BT_2020_NCL:
+		return 0.2627, 0.0593
+	default:
+		return 0.299, 0.114
+	}
+}
+
+// convert calls set with the normalised RGB value of every pixel of f.
+func (f *Frame) convert(opts RGBOptions, set func(x int, y int, r float64, g float64, b float64)) {
+	shift := f.BitDepth - 8
+	maxValue := float64(int(1)<<f.BitDepth - 1)
+
+	// Luma and chroma normalisation: value = (sample - offset) * scale.
+	yOffset, yScale := 0.0, 1/maxValue
+	cOffset, cScale := float64(int(1)<<(f.BitDepth-1)), 1/maxValue
+	if !f.FullRange {
+		yOffset, yScale = float64(int(16)<<shift), 1/float64(int(219)<<shift)
+		cOffset, cScale = float64(int(128)<<shift), 1/float64(int(224)<<shift)
+	}
+
+	identity := f.MatrixCoefficients == MC_IDENTITY && f.NumPlanes == 3
+	if identity {
+		// G, B and R are all coded like luma.
+		cOffset, cScale = yOffset, yScale
+	}
+
+	kr, kb := matrixKrKb(f.MatrixCoefficients)
+	kg := 1 - kr - kb
+
+	toneMap := opts.ToneMap &&
+		(f.TransferCharacteristics == TC_SMPTE_2084 || f.TransferCharacteristics == TC_HLG)
+
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			luma := (float64(f.Planes[0].At(x, y)) - yOffset) * yScale
+
+			var r, g, b float64
+			if f.NumPlanes == 1 {
+				r, g, b = luma, luma, luma
+			} else {
+				u := (f.chromaAt(1, x, y) - cOffset) * cScale
+				v := (f.chromaAt(2, x, y) - cOffset) * cScale
+
+				if identity {
+					r, g, b = v, luma, u
+				} else {
+					r = luma + 2*(1-kr)*v
+					b = luma + 2*(1-kb)*u
+					g = (luma - kr*r - kb*b) / kg
+				}
+			}
+
+			if toneMap {
+				r, g, b = f.toneMapToSdr(r, g, b)
+			}
+
+			set(x, y, r, g, b)
+		}
+	}
+}
+
+// chromaAt returns the chroma of plane at luma position (x, y), bilinearly
+// interpolated according to the chroma sample position. CSP_VERTICAL and
+// CSP_COLOCATED chroma is horizontally co-sited with the left luma sample,
+// and vertically sits between two luma rows unless CSP_COLOCATED is
+// signalled. CSP_UNKNOWN chroma is taken to be centred between the luma
+// samples in both directions.
+func (f *Frame) chromaAt(plane int, x int, y int) float64 {
+	p := &f.Planes[plane]
+
+	cx := float64(x)
+	if f.SubsamplingX == 1 {
+		if f.ChromaSamplePosition == CSP_UNKNOWN {
+			cx = (cx - 0.5) / 2
+		} else {
+			cx /= 2
+		}
+	}
+
+	cy := float64(y)
+	if f.SubsamplingY == 1 {
+		if f.ChromaSamplePosition == CSP_COLOCATED {
+			cy /= 2
+		} else {
+			cy = (cy - 0.5) / 2
+		}
+	}
+
+	x0 := int(math.Floor(cx))
+	y0 := int(math.Floor(cy))
+	fx := cx - float64(x0)
+	fy := cy - float64(y0)
+
+	at := func(x int, y int) float64 {
+		return float64(p.At(clip3(0, p.Width-1, x), clip3(0, p.Height-1, y)))
+	}
+
+	top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+	bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+
+	return top*(1-fy) + bottom*fy
+}
+
+// SDR reference white in nits, per ITU-R BT.2408.
+const sdrWhite = 203.0
+
+// toneMapToSdr converts nonlinear PQ or HLG RGB to nonlinear SDR RGB with
+// BT.709 primaries and a BT.709 transfer.
+func (f *Frame) toneMapToSdr(r float64, g float64, b float64) (float64, float64, float64) {
+	var lin [3]float64
+	for i, v := range [3]float64{r, g, b} {
+		v = clampUnit(v)
+		if f.TransferCharacteristics == TC_SMPTE_2084 {
+			lin[i] = pqEotf(v) * 10000 / sdrWhite
+		} else {
+			lin[i] = hlgInverseOetf(v)
+		}
+	}
+
+	if f.TransferCharacteristics == TC_HLG {
+		// The HLG OOTF for a 1000 nit display, relative to SDR white.
+		ys := 0.2627*lin[0] + 0.6780*lin[1] + 0.0593*lin[2]
+		gain := math.Pow(ys, 0.2) * 1000 / sdrWhite
+		for i := range lin {
+			lin[i] *= gain
+		}
+	}
+
+	if f.ColorPrimaries == CP_BT_2020 {
+		lin = [3]float64{
+			1.6605*lin[0] - 0.5876*lin[1] - 0.0728*lin[2],
+			-0.1246*lin[0] + 1.1329*lin[1] - 0.0083*lin[2],
+			-0.0182*lin[0] - 0.1006*lin[1] + 1.1187*lin[2],
+		}
+	}
+
+	var out [3]float64
+	for i, v := range lin {
+		// Extended Reinhard mapping the PQ peak to 1.
+		const peak = 10000 / sdrWhite
+		v = math.Max(0, v)
+		v = v * (1 + v/(peak*peak)) / (1 + v)
+		out[i] = bt709Oetf(clampUnit(v))
+	}
+
+	return out[0], out[1], out[2]
+}
+
+func pqEotf(v float64) float64 {
+	const m1 = 2610.0 / 16384
+	const m2 = 2523.0 / 4096 * 128
+	const c1 = 3424.0 / 4096
+	const c2 = 2413.0 / 4096 * 32
+	const c3 = 2392.0 / 4096 * 32
+
+	p := math.Pow(v, 1/m2)
+	return math.Pow(math.Max(p-c1, 0)/(c2-c3*p), 1/m1)
+}
+
+func hlgInverseOetf(v float64) float64 {
+	const a = 0.17883277
+	const b = 1 - 4*a
+	c := 0.5 - a*math.Log(4*a)
+
+	if v <= 0.5 {
+		return v * v / 3
+	}
+
+	return (math.Exp((v-c)/a) + b) / 12
+}
+
+func bt709Oetf(l float64) float64 {
+	if l < 0.018 {
+		return 4.5 * l
+	}
+
+	return 1.099*math.Pow(l, 0.45) - 0.099
+}
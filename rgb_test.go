@@ -0,0 +1,97 @@
+package boulder
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestColorFrame(w int, h int, cc ColorConfig, y int, u int, v int) *Frame {
+	f := NewFrame(w, h, cc)
+	for plane, value := range []int{y, u, v}[:f.NumPlanes] {
+		p := &f.Planes[plane]
+		for row := 0; row < p.Height; row++ {
+			for col := 0; col < p.Width; col++ {
+				p.Set(col, row, value)
+			}
+		}
+	}
+
+	return f
+}
+
+func TestToRGBALimitedRange(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1, matrixCoefficients: MC_BT_601}
+
+	white := newTestColorFrame(2, 2, cc, 235, 128, 128).ToRGBA(RGBOptions{})
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, white.RGBAAt(1, 1))
+
+	black := newTestColorFrame(2, 2, cc, 16, 128, 128).ToRGBA(RGBOptions{})
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, black.RGBAAt(0, 0))
+
+	red := newTestColorFrame(2, 2, cc, 81, 90, 240).ToRGBA(RGBOptions{}).RGBAAt(0, 0)
+	assert.InDelta(t, 255, int(red.R), 2)
+	assert.InDelta(t, 0, int(red.G), 2)
+	assert.InDelta(t, 0, int(red.B), 2)
+}
+
+func TestToRGBAIdentity(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8, colorRange: 1, matrixCoefficients: MC_IDENTITY}
+
+	img := newTestColorFrame(1, 1, cc, 10, 20, 30).ToRGBA(RGBOptions{})
+	assert.Equal(t, color.RGBA{30, 10, 20, 255}, img.RGBAAt(0, 0))
+}
+
+func TestToRGBA64HighBitDepth(t *testing.T) {
+	cc := ColorConfig{bitDepth: 10, monoChrome: true, colorRange: 1}
+
+	img := newTestColorFrame(1, 1, cc, 1023, 0, 0).ToRGBA64(RGBOptions{})
+	assert.Equal(t, color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}, img.RGBA64At(0, 0))
+
+	img = newTestColorFrame(1, 1, cc, 0, 0, 0).ToRGBA64(RGBOptions{})
+	assert.Equal(t, color.RGBA64{0, 0, 0, 0xffff}, img.RGBA64At(0, 0))
+}
+
+func TestChromaAt(t *testing.T) {
+	cc := ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1}
+	f := NewFrame(4, 4, cc)
+	f.Planes[1].Set(0, 0, 0)
+	f.Planes[1].Set(1, 0, 200)
+	f.Planes[1].Set(0, 1, 100)
+	f.Planes[1].Set(1, 1, 100)
+
+	// Horizontally co-sited with even luma columns.
+	f.ChromaSamplePosition = CSP_COLOCATED
+	assert.Equal(t, 0.0, f.chromaAt(1, 0, 0))
+	assert.Equal(t, 100.0, f.chromaAt(1, 1, 0))
+	assert.Equal(t, 200.0, f.chromaAt(1, 2, 0))
+	assert.Equal(t, 50.0, f.chromaAt(1, 0, 1))
+
+	// Vertically centred between luma rows 0 and 1.
+	f.ChromaSamplePosition = CSP_VERTICAL
+	assert.Equal(t, 0.0, f.chromaAt(1, 0, 0))
+	assert.Equal(t, 25.0, f.chromaAt(1, 0, 1))
+
+	// Centred between luma columns and rows 0 and 1.
+	f.ChromaSamplePosition = CSP_UNKNOWN
+	assert.Equal(t, 0.0, f.chromaAt(1, 0, 0))
+	assert.Equal(t, 50.0, f.chromaAt(1, 1, 0))
+	assert.Equal(t, 150.0, f.chromaAt(1, 2, 0))
+	assert.Equal(t, 62.5, f.chromaAt(1, 1, 1))
+}
+
+func TestToRGBAToneMap(t *testing.T) {
+	cc := ColorConfig{bitDepth: 10, monoChrome: true, colorRange: 1, transferCharacteristics: TC_SMPTE_2084}
+
+	peak := newTestColorFrame(1, 1, cc, 1023, 0, 0).ToRGBA(RGBOptions{ToneMap: true})
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, peak.RGBAAt(0, 0))
+
+	// 203 nit reference white sits at PQ code ~58% and lands mid-range.
+	white := newTestColorFrame(1, 1, cc, 596, 0, 0).ToRGBA(RGBOptions{ToneMap: true}).RGBAAt(0, 0)
+	assert.InDelta(t, 180, int(white.R), 10)
+
+	// Without tone mapping the PQ signal is passed through.
+	raw := newTestColorFrame(1, 1, cc, 596, 0, 0).ToRGBA(RGBOptions{}).RGBAAt(0, 0)
+	assert.Equal(t, uint8(149), raw.R)
+}
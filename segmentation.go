@@ -0,0 +1,222 @@
+package boulder
+
+const SEG_LVL_SKIP = 6
+const SEG_LVL_GLOBALMV = 7
+
+const SEGMENT_ID_CONTEXTS = 3
+const SEGMENT_ID_PREDICTED_CONTEXTS = 3
+
+var (
+	SegmentationFeatureBits   = [SEG_LVL_MAX]int{8, 6, 6, 6, 6, 3, 0, 0}
+	SegmentationFeatureSigned = [SEG_LVL_MAX]bool{true, true, true, true, true, false, false, false}
+	SegmentationFeatureMax    = [SEG_LVL_MAX]int{255, MAX_LOOP_FILTER, MAX_LOOP_FILTER, MAX_LOOP_FILTER, MAX_LOOP_FILTER, 7, 0, 0}
+
+	DefaultSegmentIdCdf = [SEGMENT_ID_CONTEXTS][MAX_SEGMENTS + 1]int{
+		{5622, 7893, 16093, 18233, 27809, 28373, 32533, 32768, 0},
+		{14274, 18230, 22557, 24935, 29980, 30851, 32344, 32768, 0},
+		{27527, 28487, 28723, 28890, 32397, 32647, 32679, 32768, 0},
+	}
+	DefaultSegmentIdPredictedCdf = [SEGMENT_ID_PREDICTED_CONTEXTS][3]int{
+		{128 * 128, 32768, 0},
+		{128 * 128, 32768, 0},
+		{128 * 128, 32768, 0},
+	}
+
+	SegmentIdCdf          [SEGMENT_ID_CONTEXTS][MAX_SEGMENTS + 1]int
+	SegmentIdPredictedCdf [SEGMENT_ID_PREDICTED_CONTEXTS][3]int
+
+	SavedSegmentIdCdf          [NUM_REF_FRAMES][SEGMENT_ID_CONTEXTS][MAX_SEGMENTS + 1]int
+	SavedSegmentIdPredictedCdf [NUM_REF_FRAMES][SEGMENT_ID_PREDICTED_CONTEXTS][3]int
+
+	SavedFeatureEnabled       [NUM_REF_FRAMES][MAX_SEGMENTS][SEG_LVL_MAX]bool
+	SavedFeatureData          [NUM_REF_FRAMES][MAX_SEGMENTS][SEG_LVL_MAX]int
+	SavedSegmentIds           [NUM_REF_FRAMES][][]int
+	SavedLoopFilterRefDeltas  [NUM_REF_FRAMES][]int
+	SavedLoopFilterModeDeltas [NUM_REF_FRAMES][]int
+
+	SegmentId int
+	Lossless  bool
+)
+
+// loadPrevious restores the global motion parameters and segmentation
+// features of prevFrame and returns its loop filter deltas as the defaults
+// for the current frame.
+func loadPrevious(prevFrame int) (loopFilterRefDeltas []int, loopFilterModeDeltas []int) {
+	PrevGmParams = SavedGmParams[prevFrame]
+	FeatureEnabled = SavedFeatureEnabled[prevFrame]
+	FeatureData = SavedFeatureData[prevFrame]
+
+	return SavedLoopFilterRefDeltas[prevFrame], SavedLoopFilterModeDeltas[prevFrame]
+}
+
+// loadPreviousSegmentIds sets up PrevSegmentIds for temporal prediction.
+// The saved map is only usable when prevFrame has the same mode info size.
+func loadPreviousSegmentIds(prevFrame int, segmentationEnabled bool) {
+	PrevSegmentIds = make([][]int, MiRows)
+	for row := 0; row < MiRows; row++ {
+		PrevSegmentIds[row] = make([]int, MiCols)
+	}
+
+	if !segmentationEnabled || RefMiRows[prevFrame] != MiRows || RefMiCols[prevFrame] != MiCols {
+		return
+	}
+
+	for row := 0; row < MiRows; row++ {
+		copy(PrevSegmentIds[row], SavedSegmentIds[prevFrame][row])
+	}
+}
+
+func intraSegmentId(r *Reader) {
+	if uh.segmentationEnabled {
+		readSegmentId(r)
+	} else {
+		SegmentId = 0
+	}
+
+	Lossless = LossLessArray[SegmentId]
+}
+
+func interSegmentId(r *Reader, preSkip bool) {
+	if !uh.segmentationEnabled {
+		SegmentId = 0
+		return
+	}
+
+	predictedSegmentId := getSegmentId()
+
+	if !uh.segmentationUpdateMap {
+		SegmentId = predictedSegmentId
+		return
+	}
+
+	if preSkip && !SegIdPreSkip {
+		SegmentId = 0
+		return
+	}
+
+	if !preSkip && Skip {
+		setSegPredContext(0)
+		readSegmentId(r)
+		return
+	}
+
+	if uh.segmentationTemporalUpdate {
+		ctx := LeftSegPredContext[MiRow] + AboveSegPredContext[MiCol]
+		segIdPredicted := readSymbol(r, SegmentIdPredictedCdf[ctx][:])
+		if segIdPredicted == 1 {
+			SegmentId = predictedSegmentId
+		} else {
+			readSegmentId(r)
+		}
+		setSegPredContext(segIdPredicted)
+	} else {
+		readSegmentId(r)
+	}
+}
+
+func setSegPredContext(segIdPredicted int) {
+	for i := 0; i < Num4x4BlocksWide[MiSize] && MiCol+i < MiCols; i++ {
+		AboveSegPredContext[MiCol+i] = segIdPredicted
+	}
+	for i := 0; i < Num4x4BlocksHigh[MiSize] && MiRow+i < MiRows; i++ {
+		LeftSegPredContext[MiRow+i] = segIdPredicted
+	}
+}
+
+// readSegmentId codes segment_id relative to a prediction from the above,
+// left and above-left blocks. Skipped blocks take the prediction as is.
+func readSegmentId(r *Reader) {
+	prevUL, prevU, prevL := -1, -1, -1
+	if AvailU && AvailL {
+		prevUL = SegmentIds[MiRow-1][MiCol-1]
+	}
+	if AvailU {
+		prevU = SegmentIds[MiRow-1][MiCol]
+	}
+	if AvailL {
+		prevL = SegmentIds[MiRow][MiCol-1]
+	}
+
+	var pred int
+	if prevU == -1 {
+		if prevL != -1 {
+			pred = prevL
+		}
+	} else if prevL == -1 {
+		pred = prevU
+	} else if prevUL == prevU {
+		pred = prevU
+	} else {
+		pred = prevL
+	}
+
+	if Skip {
+		SegmentId = pred
+		return
+	}
+
+	var ctx int
+	if prevUL < 0 {
+		ctx = 0
+	} else if prevUL == prevU && prevUL == prevL {
+		ctx = 2
+	} else if prevUL == prevU || prevUL == prevL || prevU == prevL {
+		ctx = 1
+	}
+
+	segmentId := readSymbol(r, SegmentIdCdf[ctx][:])
+	segmentId = negDeinterleave(segmentId, pred, LastActiveSegId+1)
+	SegmentId = clip3(0, LastActiveSegId, segmentId)
+}
+
+func negDeinterleave(diff int, ref int, max int) int {
+	if ref == 0 {
+		return diff
+	}
+
+	if ref >= max-1 {
+		return max - diff - 1
+	}
+
+	if 2*ref < max {
+		if diff <= 2*ref {
+			if diff&1 == 1 {
+				return ref + ((diff + 1) >> 1)
+			}
+			return ref - (diff >> 1)
+		}
+		return diff
+	}
+
+	if diff <= 2*(max-ref-1) {
+		if diff&1 == 1 {
+			return ref + ((diff + 1) >> 1)
+		}
+		return ref - (diff >> 1)
+	}
+	return max - (diff + 1)
+}
+
+// getSegmentId returns the smallest segment id of the previous frame
+// covered by the current block.
+func getSegmentId() int {
+	bw4 := Num4x4BlocksWide[MiSize]
+	bh4 := Num4x4BlocksHigh[MiSize]
+	xMis := min(MiCols-MiCol, bw4)
+	yMis := min(MiRows-MiRow, bh4)
+
+	seg := 7
+	for y := 0; y < yMis; y++ {
+		for x := 0; x < xMis; x++ {
+			seg = min(seg, PrevSegmentIds[MiRow+y][MiCol+x])
+		}
+	}
+
+	return seg
+}
+
+// segFeatureActive reports whether feature is enabled for the segment of
+// the current block.
+func segFeatureActive(feature int) bool {
+	return segFeatureActiveIdx(SegmentId, feature, uh.segmentationEnabled)
+}
@@ -0,0 +1,157 @@
+package boulder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bitsToBytes(bits string) []byte {
+	bits = strings.ReplaceAll(bits, " ", "")
+	data := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b == '1' {
+			data[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	return data
+}
+
+func TestSegmentationParams(t *testing.T) {
+	saveGlobals(t, &uh, &FeatureEnabled, &FeatureData, &LastActiveSegId, &SegIdPreSkip)
+
+	// Segment 0 enables alt Q with -256, clipped to -255, and the ref frame
+	// feature with 6. Every other feature of every segment is disabled.
+	bits := "1" + "1 100000000" + "0000" + "1 110" + "00" + strings.Repeat("0", 7*SEG_LVL_MAX)
+	r := Reader{data: bitsToBytes(bits)}
+
+	enabled, updateMap, temporalUpdate := segmentationParams(PRIMARY_REF_NONE, &r)
+	assert.True(t, enabled)
+	assert.True(t, updateMap)
+	assert.False(t, temporalUpdate)
+	assert.Equal(t, 1+(1+9)+4+(1+3)+2+7*SEG_LVL_MAX, r.bitIndex)
+
+	assert.True(t, FeatureEnabled[0][SEG_LVL_ALT_Q])
+	assert.Equal(t, -255, FeatureData[0][SEG_LVL_ALT_Q])
+	assert.True(t, FeatureEnabled[0][SEG_LVL_REF_FRAME])
+	assert.Equal(t, 6, FeatureData[0][SEG_LVL_REF_FRAME])
+	assert.False(t, FeatureEnabled[1][SEG_LVL_ALT_Q])
+	assert.Equal(t, 0, LastActiveSegId)
+	assert.True(t, SegIdPreSkip)
+
+	// Without update_data the features of the previous frame are kept.
+	r = Reader{data: bitsToBytes("1 1 1 0")}
+	enabled, updateMap, temporalUpdate = segmentationParams(0, &r)
+	assert.True(t, enabled)
+	assert.True(t, updateMap)
+	assert.True(t, temporalUpdate)
+	assert.Equal(t, -255, FeatureData[0][SEG_LVL_ALT_Q])
+
+	r = Reader{data: bitsToBytes("0")}
+	enabled, _, _ = segmentationParams(PRIMARY_REF_NONE, &r)
+	assert.False(t, enabled)
+	assert.False(t, FeatureEnabled[0][SEG_LVL_ALT_Q])
+	assert.False(t, SegIdPreSkip)
+}
+
+func TestGetQIndexAltQ(t *testing.T) {
+	saveGlobals(t, &uh, &FeatureEnabled, &FeatureData, &CurrentQIndex)
+	FeatureEnabled = [MAX_SEGMENTS][SEG_LVL_MAX]bool{}
+	FeatureData = [MAX_SEGMENTS][SEG_LVL_MAX]int{}
+	FeatureEnabled[2][SEG_LVL_ALT_Q] = true
+	FeatureData[2][SEG_LVL_ALT_Q] = -40
+	CurrentQIndex = 100
+
+	assert.Equal(t, 20, getQIndex(true, 2, true, true, 60))
+	assert.Equal(t, 60, getQIndex(false, 2, true, true, 60))
+	assert.Equal(t, 0, getQIndex(true, 2, true, false, 30))
+	assert.Equal(t, 60, getQIndex(true, 1, true, false, 60))
+	assert.Equal(t, 60, getQIndex(true, 2, false, false, 60))
+}
+
+func TestNegDeinterleave(t *testing.T) {
+	decode := func(ref int, max int) []int {
+		var out []int
+		for diff := 0; diff < max; diff++ {
+			out = append(out, negDeinterleave(diff, ref, max))
+		}
+		return out
+	}
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, decode(0, 8))
+	assert.Equal(t, []int{3, 4, 2, 5, 1, 6, 0, 7}, decode(3, 8))
+	assert.Equal(t, []int{5, 6, 4, 7, 3, 2, 1, 0}, decode(5, 8))
+	assert.Equal(t, []int{7, 6, 5, 4, 3, 2, 1, 0}, decode(7, 8))
+}
+
+func TestGetSegmentId(t *testing.T) {
+	saveGlobals(t, &MiRows, &MiCols, &MiRow, &MiCol, &MiSize, &PrevSegmentIds)
+	MiRows, MiCols = 4, 4
+	PrevSegmentIds = [][]int{
+		{7, 7, 7, 7},
+		{7, 7, 7, 7},
+		{7, 7, 7, 5},
+		{7, 7, 7, 7},
+	}
+
+	MiSize = BLOCK_8X8
+	MiRow, MiCol = 0, 0
+	assert.Equal(t, 7, getSegmentId())
+
+	MiRow, MiCol = 2, 2
+	assert.Equal(t, 5, getSegmentId())
+
+	// Only the part of the block inside the frame is considered.
+	MiSize = BLOCK_16X16
+	assert.Equal(t, 5, getSegmentId())
+}
+
+func TestReadSegmentIdPrediction(t *testing.T) {
+	saveGlobals(t, &MiRows, &MiCols, &MiRow, &MiCol, &SegmentIds, &SegmentId, &Skip,
+		&AvailU, &AvailL)
+	MiRows, MiCols = 4, 4
+	SegmentIds = [][]int{
+		{1, 2, 0, 0},
+		{3, 0, 0, 0},
+		{0, 0, 0, 0},
+		{0, 0, 0, 0},
+	}
+	MiRow, MiCol = 1, 1
+	Skip = true
+
+	AvailU, AvailL = true, true
+	readSegmentId(nil)
+	assert.Equal(t, 3, SegmentId)
+
+	SegmentIds[0][0] = 2
+	readSegmentId(nil)
+	assert.Equal(t, 2, SegmentId)
+
+	AvailU, AvailL = false, true
+	readSegmentId(nil)
+	assert.Equal(t, 3, SegmentId)
+
+	AvailU, AvailL = false, false
+	readSegmentId(nil)
+	assert.Equal(t, 0, SegmentId)
+}
+
+func TestLoadPreviousSegmentIds(t *testing.T) {
+	saveGlobals(t, &MiRows, &MiCols, &RefMiRows, &RefMiCols, &SavedSegmentIds, &PrevSegmentIds)
+	MiRows, MiCols = 2, 2
+	RefMiRows[1], RefMiCols[1] = 2, 2
+	SavedSegmentIds[1] = [][]int{{1, 2}, {3, 4}}
+	RefMiRows[2], RefMiCols[2] = 2, 4
+	SavedSegmentIds[2] = [][]int{{1, 2, 3, 4}, {5, 6, 7, 0}}
+
+	loadPreviousSegmentIds(1, true)
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}}, PrevSegmentIds)
+
+	loadPreviousSegmentIds(1, false)
+	assert.Equal(t, [][]int{{0, 0}, {0, 0}}, PrevSegmentIds)
+
+	loadPreviousSegmentIds(2, true)
+	assert.Equal(t, [][]int{{0, 0}, {0, 0}}, PrevSegmentIds)
+}
@@ -0,0 +1,112 @@
+package boulder
+
+const SUPERRES_SCALE_BITS = 14
+const SUPERRES_SCALE_MASK = (1 << SUPERRES_SCALE_BITS) - 1
+const SUPERRES_EXTRA_BITS = 8
+const SUPERRES_FILTER_BITS = 6
+const SUPERRES_FILTER_TAPS = 8
+const SUPERRES_FILTER_OFFSET = 3
+
+var UpscaleFilter = [1 << SUPERRES_FILTER_BITS][SUPERRES_FILTER_TAPS]int{
+	{0, 0, 0, 128, 0, 0, 0, 0}, {0, 0, -1, 128, 2, -1, 0, 0},
+	{0, 1, -3, 127, 4, -2, 1, 0}, {0, 1, -4, 127, 6, -3, 1, 0},
+	{0, 2, -6, 126, 8, -3, 1, 0}, {0, 2, -7, 125, 11, -4, 1, 0},
+	{-1, 2, -8, 125, 13, -5, 2, 0}, {-1, 3, -9, 124, 15, -6, 2, 0},
+	{-1, 3, -10, 123, 18, -6, 2, -1}, {-1, 3, -11, 122, 20, -7, 3, -1},
+	{-1, 4, -12, 121, 22, -8, 3, -1}, {-1, 4, -13, 120, 25, -9, 3, -1},
+	{-1, 4, -14, 118, 28, -9, 3, -1}, {-1, 4, -15, 117, 30, -10, 4, -1},
+	{-1, 5, -16, 116, 32, -11, 4, -1}, {-1, 5, -16, 114, 35, -12, 4, -1},
+	{-1, 5, -17, 112, 38, -12, 4, -1}, {-1, 5, -18, 111, 40, -13, 5, -1},
+	{-1, 5, -18, 109, 43, -14, 5, -1}, {-1, 6, -19, 107, 45, -14, 5, -1},
+	{-1, 6, -19, 105, 48, -15, 5, -1}, {-1, 6, -19, 103, 51, -16, 5, -1},
+	{-1, 6, -20, 101, 53, -16, 6, -1}, {-1, 6, -20, 99, 56, -17, 6, -1},
+	{-1, 6, -20, 97, 58, -17, 6, -1}, {-1, 6, -20, 95, 61, -18, 6, -1},
+	{-2, 7, -20, 93, 64, -18, 6, -2}, {-2, 7, -20, 91, 66, -19, 6, -1},
+	{-2, 7, -20, 88, 69, -19, 6, -1}, {-2, 7, -20, 86, 71, -19, 6, -1},
+	{-2, 7, -20, 84, 74, -20, 7, -2}, {-2, 7, -20, 81, 76, -20, 7, -1},
+	{-2, 7, -20, 79, 79, -20, 7, -2}, {-1, 7, -20, 76, 81, -20, 7, -2},
+	{-2, 7, -20, 74, 84, -20, 7, -2}, {-1, 6, -19, 71, 86, -20, 7, -2},
+	{-1, 6, -19, 69, 88, -20, 7, -2}, {-1, 6, -19, 66, 91, -20, 7, -2},
+	{-2, 6, -18, 64, 93, -20, 7, -2}, {-1, 6, -18, 61, 95, -20, 6, -1},
+	{-1, 6, -17, 58, 97, -20, 6, -1}, {-1, 6, -17, 56, 99, -20, 6, -1},
+	{-1, 6, -16, 53, 101, -20, 6, -1}, {-1, 5, -16, 51, 103, -19, 6, -1},
+	{-1, 5, -15, 48, 105, -19, 6, -1}, {-1, 5, -14, 45, 107, -19, 6, -1},
+	{-1, 5, -14, 43, 109, -18, 5, -1}, {-1, 5, -13, 40, 111, -18, 5, -1},
+	{-1, 4, -12, 38, 112, -17, 5, -1}, {-1, 4, -12, 35, 114, -16, 5, -1},
+	{-1, 4, -11, 32, 116, -16, 5, -1}, {-1, 4, -10, 30, 117, -15, 4, -1},
+	{-1, 3, -9, 28, 118, -14, 4, -1}, {-1, 3, -9, 25, 120, -13, 4, -1},
+	{-1, 3, -8, 22, 121, -12, 4, -1}, {-1, 3, -7, 20, 122, -11, 3, -1},
+	{-1, 2, -6, 18, 123, -10, 3, -1}, {0, 2, -6, 15, 124, -9, 3, -1},
+	{0, 2, -5, 13, 125, -8, 2, -1}, {0, 1, -4, 11, 125, -7, 2, 0},
+	{0, 1, -3, 8, 126, -6, 2, 0}, {0, 1, -3, 6, 127, -4, 1, 0},
+	{0, 1, -2, 4, 127, -3, 1, 0}, {0, 0, -1, 2, 128, -1, 0, 0},
+}
+
+// superresProcess produces UpscaledCurrFrame and UpscaledCdefFrame at
+// UpscaledWidth. Without super-resolution they alias the inputs.
+func superresProcess() {
+	if !uh.useSuperres {
+		UpscaledCurrFrame = CurrFrame
+		UpscaledCdefFrame = CdefFrame
+		return
+	}
+
+	UpscaledCdefFrame = upscalingProcess(CdefFrame)
+
+	// The deblocked frame is only read by loop restoration.
+	if CdefFrame == CurrFrame {
+		UpscaledCurrFrame = UpscaledCdefFrame
+	} else if UsesLr {
+		UpscaledCurrFrame = upscalingProcess(CurrFrame)
+	} else {
+		UpscaledCurrFrame = CurrFrame
+	}
+}
+
+// upscalingProcess horizontally scales frame from FrameWidth to
+// UpscaledWidth with the normative 8-tap filter.
+func upscalingProcess(frame *Frame) *Frame {
+	upscaledFrame := framePool.Get(UpscaledWidth, FrameHeight, sh.colorConfig)
+
+	for plane := 0; plane < NumPlanes; plane++ {
+		subX, subY := 0, 0
+		if plane > 0 {
+			subX = sh.colorConfig.subsamplingX
+			subY = sh.colorConfig.subsamplingY
+		}
+
+		downscaledPlaneW := round2(FrameWidth, subX)
+		upscaledPlaneW := round2(UpscaledWidth, subX)
+		planeH := round2(FrameHeight, subY)
+
+		stepX := ((downscaledPlaneW << SUPERRES_SCALE_BITS) + (upscaledPlaneW / 2)) / upscaledPlaneW
+		err := upscaledPlaneW*stepX - (downscaledPlaneW << SUPERRES_SCALE_BITS)
+		initialSubpelX := (-((upscaledPlaneW-downscaledPlaneW)<<(SUPERRES_SCALE_BITS-1))+upscaledPlaneW/2)/upscaledPlaneW +
+			(1 << (SUPERRES_EXTRA_BITS - 1)) - err/2
+		initialSubpelX &= SUPERRES_SCALE_MASK
+
+		miW := MiCols >> subX
+		minX := 0
+		maxX := miW*MI_SIZE - 1
+
+		src := &frame.Planes[plane]
+		dst := &upscaledFrame.Planes[plane]
+		for y := 0; y < planeH; y++ {
+			for x := 0; x < upscaledPlaneW; x++ {
+				srcX := -(1 << SUPERRES_SCALE_BITS) + initialSubpelX + x*stepX
+				srcP := srcX >> SUPERRES_SCALE_BITS
+				filterIdx := (srcX & SUPERRES_SCALE_MASK) >> SUPERRES_EXTRA_BITS
+
+				sum := 0
+				for k := 0; k < SUPERRES_FILTER_TAPS; k++ {
+					sampleX := clip3(minX, maxX, srcP+(k-SUPERRES_FILTER_OFFSET))
+					sum += src.At(sampleX, y) * UpscaleFilter[filterIdx][k]
+				}
+
+				dst.Set(x, y, clip1(round2(sum, FILTER_BITS)))
+			}
+		}
+	}
+
+	return upscaledFrame
+}
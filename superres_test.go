@@ -0,0 +1,97 @@
+package boulder
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSuperresTest(t *testing.T) {
+	setupLoopFilterTest(t, 8, 8)
+	saveGlobals(t, &UpscaledWidth, &SuperresDenom, &CdefFrame, &UpscaledCurrFrame, &UpscaledCdefFrame)
+	UpscaledWidth = 16
+	SuperresDenom = 16
+	uh.useSuperres = true
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			CurrFrame.Planes[0].Set(x, y, 16*x)
+		}
+	}
+}
+
+func TestUpscaleFilterTaps(t *testing.T) {
+	for i, taps := range UpscaleFilter {
+		sum := 0
+		for k, tap := range taps {
+			sum += tap
+			if i > 0 {
+				assert.Equal(t, tap, UpscaleFilter[len(UpscaleFilter)-i][SUPERRES_FILTER_TAPS-1-k])
+			}
+		}
+		assert.Equal(t, 1<<FILTER_BITS, sum)
+	}
+}
+
+func TestUpscalingProcess(t *testing.T) {
+	setupSuperresTest(t)
+
+	f := upscalingProcess(CurrFrame)
+
+	assert.Equal(t, 16, f.Width)
+	for y := 0; y < 8; y++ {
+		assert.Equal(t, 0, f.Planes[0].At(0, y))
+		assert.Equal(t, 11, f.Planes[0].At(2, y))
+		assert.Equal(t, 60, f.Planes[0].At(8, y))
+		assert.Equal(t, 113, f.Planes[0].At(15, y))
+	}
+}
+
+func TestSuperresProcessAliasesWithoutScaling(t *testing.T) {
+	setupSuperresTest(t)
+	uh.useSuperres = false
+	CdefFrame = CurrFrame
+
+	superresProcess()
+	assert.Same(t, CurrFrame, UpscaledCurrFrame)
+	assert.Same(t, CurrFrame, UpscaledCdefFrame)
+
+	uh.useSuperres = true
+	superresProcess()
+	assert.Same(t, UpscaledCdefFrame, UpscaledCurrFrame)
+	assert.Equal(t, 16, UpscaledCdefFrame.Width)
+}
+
+// TestArgonSuperresFrameSize probes every Argon stream that uses superres
+// and checks the downscaled width of each such frame against its upscaled
+// width. The upscaling itself only runs once tile data is decoded.
+func TestArgonSuperresFrameSize(t *testing.T) {
+	obuPaths := argonStreams(t)
+
+	found := false
+	for _, obuPath := range obuPaths {
+		d := NewDecoder(Options{})
+		result, err := d.Probe(obuPath)
+		name := filepath.Base(obuPath)
+
+		usesSuperres := false
+		for i, frame := range result.Frames {
+			if frame.Header == nil || !frame.Header.UseSuperres {
+				continue
+			}
+			usesSuperres = true
+
+			denom := frame.Header.SuperresDenom
+			assert.GreaterOrEqual(t, denom, SUPERRES_DENOM_MIN, "%s frame %d", name, i)
+			assert.LessOrEqual(t, denom, SUPERRES_DENOM_MIN+(1<<SUPERRES_DENOM_BITS)-1, "%s frame %d", name, i)
+			assert.Equal(t, (frame.UpscaledWidth*SUPERRES_NUM+denom/2)/denom, frame.FrameWidth, "%s frame %d", name, i)
+		}
+
+		if usesSuperres {
+			found = true
+			assert.NoError(t, err, name)
+		}
+	}
+
+	assert.True(t, found, "no Argon stream uses superres")
+}
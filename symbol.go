@@ -0,0 +1,101 @@
+package boulder
+
+const EC_PROB_SHIFT = 6
+const EC_MIN_PROB = 4
+
+// readSymbol decodes one symbol using cdf, which holds N cumulative
+// probabilities followed by the adaptation counter, and adapts cdf
+// afterwards unless CDF updates are disabled for the frame.
+func readSymbol(r *Reader, cdf []int) int {
+	n := len(cdf) - 1
+
+	cur := SymbolRange
+	symbol := -1
+	var prev int
+	for {
+		symbol++
+		prev = cur
+		f := (1 << 15) - cdf[symbol]
+		cur = ((SymbolRange >> 8) * (f >> EC_PROB_SHIFT) >> (7 - EC_PROB_SHIFT)) + EC_MIN_PROB*(n-symbol-1)
+
+		if SymbolValue >= cur {
+			break
+		}
+	}
+
+	SymbolRange = prev - cur
+	SymbolValue = SymbolValue - cur
+
+	bits := 15 - floorLog2(SymbolRange)
+	SymbolRange = SymbolRange << bits
+	numBits := min(bits, max(0, SymbolMaxBits))
+	newData := r.f(numBits)
+	paddedData := newData << (bits - numBits)
+	SymbolValue = paddedData ^ (((SymbolValue + 1) << bits) - 1)
+	SymbolMaxBits = SymbolMaxBits - bits
+
+	if !uh.disableCdfUpdate {
+		updateCdf(cdf, symbol)
+	}
+
+	return symbol
+}
+
+func updateCdf(cdf []int, symbol int) {
+	n := len(cdf) - 1
+
+	rate := 3 + min(floorLog2(n), 2)
+	if cdf[n] > 15 {
+		rate++
+	}
+	if cdf[n] > 31 {
+		rate++
+	}
+
+	tmp := 0
+	for i := 0; i < n-1; i++ {
+		if i == symbol {
+			tmp = 1 << 15
+		}
+
+		if tmp < cdf[i] {
+			cdf[i] -= (cdf[i] - tmp) >> rate
+		} else {
+			cdf[i] += (tmp - cdf[i]) >> rate
+		}
+	}
+
+	if cdf[n] < 32 {
+		cdf[n]++
+	}
+}
+
+func readBool(r *Reader) bool {
+	cdf := []int{1 << 14, 1 << 15, 0}
+	return readSymbol(r, cdf) == 1
+}
+
+func readLiteral(r *Reader, n int) int {
+	x := 0
+	for i := 0; i < n; i++ {
+		x = 2 * x
+		if readBool(r) {
+			x++
+		}
+	}
+
+	return x
+}
+
+// readNs reads a value in [0, n) with the symbol coded form of ns(n).
+func readNs(r *Reader, n int) int {
+	w := floorLog2(n) + 1
+	m := (1 << w) - n
+	v := readLiteral(r, w-1)
+	if v < m {
+		return v
+	}
+
+	extraBit := readLiteral(r, 1)
+	return (v << 1) - m + extraBit
+}
@@ -0,0 +1,127 @@
+package boulder
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// symbolEncoder is the arithmetic encoder matching readSymbol. It keeps the
+// low end of the coding interval as an arbitrary precision integer so that
+// carries need no special handling.
+type symbolEncoder struct {
+	low   *big.Int
+	rng   int
+	nbits int
+}
+
+func newSymbolEncoder() *symbolEncoder {
+	return &symbolEncoder{low: big.NewInt(0), rng: 1 << 15}
+}
+
+func (e *symbolEncoder) bound(cdf []int, symbol int) int {
+	n := len(cdf) - 1
+	if symbol < 0 {
+		return e.rng
+	}
+	if symbol == n-1 {
+		return 0
+	}
+
+	f := (1 << 15) - cdf[symbol]
+	return ((e.rng >> 8) * (f >> EC_PROB_SHIFT) >> (7 - EC_PROB_SHIFT)) + EC_MIN_PROB*(n-symbol-1)
+}
+
+func (e *symbolEncoder) encode(cdf []int, symbol int) {
+	u := e.bound(cdf, symbol-1)
+	v := e.bound(cdf, symbol)
+
+	e.low.Add(e.low, big.NewInt(int64(e.rng-u)))
+	e.rng = u - v
+
+	for e.rng < 1<<15 {
+		e.rng <<= 1
+		e.low.Lsh(e.low, 1)
+		e.nbits++
+	}
+
+	updateCdf(cdf, symbol)
+}
+
+func (e *symbolEncoder) encodeBool(b bool) {
+	symbol := 0
+	if b {
+		symbol = 1
+	}
+	e.encode([]int{1 << 14, 1 << 15, 0}, symbol)
+}
+
+func (e *symbolEncoder) bytes() []byte {
+	total := 15 + e.nbits
+	size := (total + 7) / 8
+	value := new(big.Int).Lsh(e.low, uint(size*8-total))
+
+	out := make([]byte, size)
+	value.FillBytes(out)
+	return out
+}
+
+func TestReadSymbolRoundTrip(t *testing.T) {
+	saveGlobals(t, &uh, &SymbolValue, &SymbolRange, &SymbolMaxBits)
+	uh = UncompressedHeader{}
+	rng := rand.New(rand.NewSource(1))
+
+	encCdf := []int{4096, 11264, 19328, 32768, 0}
+	decCdf := append([]int(nil), encCdf...)
+
+	symbols := make([]int, 500)
+	enc := newSymbolEncoder()
+	for i := range symbols {
+		symbols[i] = rng.Intn(4)
+		enc.encode(encCdf, symbols[i])
+	}
+	data := enc.bytes()
+
+	r := Reader{data: data}
+	initSymbol(len(data), &r)
+	for i := range symbols {
+		assert.Equal(t, symbols[i], readSymbol(&r, decCdf), "symbol %d", i)
+	}
+	assert.Equal(t, encCdf, decCdf)
+}
+
+func TestReadLiteral(t *testing.T) {
+	saveGlobals(t, &uh, &SymbolValue, &SymbolRange, &SymbolMaxBits)
+	uh = UncompressedHeader{}
+
+	enc := newSymbolEncoder()
+	for _, v := range []int{5, 0, 255} {
+		for i := 7; i >= 0; i-- {
+			enc.encodeBool((v>>i)&1 == 1)
+		}
+	}
+	data := enc.bytes()
+
+	r := Reader{data: data}
+	initSymbol(len(data), &r)
+	assert.Equal(t, 5, readLiteral(&r, 8))
+	assert.Equal(t, 0, readLiteral(&r, 8))
+	assert.Equal(t, 255, readLiteral(&r, 8))
+}
+
+func TestUpdateCdfDisabled(t *testing.T) {
+	saveGlobals(t, &uh)
+	uh = UncompressedHeader{disableCdfUpdate: true}
+
+	cdf := []int{16384, 32768, 0}
+	enc := newSymbolEncoder()
+	enc.encode(append([]int(nil), cdf...), 1)
+	data := enc.bytes()
+
+	r := Reader{data: data}
+	initSymbol(len(data), &r)
+	assert.Equal(t, 1, readSymbol(&r, cdf))
+	assert.Equal(t, []int{16384, 32768, 0}, cdf)
+}
@@ -0,0 +1,71 @@
+package boulder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Tracer receives every syntax element the parser reads outside of tile
+// data: its name as written in the specification, the bit position in the
+// file it starts at, its width in bits and its value. That covers the OBU,
+// sequence, frame and tile group headers. Symbols decoded from tile data
+// by the arithmetic decoder are not traced, as they have no bit position
+// or width of their own.
+type Tracer interface {
+	Element(name string, bitPos int, width int, value int)
+}
+
+// TextTracer writes one line per syntax element with its bit position,
+// width, name and value.
+type TextTracer struct {
+	w   io.Writer
+	err error
+}
+
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w: w}
+}
+
+func (t *TextTracer) Element(name string, bitPos int, width int, value int) {
+	if t.err != nil {
+		return
+	}
+
+	_, t.err = fmt.Fprintf(t.w, "%10d %2d %s = %d\n", bitPos, width, name, value)
+}
+
+// Err returns the first error writing to the underlying writer.
+func (t *TextTracer) Err() error {
+	return t.err
+}
+
+// JSONTracer writes one JSON object per syntax element and line.
+type JSONTracer struct {
+	enc *json.Encoder
+	err error
+}
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+type tracedElement struct {
+	Name   string `json:"name"`
+	BitPos int    `json:"bit_pos"`
+	Width  int    `json:"width"`
+	Value  int    `json:"value"`
+}
+
+func (t *JSONTracer) Element(name string, bitPos int, width int, value int) {
+	if t.err != nil {
+		return
+	}
+
+	t.err = t.enc.Encode(tracedElement{Name: name, BitPos: bitPos, Width: width, Value: value})
+}
+
+// Err returns the first error writing to the underlying writer.
+func (t *JSONTracer) Err() error {
+	return t.err
+}
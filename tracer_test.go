@@ -0,0 +1,61 @@
+package boulder
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextTracer(t *testing.T) {
+	var out bytes.Buffer
+	tracer := NewTextTracer(&out)
+	tracer.Element("seq_profile", 48, 3, 0)
+	tracer.Element("max_frame_width_minus_1", 1234, 16, 1919)
+
+	assert.NoError(t, tracer.Err())
+	assert.Equal(t, "        48  3 seq_profile = 0\n      1234 16 max_frame_width_minus_1 = 1919\n", out.String())
+}
+
+func TestJSONTracer(t *testing.T) {
+	var out bytes.Buffer
+	tracer := NewJSONTracer(&out)
+	tracer.Element("base_q_idx", 100, 8, 255)
+	tracer.Element("delta_q", 108, 7, -3)
+
+	assert.NoError(t, tracer.Err())
+	assert.Equal(t, `{"name":"base_q_idx","bit_pos":100,"width":8,"value":255}`+"\n"+
+		`{"name":"delta_q","bit_pos":108,"width":7,"value":-3}`+"\n", out.String())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestTracerWriteError(t *testing.T) {
+	text := NewTextTracer(failingWriter{})
+	text.Element("seq_profile", 0, 3, 0)
+	text.Element("still_picture", 3, 1, 0)
+	assert.EqualError(t, text.Err(), "disk full")
+
+	json := NewJSONTracer(failingWriter{})
+	json.Element("seq_profile", 0, 3, 0)
+	assert.EqualError(t, json.Err(), "disk full")
+}
+
+func TestProbeTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	d := NewDecoder(Options{Tracer: tracer})
+
+	_, err := d.Probe(writeProbeStream(t))
+	assert.NoError(t, err)
+
+	// The sequence header OBU header is at byte 5.
+	assert.Contains(t, tracer.elements, tracedElement{Name: "obu_type", BitPos: 5*8 + 1, Width: 4, Value: OBU_SEQUENCE_HEADER})
+	assert.Contains(t, tracer.elements, tracedElement{Name: "seq_profile", BitPos: 6 * 8, Width: 3, Value: 0})
+	assert.Contains(t, tracer.elements, tracedElement{Name: "base_q_idx", BitPos: 34 * 8, Width: 8, Value: 100})
+	assert.Contains(t, tracer.elements, tracedElement{Name: "frame_to_show_map_idx", BitPos: 89*8 + 1, Width: 3, Value: 6})
+}
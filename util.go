@@ -1,5 +1,7 @@
 package boulder
 
+import "sync"
+
 func set[T any](i int, arr []T, val T) {
 	if i < 0 {
 		arr[len(arr)+i] = val
@@ -47,3 +49,98 @@ func get3d(i int, j int, z int, arr [][][]int) int {
 		return get2d(j, z, arr[i])
 	}
 }
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+func clip3(x int, y int, z int) int {
+	if z < x {
+		return x
+	} else if z > y {
+		return y
+	}
+
+	return z
+}
+
+func clip1(x int) int {
+	return clip3(0, (1<<BitDepth)-1, x)
+}
+
+func round2Signed(x int, n int) int {
+	if x >= 0 {
+		return round2(x, n)
+	}
+
+	return -round2(-x, n)
+}
+
+func floorLog2(x int) int {
+	s := 0
+	for x > 1 {
+		x >>= 1
+		s++
+	}
+
+	return s
+}
+
+func ceilLog2(x int) int {
+	if x < 2 {
+		return 0
+	}
+
+	i := 1
+	p := 2
+	for p < x {
+		i++
+		p <<= 1
+	}
+
+	return i
+}
+
+func inverseRecenter(r int, v int) int {
+	if v > 2*r {
+		return v
+	} else if v&1 != 0 {
+		return r - ((v + 1) >> 1)
+	}
+
+	return r + (v >> 1)
+}
+
+// parallelFor calls fn for every i in [0, n), spread over up to threads
+// goroutines. fn must only write state no other i touches.
+func parallelFor(threads int, n int, fn func(i int)) {
+	threads = min(threads, n)
+	if threads < 2 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
@@ -1,6 +1,7 @@
 package boulder
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -55,3 +56,72 @@ func TestGet2d(t *testing.T) {
 	assert.Equal(t, 3, get2d(0, -1, arr))
 	assert.Equal(t, 4, get2d(-1, -1, arr))
 }
+
+func TestRound2(t *testing.T) {
+	assert.Equal(t, 5, round2(5, 0))
+	assert.Equal(t, 3, round2(5, 1))
+	assert.Equal(t, 1, round2(5, 3))
+	assert.Equal(t, 0, round2(3, 3))
+}
+
+func TestParallelFor(t *testing.T) {
+	for _, threads := range []int{0, 1, 3, 100} {
+		done := make([]int, 10)
+		parallelFor(threads, len(done), func(i int) { done[i]++ })
+		assert.Equal(t, []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, done)
+	}
+}
+
+// saveGlobals restores the package variables that vars point to when t and
+// its subtests finish, so that tests setting up decoder state do not depend
+// on the order they run in. Slices and arrays are copied deeply; anything
+// else, like a *Frame, is restored as the value it had.
+func saveGlobals(t *testing.T, vars ...any) {
+	saved := make([]reflect.Value, len(vars))
+	for i, v := range vars {
+		saved[i] = deepCopy(reflect.ValueOf(v).Elem())
+	}
+
+	t.Cleanup(func() {
+		for i, v := range vars {
+			reflect.ValueOf(v).Elem().Set(saved[i])
+		}
+	})
+}
+
+func deepCopy(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return c
+		}
+		c.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Cap()))
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+	default:
+		c.Set(v)
+	}
+
+	return c
+}
+
+func TestSaveGlobals(t *testing.T) {
+	MiCols = 4
+	Skips = [][]bool{{false, true}}
+	defer func() { MiCols, Skips = 0, nil }()
+
+	t.Run("modify", func(t *testing.T) {
+		saveGlobals(t, &MiCols, &Skips)
+		MiCols = 8
+		Skips[0][0] = true
+	})
+
+	assert.Equal(t, 4, MiCols)
+	assert.Equal(t, [][]bool{{false, true}}, Skips)
+}
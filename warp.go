@@ -0,0 +1,575 @@
+package boulder
+
+const WARP_PARAM_REDUCE_BITS = 6
+const WARPEDPIXEL_PREC_SHIFTS = 1 << 6
+const WARPEDDIFF_PREC_BITS = 10
+const WARPEDMODEL_TRANS_CLAMP = 1 << 23
+const WARPEDMODEL_NONDIAGAFFINE_CLAMP = 1 << 13
+const DIV_LUT_BITS = 8
+const DIV_LUT_PREC_BITS = 14
+const DIV_LUT_NUM = 257
+const LS_MV_MAX = 256
+const LEAST_SQUARES_SAMPLES_MAX = 8
+
+var (
+	LocalValid        bool
+	LocalWarpParams   [6]int
+	NumSamples        int
+	NumSamplesScanned int
+	CandList          [LEAST_SQUARES_SAMPLES_MAX][4]int
+	WarpedFilters     = [193][8]int{
+		// [-1, 0)
+		{0, 0, 127, 1, 0, 0, 0, 0},
+		{0, -1, 127, 2, 0, 0, 0, 0},
+		{1, -3, 127, 4, -1, 0, 0, 0},
+		{1, -4, 126, 6, -2, 1, 0, 0},
+		{1, -5, 126, 8, -3, 1, 0, 0},
+		{1, -6, 125, 11, -4, 1, 0, 0},
+		{1, -7, 124, 13, -4, 1, 0, 0},
+		{2, -8, 123, 15, -5, 1, 0, 0},
+		{2, -9, 122, 18, -6, 1, 0, 0},
+		{2, -10, 121, 20, -6, 1, 0, 0},
+		{2, -11, 120, 22, -7, 2, 0, 0},
+		{2, -12, 119, 25, -8, 2, 0, 0},
+		{3, -13, 117, 27, -8, 2, 0, 0},
+		{3, -13, 116, 29, -9, 2, 0, 0},
+		{3, -14, 114, 32, -10, 3, 0, 0},
+		{3, -15, 113, 35, -10, 2, 0, 0},
+		{3, -15, 111, 37, -11, 3, 0, 0},
+		{3, -16, 109, 40, -11, 3, 0, 0},
+		{3, -16, 108, 42, -12, 3, 0, 0},
+		{4, -17, 106, 45, -13, 3, 0, 0},
+		{4, -17, 104, 47, -13, 3, 0, 0},
+		{4, -17, 102, 50, -14, 3, 0, 0},
+		{4, -17, 100, 52, -14, 3, 0, 0},
+		{4, -18, 98, 55, -15, 4, 0, 0},
+		{4, -18, 96, 58, -15, 3, 0, 0},
+		{4, -18, 94, 60, -16, 4, 0, 0},
+		{4, -18, 91, 63, -16, 4, 0, 0},
+		{4, -18, 89, 65, -16, 4, 0, 0},
+		{4, -18, 87, 68, -17, 4, 0, 0},
+		{4, -18, 85, 70, -17, 4, 0, 0},
+		{4, -18, 82, 73, -17, 4, 0, 0},
+		{4, -18, 80, 75, -17, 4, 0, 0},
+		{4, -18, 78, 78, -18, 4, 0, 0},
+		{4, -17, 75, 80, -18, 4, 0, 0},
+		{4, -17, 73, 82, -18, 4, 0, 0},
+		{4, -17, 70, 85, -18, 4, 0, 0},
+		{4, -17, 68, 87, -18, 4, 0, 0},
+		{4, -16, 65, 89, -18, 4, 0, 0},
+		{4, -16, 63, 91, -18, 4, 0, 0},
+		{4, -16, 60, 94, -18, 4, 0, 0},
+		{3, -15, 58, 96, -18, 4, 0, 0},
+		{4, -15, 55, 98, -18, 4, 0, 0},
+		{3, -14, 52, 100, -17, 4, 0, 0},
+		{3, -14, 50, 102, -17, 4, 0, 0},
+		{3, -13, 47, 104, -17, 4, 0, 0},
+		{3, -13, 45, 106, -17, 4, 0, 0},
+		{3, -12, 42, 108, -16, 3, 0, 0},
+		{3, -11, 40, 109, -16, 3, 0, 0},
+		{3, -11, 37, 111, -15, 3, 0, 0},
+		{2, -10, 35, 113, -15, 3, 0, 0},
+		{3, -10, 32, 114, -14, 3, 0, 0},
+		{2, -9, 29, 116, -13, 3, 0, 0},
+		{2, -8, 27, 117, -13, 3, 0, 0},
+		{2, -8, 25, 119, -12, 2, 0, 0},
+		{2, -7, 22, 120, -11, 2, 0, 0},
+		{1, -6, 20, 121, -10, 2, 0, 0},
+		{1, -6, 18, 122, -9, 2, 0, 0},
+		{1, -5, 15, 123, -8, 2, 0, 0},
+		{1, -4, 13, 124, -7, 1, 0, 0},
+		{1, -4, 11, 125, -6, 1, 0, 0},
+		{1, -3, 8, 126, -5, 1, 0, 0},
+		{1, -2, 6, 126, -4, 1, 0, 0},
+		{0, -1, 4, 127, -3, 1, 0, 0},
+		{0, 0, 2, 127, -1, 0, 0, 0},
+		// [0, 1)
+		{0, 0, 0, 127, 1, 0, 0, 0},
+		{0, 0, -1, 127, 2, 0, 0, 0},
+		{0, 1, -3, 127, 4, -2, 1, 0},
+		{0, 1, -5, 127, 6, -2, 1, 0},
+		{0, 2, -6, 126, 8, -3, 1, 0},
+		{-1, 2, -7, 126, 11, -4, 2, -1},
+		{-1, 3, -8, 125, 13, -5, 2, -1},
+		{-1, 3, -10, 124, 16, -6, 3, -1},
+		{-1, 4, -11, 123, 18, -7, 3, -1},
+		{-1, 4, -12, 122, 20, -7, 3, -1},
+		{-1, 4, -13, 121, 23, -8, 3, -1},
+		{-2, 5, -14, 120, 25, -9, 4, -1},
+		{-1, 5, -15, 119, 27, -10, 4, -1},
+		{-1, 5, -16, 118, 30, -11, 4, -1},
+		{-2, 6, -17, 116, 33, -12, 5, -1},
+		{-2, 6, -17, 114, 35, -12, 5, -1},
+		{-2, 6, -18, 113, 38, -13, 5, -1},
+		{-2, 7, -19, 111, 41, -14, 6, -2},
+		{-2, 7, -19, 110, 43, -15, 6, -2},
+		{-2, 7, -20, 108, 46, -15, 6, -2},
+		{-2, 7, -20, 106, 49, -16, 6, -2},
+		{-2, 7, -21, 104, 51, -16, 7, -2},
+		{-2, 7, -21, 102, 54, -17, 7, -2},
+		{-2, 8, -21, 100, 56, -18, 7, -2},
+		{-2, 8, -22, 98, 59, -18, 7, -2},
+		{-2, 8, -22, 96, 62, -19, 7, -2},
+		{-2, 8, -22, 94, 64, -19, 7, -2},
+		{-2, 8, -22, 91, 67, -20, 8, -2},
+		{-2, 8, -22, 89, 69, -20, 8, -2},
+		{-2, 8, -22, 87, 72, -21, 8, -2},
+		{-2, 8, -21, 84, 74, -21, 8, -2},
+		{-2, 8, -22, 82, 77, -21, 8, -2},
+		{-2, 8, -21, 79, 79, -21, 8, -2},
+		{-2, 8, -21, 77, 82, -22, 8, -2},
+		{-2, 8, -21, 74, 84, -21, 8, -2},
+		{-2, 8, -21, 72, 87, -22, 8, -2},
+		{-2, 8, -20, 69, 89, -22, 8, -2},
+		{-2, 8, -20, 67, 91, -22, 8, -2},
+		{-2, 7, -19, 64, 94, -22, 8, -2},
+		{-2, 7, -19, 62, 96, -22, 8, -2},
+		{-2, 7, -18, 59, 98, -22, 8, -2},
+		{-2, 7, -18, 56, 100, -21, 8, -2},
+		{-2, 7, -17, 54, 102, -21, 7, -2},
+		{-2, 7, -16, 51, 104, -21, 7, -2},
+		{-2, 6, -16, 49, 106, -20, 7, -2},
+		{-2, 6, -15, 46, 108, -20, 7, -2},
+		{-2, 6, -15, 43, 110, -19, 7, -2},
+		{-2, 6, -14, 41, 111, -19, 7, -2},
+		{-1, 5, -13, 38, 113, -18, 6, -2},
+		{-1, 5, -12, 35, 114, -17, 6, -2},
+		{-1, 5, -12, 33, 116, -17, 6, -2},
+		{-1, 4, -11, 30, 118, -16, 5, -1},
+		{-1, 4, -10, 27, 119, -15, 5, -1},
+		{-1, 4, -9, 25, 120, -14, 5, -2},
+		{-1, 3, -8, 23, 121, -13, 4, -1},
+		{-1, 3, -7, 20, 122, -12, 4, -1},
+		{-1, 3, -7, 18, 123, -11, 4, -1},
+		{-1, 3, -6, 16, 124, -10, 3, -1},
+		{-1, 2, -5, 13, 125, -8, 3, -1},
+		{-1, 2, -4, 11, 126, -7, 2, -1},
+		{0, 1, -3, 8, 126, -6, 2, 0},
+		{0, 1, -2, 6, 127, -5, 1, 0},
+		{0, 1, -2, 4, 127, -3, 1, 0},
+		{0, 0, 0, 2, 127, -1, 0, 0},
+		// [1, 2)
+		{0, 0, 0, 1, 127, 0, 0, 0},
+		{0, 0, 0, -1, 127, 2, 0, 0},
+		{0, 0, 1, -3, 127, 4, -1, 0},
+		{0, 0, 1, -4, 126, 6, -2, 1},
+		{0, 0, 1, -5, 126, 8, -3, 1},
+		{0, 0, 1, -6, 125, 11, -4, 1},
+		{0, 0, 1, -7, 124, 13, -4, 1},
+		{0, 0, 2, -8, 123, 15, -5, 1},
+		{0, 0, 2, -9, 122, 18, -6, 1},
+		{0, 0, 2, -10, 121, 20, -6, 1},
+		{0, 0, 2, -11, 120, 22, -7, 2},
+		{0, 0, 2, -12, 119, 25, -8, 2},
+		{0, 0, 3, -13, 117, 27, -8, 2},
+		{0, 0, 3, -13, 116, 29, -9, 2},
+		{0, 0, 3, -14, 114, 32, -10, 3},
+		{0, 0, 3, -15, 113, 35, -10, 2},
+		{0, 0, 3, -15, 111, 37, -11, 3},
+		{0, 0, 3, -16, 109, 40, -11, 3},
+		{0, 0, 3, -16, 108, 42, -12, 3},
+		{0, 0, 4, -17, 106, 45, -13, 3},
+		{0, 0, 4, -17, 104, 47, -13, 3},
+		{0, 0, 4, -17, 102, 50, -14, 3},
+		{0, 0, 4, -17, 100, 52, -14, 3},
+		{0, 0, 4, -18, 98, 55, -15, 4},
+		{0, 0, 4, -18, 96, 58, -15, 3},
+		{0, 0, 4, -18, 94, 60, -16, 4},
+		{0, 0, 4, -18, 91, 63, -16, 4},
+		{0, 0, 4, -18, 89, 65, -16, 4},
+		{0, 0, 4, -18, 87, 68, -17, 4},
+		{0, 0, 4, -18, 85, 70, -17, 4},
+		{0, 0, 4, -18, 82, 73, -17, 4},
+		{0, 0, 4, -18, 80, 75, -17, 4},
+		{0, 0, 4, -18, 78, 78, -18, 4},
+		{0, 0, 4, -17, 75, 80, -18, 4},
+		{0, 0, 4, -17, 73, 82, -18, 4},
+		{0, 0, 4, -17, 70, 85, -18, 4},
+		{0, 0, 4, -17, 68, 87, -18, 4},
+		{0, 0, 4, -16, 65, 89, -18, 4},
+		{0, 0, 4, -16, 63, 91, -18, 4},
+		{0, 0, 4, -16, 60, 94, -18, 4},
+		{0, 0, 3, -15, 58, 96, -18, 4},
+		{0, 0, 4, -15, 55, 98, -18, 4},
+		{0, 0, 3, -14, 52, 100, -17, 4},
+		{0, 0, 3, -14, 50, 102, -17, 4},
+		{0, 0, 3, -13, 47, 104, -17, 4},
+		{0, 0, 3, -13, 45, 106, -17, 4},
+		{0, 0, 3, -12, 42, 108, -16, 3},
+		{0, 0, 3, -11, 40, 109, -16, 3},
+		{0, 0, 3, -11, 37, 111, -15, 3},
+		{0, 0, 2, -10, 35, 113, -15, 3},
+		{0, 0, 3, -10, 32, 114, -14, 3},
+		{0, 0, 2, -9, 29, 116, -13, 3},
+		{0, 0, 2, -8, 27, 117, -13, 3},
+		{0, 0, 2, -8, 25, 119, -12, 2},
+		{0, 0, 2, -7, 22, 120, -11, 2},
+		{0, 0, 1, -6, 20, 121, -10, 2},
+		{0, 0, 1, -6, 18, 122, -9, 2},
+		{0, 0, 1, -5, 15, 123, -8, 2},
+		{0, 0, 1, -4, 13, 124, -7, 1},
+		{0, 0, 1, -4, 11, 125, -6, 1},
+		{0, 0, 1, -3, 8, 126, -5, 1},
+		{0, 0, 1, -2, 6, 126, -4, 1},
+		{0, 0, 0, -1, 4, 127, -3, 1},
+		{0, 0, 0, 0, 2, 127, -1, 0},
+		// dummy, replicates row 191
+		{0, 0, 0, 0, 2, 127, -1, 0},
+	}
+	DivLut = [DIV_LUT_NUM]int{
+		16384, 16320, 16257, 16194, 16132, 16070, 16009, 15948, 15888, 15828, 15768, 15709,
+		15650, 15592, 15534, 15477, 15420, 15364, 15308, 15252, 15197, 15142, 15087, 15033,
+		14980, 14926, 14873, 14821, 14769, 14717, 14665, 14614, 14564, 14513, 14463, 14413,
+		14364, 14315, 14266, 14218, 14170, 14122, 14075, 14028, 13981, 13935, 13888, 13843,
+		13797, 13752, 13707, 13662, 13618, 13574, 13530, 13487, 13443, 13400, 13358, 13315,
+		13273, 13231, 13190, 13148, 13107, 13066, 13026, 12985, 12945, 12906, 12866, 12827,
+		12788, 12749, 12710, 12672, 12633, 12596, 12558, 12520, 12483, 12446, 12409, 12373,
+		12336, 12300, 12264, 12228, 12193, 12157, 12122, 12087, 12053, 12018, 11984, 11950,
+		11916, 11882, 11848, 11815, 11782, 11749, 11716, 11683, 11651, 11619, 11586, 11555,
+		11523, 11491, 11460, 11429, 11398, 11367, 11336, 11305, 11275, 11245, 11215, 11185,
+		11155, 11125, 11096, 11067, 11038, 11009, 10980, 10951, 10923, 10894, 10866, 10838,
+		10810, 10782, 10755, 10727, 10700, 10673, 10645, 10618, 10592, 10565, 10538, 10512,
+		10486, 10460, 10434, 10408, 10382, 10356, 10331, 10305, 10280, 10255, 10230, 10205,
+		10180, 10156, 10131, 10107, 10082, 10058, 10034, 10010, 9986, 9963, 9939, 9916,
+		9892, 9869, 9846, 9823, 9800, 9777, 9754, 9732, 9709, 9687, 9664, 9642,
+		9620, 9598, 9576, 9554, 9533, 9511, 9489, 9468, 9447, 9425, 9404, 9383,
+		9362, 9341, 9321, 9300, 9279, 9259, 9239, 9218, 9198, 9178, 9158, 9138,
+		9118, 9098, 9079, 9059, 9039, 9020, 9001, 8981, 8962, 8943, 8924, 8905,
+		8886, 8867, 8849, 8830, 8812, 8793, 8775, 8756, 8738, 8720, 8702, 8684,
+		8666, 8648, 8630, 8613, 8595, 8577, 8560, 8542, 8525, 8508, 8490, 8473,
+		8456, 8439, 8422, 8405, 8389, 8372, 8355, 8339, 8322, 8306, 8289, 8273,
+		8257, 8240, 8224, 8208, 8192,
+	}
+)
+
+// findWarpSamples collects the motion vectors of the neighbouring blocks
+// that use the same single reference as the current block into CandList,
+// for use by warpEstimation.
+func findWarpSamples() {
+	NumSamples = 0
+	NumSamplesScanned = 0
+
+	w4 := Num4x4BlocksWide[MiSize]
+	h4 := Num4x4BlocksHigh[MiSize]
+
+	doTopLeft := true
+	doTopRight := true
+
+	if AvailU {
+		srcSize := MiSizes[MiRow-1][MiCol]
+		srcW := Num4x4BlocksWide[srcSize]
+
+		if w4 <= srcW {
+			colOffset := -(MiCol & (srcW - 1))
+			if colOffset < 0 {
+				doTopLeft = false
+			}
+			if colOffset+srcW > w4 {
+				doTopRight = false
+			}
+			addSample(-1, 0)
+		} else {
+			step := 0
+			for i := 0; i < min(w4, MiCols-MiCol); i += step {
+				srcSize = MiSizes[MiRow-1][MiCol+i]
+				srcW = Num4x4BlocksWide[srcSize]
+				step = max(srcW, 1)
+				addSample(-1, i)
+			}
+		}
+	}
+
+	if AvailL {
+		srcSize := MiSizes[MiRow][MiCol-1]
+		srcH := Num4x4BlocksHigh[srcSize]
+
+		if h4 <= srcH {
+			rowOffset := -(MiRow & (srcH - 1))
+			if rowOffset < 0 {
+				doTopLeft = false
+			}
+			addSample(0, -1)
+		} else {
+			step := 0
+			for i := 0; i < min(h4, MiRows-MiRow); i += step {
+				srcSize = MiSizes[MiRow+i][MiCol-1]
+				srcH = Num4x4BlocksHigh[srcSize]
+				step = max(srcH, 1)
+				addSample(i, -1)
+			}
+		}
+	}
+
+	if doTopLeft {
+		addSample(-1, -1)
+	}
+
+	if doTopRight && max(w4, h4) <= 16 {
+		addSample(-1, w4)
+	}
+
+	if NumSamples == 0 && NumSamplesScanned > 0 {
+		NumSamples = 1
+	}
+}
+
+func addSample(deltaRow int, deltaCol int) {
+	if NumSamplesScanned >= LEAST_SQUARES_SAMPLES_MAX {
+		return
+	}
+
+	mvRow := MiRow + deltaRow
+	mvCol := MiCol + deltaCol
+
+	if !isInside(mvRow, mvCol) {
+		return
+	}
+
+	if RefFrames[mvRow][mvCol][0] == -1 {
+		return
+	}
+
+	if RefFrames[mvRow][mvCol][0] != RefFrame[0] {
+		return
+	}
+
+	if RefFrames[mvRow][mvCol][1] != NONE {
+		return
+	}
+
+	candSz := MiSizes[mvRow][mvCol]
+	candW4 := Num4x4BlocksWide[candSz]
+	candH4 := Num4x4BlocksHigh[candSz]
+	candRow := mvRow & ^(candH4 - 1)
+	candCol := mvCol & ^(candW4 - 1)
+	midY := candRow*4 + candH4*2 - 1
+	midX := candCol*4 + candW4*2 - 1
+	threshold := clip3(16, 112, max(BlockWidth[MiSize], BlockHeight[MiSize]))
+
+	candMv := Mvs[candRow][candCol][0]
+	mvDiffRow := abs(candMv[0] - Mv[0][0])
+	mvDiffCol := abs(candMv[1] - Mv[0][1])
+	valid := mvDiffRow+mvDiffCol <= threshold
+
+	cand := [4]int{midY * 8, midX * 8, midY*8 + candMv[0], midX*8 + candMv[1]}
+
+	NumSamplesScanned++
+	if !valid && NumSamplesScanned > 1 {
+		return
+	}
+
+	CandList[NumSamples] = cand
+	if valid {
+		NumSamples++
+	}
+}
+
+// warpEstimation fits an affine model to the samples found by
+// findWarpSamples using least squares, setting LocalWarpParams and
+// LocalValid.
+func warpEstimation() {
+	var A [2][2]int
+	var Bx [2]int
+	var By [2]int
+
+	w4 := Num4x4BlocksWide[MiSize]
+	h4 := Num4x4BlocksHigh[MiSize]
+	midY := MiRow*4 + h4*2 - 1
+	midX := MiCol*4 + w4*2 - 1
+	suy := midY * 8
+	sux := midX * 8
+	duy := suy + Mv[0][0]
+	dux := sux + Mv[0][1]
+
+	for i := 0; i < NumSamples; i++ {
+		sy := CandList[i][0] - suy
+		sx := CandList[i][1] - sux
+		dy := CandList[i][2] - duy
+		dx := CandList[i][3] - dux
+
+		if abs(sx-dx) < LS_MV_MAX && abs(sy-dy) < LS_MV_MAX {
+			A[0][0] += lsProduct(sx, sx) + 8
+			A[0][1] += lsProduct(sx, sy) + 4
+			A[1][1] += lsProduct(sy, sy) + 8
+			Bx[0] += lsProduct(sx, dx) + 8
+			Bx[1] += lsProduct(sy, dx) + 4
+			By[0] += lsProduct(sx, dy) + 4
+			By[1] += lsProduct(sy, dy) + 8
+		}
+	}
+
+	det := A[0][0]*A[1][1] - A[0][1]*A[0][1]
+	if det == 0 {
+		LocalValid = false
+		return
+	}
+	LocalValid = true
+
+	divShift, divFactor := resolveDivisor(det)
+	divShift -= WARPEDMODEL_PREC_BITS
+	if divShift < 0 {
+		divFactor = divFactor << (-divShift)
+		divShift = 0
+	}
+
+	LocalWarpParams[2] = warpDiag(A[1][1]*Bx[0]-A[0][1]*Bx[1], divShift, divFactor)
+	LocalWarpParams[3] = warpNonDiag(-A[0][1]*Bx[0]+A[0][0]*Bx[1], divShift, divFactor)
+	LocalWarpParams[4] = warpNonDiag(A[1][1]*By[0]-A[0][1]*By[1], divShift, divFactor)
+	LocalWarpParams[5] = warpDiag(-A[0][1]*By[0]+A[0][0]*By[1], divShift, divFactor)
+
+	vx := Mv[0][1]*(1<<(WARPEDMODEL_PREC_BITS-3)) -
+		(midX*(LocalWarpParams[2]-(1<<WARPEDMODEL_PREC_BITS)) + midY*LocalWarpParams[3])
+	vy := Mv[0][0]*(1<<(WARPEDMODEL_PREC_BITS-3)) -
+		(midX*LocalWarpParams[4] + midY*(LocalWarpParams[5]-(1<<WARPEDMODEL_PREC_BITS)))
+
+	LocalWarpParams[0] = clip3(-WARPEDMODEL_TRANS_CLAMP, WARPEDMODEL_TRANS_CLAMP-1, vx)
+	LocalWarpParams[1] = clip3(-WARPEDMODEL_TRANS_CLAMP, WARPEDMODEL_TRANS_CLAMP-1, vy)
+}
+
+func lsProduct(a int, b int) int {
+	return ((a * b) >> 2) + (a + b)
+}
+
+func warpNonDiag(v int, divShift int, divFactor int) int {
+	return clip3(
+		-WARPEDMODEL_NONDIAGAFFINE_CLAMP+1,
+		WARPEDMODEL_NONDIAGAFFINE_CLAMP-1,
+		round2Signed(v*divFactor, divShift),
+	)
+}
+
+func warpDiag(v int, divShift int, divFactor int) int {
+	return clip3(
+		(1<<WARPEDMODEL_PREC_BITS)-WARPEDMODEL_NONDIAGAFFINE_CLAMP+1,
+		(1<<WARPEDMODEL_PREC_BITS)+WARPEDMODEL_NONDIAGAFFINE_CLAMP-1,
+		round2Signed(v*divFactor, divShift),
+	)
+}
+
+func resolveDivisor(d int) (divShift int, divFactor int) {
+	n := floorLog2(abs(d))
+	e := abs(d) - (1 << n)
+
+	var f int
+	if n > DIV_LUT_BITS {
+		f = round2(e, n-DIV_LUT_BITS)
+	} else {
+		f = e << (DIV_LUT_BITS - n)
+	}
+
+	divShift = n + DIV_LUT_PREC_BITS
+	if d < 0 {
+		divFactor = -DivLut[f]
+	} else {
+		divFactor = DivLut[f]
+	}
+
+	return divShift, divFactor
+}
+
+// setupShear converts the affine warpParams into the shear parameters used
+// by blockWarp, also reporting whether the warp is valid.
+func setupShear(warpParams []int) (warpValid bool, alpha int, beta int, gamma int, delta int) {
+	alpha0 := clip3(-32768, 32767, warpParams[2]-(1<<WARPEDMODEL_PREC_BITS))
+	beta0 := clip3(-32768, 32767, warpParams[3])
+
+	divShift, divFactor := resolveDivisor(warpParams[2])
+
+	v := warpParams[4] << WARPEDMODEL_PREC_BITS
+	gamma0 := clip3(-32768, 32767, round2Signed(v*divFactor, divShift))
+
+	w := warpParams[3] * warpParams[4]
+	delta0 := clip3(-32768, 32767,
+		warpParams[5]-round2Signed(w*divFactor, divShift)-(1<<WARPEDMODEL_PREC_BITS))
+
+	alpha = round2Signed(alpha0, WARP_PARAM_REDUCE_BITS) << WARP_PARAM_REDUCE_BITS
+	beta = round2Signed(beta0, WARP_PARAM_REDUCE_BITS) << WARP_PARAM_REDUCE_BITS
+	gamma = round2Signed(gamma0, WARP_PARAM_REDUCE_BITS) << WARP_PARAM_REDUCE_BITS
+	delta = round2Signed(delta0, WARP_PARAM_REDUCE_BITS) << WARP_PARAM_REDUCE_BITS
+
+	warpValid = true
+	if 4*abs(alpha)+7*abs(beta) >= (1 << WARPEDMODEL_PREC_BITS) {
+		warpValid = false
+	}
+	if 4*abs(gamma)+4*abs(delta) >= (1 << WARPEDMODEL_PREC_BITS) {
+		warpValid = false
+	}
+
+	return warpValid, alpha, beta, gamma, delta
+}
+
+// blockWarp predicts the 8x8 block (i8, j8) of the w x h block at (x, y)
+// by applying either the local warp (useWarp 1) or the global motion of
+// refFrame (useWarp 2), writing the result into pred.
+func blockWarp(useWarp int, plane int, refFrame int, x int, y int, i8 int, j8 int, w int, h int, pred [][]int) {
+	subX := 0
+	subY := 0
+	if plane > 0 {
+		subX = sh.colorConfig.subsamplingX
+		subY = sh.colorConfig.subsamplingY
+	}
+
+	refIdx := uh.refFrameIdx[refFrame-LAST_FRAME]
+	ref := refPlane(refIdx, plane)
+	refUpscaledWidth, refFrameHeight := refDimensions(refIdx)
+
+	lastX := ((refUpscaledWidth + subX) >> subX) - 1
+	lastY := ((refFrameHeight + subY) >> subY) - 1
+
+	srcX := (x + j8*8 + 4) << subX
+	srcY := (y + i8*8 + 4) << subY
+
+	var warpParams []int
+	if useWarp == 1 {
+		warpParams = LocalWarpParams[:]
+	} else {
+		warpParams = uh.globalMotionParams.gmParams[refFrame]
+	}
+
+	dstX := warpParams[2]*srcX + warpParams[3]*srcY + warpParams[0]
+	dstY := warpParams[4]*srcX + warpParams[5]*srcY + warpParams[1]
+
+	_, alpha, beta, gamma, delta := setupShear(warpParams)
+
+	x4 := dstX >> subX
+	y4 := dstY >> subY
+	ix4 := x4 >> WARPEDMODEL_PREC_BITS
+	sx4 := x4 & ((1 << WARPEDMODEL_PREC_BITS) - 1)
+	iy4 := y4 >> WARPEDMODEL_PREC_BITS
+	sy4 := y4 & ((1 << WARPEDMODEL_PREC_BITS) - 1)
+
+	// The filter positions are taken relative to the top left corner of
+	// the 8x8 block with their fractional bits reduced, as in libaom.
+	sx4 += -4*alpha - 4*beta
+	sy4 += -4*gamma - 4*delta
+	sx4 &= ^((1 << WARP_PARAM_REDUCE_BITS) - 1)
+	sy4 &= ^((1 << WARP_PARAM_REDUCE_BITS) - 1)
+
+	var intermediate [15][8]int
+	for i1 := -7; i1 < 8; i1++ {
+		refY := clip3(0, lastY, iy4+i1)
+		for i2 := -4; i2 < 4; i2++ {
+			sx := sx4 + alpha*(i2+4) + beta*(i1+4)
+			offs := round2(sx, WARPEDDIFF_PREC_BITS) + WARPEDPIXEL_PREC_SHIFTS
+
+			s := 0
+			for i3 := 0; i3 < 8; i3++ {
+				s += WarpedFilters[offs][i3] * ref.At(clip3(0, lastX, ix4+i2-3+i3), refY)
+			}
+			intermediate[i1+7][i2+4] = round2(s, InterRound0)
+		}
+	}
+
+	for i1 := -4; i1 < min(4, h-i8*8-4); i1++ {
+		for i2 := -4; i2 < min(4, w-j8*8-4); i2++ {
+			sy := sy4 + gamma*(i2+4) + delta*(i1+4)
+			offs := round2(sy, WARPEDDIFF_PREC_BITS) + WARPEDPIXEL_PREC_SHIFTS
+
+			s := 0
+			for i3 := 0; i3 < 8; i3++ {
+				s += WarpedFilters[offs][i3] * intermediate[i1+i3+4][i2+4]
+			}
+			pred[i8*8+i1+4][j8*8+i2+4] = round2(s, InterRound1)
+		}
+	}
+}
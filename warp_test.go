@@ -0,0 +1,101 @@
+package boulder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarpedFiltersSumTo128(t *testing.T) {
+	for i := range WarpedFilters {
+		sum := 0
+		for _, tap := range WarpedFilters[i] {
+			sum += tap
+		}
+		assert.Equal(t, 128, sum, "row %d", i)
+	}
+	assert.Equal(t, WarpedFilters[191], WarpedFilters[192])
+}
+
+func TestResolveDivisor(t *testing.T) {
+	divShift, divFactor := resolveDivisor(1 << WARPEDMODEL_PREC_BITS)
+	assert.Equal(t, WARPEDMODEL_PREC_BITS+DIV_LUT_PREC_BITS, divShift)
+	assert.Equal(t, 1<<DIV_LUT_PREC_BITS, divFactor)
+
+	divShift, divFactor = resolveDivisor(-3)
+	assert.Equal(t, 1+DIV_LUT_PREC_BITS, divShift)
+	assert.Equal(t, -DivLut[128], divFactor)
+	assert.Equal(t, 10923, DivLut[128])
+}
+
+func TestSetupShear(t *testing.T) {
+	identity := []int{0, 0, 1 << WARPEDMODEL_PREC_BITS, 0, 0, 1 << WARPEDMODEL_PREC_BITS}
+	valid, alpha, beta, gamma, delta := setupShear(identity)
+	assert.True(t, valid)
+	assert.Equal(t, [4]int{0, 0, 0, 0}, [4]int{alpha, beta, gamma, delta})
+
+	zoom := []int{0, 0, 2 << WARPEDMODEL_PREC_BITS, 0, 0, 1 << WARPEDMODEL_PREC_BITS}
+	valid, _, _, _, _ = setupShear(zoom)
+	assert.False(t, valid)
+}
+
+func TestFindWarpSamplesAndEstimation(t *testing.T) {
+	setupMvPredTest(t)
+	saveGlobals(t, &AvailU, &AvailL, &Mv, &NumSamples, &NumSamplesScanned, &CandList,
+		&LocalValid, &LocalWarpParams)
+
+	setInterBlock(0, 2, BLOCK_8X8, LAST_FRAME, [2]int{8, -16})
+	setInterBlock(2, 0, BLOCK_8X8, LAST_FRAME, [2]int{8, -16})
+
+	MiRow = 2
+	MiCol = 2
+	MiSize = BLOCK_8X8
+	RefFrame = [2]int{LAST_FRAME, NONE}
+	AvailU = true
+	AvailL = true
+	Mv[0] = [2]int{8, -16}
+
+	findWarpSamples()
+
+	assert.Equal(t, 2, NumSamples)
+	assert.Equal(t, 2, NumSamplesScanned)
+	assert.Equal(t, [4]int{24, 88, 32, 72}, CandList[0])
+	assert.Equal(t, [4]int{88, 24, 96, 8}, CandList[1])
+
+	warpEstimation()
+
+	// The neighbours move exactly like the block, so the model is a
+	// translation up to the precision of the divisor lookup table.
+	assert.True(t, LocalValid)
+	assert.Equal(t, 65551, LocalWarpParams[2])
+	assert.Equal(t, 0, LocalWarpParams[3])
+	assert.Equal(t, 0, LocalWarpParams[4])
+	assert.Equal(t, 65551, LocalWarpParams[5])
+
+	valid, _, _, _, _ := setupShear(LocalWarpParams[:])
+	assert.True(t, valid)
+}
+
+func TestPredictInterGlobalWarp(t *testing.T) {
+	setupInterTest(t)
+	saveGlobals(t, &GmType)
+
+	uh.globalMotionParams.gmParams = make([][]int, ALTREF_FRAME+1)
+	uh.globalMotionParams.gmParams[LAST_FRAME] = []int{
+		2 << WARPEDMODEL_PREC_BITS, 3 << WARPEDMODEL_PREC_BITS,
+		1 << WARPEDMODEL_PREC_BITS, 0,
+		0, 1 << WARPEDMODEL_PREC_BITS,
+	}
+	GmType[LAST_FRAME] = AFFINE
+
+	YMode = GLOBALMV
+	RefFrames[0][0] = [2]int{LAST_FRAME, NONE}
+
+	predictInter(0, 8, 8, 8, 8, 0, 0)
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			assert.Equal(t, (x+8+2)+2*(y+8+3), CurrFrame.Planes[0].At(x+8, y+8))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package boulder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Y4MWriter writes shown frames as a YUV4MPEG2 stream. The stream header
+// is derived from the sequence header when the first frame is written, so
+// WriteFrame is meant to be called from Options.OnFrame.
+type Y4MWriter struct {
+	w *bufio.Writer
+
+	// CropToRender crops every frame to its RenderWidth x RenderHeight
+	// instead of writing the full decoded frame.
+	CropToRender bool
+
+	headerWritten bool
+	width         int
+	height        int
+}
+
+func NewY4MWriter(w io.Writer) *Y4MWriter {
+	return &Y4MWriter{w: bufio.NewWriter(w)}
+}
+
+// WriteFrame writes f as the next frame of the stream.
+func (y *Y4MWriter) WriteFrame(f *Frame) error {
+	width, height := f.Width, f.Height
+	if y.CropToRender {
+		width = min(width, f.RenderWidth)
+		height = min(height, f.RenderHeight)
+	}
+
+	if !y.headerWritten {
+		if err := y.writeHeader(f, width, height); err != nil {
+			return err
+		}
+	} else if width != y.width || height != y.height {
+		return fmt.Errorf("y4m: frame size changed from %dx%d to %dx%d", y.width, y.height, width, height)
+	}
+
+	if _, err := y.w.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+
+	for plane := 0; plane < f.NumPlanes; plane++ {
+		w, h := width, height
+		if plane > 0 {
+			w = (width + f.SubsamplingX) >> f.SubsamplingX
+			h = (height + f.SubsamplingY) >> f.SubsamplingY
+		}
+
+		if err := writePlaneSamples(y.w, &f.Planes[plane], w, h); err != nil {
+			return err
+		}
+	}
+
+	return y.w.Flush()
+}
+
+func (y *Y4MWriter) writeHeader(f *Frame, width int, height int) error {
+	fpsNum, fpsDen := y4mFrameRate(sh.timingInfo)
+
+	colorRange := ""
+	if sh.colorConfig.colorRange == 1 {
+		colorRange = " XCOLORRANGE=FULL"
+	}
+
+	_, err := fmt.Fprintf(y.w, "YUV4MPEG2 W%d H%d F%d:%d Ip %s%s\n",
+		width, height, fpsNum, fpsDen, y4mColorspace(f), colorRange)
+	if err != nil {
+		return err
+	}
+
+	y.headerWritten = true
+	y.width = width
+	y.height = height
+
+	return nil
+}
+
+// y4mFrameRate returns the frame rate signalled by the timing info, or 30
+// fps when the stream does not carry one.
+func y4mFrameRate(ti TimingInfo) (int, int) {
+	if ti.timeScale == 0 || ti.numUnitsInDisplayTick == 0 {
+		return 30, 1
+	}
+
+	den := ti.numUnitsInDisplayTick
+	if ti.equalPictureInterval {
+		den *= ti.numTicksPerPictureMinusOne + 1
+	}
+
+	return ti.timeScale, den
+}
+
+// y4mColorspace returns the C tag for f, using the same names as libaom's
+// y4m output.
+func y4mColorspace(f *Frame) string {
+	if f.NumPlanes == 1 {
+		if f.BitDepth == 8 {
+			return "Cmono"
+		}
+		return fmt.Sprintf("Cmono%d", f.BitDepth)
+	}
+
+	var sampling string
+	switch {
+	case f.SubsamplingX == 1 && f.SubsamplingY == 1:
+		sampling = "420"
+	case f.SubsamplingX == 1:
+		sampling = "422"
+	default:
+		sampling = "444"
+	}
+
+	if f.BitDepth == 8 {
+		if sampling == "420" {
+			return "C420jpeg"
+		}
+		return "C" + sampling
+	}
+
+	return fmt.Sprintf("C%sp%d XYSCSS=%sP%d", sampling, f.BitDepth, sampling, f.BitDepth)
+}
+
+// writePlaneSamples writes the top left w x h samples of p row by row, one
+// byte per sample for 8-bit planes and two little endian bytes otherwise.
+func writePlaneSamples(w io.Writer, p *Plane, width int, height int) error {
+	var buf []byte
+	if p.Pix16 != nil {
+		buf = make([]byte, 2*width)
+	}
+
+	for y := 0; y < height; y++ {
+		if p.Pix16 == nil {
+			if _, err := w.Write(p.Row8(y)[:width]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for x, v := range p.Row16(y)[:width] {
+			buf[2*x] = byte(v)
+			buf[2*x+1] = byte(v >> 8)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package boulder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestY4MWriter(t *testing.T) {
+	sh = SequenceHeader{
+		colorConfig: ColorConfig{bitDepth: 8, subsamplingX: 1, subsamplingY: 1},
+		timingInfo:  TimingInfo{numUnitsInDisplayTick: 1001, timeScale: 60000, equalPictureInterval: true, numTicksPerPictureMinusOne: 1},
+	}
+	f := NewFrame(4, 2, sh.colorConfig)
+	for x := 0; x < 4; x++ {
+		f.Planes[0].Set(x, 0, x)
+		f.Planes[0].Set(x, 1, 10+x)
+	}
+	f.Planes[1].Set(0, 0, 100)
+	f.Planes[1].Set(1, 0, 101)
+	f.Planes[2].Set(0, 0, 200)
+	f.Planes[2].Set(1, 0, 201)
+
+	var out bytes.Buffer
+	y := NewY4MWriter(&out)
+	assert.NoError(t, y.WriteFrame(f))
+	assert.NoError(t, y.WriteFrame(f))
+
+	frame := "FRAME\n" + string([]byte{0, 1, 2, 3, 10, 11, 12, 13, 100, 101, 200, 201})
+	assert.Equal(t, "YUV4MPEG2 W4 H2 F60000:2002 Ip C420jpeg\n"+frame+frame, out.String())
+}
+
+func TestY4MWriterCropHighBitDepth(t *testing.T) {
+	sh = SequenceHeader{colorConfig: ColorConfig{bitDepth: 10, monoChrome: true, colorRange: 1}}
+	f := NewFrame(4, 2, sh.colorConfig)
+	f.RenderWidth, f.RenderHeight = 2, 1
+	f.Planes[0].Set(0, 0, 0x3ff)
+	f.Planes[0].Set(1, 0, 0x102)
+
+	var out bytes.Buffer
+	y := NewY4MWriter(&out)
+	y.CropToRender = true
+	assert.NoError(t, y.WriteFrame(f))
+
+	assert.Equal(t, "YUV4MPEG2 W2 H1 F30:1 Ip Cmono10 XCOLORRANGE=FULL\nFRAME\n\xff\x03\x02\x01", out.String())
+
+	f.RenderWidth = 4
+	assert.Error(t, y.WriteFrame(f))
+}
+
+func TestY4MColorspace(t *testing.T) {
+	assert.Equal(t, "C444", y4mColorspace(NewFrame(2, 2, ColorConfig{bitDepth: 8})))
+	assert.Equal(t, "C422", y4mColorspace(NewFrame(2, 2, ColorConfig{bitDepth: 8, subsamplingX: 1})))
+	assert.Equal(t, "C420p10 XYSCSS=420P10", y4mColorspace(NewFrame(2, 2, ColorConfig{bitDepth: 10, subsamplingX: 1, subsamplingY: 1})))
+	assert.Equal(t, "Cmono", y4mColorspace(NewFrame(2, 2, ColorConfig{bitDepth: 8, monoChrome: true})))
+}